@@ -0,0 +1,76 @@
+// Package admin protects the HTTP admin APIs of the sigma controller.
+// Requests must carry the configured token as bearer token and
+// listeners are bound to loopback unless a host is configured explicitly
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrNoToken is returned if the admin token is empty
+var ErrNoToken = errors.New("admin token not configured")
+
+// Protect returns a handler that only passes requests carrying token as
+// bearer token in the Authorization header to h
+func Protect(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(token, r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sigma"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func authorized(token string, r *http.Request) bool {
+	if token == "" {
+		return false
+	}
+
+	hdr := r.Header.Get("Authorization")
+	if !strings.HasPrefix(hdr, "Bearer ") {
+		return false
+	}
+
+	given := strings.TrimPrefix(hdr, "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// LoadToken reads the admin token from path. Surrounding whitespace is
+// ignored
+func LoadToken(path string) (string, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(blob))
+	if token == "" {
+		return "", ErrNoToken
+	}
+
+	return token, nil
+}
+
+// ListenAddr returns the address an admin API should listen on. Addresses
+// without host, e.g. ":50058", are bound to loopback
+func ListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtect(t *testing.T) {
+	assert := assert.New(t)
+
+	h := Protect("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for hdr, code := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer other":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusNoContent,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/snapshot", nil)
+		if hdr != "" {
+			req.Header.Set("Authorization", hdr)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(code, rec.Code, hdr)
+	}
+
+	// an empty token never authorizes
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/snapshot", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	Protect("", h).ServeHTTP(rec, req)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+func TestListenAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, err := ListenAddr(":50058")
+	assert.NoError(err)
+	assert.Equal("localhost:50058", addr)
+
+	addr, err = ListenAddr("0.0.0.0:50058")
+	assert.NoError(err)
+	assert.Equal("0.0.0.0:50058", addr)
+
+	_, err = ListenAddr("50058")
+	assert.Error(err)
+}
@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/rpc"
+)
+
+var (
+	// ErrUnknownInstance is returned if the instance in question is not
+	// running on the agent
+	ErrUnknownInstance = errors.New("unknown instance")
+
+	// ErrNoCapacity is returned if the agent has no free slots left
+	ErrNoCapacity = errors.New("agent capacity exhausted")
+)
+
+// Config configures a sigma host agent
+type Config struct {
+	// ID is the unique ID of the agent. If empty, a random ID is generated
+	ID string
+
+	// Advertise is the address the controller should use to reach the agent
+	Advertise string
+
+	// Controller is the address of the controller's agent registry
+	Controller string
+
+	// Capacity is the capacity to announce to the controller
+	Capacity Capacity
+
+	// TLS holds the certificates used for mutual authentication with the
+	// controller. Mandatory
+	TLS *tls.Config
+}
+
+// Agent runs on each host, registers its capacity at the controller and
+// launches or stops node instances on behalf of the controller using a local
+// launcher
+type Agent struct {
+	cfg      Config
+	launcher launcher.Launcher
+
+	rw        sync.RWMutex
+	instances map[string]launcher.Instance
+}
+
+// New creates a new agent that uses l to launch node instances
+func New(cfg Config, l launcher.Launcher) (*Agent, error) {
+	if l == nil {
+		return nil, errors.New("agent: launcher is mandatory")
+	}
+
+	if cfg.Controller == "" {
+		return nil, errors.New("agent: controller address is mandatory")
+	}
+
+	if cfg.Advertise == "" {
+		return nil, errors.New("agent: advertise address is mandatory")
+	}
+
+	if cfg.TLS == nil {
+		return nil, errors.New("agent: TLS configuration is mandatory")
+	}
+
+	if cfg.ID == "" {
+		cfg.ID = uuid.NewV4().String()
+	}
+
+	return &Agent{
+		cfg:       cfg,
+		launcher:  l,
+		instances: make(map[string]launcher.Instance),
+	}, nil
+}
+
+// ID returns the ID of the agent
+func (a *Agent) ID() string {
+	return a.cfg.ID
+}
+
+// Serve serves the agent gRPC service on lis. Only clients presenting a
+// certificate signed by the configured CA are accepted
+func (a *Agent) Serve(lis net.Listener) error {
+	srv := grpc.NewServer(rpc.ServerOption(), grpc.Creds(rpc.ServerCredentials(a.cfg.TLS)))
+	RegisterAgentServer(srv, a)
+
+	return srv.Serve(lis)
+}
+
+// Run registers the agent at the controller and keeps sending heartbeats
+// until ctx is cancelled
+func (a *Agent) Run(ctx context.Context) error {
+	conn, err := grpc.Dial(a.cfg.Controller, grpc.WithTransportCredentials(rpc.ClientCredentials(a.cfg.TLS)), rpc.DialOption())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cli := &registryClient{conn}
+	interval := DefaultHeartbeatInterval
+
+	for {
+		res, err := cli.Register(ctx, a.registration())
+		if err != nil {
+			log.Printf("[agent] failed to register at controller %s: %s\n", a.cfg.Controller, err)
+		} else if res.HeartbeatInterval > 0 {
+			interval = res.HeartbeatInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			a.stopAll()
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Launch launches a new node instance and implements AgentServer
+func (a *Agent) Launch(ctx context.Context, in *LaunchRequest) (*LaunchResponse, error) {
+	if _, err := rpc.AuthenticatedPeer(ctx); err != nil {
+		return nil, err
+	}
+
+	if !a.cfg.Capacity.Supports(in.Type) {
+		return nil, errors.New("unsupported node type")
+	}
+
+	a.rw.Lock()
+	defer a.rw.Unlock()
+
+	if a.cfg.Capacity.Slots > 0 && len(a.instances) >= a.cfg.Capacity.Slots {
+		return nil, ErrNoCapacity
+	}
+
+	instance, err := a.launcher.Create(ctx, in.Type, in.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.NewV4().String()
+	a.instances[id] = instance
+
+	log.Printf("[agent] launched %s instance %s for %s\n", in.Type, id, in.Config.URN)
+
+	return &LaunchResponse{
+		InstanceID: id,
+	}, nil
+}
+
+// Stop stops a node instance and implements AgentServer
+func (a *Agent) Stop(ctx context.Context, in *InstanceRequest) (*Empty, error) {
+	if _, err := rpc.AuthenticatedPeer(ctx); err != nil {
+		return nil, err
+	}
+
+	a.rw.Lock()
+	instance, ok := a.instances[in.InstanceID]
+	delete(a.instances, in.InstanceID)
+	a.rw.Unlock()
+
+	if !ok {
+		return nil, ErrUnknownInstance
+	}
+
+	log.Printf("[agent] stopping instance %s\n", in.InstanceID)
+
+	if err := instance.Stop(); err != nil {
+		return nil, err
+	}
+
+	return &Empty{}, nil
+}
+
+// Healthy checks the health of a node instance and implements AgentServer
+func (a *Agent) Healthy(ctx context.Context, in *InstanceRequest) (*HealthResponse, error) {
+	if _, err := rpc.AuthenticatedPeer(ctx); err != nil {
+		return nil, err
+	}
+
+	a.rw.RLock()
+	instance, ok := a.instances[in.InstanceID]
+	a.rw.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownInstance
+	}
+
+	res := &HealthResponse{}
+	if err := instance.Healthy(); err != nil {
+		res.Error = err.Error()
+	}
+
+	return res, nil
+}
+
+// registration returns the registration sent to the controller. It
+// includes the health of all instances so the controller does not need to
+// query it
+func (a *Agent) registration() *Registration {
+	a.rw.RLock()
+	instances := make(map[string]launcher.Instance, len(a.instances))
+	for id, instance := range a.instances {
+		instances[id] = instance
+	}
+	a.rw.RUnlock()
+
+	health := make(map[string]string, len(instances))
+	for id, instance := range instances {
+		health[id] = ""
+		if err := instance.Healthy(); err != nil {
+			health[id] = err.Error()
+		}
+	}
+
+	return &Registration{
+		ID:        a.cfg.ID,
+		Address:   a.cfg.Advertise,
+		Capacity:  a.cfg.Capacity,
+		Running:   len(instances),
+		Instances: health,
+	}
+}
+
+func (a *Agent) stopAll() {
+	a.rw.Lock()
+	defer a.rw.Unlock()
+
+	for id, instance := range a.instances {
+		if err := instance.Stop(); err != nil {
+			log.Printf("[agent] failed to stop instance %s: %s\n", id, err)
+		}
+		delete(a.instances, id)
+	}
+}
+
+// compile time check
+var _ AgentServer = &Agent{}
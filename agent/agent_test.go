@@ -0,0 +1,268 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sigma-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+// config returns a TLS configuration with a certificate for name that is
+// valid for localhost
+func (ca *testCA) config(t *testing.T, name string) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+	}
+}
+
+type testInstance struct {
+	rw      sync.RWMutex
+	err     error
+	stopped bool
+}
+
+func (i *testInstance) Healthy() error {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+	return i.err
+}
+
+func (i *testInstance) Stop() error {
+	i.rw.Lock()
+	defer i.rw.Unlock()
+	i.stopped = true
+	return nil
+}
+
+func (i *testInstance) setError(err error) {
+	i.rw.Lock()
+	defer i.rw.Unlock()
+	i.err = err
+}
+
+func listen(t *testing.T) net.Listener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lis
+}
+
+// waitFor waits until fn returns true
+func waitFor(t *testing.T, fn func() bool) {
+	for i := 0; i < 500; i++ {
+		if fn() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	l := launcher.CreateFunc(func(context.Context, string, launcher.Config) (launcher.Instance, error) {
+		return &testInstance{}, nil
+	})
+
+	_, err := New(Config{Controller: "controller", Advertise: "agent"}, l)
+	assert.Error(err)
+
+	_, err = NewRegistry(nil)
+	assert.Error(err)
+}
+
+func TestAgent(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(t)
+
+	registry, err := NewRegistry(ca.config(t, "controller"))
+	if !assert.NoError(err) {
+		return
+	}
+	registry.interval = 20 * time.Millisecond
+
+	registryListener := listen(t)
+	go registry.Serve(registryListener)
+	defer registryListener.Close()
+
+	instance := &testInstance{}
+	l := launcher.CreateFunc(func(context.Context, string, launcher.Config) (launcher.Instance, error) {
+		return instance, nil
+	})
+
+	agentListener := listen(t)
+	defer agentListener.Close()
+
+	a, err := New(Config{
+		ID:         "agent-1",
+		Controller: registryListener.Addr().String(),
+		Advertise:  agentListener.Addr().String(),
+		Capacity:   Capacity{Slots: 1, Types: []string{"js"}},
+		TLS:        ca.config(t, "agent-1"),
+	}, l)
+	if !assert.NoError(err) {
+		return
+	}
+	go a.Serve(agentListener)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	waitFor(t, func() bool { return len(registry.Agents()) == 1 })
+
+	_, err = registry.Create(context.Background(), "go", launcher.Config{URN: "urn:sigma:default:fn:1:node"})
+	assert.Equal(ErrNoAgent, err)
+
+	i, err := registry.Create(context.Background(), "js", launcher.Config{URN: "urn:sigma:default:fn:1:node"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// the health of instances is reported with each heartbeat
+	waitFor(t, func() bool {
+		registry.rw.RLock()
+		defer registry.rw.RUnlock()
+		_, ok := registry.agents["agent-1"].Instances[i.(*remoteInstance).id]
+		return ok
+	})
+	assert.NoError(i.Healthy())
+
+	instance.setError(errors.New("crashed"))
+	waitFor(t, func() bool { return i.Healthy() != nil })
+	assert.Equal("crashed", i.Healthy().Error())
+
+	assert.NoError(i.Stop())
+	assert.True(instance.stopped)
+
+	// instances no longer reported by the agent are unknown
+	waitFor(t, func() bool { return i.Healthy() == ErrUnknownInstance })
+
+	// once the agent is gone, its instances are unhealthy
+	cancel()
+	waitFor(t, func() bool { return i.Healthy() == ErrNoAgent })
+}
+
+func TestAgent_Unauthenticated(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(t)
+
+	registry, err := NewRegistry(ca.config(t, "controller"))
+	if !assert.NoError(err) {
+		return
+	}
+
+	lis := listen(t)
+	go registry.Serve(lis)
+	defer lis.Close()
+
+	register := func(opt grpc.DialOption) error {
+		conn, err := grpc.Dial(lis.Addr().String(), opt, rpc.DialOption())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		_, err = (&registryClient{conn}).Register(ctx, &Registration{ID: "agent-1", Address: "127.0.0.1:1"})
+		return err
+	}
+
+	// agents need a certificate signed by the CA
+	assert.Error(register(grpc.WithInsecure()))
+	assert.Error(register(grpc.WithTransportCredentials(rpc.ClientCredentials(newTestCA(t).config(t, "agent-1")))))
+
+	assert.NoError(register(grpc.WithTransportCredentials(rpc.ClientCredentials(ca.config(t, "agent-1")))))
+
+	// registered agents cannot be taken over using other certificates
+	assert.Error(register(grpc.WithTransportCredentials(rpc.ClientCredentials(ca.config(t, "agent-2")))))
+	assert.NoError(register(grpc.WithTransportCredentials(rpc.ClientCredentials(ca.config(t, "agent-1")))))
+
+	// calls without a verified client certificate are rejected
+	_, err = registry.Register(context.Background(), &Registration{ID: "agent-1", Address: "127.0.0.1:1"})
+	assert.Error(err)
+
+	a := &Agent{instances: make(map[string]launcher.Instance)}
+	_, err = a.Launch(context.Background(), &LaunchRequest{Type: "js"})
+	assert.Error(err)
+}
@@ -0,0 +1,259 @@
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/rpc"
+	"github.com/homebot/sigma/urn"
+)
+
+// DefaultHeartbeatInterval is the interval at which agents re-register
+// themselves at the controller
+const DefaultHeartbeatInterval = 10 * time.Second
+
+// ErrNoAgent is returned if no registered agent is able to launch the
+// requested node type
+var ErrNoAgent = errors.New("no agent available")
+
+type agentEntry struct {
+	Registration
+
+	// identity is the common name of the agent's certificate
+	identity string
+
+	lastSeen time.Time
+	conn     *grpc.ClientConn
+	client   AgentServer
+}
+
+// Registry is served by the controller and keeps track of all host agents.
+// It implements launcher.Launcher and forwards instance creation to the
+// agent with the most free capacity. Agents and the registry authenticate
+// each other using mutual TLS
+type Registry struct {
+	interval time.Duration
+	tls      *tls.Config
+
+	rw     sync.RWMutex
+	agents map[string]*agentEntry
+}
+
+// NewRegistry returns a new agent registry using cfg to authenticate agents
+func NewRegistry(cfg *tls.Config) (*Registry, error) {
+	if cfg == nil {
+		return nil, errors.New("agent: TLS configuration is mandatory")
+	}
+
+	return &Registry{
+		interval: DefaultHeartbeatInterval,
+		tls:      cfg,
+		agents:   make(map[string]*agentEntry),
+	}, nil
+}
+
+// Serve serves the registry gRPC service on lis. Only agents presenting a
+// certificate signed by the configured CA are accepted
+func (r *Registry) Serve(lis net.Listener) error {
+	srv := grpc.NewServer(rpc.ServerOption(), grpc.Creds(rpc.ServerCredentials(r.tls)))
+	RegisterRegistryServer(srv, r)
+
+	return srv.Serve(lis)
+}
+
+// Register registers or refreshes an agent and implements RegistryServer.
+// While alive, an agent can only be refreshed using the certificate it
+// registered with
+func (r *Registry) Register(ctx context.Context, in *Registration) (*RegistrationResponse, error) {
+	identity, err := rpc.AuthenticatedPeer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.ID == "" || in.Address == "" {
+		return nil, errors.New("invalid agent registration")
+	}
+
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	e, ok := r.agents[in.ID]
+	if ok && e.identity != identity && r.alive(e) {
+		return nil, status.Error(codes.PermissionDenied, "agent registered with a different certificate")
+	}
+
+	if ok && (e.Address != in.Address || e.identity != identity) {
+		e.conn.Close()
+		ok = false
+	}
+
+	if !ok {
+		conn, err := grpc.Dial(in.Address, grpc.WithTransportCredentials(rpc.ClientCredentials(r.tls)), rpc.DialOption())
+		if err != nil {
+			return nil, err
+		}
+
+		e = &agentEntry{
+			identity: identity,
+			conn:     conn,
+			client:   &agentClient{conn},
+		}
+		r.agents[in.ID] = e
+
+		log.Printf("[agent] agent %s registered from %s (types: %v)\n", in.ID, in.Address, in.Capacity.Types)
+	}
+
+	e.Registration = *in
+	e.lastSeen = time.Now()
+
+	return &RegistrationResponse{
+		HeartbeatInterval: r.interval,
+	}, nil
+}
+
+// Agents returns the registrations of all agents that are currently alive
+func (r *Registry) Agents() []Registration {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	var res []Registration
+	for _, e := range r.agents {
+		if r.alive(e) {
+			res = append(res, e.Registration)
+		}
+	}
+
+	return res
+}
+
+// Create launches a new node instance on one of the registered agents and
+// implements launcher.Launcher
+func (r *Registry) Create(ctx context.Context, typ string, cfg launcher.Config) (launcher.Instance, error) {
+	if _, err := urn.ParseInstance(cfg.URN); err != nil {
+		return nil, err
+	}
+
+	e, err := r.selectAgent(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.client.Launch(ctx, &LaunchRequest{
+		Type:   typ,
+		Config: cfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteInstance{
+		registry: r,
+		agent:    e.ID,
+		id:       res.InstanceID,
+		cli:      e.client,
+		created:  time.Now(),
+	}, nil
+}
+
+// selectAgent selects the alive agent supporting typ that has the most
+// free slots. The selected agent's running counter is incremented so
+// concurrent launches spread until the next heartbeat corrects it
+func (r *Registry) selectAgent(typ string) (*agentEntry, error) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	var (
+		selected *agentEntry
+		free     int
+	)
+
+	for _, e := range r.agents {
+		if !r.alive(e) || !e.Capacity.Supports(typ) {
+			continue
+		}
+
+		f := e.Capacity.Slots - e.Running
+		if e.Capacity.Slots == 0 {
+			f = int(^uint(0) >> 1)
+		}
+
+		if f > 0 && (selected == nil || f > free) {
+			selected = e
+			free = f
+		}
+	}
+
+	if selected == nil {
+		return nil, ErrNoAgent
+	}
+
+	selected.Running++
+
+	return selected, nil
+}
+
+func (r *Registry) alive(e *agentEntry) bool {
+	return time.Now().Sub(e.lastSeen) < 3*r.interval
+}
+
+// health returns the health of an instance as reported by the last
+// heartbeat of its agent. Instances created less than one heartbeat
+// interval before the last heartbeat may not be reported yet
+func (r *Registry) health(agent, id string, created time.Time) error {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	e, ok := r.agents[agent]
+	if !ok || !r.alive(e) {
+		return ErrNoAgent
+	}
+
+	msg, ok := e.Instances[id]
+	switch {
+	case ok && msg != "":
+		return errors.New(msg)
+	case !ok && e.lastSeen.Sub(created) > r.interval:
+		return ErrUnknownInstance
+	}
+
+	return nil
+}
+
+// remoteInstance is a node instance running on an agent and implements
+// launcher.Instance
+type remoteInstance struct {
+	registry *Registry
+	agent    string
+	id       string
+	cli      AgentServer
+	created  time.Time
+}
+
+// Healthy returns nil if the agent reported the instance as healthy in
+// its last heartbeat. It does not call the agent
+func (i *remoteInstance) Healthy() error {
+	return i.registry.health(i.agent, i.id, i.created)
+}
+
+// Stop instructs the agent to stop the instance
+func (i *remoteInstance) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := i.cli.Stop(ctx, &InstanceRequest{InstanceID: i.id})
+	return err
+}
+
+// compile time checks
+var _ RegistryServer = &Registry{}
+var _ launcher.Launcher = &Registry{}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// RegistryServer is served by the controller and accepts agent registrations
+type RegistryServer interface {
+	// Register registers or refreshes an agent
+	Register(context.Context, *Registration) (*RegistrationResponse, error)
+}
+
+// AgentServer is served by each agent and receives launch and stop commands
+// from the controller
+type AgentServer interface {
+	// Launch launches a new node instance
+	Launch(context.Context, *LaunchRequest) (*LaunchResponse, error)
+
+	// Stop stops a node instance
+	Stop(context.Context, *InstanceRequest) (*Empty, error)
+
+	// Healthy checks the health of a node instance
+	Healthy(context.Context, *InstanceRequest) (*HealthResponse, error)
+}
+
+// RegisterRegistryServer registers srv at the gRPC server s. The server
+// must be configured to use rpc.ServerOption()
+func RegisterRegistryServer(s *grpc.Server, srv RegistryServer) {
+	s.RegisterService(&registryServiceDesc, srv)
+}
+
+// RegisterAgentServer registers srv at the gRPC server s. The server
+// must be configured to use rpc.ServerOption()
+func RegisterAgentServer(s *grpc.Server, srv AgentServer) {
+	s.RegisterService(&agentServiceDesc, srv)
+}
+
+var registryServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sigma.agent.Registry",
+	HandlerType: (*RegistryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(Registration)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(RegistryServer).Register(ctx, in)
+			},
+		},
+	},
+}
+
+var agentServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sigma.agent.Agent",
+	HandlerType: (*AgentServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Launch",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(LaunchRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AgentServer).Launch(ctx, in)
+			},
+		},
+		{
+			MethodName: "Stop",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(InstanceRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AgentServer).Stop(ctx, in)
+			},
+		},
+		{
+			MethodName: "Healthy",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(InstanceRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(AgentServer).Healthy(ctx, in)
+			},
+		},
+	},
+}
+
+type registryClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *registryClient) Register(ctx context.Context, in *Registration) (*RegistrationResponse, error) {
+	out := new(RegistrationResponse)
+	if err := grpc.Invoke(ctx, "/sigma.agent.Registry/Register", in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type agentClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *agentClient) Launch(ctx context.Context, in *LaunchRequest) (*LaunchResponse, error) {
+	out := new(LaunchResponse)
+	if err := grpc.Invoke(ctx, "/sigma.agent.Agent/Launch", in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) Stop(ctx context.Context, in *InstanceRequest) (*Empty, error) {
+	out := new(Empty)
+	if err := grpc.Invoke(ctx, "/sigma.agent.Agent/Stop", in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) Healthy(ctx context.Context, in *InstanceRequest) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	if err := grpc.Invoke(ctx, "/sigma.agent.Agent/Healthy", in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/homebot/sigma/launcher"
+)
+
+// Capacity describes the resources an agent offers to the controller
+type Capacity struct {
+	// Slots is the maximum number of node instances the agent is willing
+	// to run. Zero means unlimited
+	Slots int `json:"slots"`
+
+	// Types holds the node types the agent is able to launch
+	Types []string `json:"types"`
+}
+
+// Supports returns true if the capacity includes the given node type
+func (c Capacity) Supports(typ string) bool {
+	for _, t := range c.Types {
+		if t == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Registration is sent by agents to register (and periodically re-register)
+// at the controller
+type Registration struct {
+	// ID is the unique ID of the agent
+	ID string `json:"id"`
+
+	// Address is the address the agent service is reachable at
+	Address string `json:"address"`
+
+	// Capacity holds the capacity of the agent
+	Capacity Capacity `json:"capacity"`
+
+	// Running is the number of node instances currently running on
+	// the agent
+	Running int `json:"running"`
+
+	// Instances holds the health of all instances running on the agent
+	// keyed by instance ID. Values hold the error of unhealthy instances
+	// and are empty otherwise
+	Instances map[string]string `json:"instances,omitempty"`
+}
+
+// RegistrationResponse is returned by the controller
+type RegistrationResponse struct {
+	// HeartbeatInterval is the interval at which the agent should
+	// re-register itself
+	HeartbeatInterval time.Duration `json:"heartbeatInterval"`
+}
+
+// LaunchRequest instructs an agent to launch a new node instance
+type LaunchRequest struct {
+	// Type is the node type to launch
+	Type string `json:"type"`
+
+	// Config is the launcher configuration for the new instance
+	Config launcher.Config `json:"config"`
+}
+
+// LaunchResponse is returned by an agent after a node instance
+// has been launched
+type LaunchResponse struct {
+	// InstanceID is the agent-local ID of the new instance
+	InstanceID string `json:"instanceId"`
+}
+
+// InstanceRequest references a node instance running on an agent
+type InstanceRequest struct {
+	// InstanceID is the agent-local ID of the instance
+	InstanceID string `json:"instanceId"`
+}
+
+// HealthResponse holds the health state of an instance
+type HealthResponse struct {
+	// Error is set if the instance is unhealthy
+	Error string `json:"error,omitempty"`
+}
+
+// Empty is an empty message
+type Empty struct{}
@@ -0,0 +1,401 @@
+// Package alert evaluates health rules for functions and notifies
+// operators about failing functions
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/insight/logger"
+	"github.com/homebot/sigma/metrics"
+)
+
+// Kind is the kind of condition evaluated by a rule
+type Kind string
+
+// Supported rule kinds
+const (
+	// KindErrorRate fires if the ratio of failed invocations within the
+	// rule's window exceeds the threshold (0 - 1)
+	KindErrorRate Kind = "error-rate"
+
+	// KindNoNodes fires if a function does not have any node ready to
+	// accept events
+	KindNoNodes Kind = "no-nodes"
+
+	// KindQueueDepth fires if more events than the threshold are waiting
+	// to be dispatched to a function
+	KindQueueDepth Kind = "queue-depth"
+)
+
+// DefaultInterval is the default interval rules are evaluated at
+const DefaultInterval = 30 * time.Second
+
+// Rule is an alerting rule
+type Rule struct {
+	// Name is the name of the rule
+	Name string
+
+	// Kind is the condition evaluated by the rule
+	Kind Kind
+
+	// Function restricts the rule to functions matching the pattern (see
+	// path.Match). Empty matches all functions
+	Function string
+
+	// Threshold is the value the condition is compared against
+	Threshold float64
+
+	// Window is the time frame the error rate is calculated for
+	Window time.Duration
+}
+
+// Valid checks if the rule is valid
+func (r Rule) Valid() error {
+	if r.Name == "" {
+		return errors.New("rule without name")
+	}
+
+	switch r.Kind {
+	case KindErrorRate:
+		if r.Window <= 0 {
+			return fmt.Errorf("rule %s: window required", r.Name)
+		}
+	case KindNoNodes, KindQueueDepth:
+	default:
+		return fmt.Errorf("rule %s: unknown kind %q", r.Name, r.Kind)
+	}
+
+	if _, err := path.Match(r.Function, ""); err != nil {
+		return fmt.Errorf("rule %s: invalid function pattern: %s", r.Name, err)
+	}
+
+	return nil
+}
+
+// Alert is sent to notifiers once a rule starts and stops firing
+type Alert struct {
+	// Rule is the name of the rule
+	Rule string `json:"rule"`
+
+	// Kind is the kind of the rule
+	Kind Kind `json:"kind"`
+
+	// Function is the function the rule fired for
+	Function string `json:"function"`
+
+	// Firing is true if the rule started firing and false if the alert
+	// has been resolved
+	Firing bool `json:"firing"`
+
+	// Value is the value that has been compared to the threshold
+	Value float64 `json:"value"`
+
+	// Threshold is the threshold of the rule
+	Threshold float64 `json:"threshold"`
+
+	// Time is the time the alert has been raised or resolved
+	Time time.Time `json:"time"`
+}
+
+// String returns a human readable description of the alert
+func (a Alert) String() string {
+	state := "RESOLVED"
+	if a.Firing {
+		state = "FIRING"
+	}
+
+	return fmt.Sprintf("[%s] %s: function %s: %s is %g (threshold %g)", state, a.Rule, a.Function, a.Kind, a.Value, a.Threshold)
+}
+
+// Notifier delivers alerts to operators
+type Notifier interface {
+	Notify(Alert) error
+}
+
+// Function describes the health of a function
+type Function struct {
+	// Name is the name of the function
+	Name string
+
+	// ReadyNodes is the number of nodes ready to accept events
+	ReadyNodes int
+
+	// QueueDepth is the number of events waiting to be dispatched
+	QueueDepth int
+}
+
+// Source provides the functions rules are evaluated for
+type Source interface {
+	Functions(context.Context) ([]Function, error)
+}
+
+// SourceFunc implements Source
+type SourceFunc func(context.Context) ([]Function, error)
+
+// Functions calls fn and implements Source
+func (fn SourceFunc) Functions(ctx context.Context) ([]Function, error) {
+	return fn(ctx)
+}
+
+// sample holds the invocation counters of a function at a given time
+type sample struct {
+	at          time.Time
+	invocations int64
+	failures    int64
+}
+
+// Manager periodically evaluates alerting rules
+type Manager struct {
+	source    Source
+	rules     []Rule
+	notifiers []Notifier
+	counters  *metrics.Counters
+	interval  time.Duration
+	log       logger.Logger
+
+	// maxWindow is the largest window of all rules and limits the
+	// history kept for each function
+	maxWindow time.Duration
+
+	mu      sync.Mutex
+	samples map[string][]sample
+	firing  map[string]Alert
+}
+
+// Option configures a Manager
+type Option func(m *Manager) error
+
+// WithNotifiers adds notifiers to the manager
+func WithNotifiers(n ...Notifier) Option {
+	return func(m *Manager) error {
+		m.notifiers = append(m.notifiers, n...)
+		return nil
+	}
+}
+
+// WithInterval configures the interval rules are evaluated at
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) error {
+		if d <= 0 {
+			return errors.New("invalid interval")
+		}
+		m.interval = d
+		return nil
+	}
+}
+
+// WithCounters configures the counters holding the invocation statistics
+// of functions. Defaults to metrics.DefaultCounters
+func WithCounters(c *metrics.Counters) Option {
+	return func(m *Manager) error {
+		m.counters = c
+		return nil
+	}
+}
+
+// WithLogger configures the logger to use
+func WithLogger(l logger.Logger) Option {
+	return func(m *Manager) error {
+		m.log = l
+		return nil
+	}
+}
+
+// New creates a new alert manager evaluating rules for all functions of
+// source
+func New(source Source, rules []Rule, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		source:   source,
+		rules:    rules,
+		counters: metrics.DefaultCounters,
+		interval: DefaultInterval,
+		samples:  make(map[string][]sample),
+		firing:   make(map[string]Alert),
+	}
+
+	for _, r := range rules {
+		if err := r.Valid(); err != nil {
+			return nil, err
+		}
+
+		if r.Window > m.maxWindow {
+			m.maxWindow = r.Window
+		}
+	}
+
+	for _, fn := range opts {
+		if err := fn(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.log == nil {
+		m.log = logger.NopLogger{}
+	}
+
+	return m, nil
+}
+
+// Run evaluates all rules until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Evaluate(ctx); err != nil {
+			m.log.Errorf("failed to evaluate alerting rules: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate evaluates all rules once and notifies about alerts that
+// started or stopped firing
+func (m *Manager) Evaluate(ctx context.Context) error {
+	fns, err := m.source.Functions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range m.evaluate(fns, time.Now()) {
+		for _, n := range m.notifiers {
+			if err := n.Notify(a); err != nil {
+				m.log.Errorf("failed to deliver alert %s: %s", a, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// evaluate evaluates all rules for fns and returns the alerts that
+// changed their state
+func (m *Manager) evaluate(fns []Function, now time.Time) []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changed []Alert
+	seen := make(map[string]bool)
+	present := make(map[string]bool, len(fns))
+
+	for _, fn := range fns {
+		present[fn.Name] = true
+		m.record(fn.Name, now)
+
+		for _, r := range m.rules {
+			if ok, _ := path.Match(r.Function, fn.Name); r.Function != "" && !ok {
+				continue
+			}
+
+			value, firing := m.check(r, fn, now)
+
+			key := r.Name + "/" + fn.Name
+			seen[key] = true
+
+			if _, ok := m.firing[key]; ok == firing {
+				continue
+			}
+
+			a := Alert{
+				Rule:      r.Name,
+				Kind:      r.Kind,
+				Function:  fn.Name,
+				Firing:    firing,
+				Value:     value,
+				Threshold: r.Threshold,
+				Time:      now,
+			}
+
+			if firing {
+				m.firing[key] = a
+			} else {
+				delete(m.firing, key)
+			}
+
+			changed = append(changed, a)
+		}
+	}
+
+	// resolve alerts of functions that have been removed
+	for key, a := range m.firing {
+		if seen[key] {
+			continue
+		}
+
+		delete(m.firing, key)
+
+		a.Firing = false
+		a.Time = now
+		changed = append(changed, a)
+	}
+
+	for fn := range m.samples {
+		if !present[fn] {
+			delete(m.samples, fn)
+		}
+	}
+
+	return changed
+}
+
+// record appends the current invocation counters of fn to its history
+func (m *Manager) record(fn string, now time.Time) {
+	samples := append(m.samples[fn], sample{
+		at:          now,
+		invocations: m.counters.Get("function.invocations." + fn),
+		failures:    m.counters.Get("function.failures." + fn),
+	})
+
+	// keep the newest sample older than the largest window as baseline
+	i := 0
+	for i+1 < len(samples) && now.Sub(samples[i+1].at) >= m.maxWindow {
+		i++
+	}
+
+	m.samples[fn] = samples[i:]
+}
+
+// check evaluates the rule for fn and returns the value compared to the
+// threshold and whether the rule fires
+func (m *Manager) check(r Rule, fn Function, now time.Time) (float64, bool) {
+	switch r.Kind {
+	case KindErrorRate:
+		samples := m.samples[fn.Name]
+		current := samples[len(samples)-1]
+
+		baseline := samples[0]
+		for _, s := range samples {
+			if now.Sub(s.at) < r.Window {
+				break
+			}
+			baseline = s
+		}
+
+		invocations := current.invocations - baseline.invocations
+		if invocations <= 0 {
+			return 0, false
+		}
+
+		rate := float64(current.failures-baseline.failures) / float64(invocations)
+		return rate, rate > r.Threshold
+
+	case KindNoNodes:
+		return float64(fn.ReadyNodes), fn.ReadyNodes == 0
+
+	case KindQueueDepth:
+		return float64(fn.QueueDepth), float64(fn.QueueDepth) > r.Threshold
+	}
+
+	return 0, false
+}
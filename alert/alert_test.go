@@ -0,0 +1,66 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/homebot/sigma/metrics"
+)
+
+func TestEvaluate(t *testing.T) {
+	counters := metrics.NewCounters()
+
+	m, err := New(nil, []Rule{
+		{Name: "errors", Kind: KindErrorRate, Threshold: 0.5, Window: time.Minute},
+		{Name: "dead", Kind: KindNoNodes, Function: "urn:fn:*"},
+		{Name: "queue", Kind: KindQueueDepth, Threshold: 10},
+	}, WithCounters(counters))
+	assert.NoError(t, err)
+
+	now := time.Now()
+	fns := []Function{{Name: "urn:fn:a", ReadyNodes: 1, QueueDepth: 2}}
+
+	assert.Empty(t, m.evaluate(fns, now))
+
+	// 3 out of 4 invocations failed
+	counters.Add("function.invocations.urn:fn:a", 4)
+	counters.Add("function.failures.urn:fn:a", 3)
+
+	changed := m.evaluate(fns, now.Add(30*time.Second))
+	if assert.Len(t, changed, 1) {
+		assert.Equal(t, "errors", changed[0].Rule)
+		assert.True(t, changed[0].Firing)
+		assert.Equal(t, 0.75, changed[0].Value)
+	}
+
+	// still firing, no new notifications
+	assert.Empty(t, m.evaluate(fns, now.Add(45*time.Second)))
+
+	// the failures are no longer part of the window
+	counters.Add("function.invocations.urn:fn:a", 4)
+	changed = m.evaluate(fns, now.Add(90*time.Second))
+	if assert.Len(t, changed, 1) {
+		assert.Equal(t, "errors", changed[0].Rule)
+		assert.False(t, changed[0].Firing)
+	}
+
+	fns = []Function{{Name: "urn:fn:a", ReadyNodes: 0, QueueDepth: 11}}
+	changed = m.evaluate(fns, now.Add(120*time.Second))
+	assert.Len(t, changed, 2)
+
+	// alerts of removed functions are resolved
+	changed = m.evaluate(nil, now.Add(150*time.Second))
+	if assert.Len(t, changed, 2) {
+		assert.False(t, changed[0].Firing)
+		assert.False(t, changed[1].Firing)
+	}
+}
+
+func TestRuleValid(t *testing.T) {
+	assert.Error(t, Rule{Name: "r", Kind: KindErrorRate}.Valid())
+	assert.Error(t, Rule{Name: "r", Kind: "unknown"}.Valid())
+	assert.Error(t, Rule{Name: "r", Kind: KindNoNodes, Function: "["}.Valid())
+	assert.NoError(t, Rule{Name: "r", Kind: KindNoNodes}.Valid())
+}
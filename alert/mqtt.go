@@ -0,0 +1,143 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// MQTT is a Notifier publishing alerts JSON encoded to an MQTT topic.
+// A new connection is established for every alert and messages are
+// published with QoS 0
+type MQTT struct {
+	// Broker is the address of the MQTT broker, e.g. tcp://localhost:1883
+	Broker string `json:"broker" yaml:"broker"`
+
+	// Topic is the topic alerts are published on
+	Topic string `json:"topic" yaml:"topic"`
+
+	// ClientID is the client identifier. Defaults to "sigma-alerts"
+	ClientID string `json:"clientID,omitempty" yaml:"clientID,omitempty"`
+
+	// Username and Password are used to authenticate, if set
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1 << 4
+	mqttConnack    = 2 << 4
+	mqttPublish    = 3 << 4
+	mqttDisconnect = 14 << 4
+)
+
+// Notify implements Notifier
+func (m *MQTT) Notify(a Alert) error {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", strings.TrimPrefix(m.Broker, "tcp://"), 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if err := m.connect(conn); err != nil {
+		return err
+	}
+
+	var publish bytes.Buffer
+	writeString(&publish, m.Topic)
+	publish.Write(payload)
+
+	if err := writePacket(conn, mqttPublish, publish.Bytes()); err != nil {
+		return err
+	}
+
+	return writePacket(conn, mqttDisconnect, nil)
+}
+
+func (m *MQTT) connect(conn net.Conn) error {
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = "sigma-alerts"
+	}
+
+	// clean session
+	flags := byte(0x02)
+	if m.Username != "" {
+		flags |= 0x80
+		if m.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	var connect bytes.Buffer
+	writeString(&connect, "MQTT")
+	connect.WriteByte(4) // protocol level 3.1.1
+	connect.WriteByte(flags)
+	binary.Write(&connect, binary.BigEndian, uint16(60)) // keep alive
+	writeString(&connect, clientID)
+	if m.Username != "" {
+		writeString(&connect, m.Username)
+		if m.Password != "" {
+			writeString(&connect, m.Password)
+		}
+	}
+
+	if err := writePacket(conn, mqttConnect, connect.Bytes()); err != nil {
+		return err
+	}
+
+	var connack [4]byte
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		return err
+	}
+
+	if connack[0] != mqttConnack {
+		return errors.New("mqtt: unexpected response to CONNECT")
+	}
+
+	if connack[3] != 0 {
+		return fmt.Errorf("mqtt: connection refused: return code %d", connack[3])
+	}
+
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func writePacket(w io.Writer, typ byte, body []byte) error {
+	packet := []byte{typ}
+
+	// the remaining length is encoded using 7 bits per byte
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(packet, body...))
+	return err
+}
@@ -0,0 +1,82 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Webhook is a Notifier posting alerts JSON encoded to an HTTP endpoint
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook returns a new webhook notifier posting to url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(a Alert) error {
+	blob, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook: unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Email is a Notifier sending alerts via SMTP
+type Email struct {
+	// Server is the address of the SMTP server, e.g. mail.example.com:587
+	Server string `json:"server" yaml:"server"`
+
+	// From is the sender address
+	From string `json:"from" yaml:"from"`
+
+	// To holds the addresses of all recipients
+	To []string `json:"to" yaml:"to"`
+
+	// Username and Password are used for PLAIN authentication, if set
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// Notify implements Notifier
+func (e *Email) Notify(a Alert) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host := e.Server
+		if idx := strings.LastIndexByte(host, ':'); idx >= 0 {
+			host = host[:idx]
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", a)
+	fmt.Fprintf(&msg, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "\r\n%s\r\n", a)
+
+	return smtp.SendMail(e.Server, auth, e.From, e.To, msg.Bytes())
+}
@@ -0,0 +1,106 @@
+// Package artifact implements a content-addressed store for function bundles
+package artifact
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownArtifact is returned if the artifact in question does not exist
+	ErrUnknownArtifact = errors.New("unknown artifact")
+
+	// ErrInvalidDigest is returned if a digest is malformed
+	ErrInvalidDigest = errors.New("invalid digest")
+)
+
+// Kind is the kind of an artifact
+type Kind string
+
+const (
+	// KindArchive is a zip or tar bundle stored in the artifact store
+	KindArchive = Kind("archive")
+
+	// KindOCI is a reference to an OCI (docker) image. Only the reference
+	// is stored, the image itself is pulled by the launcher
+	KindOCI = Kind("oci")
+)
+
+// Well-known media types for archive bundles
+const (
+	MediaTypeZip   = "application/zip"
+	MediaTypeTar   = "application/x-tar"
+	MediaTypeTarGz = "application/gzip"
+)
+
+// Digest is the content address of an artifact in the form
+// "sha256:<hex>"
+type Digest string
+
+var digestRegexp = regexp.MustCompile("^sha256:[a-f0-9]{64}$")
+
+// Validate returns an error if the digest is malformed
+func (d Digest) Validate() error {
+	if !digestRegexp.MatchString(string(d)) {
+		return ErrInvalidDigest
+	}
+
+	return nil
+}
+
+// Hex returns the hex encoded hash of the digest
+func (d Digest) Hex() string {
+	return strings.TrimPrefix(string(d), "sha256:")
+}
+
+// String returns the string representation of the digest
+func (d Digest) String() string {
+	return string(d)
+}
+
+// Descriptor describes an artifact stored in a Store
+type Descriptor struct {
+	// Digest is the content address of the artifact
+	Digest Digest `json:"digest"`
+
+	// Kind is the kind of the artifact
+	Kind Kind `json:"kind"`
+
+	// MediaType is the media type of an archive artifact
+	MediaType string `json:"mediaType,omitempty"`
+
+	// Reference holds the image reference of an OCI artifact
+	Reference string `json:"reference,omitempty"`
+
+	// Size is the size of the artifact content in bytes
+	Size int64 `json:"size"`
+
+	// Created holds the time the artifact has been stored
+	Created time.Time `json:"created"`
+}
+
+// Store stores function artifacts addressed by their digest
+type Store interface {
+	// Put stores the archive read from r and returns it's descriptor.
+	// Storing the same content twice yields the same digest
+	Put(mediaType string, r io.Reader) (Descriptor, error)
+
+	// PutReference stores a reference to an OCI image
+	PutReference(ref string) (Descriptor, error)
+
+	// Get returns the content and descriptor of an artifact. For OCI
+	// artifacts the content holds the image reference
+	Get(Digest) (io.ReadCloser, Descriptor, error)
+
+	// Stat returns the descriptor of an artifact
+	Stat(Digest) (Descriptor, error)
+
+	// Delete deletes an artifact
+	Delete(Digest) error
+
+	// List returns the descriptors of all stored artifacts
+	List() ([]Descriptor, error)
+}
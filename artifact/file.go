@@ -0,0 +1,213 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store backed by a local directory. Blobs are stored in
+// <dir>/blobs/<hex> and descriptors in <dir>/meta/<hex>.json
+type FileStore struct {
+	dir string
+
+	rw sync.RWMutex
+}
+
+// NewFileStore creates a new file store in dir
+func NewFileStore(dir string) (*FileStore, error) {
+	for _, d := range []string{"blobs", "meta", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileStore{
+		dir: dir,
+	}, nil
+}
+
+// Put stores an archive artifact
+func (s *FileStore) Put(mediaType string, r io.Reader) (Descriptor, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(s.dir, "tmp"), "upload-")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return Descriptor{}, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return Descriptor{}, err
+	}
+
+	desc := Descriptor{
+		Digest:    Digest("sha256:" + hex.EncodeToString(h.Sum(nil))),
+		Kind:      KindArchive,
+		MediaType: mediaType,
+		Size:      size,
+		Created:   time.Now(),
+	}
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if existing, err := s.stat(desc.Digest); err == nil {
+		return existing, nil
+	}
+
+	if err := os.Rename(tmp.Name(), s.blobPath(desc.Digest)); err != nil {
+		return Descriptor{}, err
+	}
+
+	return desc, s.writeMeta(desc)
+}
+
+// PutReference stores a reference to an OCI image
+func (s *FileStore) PutReference(ref string) (Descriptor, error) {
+	h := sha256.Sum256([]byte(ref))
+
+	desc := Descriptor{
+		Digest:    Digest("sha256:" + hex.EncodeToString(h[:])),
+		Kind:      KindOCI,
+		Reference: ref,
+		Size:      int64(len(ref)),
+		Created:   time.Now(),
+	}
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if existing, err := s.stat(desc.Digest); err == nil {
+		return existing, nil
+	}
+
+	if err := ioutil.WriteFile(s.blobPath(desc.Digest), []byte(ref), 0600); err != nil {
+		return Descriptor{}, err
+	}
+
+	return desc, s.writeMeta(desc)
+}
+
+// Get returns the content and descriptor of an artifact
+func (s *FileStore) Get(d Digest) (io.ReadCloser, Descriptor, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	desc, err := s.stat(d)
+	if err != nil {
+		return nil, desc, err
+	}
+
+	f, err := os.Open(s.blobPath(d))
+	if err != nil {
+		return nil, desc, err
+	}
+
+	return f, desc, nil
+}
+
+// Stat returns the descriptor of an artifact
+func (s *FileStore) Stat(d Digest) (Descriptor, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	return s.stat(d)
+}
+
+// Delete deletes an artifact
+func (s *FileStore) Delete(d Digest) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if err := os.Remove(s.metaPath(d)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrUnknownArtifact
+		}
+		return err
+	}
+
+	return os.Remove(s.blobPath(d))
+}
+
+// List returns the descriptors of all stored artifacts
+func (s *FileStore) List() ([]Descriptor, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, "meta"))
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Descriptor
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		desc, err := s.stat(Digest("sha256:" + strings.TrimSuffix(f.Name(), ".json")))
+		if err != nil {
+			continue
+		}
+
+		res = append(res, desc)
+	}
+
+	return res, nil
+}
+
+func (s *FileStore) stat(d Digest) (Descriptor, error) {
+	var desc Descriptor
+
+	if err := d.Validate(); err != nil {
+		return desc, err
+	}
+
+	blob, err := ioutil.ReadFile(s.metaPath(d))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return desc, ErrUnknownArtifact
+		}
+		return desc, err
+	}
+
+	err = json.Unmarshal(blob, &desc)
+	return desc, err
+}
+
+func (s *FileStore) writeMeta(desc Descriptor) error {
+	blob, err := json.Marshal(desc)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.metaPath(desc.Digest), blob, 0600)
+}
+
+func (s *FileStore) blobPath(d Digest) string {
+	return filepath.Join(s.dir, "blobs", d.Hex())
+}
+
+func (s *FileStore) metaPath(d Digest) string {
+	return filepath.Join(s.dir, "meta", d.Hex()+".json")
+}
+
+// compile time check
+var _ Store = &FileStore{}
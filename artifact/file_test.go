@@ -0,0 +1,111 @@
+package artifact
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) (*FileStore, string) {
+	dir, err := ioutil.TempDir("", "sigma-artifacts-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return s, dir
+}
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	desc, err := s.Put(MediaTypeZip, strings.NewReader("content"))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(desc.Digest.Validate())
+	assert.Equal(KindArchive, desc.Kind)
+	assert.Equal(int64(7), desc.Size)
+
+	// artifacts are content addressed
+	again, err := s.Put(MediaTypeZip, strings.NewReader("content"))
+	assert.NoError(err)
+	assert.Equal(desc.Digest, again.Digest)
+	assert.Equal(desc.Created.Unix(), again.Created.Unix())
+
+	rc, got, err := s.Get(desc.Digest)
+	if assert.NoError(err) {
+		blob, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		assert.Equal("content", string(blob))
+		assert.Equal(MediaTypeZip, got.MediaType)
+	}
+
+	ref, err := s.PutReference("registry.example.com/fn:1")
+	assert.NoError(err)
+	assert.Equal(KindOCI, ref.Kind)
+
+	list, err := s.List()
+	assert.NoError(err)
+	assert.Len(list, 2)
+
+	assert.NoError(s.Delete(desc.Digest))
+	assert.Equal(ErrUnknownArtifact, s.Delete(desc.Digest))
+	assert.Equal(ErrInvalidDigest, s.Delete("sha256:../../etc"))
+
+	_, _, err = s.Get(desc.Digest)
+	assert.Equal(ErrUnknownArtifact, err)
+
+	_, err = s.Stat("invalid")
+	assert.Equal(ErrInvalidDigest, err)
+}
+
+func TestCollect(t *testing.T) {
+	assert := assert.New(t)
+
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	put := func(content string, age time.Duration) Digest {
+		desc, err := s.Put(MediaTypeTar, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		desc.Created = time.Now().Add(-age)
+		if err := s.writeMeta(desc); err != nil {
+			t.Fatal(err)
+		}
+
+		return desc.Digest
+	}
+
+	used := put("used", 48*time.Hour)
+	unused := put("unused", 48*time.Hour)
+	recent := put("recent", time.Minute)
+
+	deleted, err := Collect(s, func() ([]Digest, error) {
+		return []Digest{used}, nil
+	}, 24*time.Hour)
+	assert.NoError(err)
+	assert.Equal([]Digest{unused}, deleted)
+
+	// recently uploaded artifacts are kept within the grace period
+	_, err = s.Stat(recent)
+	assert.NoError(err)
+
+	_, err = s.Stat(used)
+	assert.NoError(err)
+}
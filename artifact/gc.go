@@ -0,0 +1,48 @@
+package artifact
+
+import (
+	"time"
+)
+
+// ReferenceFunc returns the digests of all artifacts that are still in use
+type ReferenceFunc func() ([]Digest, error)
+
+// Collect deletes all artifacts that are not referenced and have been
+// stored before grace. The grace period protects artifacts that have been
+// uploaded but not yet referenced by a function. It returns the digests of
+// deleted artifacts
+func Collect(s Store, refs ReferenceFunc, grace time.Duration) ([]Digest, error) {
+	inUse, err := refs()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[Digest]struct{}, len(inUse))
+	for _, d := range inUse {
+		used[d] = struct{}{}
+	}
+
+	all, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Digest
+	for _, desc := range all {
+		if _, ok := used[desc.Digest]; ok {
+			continue
+		}
+
+		if time.Now().Sub(desc.Created) < grace {
+			continue
+		}
+
+		if err := s.Delete(desc.Digest); err != nil {
+			return deleted, err
+		}
+
+		deleted = append(deleted, desc.Digest)
+	}
+
+	return deleted, nil
+}
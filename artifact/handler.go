@@ -0,0 +1,138 @@
+package artifact
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxUploadSize is the default maximum size of uploaded archives
+const DefaultMaxUploadSize = 256 << 20
+
+// HandlerOption configures a Handler
+type HandlerOption func(*Handler)
+
+// WithMaxUploadSize sets the maximum size of uploaded archives in bytes.
+// Defaults to DefaultMaxUploadSize
+func WithMaxUploadSize(n int64) HandlerOption {
+	return func(h *Handler) {
+		if n <= 0 {
+			n = DefaultMaxUploadSize
+		}
+		h.maxUploadSize = n
+	}
+}
+
+// Handler serves the artifact store via HTTP:
+//
+//	POST   /artifacts            upload an archive (Content-Type is stored as media type)
+//	POST   /artifacts?ref=<img>  store an OCI image reference
+//	GET    /artifacts            list all artifacts
+//	GET    /artifacts/<digest>   download an artifact
+//	DELETE /artifacts/<digest>   delete an artifact
+type Handler struct {
+	store         Store
+	maxUploadSize int64
+}
+
+// NewHandler returns a new HTTP handler for the store
+func NewHandler(s Store, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		store:         s,
+		maxUploadSize: DefaultMaxUploadSize,
+	}
+
+	for _, fn := range opts {
+		fn(h)
+	}
+
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := Digest(strings.Trim(strings.TrimPrefix(r.URL.Path, "/artifacts"), "/"))
+
+	switch {
+	case r.Method == http.MethodPost && d == "":
+		h.upload(w, r)
+	case r.Method == http.MethodGet && d == "":
+		list, err := h.store.List()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == http.MethodGet:
+		h.download(w, d)
+	case r.Method == http.MethodDelete:
+		if err := h.store.Delete(d); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) upload(w http.ResponseWriter, r *http.Request) {
+	var (
+		desc Descriptor
+		err  error
+	)
+
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		desc, err = h.store.PutReference(ref)
+	} else {
+		desc, err = h.store.Put(r.Header.Get("Content-Type"), http.MaxBytesReader(w, r.Body, h.maxUploadSize))
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "artifact too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, desc)
+}
+
+func (h *Handler) download(w http.ResponseWriter, d Digest) {
+	rc, desc, err := h.store.Get(d)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	if desc.MediaType != "" {
+		w.Header().Set("Content-Type", desc.MediaType)
+	}
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+
+	io.Copy(w, rc)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUnknownArtifact:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrInvalidDigest:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
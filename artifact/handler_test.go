@@ -0,0 +1,64 @@
+package artifact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Upload(t *testing.T) {
+	assert := assert.New(t)
+
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	h := NewHandler(s, WithMaxUploadSize(8))
+
+	upload := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/artifacts", strings.NewReader(body))
+		req.Header.Set("Content-Type", MediaTypeZip)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload("too large")
+	assert.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+
+	list, err := s.List()
+	assert.NoError(err)
+	assert.Empty(list)
+
+	rec = upload("content")
+	if !assert.Equal(http.StatusCreated, rec.Code) {
+		return
+	}
+
+	var desc Descriptor
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&desc))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/artifacts/"+desc.Digest.String(), nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("content", rec.Body.String())
+	assert.Equal(MediaTypeZip, rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/artifacts/"+desc.Digest.String(), nil))
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/artifacts/"+desc.Digest.String(), nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// image references are not limited by the upload size
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/artifacts?ref=registry.example.com/fn:1", nil))
+	assert.Equal(http.StatusCreated, rec.Code)
+}
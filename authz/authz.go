@@ -0,0 +1,195 @@
+// Package authz authorizes function invocations. Authorizers are
+// evaluated for every invocation with the identity of the caller, the
+// invoked function and the event metadata and payload so exposing a
+// function does not mean everyone can call it with any payload.
+//
+// The built-in Policy evaluates an ordered list of rules. Rule conditions
+// use the expression language of trigger conditions with the following
+// parameters:
+//
+//	identity  the identity of the caller, empty if unauthenticated
+//	function  the ID of the invoked function
+//	payload   the event payload as a string, see jsonpath()
+//	type      the event type
+//
+// Event metadata is available using its key with dashes replaced by
+// underscores, e.g. source or correlation_id
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/homebot/core/utils"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/trigger"
+	"golang.org/x/net/context"
+)
+
+// Rule effects
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// reserved holds the parameter names metadata keys must not use
+var reserved = map[string]bool{
+	"identity": true,
+	"function": true,
+	"payload":  true,
+	"type":     true,
+}
+
+// ErrDenied is returned if an invocation is not authorized
+var ErrDenied = errors.New("invocation denied")
+
+// Request describes an invocation to authorize
+type Request struct {
+	// Identity holds the identity of the caller. Empty if the caller is
+	// not authenticated
+	Identity string
+
+	// Function holds the ID of the invoked function
+	Function string
+
+	// Event holds the event dispatched to the function
+	Event sigma.Event
+}
+
+// Authorizer decides whether an invocation is allowed
+type Authorizer interface {
+	// Authorize returns nil if the invocation is allowed
+	Authorize(context.Context, Request) error
+}
+
+// AuthorizerFunc is an Authorizer function
+type AuthorizerFunc func(context.Context, Request) error
+
+// Authorize calls f and implements Authorizer
+func (f AuthorizerFunc) Authorize(ctx context.Context, req Request) error {
+	return f(ctx, req)
+}
+
+// Rule allows or denies invocations matching all of its conditions
+type Rule struct {
+	// Effect is either Allow or Deny. Defaults to Allow
+	Effect string `json:"effect,omitempty" yaml:"effect,omitempty"`
+
+	// Functions holds path.Match patterns of function IDs the rule
+	// applies to. Matches all functions if empty
+	Functions []string `json:"functions,omitempty" yaml:"functions,omitempty"`
+
+	// Identities holds path.Match patterns of caller identities the rule
+	// applies to. Matches all callers including unauthenticated ones if
+	// empty
+	Identities []string `json:"identities,omitempty" yaml:"identities,omitempty"`
+
+	// When holds an optional condition evaluated on the invocation
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
+}
+
+// Policy is an Authorizer evaluating rules in order. The first matching
+// rule decides, invocations not matched by any rule are handled according
+// to the default effect
+type Policy struct {
+	rules   []Rule
+	allowed bool
+}
+
+// NewPolicy creates a new policy. defaultEffect is applied to invocations
+// not matched by any rule and defaults to Deny
+func NewPolicy(defaultEffect string, rules ...Rule) (*Policy, error) {
+	p := &Policy{}
+
+	switch defaultEffect {
+	case Allow:
+		p.allowed = true
+	case "", Deny:
+	default:
+		return nil, fmt.Errorf("invalid default effect %q", defaultEffect)
+	}
+
+	for i, r := range rules {
+		switch r.Effect {
+		case "":
+			r.Effect = Allow
+		case Allow, Deny:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid effect %q", i, r.Effect)
+		}
+
+		for _, patterns := range [][]string{r.Functions, r.Identities} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("rule %d: invalid pattern %q: %s", i, pattern, err)
+				}
+			}
+		}
+
+		p.rules = append(p.rules, r)
+	}
+
+	return p, nil
+}
+
+// Authorize implements Authorizer
+func (p *Policy) Authorize(ctx context.Context, req Request) error {
+	values := make(utils.ValueMap)
+
+	for k, v := range sigma.EventMetadata(req.Event) {
+		k = strings.Replace(k, "-", "_", -1)
+
+		// metadata may be set by callers and must not shadow the
+		// built-in parameters
+		if !reserved[k] {
+			values[k] = v
+		}
+	}
+
+	values["identity"] = req.Identity
+	values["function"] = req.Function
+
+	for i, r := range p.rules {
+		if !matches(r.Functions, req.Function) || !matches(r.Identities, req.Identity) {
+			continue
+		}
+
+		ok, err := trigger.Evaluate(r.When, req.Event, values)
+		if err != nil {
+			// a broken condition must not grant access
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if r.Effect == Deny {
+			return ErrDenied
+		}
+		return nil
+	}
+
+	if p.allowed {
+		return nil
+	}
+
+	return ErrDenied
+}
+
+// matches returns true if s matches one of patterns or patterns is empty
+func matches(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+
+	return false
+}
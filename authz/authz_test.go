@@ -0,0 +1,76 @@
+package authz
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewPolicy(Deny,
+		Rule{
+			Effect:     Deny,
+			Identities: []string{"guest"},
+		},
+		Rule{
+			Functions:  []string{"home/functions/*"},
+			Identities: []string{"alice", "bob"},
+			When:       `source == "api" && contains(payload, "light")`,
+		},
+	)
+	assert.NoError(err)
+
+	event := func(payload string, md sigma.Metadata) sigma.Event {
+		return sigma.NewEventWithMetadata("test", []byte(payload), md)
+	}
+
+	api := sigma.Metadata{sigma.MetadataSource: "api"}
+
+	assert.NoError(p.Authorize(context.Background(), Request{
+		Identity: "alice",
+		Function: "home/functions/lights",
+		Event:    event(`{"light": "hall"}`, api),
+	}))
+
+	// condition not satisfied
+	assert.Equal(ErrDenied, p.Authorize(context.Background(), Request{
+		Identity: "alice",
+		Function: "home/functions/lights",
+		Event:    event(`{"door": "front"}`, api),
+	}))
+
+	// unknown function
+	assert.Equal(ErrDenied, p.Authorize(context.Background(), Request{
+		Identity: "bob",
+		Function: "office/functions/lights",
+		Event:    event(`{"light": "hall"}`, api),
+	}))
+
+	// denied identity
+	assert.Equal(ErrDenied, p.Authorize(context.Background(), Request{
+		Identity: "guest",
+		Function: "home/functions/lights",
+		Event:    event(`{"light": "hall"}`, api),
+	}))
+
+	// metadata cannot shadow the caller identity
+	assert.Equal(ErrDenied, p.Authorize(context.Background(), Request{
+		Identity: "mallory",
+		Function: "home/functions/lights",
+		Event:    event(`{"light": "hall"}`, sigma.Metadata{sigma.MetadataSource: "api", "identity": "alice"}),
+	}))
+
+	_, err = NewPolicy("maybe")
+	assert.Error(err)
+
+	_, err = NewPolicy(Allow, Rule{Effect: "perhaps"})
+	assert.Error(err)
+
+	_, err = NewPolicy(Allow, Rule{Functions: []string{"["}})
+	assert.Error(err)
+}
@@ -0,0 +1,338 @@
+// Package bench provides a reproducible benchmark harness for the sigma
+// dispatch path. It starts an in-process node handler, connects a number
+// of fake nodes over gRPC and dispatches events from concurrent invokers
+// while measuring throughput, latency and allocation rates.
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/node"
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Config configures a benchmark run
+type Config struct {
+	// Nodes is the number of fake nodes to start
+	Nodes int
+
+	// Invokers is the number of concurrent invokers
+	Invokers int
+
+	// Requests is the total number of events to dispatch. If zero,
+	// Duration is used instead
+	Requests int
+
+	// Duration is the time to dispatch events for if Requests is zero
+	Duration time.Duration
+
+	// PayloadSize is the size of the event payload in bytes
+	PayloadSize int
+}
+
+// Result holds the results of a benchmark run
+type Result struct {
+	// Requests is the number of dispatched events
+	Requests int
+
+	// Errors is the number of failed dispatches
+	Errors int
+
+	// Elapsed is the duration of the run
+	Elapsed time.Duration
+
+	// Throughput is the number of dispatches per second
+	Throughput float64
+
+	// P50 and P99 are the median and 99th percentile dispatch latency
+	P50 time.Duration
+	P99 time.Duration
+
+	// AllocsPerOp and BytesPerOp are the heap allocations per dispatch
+	// across the whole process (controller and fake nodes)
+	AllocsPerOp uint64
+	BytesPerOp  uint64
+}
+
+// String returns a human readable summary of r
+func (r Result) String() string {
+	return fmt.Sprintf("requests=%d errors=%d elapsed=%s throughput=%.0f/s p50=%s p99=%s allocs/op=%d bytes/op=%d",
+		r.Requests, r.Errors, r.Elapsed, r.Throughput, r.P50, r.P99, r.AllocsPerOp, r.BytesPerOp)
+}
+
+// Harness is a running node handler with connected fake nodes
+type Harness struct {
+	server      *grpc.Server
+	nodes       []node.Controller
+	payloadSize int
+	next        uint64
+}
+
+// NewHarness starts a node handler on a loopback address and connects
+// cfg.Nodes fake nodes that echo the payload of each event
+func NewHarness(ctx context.Context, cfg Config) (*Harness, error) {
+	if cfg.Nodes <= 0 {
+		return nil, errors.New("at least one node is required")
+	}
+
+	svc := node.NewNodeServer()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Harness{
+		server:      grpc.NewServer(),
+		payloadSize: cfg.PayloadSize,
+	}
+	sigmaV1.RegisterNodeHandlerServer(h.server, svc)
+	go h.server.Serve(lis)
+
+	for i := 0; i < cfg.Nodes; i++ {
+		urn := fmt.Sprintf("urn:sigma:default:bench:1:node-%d", i)
+		secret := uuid.NewV4().String()
+
+		conn, err := svc.Prepare(urn, secret, sigma.FunctionSpec{ID: "bench", Type: "bench"})
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+
+		inst := &fakeNode{urn: urn, secret: secret, done: make(chan struct{})}
+		if err := inst.start(ctx, lis.Addr().String()); err != nil {
+			h.Close()
+			return nil, err
+		}
+
+		for !conn.Connected() {
+			select {
+			case <-ctx.Done():
+				h.Close()
+				return nil, ctx.Err()
+			case <-time.After(time.Millisecond):
+			}
+		}
+
+		h.nodes = append(h.nodes, node.CreateController(urn, inst, conn))
+	}
+
+	return h, nil
+}
+
+// Dispatch dispatches a single event to the next node
+func (h *Harness) Dispatch(ctx context.Context, payload []byte) error {
+	i := atomic.AddUint64(&h.next, 1)
+	ctrl := h.nodes[int(i%uint64(len(h.nodes)))]
+
+	_, err := ctrl.Dispatch(ctx, &sigmaV1.DispatchEvent{
+		Urn:     ctrl.URN(),
+		Payload: payload,
+	})
+	return err
+}
+
+// Close stops all fake nodes and the node handler
+func (h *Harness) Close() {
+	for _, n := range h.nodes {
+		n.Close()
+	}
+	h.server.Stop()
+}
+
+// Run runs a benchmark as configured by cfg
+func Run(ctx context.Context, cfg Config) (Result, error) {
+	if cfg.Invokers <= 0 {
+		cfg.Invokers = 1
+	}
+
+	if cfg.Requests <= 0 && cfg.Duration <= 0 {
+		return Result{}, errors.New("either requests or duration must be set")
+	}
+
+	h, err := NewHarness(ctx, cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	defer h.Close()
+
+	payload := make([]byte, cfg.PayloadSize)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		latencies []time.Duration
+		errCount  int64
+		remaining = int64(cfg.Requests)
+		deadline  = time.Now().Add(cfg.Duration)
+	)
+
+	next := func() bool {
+		if cfg.Requests > 0 {
+			return atomic.AddInt64(&remaining, -1) >= 0
+		}
+		return time.Now().Before(deadline)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for i := 0; i < cfg.Invokers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var local []time.Duration
+			for next() {
+				t := time.Now()
+				if err := h.Dispatch(ctx, payload); err != nil {
+					atomic.AddInt64(&errCount, 1)
+					continue
+				}
+				local = append(local, time.Since(t))
+			}
+
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	res := Result{
+		Requests: len(latencies) + int(errCount),
+		Errors:   int(errCount),
+		Elapsed:  elapsed,
+	}
+
+	if res.Requests > 0 {
+		res.Throughput = float64(res.Requests) / elapsed.Seconds()
+		res.AllocsPerOp = (after.Mallocs - before.Mallocs) / uint64(res.Requests)
+		res.BytesPerOp = (after.TotalAlloc - before.TotalAlloc) / uint64(res.Requests)
+	}
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		res.P50 = percentile(latencies, 0.50)
+		res.P99 = percentile(latencies, 0.99)
+	}
+
+	return res, nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
+
+// fakeNodeCredits is the credit window granted by fake nodes
+const fakeNodeCredits = 32
+
+// fakeNode is a node connected via gRPC that echoes event payloads. It
+// grants a credit for each result and implements launcher.Instance
+type fakeNode struct {
+	urn    string
+	secret string
+	conn   *grpc.ClientConn
+	done   chan struct{}
+}
+
+func (f *fakeNode) start(ctx context.Context, addr string) error {
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	f.conn = conn
+
+	cli := sigmaV1.NewNodeHandlerClient(conn)
+	callCtx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("node-urn", f.urn, "node-secret", f.secret, node.ProtocolHeader, strconv.Itoa(node.ProtocolVersion)))
+
+	if _, err := cli.Register(callCtx, &sigmaV1.NodeRegistrationRequest{
+		Urn:      f.urn,
+		NodeType: "bench",
+	}); err != nil {
+		conn.Close()
+		return err
+	}
+
+	stream, err := cli.Subscribe(callCtx)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := stream.Send(creditGrant(fakeNodeCredits)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	go func() {
+		defer close(f.done)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				return
+			}
+
+			if err := stream.Send(&sigmaV1.ExecutionResult{
+				Id: msg.GetId(),
+				ExecutionResult: &sigmaV1.ExecutionResult_Result{
+					Result: msg.GetPayload(),
+				},
+			}); err != nil {
+				return
+			}
+
+			if msg.GetId() == "" {
+				continue
+			}
+
+			if err := stream.Send(creditGrant(1)); err != nil {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// creditGrant returns the execution result granting n credits
+func creditGrant(n int) *sigmaV1.ExecutionResult {
+	return &sigmaV1.ExecutionResult{
+		Id: node.CreditID,
+		ExecutionResult: &sigmaV1.ExecutionResult_Result{
+			Result: []byte(strconv.Itoa(n)),
+		},
+	}
+}
+
+func (f *fakeNode) Healthy() error {
+	select {
+	case <-f.done:
+		return errors.New("disconnected")
+	default:
+		return nil
+	}
+}
+
+func (f *fakeNode) Stop() error {
+	return f.conn.Close()
+}
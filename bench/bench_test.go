@@ -0,0 +1,34 @@
+package bench
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func benchmarkDispatch(b *testing.B, nodes, payloadSize int) {
+	h, err := NewHarness(context.Background(), Config{Nodes: nodes})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer h.Close()
+
+	payload := make([]byte, payloadSize)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(payloadSize))
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := h.Dispatch(context.Background(), payload); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDispatch1Node(b *testing.B)        { benchmarkDispatch(b, 1, 128) }
+func BenchmarkDispatch10Nodes(b *testing.B)      { benchmarkDispatch(b, 10, 128) }
+func BenchmarkDispatch100Nodes(b *testing.B)     { benchmarkDispatch(b, 100, 128) }
+func BenchmarkDispatchLargePayload(b *testing.B) { benchmarkDispatch(b, 10, 64<<10) }
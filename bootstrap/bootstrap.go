@@ -0,0 +1,504 @@
+// Package bootstrap assembles and runs a complete sigma deployment. It
+// wires the node server, deployer, scheduler, built-in triggers, the
+// artifact store and the sigma API from a single configuration, registers
+// health checks and shuts the subsystems down in order:
+//
+//	d, err := bootstrap.New(bootstrap.Config{
+//		Launcher: launcher,
+//	})
+//	...
+//	if err := d.Run(ctx); err != nil { ... }
+//
+// Shutdown first stops accepting API calls, then destroys all functions
+// while the node handler is still reachable so nodes can handle their
+// shutdown events, then stops the node handler and finally runs the
+// shutdown hooks registered using OnShutdown in reverse order
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma/artifact"
+	"github.com/homebot/sigma/healthcheck"
+	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/scheduler"
+	"github.com/homebot/sigma/server"
+	"github.com/homebot/sigma/sidecar"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	// Register all built-in triggers
+	_ "github.com/homebot/sigma/trigger/builtin"
+)
+
+// Default listen addresses
+const (
+	DefaultAPIListen  = "localhost:50051"
+	DefaultNodeListen = "localhost:50052"
+)
+
+// DefaultShutdownTimeout is the default time Shutdown waits for a
+// graceful shutdown
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrNoLauncher is returned by New if no launcher is configured
+var ErrNoLauncher = errors.New("bootstrap: no launcher configured")
+
+// Config configures a sigma deployment. Only Launcher is required, all
+// other fields default to sane values
+type Config struct {
+	// Launcher launches function nodes
+	Launcher launcher.Launcher
+
+	// APIListen holds the address the sigma API listens on. Defaults
+	// to DefaultAPIListen
+	APIListen string
+
+	// NodeListen holds the address the node handler listens on.
+	// Defaults to DefaultNodeListen
+	NodeListen string
+
+	// NodeAdvertise holds the node handler address advertised to nodes.
+	// Defaults to NodeListen
+	NodeAdvertise string
+
+	// NodeSocket enables the node handler on a unix domain socket at the
+	// given path if set. Nodes connecting via the socket may authenticate
+	// using their peer credentials
+	NodeSocket string
+
+	// WebSocketListen enables the WebSocket node transport on the given
+	// address if set
+	WebSocketListen string
+
+	// WebSocketAdvertise holds the WebSocket node transport URL
+	// advertised to nodes. Defaults to http://<WebSocketListen>/nodes
+	WebSocketAdvertise string
+
+	// ArtifactDir enables the file based artifact store in the given
+	// directory if set
+	ArtifactDir string
+
+	// ReconcileInterval is the interval orphaned nodes are garbage
+	// collected at. Defaults to node.DefaultReconcileInterval
+	ReconcileInterval time.Duration
+
+	// ShutdownTimeout is the time Run waits for a graceful shutdown.
+	// Defaults to DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+
+	// NodeServerOptions, DeployerOptions, SchedulerOptions and
+	// ServerOptions configure the respective subsystems
+	NodeServerOptions []node.ServerOption
+	DeployerOptions   []node.DeployerOption
+	SchedulerOptions  []scheduler.Option
+	ServerOptions     []server.Option
+
+	// APIServerOptions configures the gRPC server of the sigma API, e.g.
+	// to enforce authentication
+	APIServerOptions []grpc.ServerOption
+
+	// WrapScheduler wraps the scheduler served by the sigma API if set,
+	// e.g. to federate it with other deployments
+	WrapScheduler func(scheduler.Scheduler) (scheduler.Scheduler, error)
+
+	// NodeGRPCOptions configures the gRPC server of the node handler
+	NodeGRPCOptions []grpc.ServerOption
+}
+
+// hook is a shutdown hook registered using OnShutdown
+type hook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// task is a task registered using Go
+type task struct {
+	name string
+	fn   func() error
+}
+
+// Deployment is an assembled sigma deployment
+type Deployment struct {
+	cfg Config
+
+	sidecar   *sidecar.Sidecar
+	scheduler scheduler.Scheduler
+	artifacts artifact.Store
+
+	apiServer    *grpc.Server
+	nodeServer   *grpc.Server
+	socketServer *grpc.Server
+	httpServer   *http.Server
+
+	mu      sync.Mutex
+	hooks   []hook
+	tasks   []task
+	started bool
+	errs    chan error
+}
+
+// New assembles a new deployment from cfg. Subsystems are not started
+// until Start or Run is called
+func New(cfg Config) (*Deployment, error) {
+	if cfg.Launcher == nil {
+		return nil, ErrNoLauncher
+	}
+
+	if cfg.APIListen == "" {
+		cfg.APIListen = DefaultAPIListen
+	}
+
+	if cfg.NodeListen == "" {
+		cfg.NodeListen = DefaultNodeListen
+	}
+
+	if cfg.NodeAdvertise == "" {
+		cfg.NodeAdvertise = cfg.NodeListen
+	}
+
+	if cfg.ReconcileInterval == 0 {
+		cfg.ReconcileInterval = node.DefaultReconcileInterval
+	}
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	if cfg.WebSocketListen != "" && cfg.WebSocketAdvertise == "" {
+		cfg.WebSocketAdvertise = "http://" + cfg.WebSocketListen + "/nodes"
+	}
+
+	d := &Deployment{
+		cfg: cfg,
+		// only the first error is reported
+		errs: make(chan error, 1),
+	}
+
+	nodeServerOpts := cfg.NodeServerOptions
+	deployerOpts := cfg.DeployerOptions
+
+	if cfg.ArtifactDir != "" {
+		store, err := artifact.NewFileStore(cfg.ArtifactDir)
+		if err != nil {
+			return nil, err
+		}
+		d.artifacts = store
+
+		nodeServerOpts = append(nodeServerOpts, node.WithArtifactStore(store))
+		deployerOpts = append(deployerOpts, node.WithDeployerArtifactStore(store))
+	}
+
+	if cfg.WebSocketListen != "" {
+		deployerOpts = append(deployerOpts, node.WithWebSocketAddress(cfg.WebSocketAdvertise))
+	}
+
+	var err error
+	d.sidecar, err = sidecar.New(cfg.Launcher, cfg.NodeAdvertise,
+		sidecar.WithNodeServerOptions(nodeServerOpts...),
+		sidecar.WithDeployerOptions(deployerOpts...),
+		sidecar.WithSchedulerOptions(cfg.SchedulerOptions...),
+		sidecar.WithReconcileInterval(cfg.ReconcileInterval),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.artifacts != nil {
+		d.sidecar.Checker().Add(healthcheck.Store, func(ctx context.Context) error {
+			_, err := d.artifacts.List()
+			return err
+		})
+	}
+
+	d.scheduler = d.sidecar.Scheduler()
+	if cfg.WrapScheduler != nil {
+		d.scheduler, err = cfg.WrapScheduler(d.scheduler)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// nodes calling the API are identified by their function
+	serverOpts := append([]server.Option{
+		server.WithNodeAuthenticator(d.sidecar.NodeServer().Authenticate),
+	}, cfg.ServerOptions...)
+
+	api, err := server.NewServer(d.scheduler, serverOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d.apiServer = grpc.NewServer(cfg.APIServerOptions...)
+	sigmaV1.RegisterSigmaServer(d.apiServer, api)
+	d.sidecar.Checker().Register(d.apiServer)
+
+	d.nodeServer = grpc.NewServer(cfg.NodeGRPCOptions...)
+	d.sidecar.RegisterGRPC(d.nodeServer)
+
+	if cfg.NodeSocket != "" {
+		opts := append(append([]grpc.ServerOption{}, cfg.NodeGRPCOptions...), grpc.Creds(node.UnixSocketCredentials()))
+
+		d.socketServer = grpc.NewServer(opts...)
+		d.sidecar.RegisterGRPC(d.socketServer)
+	}
+
+	if cfg.WebSocketListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/nodes/", d.sidecar.Handler())
+
+		d.httpServer = &http.Server{
+			Addr:    cfg.WebSocketListen,
+			Handler: mux,
+		}
+	}
+
+	return d, nil
+}
+
+// Scheduler returns the scheduler served by the sigma API. It is wrapped
+// using Config.WrapScheduler if set
+func (d *Deployment) Scheduler() scheduler.Scheduler {
+	return d.scheduler
+}
+
+// NodeServer returns the node server of the deployment, e.g. to
+// authenticate nodes calling additional services
+func (d *Deployment) NodeServer() node.NodeServer {
+	return d.sidecar.NodeServer()
+}
+
+// Artifacts returns the artifact store or nil if it is disabled
+func (d *Deployment) Artifacts() artifact.Store {
+	return d.artifacts
+}
+
+// Checker returns the health checker of the deployment. Additional
+// subsystems may be added to it
+func (d *Deployment) Checker() *healthcheck.Checker {
+	return d.sidecar.Checker()
+}
+
+// OnShutdown registers a hook that is called during Shutdown after the
+// core subsystems have been stopped. Hooks are called in reverse order of
+// their registration
+func (d *Deployment) OnShutdown(name string, fn func(context.Context) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hooks = append(d.hooks, hook{name: name, fn: fn})
+}
+
+// Go runs fn once the deployment has been started, e.g. to serve
+// additional APIs. If fn fails, Run shuts the deployment down
+func (d *Deployment) Go(name string, fn func() error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := task{name: name, fn: fn}
+	d.tasks = append(d.tasks, t)
+
+	if d.started {
+		go d.run(t)
+	}
+}
+
+// Start opens all listeners and starts the subsystems. Errors of the
+// servers are reported by Run
+func (d *Deployment) Start(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started {
+		return errors.New("bootstrap: already started")
+	}
+
+	// listeners are opened before anything is served so a busy
+	// address does not leave a partially started deployment behind
+	nodeListener, err := net.Listen("tcp", d.cfg.NodeListen)
+	if err != nil {
+		return err
+	}
+
+	apiListener, err := net.Listen("tcp", d.cfg.APIListen)
+	if err != nil {
+		nodeListener.Close()
+		return err
+	}
+
+	listeners := []net.Listener{nodeListener, apiListener}
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	var socketListener net.Listener
+	if d.socketServer != nil {
+		// remove stale sockets of previous runs
+		os.Remove(d.cfg.NodeSocket)
+
+		socketListener, err = net.Listen("unix", d.cfg.NodeSocket)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, socketListener)
+	}
+
+	var httpListener net.Listener
+	if d.httpServer != nil {
+		httpListener, err = net.Listen("tcp", d.cfg.WebSocketListen)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, httpListener)
+	}
+
+	if err := d.sidecar.Start(ctx); err != nil {
+		closeAll()
+		return err
+	}
+
+	glog.Infof("node handler running on %s", nodeListener.Addr())
+	go d.serve(func() error { return d.nodeServer.Serve(nodeListener) })
+
+	if socketListener != nil {
+		glog.Infof("node handler running on %s", socketListener.Addr())
+		go d.serve(func() error { return d.socketServer.Serve(socketListener) })
+	}
+
+	if httpListener != nil {
+		glog.Infof("websocket node handler running on %s", httpListener.Addr())
+		go d.serve(func() error {
+			if err := d.httpServer.Serve(httpListener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+	}
+
+	glog.Infof("sigma API running on %s", apiListener.Addr())
+	go d.serve(func() error { return d.apiServer.Serve(apiListener) })
+
+	for _, t := range d.tasks {
+		go d.run(t)
+	}
+
+	d.started = true
+
+	return nil
+}
+
+func (d *Deployment) serve(fn func() error) {
+	if err := fn(); err != nil {
+		select {
+		case d.errs <- err:
+		default:
+		}
+	}
+}
+
+func (d *Deployment) run(t task) {
+	d.serve(func() error {
+		if err := t.fn(); err != nil {
+			return fmt.Errorf("%s: %s", t.name, err)
+		}
+		return nil
+	})
+}
+
+// Run starts the deployment and blocks until ctx is cancelled or a server
+// fails. The deployment is shut down before Run returns
+func (d *Deployment) Run(ctx context.Context) error {
+	if err := d.Start(ctx); err != nil {
+		return err
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-d.errs:
+		glog.Error("server failed, shutting down: ", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), d.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if serr := d.Shutdown(shutdownCtx); err == nil {
+		err = serr
+	}
+
+	return err
+}
+
+// Shutdown stops all subsystems in order. It returns the first error
+// encountered but always runs all shutdown steps
+func (d *Deployment) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	started := d.started
+	d.started = false
+	hooks := d.hooks
+	d.mu.Unlock()
+
+	if !started {
+		return errors.New("bootstrap: not started")
+	}
+
+	var first error
+	record := func(step string, err error) {
+		if err == nil {
+			return
+		}
+		glog.Errorf("shutdown: %s: %s", step, err)
+		if first == nil {
+			first = err
+		}
+	}
+
+	// stop accepting API calls but let pending ones complete
+	gracefulStop(ctx, d.apiServer)
+
+	// nodes still need the node handler to handle their shutdown
+	// events so functions are destroyed before it is stopped
+	record("functions", d.sidecar.Stop(ctx))
+
+	gracefulStop(ctx, d.nodeServer)
+	if d.socketServer != nil {
+		gracefulStop(ctx, d.socketServer)
+	}
+	if d.httpServer != nil {
+		record("websocket", d.httpServer.Shutdown(ctx))
+	}
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		record(hooks[i].name, hooks[i].fn(ctx))
+	}
+
+	return first
+}
+
+// gracefulStop stops s gracefully or forcefully once ctx is done
+func gracefulStop(ctx context.Context, s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+var failingLauncher = launcher.CreateFunc(func(context.Context, string, launcher.Config) (launcher.Instance, error) {
+	return nil, errors.New("not supported")
+})
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(Config{})
+	assert.Equal(ErrNoLauncher, err)
+
+	// the scheduler served by the API may be wrapped
+	var wrapped scheduler.Scheduler
+	d, err := New(Config{
+		Launcher:        failingLauncher,
+		WebSocketListen: "127.0.0.1:8080",
+		WrapScheduler: func(s scheduler.Scheduler) (scheduler.Scheduler, error) {
+			wrapped = s
+			return s, nil
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NotNil(wrapped)
+	assert.Equal(wrapped, d.Scheduler())
+	assert.NotNil(d.NodeServer())
+	assert.Equal("http://127.0.0.1:8080/nodes", d.cfg.WebSocketAdvertise)
+
+	_, err = New(Config{
+		Launcher: failingLauncher,
+		WrapScheduler: func(s scheduler.Scheduler) (scheduler.Scheduler, error) {
+			return nil, errors.New("failed")
+		},
+	})
+	assert.Error(err)
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bootstrap")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "nodes.sock")
+
+	d, err := New(Config{
+		Launcher:   failingLauncher,
+		APIListen:  "127.0.0.1:0",
+		NodeListen: "127.0.0.1:0",
+		NodeSocket: socket,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Error(d.Shutdown(context.Background()))
+
+	var order []string
+	d.OnShutdown("first", func(context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	d.OnShutdown("second", func(context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	// a failing task shuts the deployment down
+	started := make(chan struct{})
+	d.Go("task", func() error {
+		_, err := os.Stat(socket)
+		assert.NoError(err)
+
+		close(started)
+		return errors.New("failed")
+	})
+
+	err = d.Run(context.Background())
+	<-started
+	if assert.Error(err) {
+		assert.Equal("task: failed", err.Error())
+	}
+	assert.Equal([]string{"second", "first"}, order)
+}
@@ -0,0 +1,41 @@
+// Package bufpool provides sync.Pool backed byte buffers for encoding
+// dispatch events and buffered trigger events.
+//
+// Ownership rules: a buffer obtained from the pool is owned by the caller
+// until it is returned using Put. After returning a buffer
+// neither the buffer nor any slice referencing its memory (e.g. the result
+// of Bytes()) may be used again. Buffers must therefore never be returned
+// while their contents are referenced by a DispatchEvent, sigma.Event or
+// any other value that outlives the call.
+package bufpool
+
+import (
+	"bytes"
+	"sync"
+)
+
+// MaxPooledSize is the maximum capacity of buffers kept in the pool.
+// Larger buffers are left to the garbage collector so a single large
+// payload does not pin memory forever
+const MaxPooledSize = 4 << 20
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// Get returns an empty buffer from the pool
+func Get() *bytes.Buffer {
+	return buffers.Get().(*bytes.Buffer)
+}
+
+// Put resets b and returns it to the pool
+func Put(b *bytes.Buffer) {
+	if b == nil || b.Cap() > MaxPooledSize {
+		return
+	}
+
+	b.Reset()
+	buffers.Put(b)
+}
@@ -0,0 +1,36 @@
+package bufpool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPut(t *testing.T) {
+	b := Get()
+	b.WriteString("foo")
+	Put(b)
+
+	b = Get()
+	assert.Equal(t, 0, b.Len())
+}
+
+var payload = make([]byte, 64<<10)
+
+func BenchmarkAlloc(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		buf.Write(payload)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := Get()
+		buf.Write(payload)
+		Put(buf)
+	}
+}
@@ -0,0 +1,152 @@
+// Package build turns function source code into runnable artifacts and
+// deploys them
+package build
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrUnknownBuilder is returned if the requested builder does not exist
+	ErrUnknownBuilder = errors.New("unknown builder")
+
+	// ErrInvalidSource is returned if a source does not specify exactly
+	// one location
+	ErrInvalidSource = errors.New("source must specify exactly one of git or artifact")
+
+	// ErrArchiveTooLarge is returned if an archive source extracts to
+	// more than MaxExtractSize bytes
+	ErrArchiveTooLarge = errors.New("archive too large")
+)
+
+// MaxExtractSize is the maximum number of bytes extracted from an archive
+// source
+const MaxExtractSize = 1 << 30
+
+// GitSource references a git repository
+type GitSource struct {
+	// URL is the clone URL of the repository
+	URL string `json:"url" yaml:"url"`
+
+	// Ref is the branch, tag or commit to build. Defaults to the
+	// repository's default branch
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+}
+
+// Source describes where to fetch the function source from. Sources are
+// supplied by API clients and therefore never reference the local file
+// system of the controller
+type Source struct {
+	// Git is a remote git repository
+	Git *GitSource `json:"git,omitempty" yaml:"git,omitempty"`
+
+	// Artifact is the digest of a zip or tar(.gz) archive stored in the
+	// artifact store
+	Artifact string `json:"artifact,omitempty" yaml:"artifact,omitempty"`
+}
+
+// Target describes the artifact to build
+type Target struct {
+	// Builder is the name of the builder to use (e.g. "docker" or "pack")
+	Builder string `json:"builder" yaml:"builder"`
+
+	// Image is the OCI image reference to tag the result with
+	Image string `json:"image" yaml:"image"`
+
+	// Options holds builder specific options
+	Options map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// Builder builds an OCI image from a source directory
+type Builder interface {
+	// Build builds the source in dir and returns the image reference
+	Build(ctx context.Context, dir string, target Target) (string, error)
+}
+
+// BuildFunc builds an OCI image and implements Builder
+type BuildFunc func(ctx context.Context, dir string, target Target) (string, error)
+
+// Build calls f and implements Builder
+func (f BuildFunc) Build(ctx context.Context, dir string, target Target) (string, error) {
+	return f(ctx, dir, target)
+}
+
+// Docker builds images using `docker build`. The source directory must
+// contain a Dockerfile. Another Dockerfile within the source directory can
+// be selected using the "dockerfile" option
+var Docker Builder = BuildFunc(func(ctx context.Context, dir string, target Target) (string, error) {
+	args := []string{"build", "-t", target.Image}
+
+	if f, ok := target.Options["dockerfile"]; ok {
+		path, err := contextFile(dir, f)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "-f", path)
+	}
+
+	args = append(args, dir)
+
+	return target.Image, run(ctx, "docker", args...)
+})
+
+// Pack builds images using cloud native buildpacks (`pack build`). The
+// buildpack builder image can be set using the "builder" option
+var Pack Builder = BuildFunc(func(ctx context.Context, dir string, target Target) (string, error) {
+	args := []string{"build", target.Image, "--path", dir}
+
+	if b, ok := target.Options["builder"]; ok {
+		args = append(args, "--builder", b)
+	}
+
+	return target.Image, run(ctx, "pack", args...)
+})
+
+// contextFile returns the path of the file name within the build context
+// dir. Neither name nor symlinks may point outside of dir
+func contextFile(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", errors.New("file must be relative to the build context: " + name)
+	}
+
+	path, err := safeJoin(dir, name)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !within(root, resolved) {
+		return "", errors.New("file escapes the build context: " + name)
+	}
+
+	return path, nil
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > 4096 {
+			msg = msg[len(msg)-4096:]
+		}
+		return errors.New(name + " failed: " + err.Error() + ": " + msg)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sigma-build-")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "docker"), 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "docker", "Dockerfile"), nil, 0644))
+	assert.NoError(os.Symlink("/etc/passwd", filepath.Join(dir, "escape")))
+
+	path, err := contextFile(dir, "docker/Dockerfile")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(dir, "docker", "Dockerfile"), path)
+
+	for _, name := range []string{
+		"/etc/passwd",
+		"../Dockerfile",
+		"docker/../../Dockerfile",
+		"escape",
+		"missing",
+	} {
+		_, err := contextFile(dir, name)
+		assert.Error(err, name)
+	}
+}
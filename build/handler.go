@@ -0,0 +1,42 @@
+package build
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the build pipeline via HTTP. A POST request with a JSON
+// encoded Request builds and deploys the function and returns the Result
+type Handler struct {
+	pipeline *Pipeline
+}
+
+// NewHandler returns a new HTTP handler for the pipeline
+func NewHandler(p *Pipeline) *Handler {
+	return &Handler{
+		pipeline: p,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.pipeline.Deploy(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
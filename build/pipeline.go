@@ -0,0 +1,129 @@
+package build
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/artifact"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// Request is a request to build and deploy a function from source
+type Request struct {
+	// Spec is the function specification to deploy. It's artifact
+	// is replaced by the build result
+	Spec sigma.FunctionSpec `json:"spec" yaml:"spec"`
+
+	// Source describes where to fetch the function source from
+	Source Source `json:"source" yaml:"source"`
+
+	// Target describes the artifact to build
+	Target Target `json:"target" yaml:"target"`
+}
+
+// Result is the result of a build
+type Result struct {
+	// Image is the reference of the built image
+	Image string `json:"image"`
+
+	// Artifact is the digest of the artifact registered for the image
+	Artifact artifact.Digest `json:"artifact"`
+
+	// Function is the name of the deployed function
+	Function string `json:"function"`
+}
+
+// Pipeline builds functions from source, registers the result in the
+// artifact store and deploys the function
+type Pipeline struct {
+	builders  map[string]Builder
+	artifacts artifact.Store
+	scheduler scheduler.Scheduler
+}
+
+// NewPipeline creates a new build pipeline with the default builders
+// "docker" and "pack"
+func NewPipeline(store artifact.Store, s scheduler.Scheduler) (*Pipeline, error) {
+	if store == nil {
+		return nil, errors.New("build: artifact store is mandatory")
+	}
+
+	return &Pipeline{
+		builders: map[string]Builder{
+			"docker": Docker,
+			"pack":   Pack,
+		},
+		artifacts: store,
+		scheduler: s,
+	}, nil
+}
+
+// RegisterBuilder registers an additional builder
+func (p *Pipeline) RegisterBuilder(name string, b Builder) {
+	p.builders[name] = b
+}
+
+// Build builds the source and registers the resulting image in the
+// artifact store
+func (p *Pipeline) Build(ctx context.Context, src Source, target Target) (artifact.Descriptor, error) {
+	builder, ok := p.builders[target.Builder]
+	if !ok {
+		return artifact.Descriptor{}, ErrUnknownBuilder
+	}
+
+	if target.Image == "" {
+		return artifact.Descriptor{}, errors.New("build: missing target image")
+	}
+
+	dir, cleanup, err := fetch(ctx, src, p.artifacts)
+	if err != nil {
+		return artifact.Descriptor{}, err
+	}
+	defer cleanup()
+
+	image, err := builder.Build(ctx, dir, target)
+	if err != nil {
+		return artifact.Descriptor{}, err
+	}
+
+	return p.artifacts.PutReference(image)
+}
+
+// Deploy builds the source and deploys the function using the built
+// artifact. An existing function with the same ID is updated
+func (p *Pipeline) Deploy(ctx context.Context, req Request) (Result, error) {
+	var res Result
+
+	if req.Spec.ID == "" || req.Spec.Type == "" {
+		return res, errors.New("invalid function spec")
+	}
+
+	desc, err := p.Build(ctx, req.Source, req.Target)
+	if err != nil {
+		return res, err
+	}
+
+	res.Image = desc.Reference
+	res.Artifact = desc.Digest
+
+	spec := req.Spec
+	spec.Artifact = desc.Digest.String()
+	spec.Content = ""
+
+	// existing functions are updated in place so running nodes are
+	// replaced using a rolling update and buffered events are kept
+	err = p.scheduler.Update(ctx, spec)
+	if err == nil {
+		res.Function = spec.ID
+		return res, nil
+	}
+
+	if err != scheduler.ErrUnknownFunction {
+		return res, err
+	}
+
+	res.Function, err = p.scheduler.Create(ctx, spec)
+	return res, err
+}
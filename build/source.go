@@ -0,0 +1,272 @@
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma/artifact"
+)
+
+// fetch makes the source available in a local directory. The returned
+// cleanup function removes any temporary files
+func fetch(ctx context.Context, src Source, store artifact.Store) (string, func(), error) {
+	nop := func() {}
+
+	if (src.Git == nil) == (src.Artifact == "") {
+		return "", nop, ErrInvalidSource
+	}
+
+	dir, err := ioutil.TempDir("", "sigma-build-")
+	if err != nil {
+		return "", nop, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	switch {
+	case src.Git != nil:
+		err = fetchGit(ctx, src.Git, dir)
+
+	case src.Artifact != "":
+		err = fetchArtifact(store, artifact.Digest(src.Artifact), dir)
+	}
+
+	if err != nil {
+		cleanup()
+		return "", nop, err
+	}
+
+	return dir, cleanup, nil
+}
+
+// scpURL matches scp-like git URLs ("user@host:path")
+var scpURL = regexp.MustCompile(`^[a-zA-Z0-9._-]+@[a-zA-Z0-9.-]+:[^-]`)
+
+// validGitURL returns true for URLs of remote repositories. Local paths
+// and other transports would give access to the controller's file system
+func validGitURL(s string) bool {
+	if scpURL.MatchString(s) {
+		return true
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https", "ssh", "git":
+		return true
+	default:
+		return false
+	}
+}
+
+// fetchGit clones the repository into dir. URL and ref are supplied by
+// the caller and must never be parsed as git options
+func fetchGit(ctx context.Context, src *GitSource, dir string) error {
+	if !validGitURL(src.URL) {
+		return errors.New("invalid git URL: " + src.URL)
+	}
+
+	if strings.HasPrefix(src.Ref, "-") {
+		return errors.New("invalid git ref: " + src.Ref)
+	}
+
+	if err := run(ctx, "git", "clone", "--", src.URL, dir); err != nil {
+		return err
+	}
+
+	if src.Ref == "" {
+		return nil
+	}
+
+	return run(ctx, "git", "-C", dir, "checkout", src.Ref, "--")
+}
+
+func fetchArtifact(store artifact.Store, d artifact.Digest, dir string) error {
+	if store == nil {
+		return errors.New("artifact store not configured")
+	}
+
+	rc, desc, err := store.Get(d)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if desc.Kind != artifact.KindArchive {
+		return errors.New("artifact is not an archive")
+	}
+
+	return extract(rc, dir, MaxExtractSize)
+}
+
+// extractor extracts archive entries into dir. At most remaining bytes
+// are written
+type extractor struct {
+	dir       string
+	remaining int64
+}
+
+// extract extracts a zip, tar or gzip compressed tar archive into dir. It
+// fails with ErrArchiveTooLarge once more than max bytes would be written
+func extract(r io.Reader, dir string, max int64) error {
+	e := &extractor{dir: dir, remaining: max}
+
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		// zip archives need random access. Stored entries are not
+		// compressed so the archive is limited as well
+		blob, err := ioutil.ReadAll(io.LimitReader(br, max+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(blob)) > max {
+			return ErrArchiveTooLarge
+		}
+		return e.extractZip(blob)
+
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return e.extractTar(gz)
+
+	default:
+		return e.extractTar(br)
+	}
+}
+
+func (e *extractor) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(e.dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := e.writeFile(target, tr, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		default:
+			// links and special files are not supported
+		}
+	}
+}
+
+func (e *extractor) extractZip(blob []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		target, err := safeJoin(e.dir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		err = e.writeFile(target, rc, f.Mode())
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFile writes the content of r to path. The number of bytes written
+// is deducted from the remaining bytes of e
+func (e *extractor) writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(f, io.LimitReader(r, e.remaining+1))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if n > e.remaining {
+		f.Close()
+		return ErrArchiveTooLarge
+	}
+	e.remaining -= n
+
+	return f.Close()
+}
+
+// safeJoin joins dir and name and makes sure the result does not escape dir
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+
+	if !within(dir, target) {
+		return "", errors.New("path escapes target directory: " + name)
+	}
+
+	return target, nil
+}
+
+// within returns true if path is dir or located below dir
+func within(dir, path string) bool {
+	dir = filepath.Clean(dir)
+
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
@@ -0,0 +1,150 @@
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tarArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, blob []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(blob)
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestFetch_InvalidSource(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, src := range []Source{
+		{},
+		{Git: &GitSource{URL: "https://example.com/fn.git"}, Artifact: "sha256:abc"},
+	} {
+		_, cleanup, err := fetch(context.Background(), src, nil)
+		cleanup()
+		assert.Equal(ErrInvalidSource, err)
+	}
+}
+
+func TestFetchGit_InvalidArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, src := range []GitSource{
+		{URL: "--upload-pack=touch /tmp/pwned"},
+		{URL: "/srv/repositories/fn.git"},
+		{URL: "file:///srv/repositories/fn.git"},
+		{URL: "ext::sh -c touch% /tmp/pwned"},
+		{URL: "git@example.com:-fn.git"},
+		{URL: "https://example.com/fn.git", Ref: "--orphan"},
+	} {
+		assert.Error(fetchGit(context.Background(), &src, ""), src.URL+" "+src.Ref)
+	}
+
+	for _, u := range []string{
+		"https://example.com/fn.git",
+		"ssh://git@example.com/fn.git",
+		"git@example.com:org/fn.git",
+	} {
+		assert.True(validGitURL(u), u)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	assert := assert.New(t)
+
+	files := map[string]string{
+		"Dockerfile":   "FROM scratch",
+		"src/index.js": "module.exports = {}",
+	}
+
+	for name, blob := range map[string][]byte{
+		"tar":    tarArchive(t, files),
+		"tar.gz": gzipped(t, tarArchive(t, files)),
+		"zip":    zipArchive(t, files),
+	} {
+		dir, err := ioutil.TempDir("", "sigma-build-")
+		if !assert.NoError(err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		if !assert.NoError(extract(bytes.NewReader(blob), dir, MaxExtractSize), name) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, "src", "index.js"))
+		assert.NoError(err, name)
+		assert.Equal("module.exports = {}", string(content), name)
+
+		// the extracted size is limited
+		assert.Equal(ErrArchiveTooLarge, extract(bytes.NewReader(blob), dir, 16), name)
+	}
+
+	// entries must not escape the target directory
+	for name, blob := range map[string][]byte{
+		"tar": tarArchive(t, map[string]string{"../escape": "x"}),
+		"zip": zipArchive(t, map[string]string{"../escape": "x"}),
+	} {
+		dir, err := ioutil.TempDir("", "sigma-build-")
+		if !assert.NoError(err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		assert.Error(extract(bytes.NewReader(blob), filepath.Join(dir, "src"), MaxExtractSize), name)
+
+		_, err = os.Stat(filepath.Join(dir, "escape"))
+		assert.True(os.IsNotExist(err), name)
+	}
+}
@@ -0,0 +1,210 @@
+// Package capture records sampled invocations of functions for debugging
+package capture
+
+import (
+	"encoding/json"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homebot/sigma"
+)
+
+const (
+	// DefaultMaxPayloadSize is the default size captured payloads are
+	// truncated to
+	DefaultMaxPayloadSize = 64 * 1024
+
+	// DefaultMaxRecords is the default number of records kept
+	DefaultMaxRecords = 100
+
+	// Redacted replaces redacted values
+	Redacted = "[REDACTED]"
+)
+
+// Record is a captured invocation
+type Record struct {
+	// ID is the ID of the invocation
+	ID string `json:"id"`
+
+	// Node is the node that handled the invocation
+	Node string `json:"node,omitempty"`
+
+	// Time is the time the invocation started
+	Time time.Time `json:"time"`
+
+	// Duration is the duration of the invocation
+	Duration time.Duration `json:"duration"`
+
+	// Metadata holds the invocation metadata
+	Metadata sigma.Metadata `json:"metadata,omitempty"`
+
+	// Request holds the event payload
+	Request []byte `json:"request,omitempty"`
+
+	// Response holds the result of the invocation
+	Response []byte `json:"response,omitempty"`
+
+	// Error holds the error of failed invocations
+	Error string `json:"error,omitempty"`
+
+	// Truncated is true if the request or the response have been
+	// truncated
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Recorder samples invocations and keeps the most recent records. A nil
+// Recorder does not sample any invocation
+type Recorder struct {
+	rate     float64
+	maxSize  int
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+
+	mu      sync.Mutex
+	records []Record
+	next    int
+	full    bool
+}
+
+// New returns a new Recorder for the configuration. It returns nil if
+// capturing is disabled
+func New(c *sigma.DebugCapture) (*Recorder, error) {
+	if c == nil || c.SampleRate <= 0 {
+		return nil, nil
+	}
+
+	r := &Recorder{
+		rate:    c.SampleRate / 100,
+		maxSize: c.MaxPayloadSize,
+		keys:    make(map[string]bool),
+	}
+
+	if r.maxSize <= 0 {
+		r.maxSize = DefaultMaxPayloadSize
+	}
+
+	max := c.MaxRecords
+	if max <= 0 {
+		max = DefaultMaxRecords
+	}
+	r.records = make([]Record, max)
+
+	for _, k := range c.RedactKeys {
+		r.keys[strings.ToLower(k)] = true
+	}
+
+	for _, p := range c.RedactPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// Sample returns true if the next invocation should be captured
+func (r *Recorder) Sample() bool {
+	if r == nil {
+		return false
+	}
+
+	return rand.Float64() < r.rate
+}
+
+// Record stores the record after redacting and truncating the request
+// and the response
+func (r *Recorder) Record(rec Record) {
+	if r == nil {
+		return
+	}
+
+	var truncReq, truncResp bool
+	rec.Request, truncReq = r.prepare(rec.Request)
+	rec.Response, truncResp = r.prepare(rec.Response)
+	rec.Truncated = truncReq || truncResp
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Records returns all records, oldest first
+func (r *Recorder) Records() []Record {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]Record(nil), r.records[:r.next]...)
+	}
+
+	return append(append([]Record(nil), r.records[r.next:]...), r.records[:r.next]...)
+}
+
+func (r *Recorder) prepare(payload []byte) ([]byte, bool) {
+	if len(payload) == 0 {
+		return nil, false
+	}
+
+	payload = r.redact(payload)
+
+	if len(payload) > r.maxSize {
+		return payload[:r.maxSize], true
+	}
+
+	return payload, false
+}
+
+// redact returns a redacted copy of the payload. Values of redacted keys
+// are replaced if the payload is JSON encoded, patterns are applied to
+// the (re-encoded) payload
+func (r *Recorder) redact(payload []byte) []byte {
+	res := append([]byte(nil), payload...)
+
+	if len(r.keys) > 0 {
+		var v interface{}
+		if err := json.Unmarshal(res, &v); err == nil {
+			if blob, err := json.Marshal(r.redactValue(v)); err == nil {
+				res = blob
+			}
+		}
+	}
+
+	for _, re := range r.patterns {
+		res = re.ReplaceAll(res, []byte(Redacted))
+	}
+
+	return res
+}
+
+func (r *Recorder) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if r.keys[strings.ToLower(k)] {
+				val[k] = Redacted
+			} else {
+				val[k] = r.redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactValue(child)
+		}
+	}
+
+	return v
+}
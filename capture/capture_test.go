@@ -0,0 +1,45 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	r, err := New(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+	assert.False(t, r.Sample())
+	assert.Nil(t, r.Records())
+
+	r, err = New(&sigma.DebugCapture{
+		SampleRate:     100,
+		MaxPayloadSize: 40,
+		MaxRecords:     2,
+		RedactKeys:     []string{"password"},
+		RedactPatterns: []string{`\d{4}-\d{4}`},
+	})
+	assert.NoError(t, err)
+	assert.True(t, r.Sample())
+
+	r.Record(Record{ID: "1", Request: []byte(`{"user":"a","Password":"secret"}`)})
+	r.Record(Record{ID: "2", Request: []byte(`card 1234-5678`)})
+	r.Record(Record{ID: "3", Response: []byte(`{"data":"` + string(make([]byte, 64)) + `"}`)})
+
+	records := r.Records()
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "2", records[0].ID)
+		assert.Equal(t, "card [REDACTED]", string(records[0].Request))
+		assert.False(t, records[0].Truncated)
+
+		assert.Equal(t, "3", records[1].ID)
+		assert.Len(t, records[1].Response, 40)
+		assert.True(t, records[1].Truncated)
+	}
+
+	r, _ = New(&sigma.DebugCapture{SampleRate: 100, RedactKeys: []string{"password"}})
+	r.Record(Record{Request: []byte(`{"users":[{"password":"secret"}]}`)})
+	assert.Equal(t, `{"users":[{"password":"[REDACTED]"}]}`, string(r.Records()[0].Request))
+}
@@ -0,0 +1,53 @@
+package capture
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Source returns the captured invocations of a function
+type Source func(ctx context.Context, function string) ([]Record, error)
+
+// Handler serves captured invocations via HTTP:
+//
+//	GET /captures/<function>   list captured invocations of a function
+type Handler struct {
+	source Source
+}
+
+// NewHandler returns a new HTTP handler serving records of source
+func NewHandler(source Source) *Handler {
+	return &Handler{
+		source: source,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fn := strings.Trim(strings.TrimPrefix(r.URL.Path, "/captures"), "/")
+	if fn == "" {
+		http.Error(w, "missing function", http.StatusBadRequest)
+		return
+	}
+
+	records, err := h.source(r.Context(), fn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if records == nil {
+		records = []Record{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 
 	"google.golang.org/grpc/metadata"
 
@@ -15,7 +17,11 @@ import (
 
 	"github.com/homebot/core/utils"
 	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
 	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/rpc"
+	"github.com/homebot/sigma/signature"
 )
 
 var binary = flag.String("binary", "", "The binary to execute")
@@ -73,7 +79,12 @@ func main() {
 	}
 	go io.Copy(os.Stderr, stderr)
 
-	conn, err := grpc.Dial(c.Address, grpc.WithInsecure())
+	if c.Transport != "" && c.Transport != sigma.TransportGRPC {
+		os.Stderr.Write([]byte(fmt.Sprintf("unsupported transport %q", c.Transport)))
+		return
+	}
+
+	conn, err := grpc.Dial(c.Address, grpc.WithInsecure(), rpc.Dialer())
 	if err != nil {
 		os.Stderr.Write([]byte(err.Error()))
 		return
@@ -82,7 +93,18 @@ func main() {
 
 	cli := sigmaV1.NewNodeHandlerClient(conn)
 
-	md := metadata.Pairs("node-urn", c.URN, "node-secret", c.Secret)
+	// the wrapped binary has no debugger
+	md := metadata.Pairs(
+		"node-urn", c.URN,
+		node.ProtocolHeader, strconv.Itoa(node.ProtocolVersion),
+		node.FeaturesHeader, strings.Join([]string{string(node.FeatureLifecycle), string(node.FeatureReadiness)}, ","),
+	)
+
+	// nodes connected via unix domain sockets authenticate using their
+	// peer credentials
+	if !strings.HasPrefix(c.Address, rpc.UnixScheme) {
+		md.Set("node-secret", c.Secret)
+	}
 	callCtx := metadata.NewOutgoingContext(ctx, md)
 
 	res, err := cli.Register(callCtx, &sigmaV1.NodeRegistrationRequest{
@@ -94,6 +116,11 @@ func main() {
 		return
 	}
 
+	if c.Digest != "" && signature.Digest(res.GetContent()) != c.Digest {
+		os.Stderr.Write([]byte("function content does not match expected digest"))
+		return
+	}
+
 	if err := cmd.Start(); err != nil {
 		os.Stderr.Write([]byte(err.Error()))
 		return
@@ -119,6 +146,15 @@ func main() {
 		return
 	}
 
+	// the binary has been started and initialized
+	if err := stream.Send(&sigmaV1.ExecutionResult{
+		Id:              node.ReadyID,
+		ExecutionResult: &sigmaV1.ExecutionResult_Result{},
+	}); err != nil {
+		os.Stderr.Write([]byte(err.Error()))
+		return
+	}
+
 	go func() {
 		defer cancel()
 		for {
@@ -127,6 +163,11 @@ func main() {
 				return
 			}
 
+			// control events do not expect a result
+			if msg.GetId() == "" {
+				continue
+			}
+
 			if err := stream.Send(&sigmaV1.ExecutionResult{
 				Id: msg.GetId(),
 				ExecutionResult: &sigmaV1.ExecutionResult_Result{
@@ -0,0 +1,119 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/homebot/sigma/agent"
+	"github.com/homebot/sigma/cmd/sigma/config"
+	"github.com/spf13/cobra"
+)
+
+var agentConfigPath string
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start a sigma host agent",
+	Long: `Starts a sigma host agent that registers at a sigma controller and
+launches function nodes on this host using the locally configured launchers.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(agentConfigPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var c *config.Config
+
+		if strings.HasSuffix(agentConfigPath, "yaml") {
+			c, err = config.ReadYAML(f)
+		} else if strings.HasSuffix(agentConfigPath, "json") {
+			c, err = config.ReadJSON(f)
+		} else {
+			log.Fatal("unknown configuration file format. Expected JSON or YAML")
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if c.Agent == nil {
+			log.Fatal("missing agent configuration")
+		}
+
+		// an agent always launches nodes on the local host
+		c.Launchers.Agents = nil
+		c.ApplyRuntimes()
+
+		if err := c.Valid(); err != nil {
+			log.Fatal(err)
+		}
+
+		launcher := getLauncher(*c)
+		if launcher == nil {
+			log.Fatal("Invalid or no launcher configured")
+		}
+
+		tlsConfig, err := c.Agent.TLS.Load()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		advertise := c.Agent.AdvertiseAddress
+		if advertise == "" {
+			advertise = c.Agent.Listen
+		}
+
+		a, err := agent.New(agent.Config{
+			ID:         c.Agent.ID,
+			Advertise:  advertise,
+			Controller: c.Agent.Controller,
+			Capacity: agent.Capacity{
+				Slots: c.Agent.Slots,
+				Types: c.Launchers.Types(),
+			},
+			TLS: tlsConfig,
+		}, launcher)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		lis, err := net.Listen("tcp", c.Agent.Listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("sigma agent %s running on %s\n", a.ID(), lis.Addr())
+
+		go func() {
+			if err := a.Serve(lis); err != nil {
+				log.Fatal(err)
+			}
+		}()
+
+		if err := a.Run(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().StringVarP(&agentConfigPath, "cfg", "c", "./sigma.yaml", "Path to Sigma agent configuration file")
+}
@@ -0,0 +1,106 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/homebot/sigma/artifact"
+	"github.com/spf13/cobra"
+)
+
+var (
+	artifactServerAddress string
+	artifactImageRef      string
+)
+
+// artifactCmd represents the artifact command
+var artifactCmd = &cobra.Command{
+	Use:   "artifact",
+	Short: "Manage function artifacts",
+}
+
+// artifactPushCmd represents the artifact push command
+var artifactPushCmd = &cobra.Command{
+	Use:   "push [bundle]",
+	Short: "Upload a zip/tar bundle or an OCI image reference to the artifact store",
+	Run: func(cmd *cobra.Command, args []string) {
+		target := strings.TrimRight(artifactServerAddress, "/") + "/artifacts"
+
+		var (
+			res *http.Response
+			err error
+		)
+
+		if artifactImageRef != "" {
+			res, err = adminClient.Post(target+"?ref="+url.QueryEscape(artifactImageRef), "text/plain", nil)
+		} else {
+			if len(args) != 1 {
+				log.Fatal("expected one argument: path to bundle")
+			}
+
+			f, ferr := os.Open(args[0])
+			if ferr != nil {
+				log.Fatal(ferr)
+			}
+			defer f.Close()
+
+			res, err = adminClient.Post(target, bundleMediaType(args[0]), f)
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusCreated {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to upload artifact: %s: %s", res.Status, string(msg))
+		}
+
+		var desc artifact.Descriptor
+		if err := json.NewDecoder(res.Body).Decode(&desc); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Artifact uploaded successfully\nDigest: %s\n", desc.Digest)
+	},
+}
+
+func bundleMediaType(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return artifact.MediaTypeZip
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return artifact.MediaTypeTarGz
+	default:
+		return artifact.MediaTypeTar
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(artifactCmd)
+	artifactCmd.AddCommand(artifactPushCmd)
+
+	artifactCmd.PersistentFlags().StringVarP(&artifactServerAddress, "artifacts", "a", "http://localhost:50053", "The address of the sigma artifact store")
+	artifactPushCmd.Flags().StringVar(&artifactImageRef, "ref", "", "Store a reference to an OCI image instead of uploading a bundle")
+}
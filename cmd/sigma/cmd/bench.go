@@ -0,0 +1,70 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/homebot/sigma/bench"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchNodes       int
+	benchInvokers    int
+	benchRequests    int
+	benchDuration    time.Duration
+	benchPayloadSize int
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Run a dispatch benchmark against in-process fake nodes",
+	Long: `Starts an in-process node handler with N fake nodes and dispatches
+events from M concurrent invokers. Reports dispatch throughput, p50/p99
+latency and allocation rates.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		res, err := bench.Run(context.Background(), bench.Config{
+			Nodes:       benchNodes,
+			Invokers:    benchInvokers,
+			Requests:    benchRequests,
+			Duration:    benchDuration,
+			PayloadSize: benchPayloadSize,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Requests:    %d (%d errors)\n", res.Requests, res.Errors)
+		fmt.Printf("Elapsed:     %s\n", res.Elapsed)
+		fmt.Printf("Throughput:  %.0f req/s\n", res.Throughput)
+		fmt.Printf("Latency p50: %s\n", res.P50)
+		fmt.Printf("Latency p99: %s\n", res.P99)
+		fmt.Printf("Allocs/op:   %d (%d bytes)\n", res.AllocsPerOp, res.BytesPerOp)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().IntVarP(&benchNodes, "nodes", "n", 10, "Number of fake nodes")
+	benchCmd.Flags().IntVarP(&benchInvokers, "invokers", "c", 10, "Number of concurrent invokers")
+	benchCmd.Flags().IntVarP(&benchRequests, "requests", "r", 0, "Total number of requests. Overrides --duration")
+	benchCmd.Flags().DurationVarP(&benchDuration, "duration", "d", 10*time.Second, "Duration of the benchmark")
+	benchCmd.Flags().IntVarP(&benchPayloadSize, "payload-size", "s", 128, "Size of the event payload in bytes")
+}
@@ -0,0 +1,160 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/homebot/sigma/capture"
+	"github.com/homebot/sigma/function"
+	"github.com/spf13/cobra"
+)
+
+var (
+	debugServerAddress string
+	debugCapturesJSON  bool
+	debugAttachTimeout time.Duration
+)
+
+// debugCmd represents the debug command
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Inspect captured invocations of functions",
+}
+
+// debugCapturesCmd represents the debug captures command
+var debugCapturesCmd = &cobra.Command{
+	Use:   "captures [function]",
+	Short: "List captured invocations of a function",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: function")
+		}
+
+		res, err := adminClient.Get(strings.TrimRight(debugServerAddress, "/") + "/captures/" + args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to get captures: %s: %s", res.Status, string(msg))
+		}
+
+		var records []capture.Record
+		if err := json.NewDecoder(res.Body).Decode(&records); err != nil {
+			log.Fatal(err)
+		}
+
+		if debugCapturesJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(records)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tID\tDURATION\tNODE\tERROR")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Time.Format("2006-01-02 15:04:05"), r.ID, r.Duration, r.Node, r.Error)
+		}
+		w.Flush()
+	},
+}
+
+// debugAttachCmd represents the debug attach command
+var debugAttachCmd = &cobra.Command{
+	Use:   "attach [function] [node]",
+	Short: "Put a node into debug mode and print the address of its debugger",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			log.Fatal("expected two arguments: function and node")
+		}
+
+		target := debugSessionsURL(args[0], args[1]) + "&timeout=" + url.QueryEscape(debugAttachTimeout.String())
+
+		res, err := adminClient.Post(target, "text/plain", nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusCreated {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to attach: %s: %s", res.Status, string(msg))
+		}
+
+		var session function.DebugSession
+		if err := json.NewDecoder(res.Body).Decode(&session); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Debugger attached\nAddress: %s\nExpires: %s\n", session.Address, session.Expires.Format(time.RFC3339))
+	},
+}
+
+// debugDetachCmd represents the debug detach command
+var debugDetachCmd = &cobra.Command{
+	Use:   "detach [function] [node]",
+	Short: "End the debug session of a node and put it back into the pool",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			log.Fatal("expected two arguments: function and node")
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, debugSessionsURL(args[0], args[1]), nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		res, err := adminClient.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to detach: %s: %s", res.Status, string(msg))
+		}
+
+		fmt.Println("Debugger detached")
+	},
+}
+
+func debugSessionsURL(fn, node string) string {
+	return strings.TrimRight(debugServerAddress, "/") + "/sessions/" + fn + "?node=" + url.QueryEscape(node)
+}
+
+func init() {
+	RootCmd.AddCommand(debugCmd)
+	debugCmd.AddCommand(debugCapturesCmd)
+	debugCmd.AddCommand(debugAttachCmd)
+	debugCmd.AddCommand(debugDetachCmd)
+
+	debugCmd.PersistentFlags().StringVarP(&debugServerAddress, "debug", "d", "http://localhost:50055", "The address of the sigma debug API")
+	debugCapturesCmd.Flags().BoolVar(&debugCapturesJSON, "json", false, "Print full records including payloads as JSON")
+	debugAttachCmd.Flags().DurationVar(&debugAttachTimeout, "timeout", function.DefaultDebugSessionTimeout, "Duration after which the node is put back into the pool")
+}
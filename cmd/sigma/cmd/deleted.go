@@ -0,0 +1,131 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/homebot/sigma/scheduler"
+	"github.com/spf13/cobra"
+)
+
+var deletedServerAddress string
+
+// deletedCmd represents the deleted command
+var deletedCmd = &cobra.Command{
+	Use:   "deleted",
+	Short: "List destroyed functions that can still be restored",
+	Run: func(cmd *cobra.Command, args []string) {
+		res, err := adminClient.Get(deletedURL(""))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to list deleted functions: %s: %s", res.Status, string(msg))
+		}
+
+		var functions []scheduler.DeletedFunction
+		if err := json.NewDecoder(res.Body).Decode(&functions); err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTYPE\tDELETED\tEXPIRES")
+		for _, f := range functions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Spec.ID, f.Spec.Type, f.Deleted.Format(time.RFC3339), f.Expires.Format(time.RFC3339))
+		}
+		w.Flush()
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [function]",
+	Short: "Restore a destroyed function within its retention window",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: function")
+		}
+
+		res, err := adminClient.Post(deletedURL(args[0]), "text/plain", nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to restore: %s: %s", res.Status, string(msg))
+		}
+
+		log.Printf("Function %s restored", args[0])
+	},
+}
+
+// purgeCmd represents the purge command
+var purgeCmd = &cobra.Command{
+	Use:   "purge [function]",
+	Short: "Purge a destroyed function before its retention window expires",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: function")
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, deletedURL(args[0]), nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		res, err := adminClient.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to purge: %s: %s", res.Status, string(msg))
+		}
+
+		log.Printf("Function %s purged", args[0])
+	},
+}
+
+func deletedURL(fn string) string {
+	u := strings.TrimRight(deletedServerAddress, "/") + "/deleted"
+	if fn != "" {
+		u += "/" + fn
+	}
+	return u
+}
+
+func init() {
+	RootCmd.AddCommand(deletedCmd)
+	deletedCmd.AddCommand(restoreCmd)
+	deletedCmd.AddCommand(purgeCmd)
+
+	deletedCmd.PersistentFlags().StringVarP(&deletedServerAddress, "deletion", "d", "http://localhost:50056", "The address of the sigma deletion API")
+}
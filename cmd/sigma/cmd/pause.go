@@ -0,0 +1,103 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	maintenanceServerAddress string
+	pauseReason              string
+	pauseBuffer              bool
+)
+
+// pauseCmd represents the pause command
+var pauseCmd = &cobra.Command{
+	Use:   "pause [function]",
+	Short: "Pause a function: triggers stop dispatching and nodes are drained",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: function")
+		}
+
+		target := pauseURL(args[0]) + "?reason=" + url.QueryEscape(pauseReason) + "&buffer=" + strconv.FormatBool(pauseBuffer)
+
+		res, err := adminClient.Post(target, "text/plain", nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to pause: %s: %s", res.Status, string(msg))
+		}
+
+		log.Printf("Function %s paused", args[0])
+	},
+}
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume [function]",
+	Short: "Resume a paused function",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: function")
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, pauseURL(args[0]), nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		res, err := adminClient.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to resume: %s: %s", res.Status, string(msg))
+		}
+
+		log.Printf("Function %s resumed", args[0])
+	},
+}
+
+func pauseURL(fn string) string {
+	return strings.TrimRight(maintenanceServerAddress, "/") + "/pause/" + fn
+}
+
+func init() {
+	RootCmd.AddCommand(pauseCmd)
+	RootCmd.AddCommand(resumeCmd)
+
+	for _, c := range []*cobra.Command{pauseCmd, resumeCmd} {
+		c.Flags().StringVarP(&maintenanceServerAddress, "maintenance", "m", "http://localhost:50057", "The address of the sigma maintenance API")
+	}
+
+	pauseCmd.Flags().StringVar(&pauseReason, "reason", "", "Reason for pausing the function")
+	pauseCmd.Flags().BoolVar(&pauseBuffer, "buffer", false, "Buffer trigger events while paused")
+}
@@ -0,0 +1,151 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/homebot/sigma/scheduler"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planServerAddress string
+	planApply         bool
+	planJSON          bool
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [function]",
+	Short: "Show the changes submitting a function spec would make",
+	Long: `Diffs the function spec against the deployed function and shows the
+changed fields, whether nodes are restarted and which triggers change.
+The spec is only applied if --apply is set. Functions are identified
+by their full ID as listed by "sigma list", use --name to set it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: function-name")
+		}
+
+		spec, err := loadFunctionSpec(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		body, err := json.Marshal(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		target := strings.TrimRight(planServerAddress, "/") + "/plan?dryRun=" + strconv.FormatBool(!planApply)
+
+		res, err := adminClient.Post(target, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to plan: %s: %s", res.Status, string(msg))
+		}
+
+		var p scheduler.Plan
+		if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+			log.Fatal(err)
+		}
+
+		if planJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(p)
+			return
+		}
+
+		printPlan(p)
+	},
+}
+
+func printPlan(p scheduler.Plan) {
+	switch {
+	case p.Create:
+		fmt.Printf("Function %s will be created\n", p.Function)
+	case p.Empty():
+		fmt.Printf("Function %s is up to date\n", p.Function)
+		return
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FIELD\tEFFECT\tOLD\tNEW")
+		for _, c := range p.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Field, c.Effect, abbreviate(c.Old), abbreviate(c.New))
+		}
+		w.Flush()
+
+		for _, t := range p.Triggers {
+			fmt.Printf("trigger %s: %s\n", t.Type, t.Action)
+		}
+
+		if p.Restart {
+			fmt.Println("Nodes will be replaced using a rolling update")
+		}
+
+		if p.Recreate {
+			fmt.Println("Some changes require the function to be destroyed and created again, the plan cannot be applied")
+		}
+	}
+
+	if p.Applied {
+		fmt.Println("Plan applied")
+	} else {
+		fmt.Println("Dry run, use --apply to apply the plan")
+	}
+}
+
+// abbreviate shortens JSON values for display
+func abbreviate(v json.RawMessage) string {
+	if len(v) == 0 {
+		return "-"
+	}
+
+	s := string(v)
+	if len(s) > 40 {
+		s = s[:37] + "..."
+	}
+	return s
+}
+
+func init() {
+	RootCmd.AddCommand(planCmd)
+
+	planCmd.Flags().StringVarP(&planServerAddress, "plan", "p", "http://localhost:50058", "The address of the sigma plan API")
+	planCmd.Flags().BoolVar(&planApply, "apply", false, "Apply the plan")
+	planCmd.Flags().BoolVar(&planJSON, "json", false, "Print the plan as JSON")
+	planCmd.Flags().StringSliceVarP(&intParams, "param-int", "i", nil, "Additional parameters in format key=value")
+	planCmd.Flags().StringSliceVarP(&stringParams, "param-str", "s", nil, "Additional parameters in format key=value")
+	planCmd.Flags().StringSliceVarP(&boolParams, "param-bool", "b", nil, "Additional parameters in format key=value")
+	planCmd.Flags().StringVarP(&idOverride, "name", "n", "", "Name for the function to plan. Overrides values from the spec")
+	planCmd.Flags().StringVar(&signKeyPath, "sign-key", "", "Path to a base64 encoded Ed25519 private key used to sign the function")
+	planCmd.Flags().StringVar(&signKeyID, "sign-key-id", "", "ID of the signing key as configured at the server")
+}
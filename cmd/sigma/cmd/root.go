@@ -27,6 +27,7 @@ var cfgFile string
 var (
 	sigmaServerAddress string
 	idamTokenFile      string
+	adminTokenFile     string
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -51,6 +52,7 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.sigma.yaml)")
 	RootCmd.PersistentFlags().StringVarP(&sigmaServerAddress, "server", "S", "localhost:50051", "The address of the sigma server")
 	RootCmd.PersistentFlags().StringVarP(&idamTokenFile, "jwt", "j", "", "Path to IDAM JWT file for authentication")
+	RootCmd.PersistentFlags().StringVar(&adminTokenFile, "admin-token", "", "Path to the token file of the sigma admin APIs")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -14,23 +14,50 @@
 package cmd
 
 import (
+	"context"
+	"crypto/ed25519"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/homebot/idam/policy"
 	"github.com/homebot/insight/logger"
-	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/admin"
+	"github.com/homebot/sigma/agent"
+	"github.com/homebot/sigma/alert"
+	"github.com/homebot/sigma/artifact"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/bootstrap"
+	"github.com/homebot/sigma/build"
+	"github.com/homebot/sigma/capture"
 	"github.com/homebot/sigma/cmd/sigma/config"
+	"github.com/homebot/sigma/debug"
+	"github.com/homebot/sigma/deleted"
+	"github.com/homebot/sigma/federation"
 	"github.com/homebot/sigma/launcher"
 	"github.com/homebot/sigma/launcher/docker"
 	"github.com/homebot/sigma/launcher/process"
+	"github.com/homebot/sigma/maintenance"
+	"github.com/homebot/sigma/metrics"
 	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/parameters"
+	"github.com/homebot/sigma/plan"
+	"github.com/homebot/sigma/proxy"
+	"github.com/homebot/sigma/rpc"
+	"github.com/homebot/sigma/runtimes"
 	"github.com/homebot/sigma/scheduler"
 	"github.com/homebot/sigma/server"
+	"github.com/homebot/sigma/signature"
+	"github.com/homebot/sigma/snapshot"
+	"github.com/homebot/sigma/state"
 	"github.com/spf13/cobra"
 )
 
@@ -68,40 +95,176 @@ var serverCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		c.ApplyRuntimes()
+
 		if err := c.Valid(); err != nil {
 			log.Fatal(err)
 		}
 
+		var adminToken string
+		if c.AdminAPIs() {
+			adminToken, err = c.Admin.Token()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		launcher := getLauncher(*c)
 		if launcher == nil {
 			log.Fatal("Invalid or no launcher configured")
 		}
 
-		nodeServer := node.NewNodeServer()
-		deployer := node.NewDeployer(nodeServer, launcher, c.Nodes.Listen)
-		scheduler, err := scheduler.NewScheduler(deployer)
-		if err != nil {
-			log.Fatal(err)
+		cfg := bootstrap.Config{
+			Launcher:   launcher,
+			APIListen:  c.Server.Listen,
+			NodeListen: c.Nodes.Listen,
+			// nodes launched on remote hosts cannot reach the node
+			// server on a loopback listen address so prefer the
+			// advertise address
+			NodeAdvertise: c.Nodes.AdvertiseAddress,
+			NodeSocket:    c.Nodes.Socket,
 		}
-		server, err := server.NewServer(scheduler)
-		if err != nil {
-			log.Fatal(err)
+
+		if c.Nodes.SendTimeout != "" {
+			d, err := time.ParseDuration(c.Nodes.SendTimeout)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			cfg.NodeServerOptions = append(cfg.NodeServerOptions, node.WithSendTimeout(d))
 		}
 
-		grpcNodeListener, err := net.Listen("tcp", c.Nodes.Listen)
-		if err != nil {
-			log.Fatal(err)
+		if c.Nodes.ReconcileInterval != "" {
+			cfg.ReconcileInterval, err = time.ParseDuration(c.Nodes.ReconcileInterval)
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
-		log.Printf("node handler server running on %s\n", grpcNodeListener.Addr())
 
-		grpcServerListener, err := net.Listen("tcp", c.Server.Listen)
-		if err != nil {
-			log.Fatal(err)
+		if c.Nodes.GRPC != nil {
+			opts, err := c.Nodes.GRPC.Options()
+			if err != nil {
+				log.Fatal(err)
+			}
+			cfg.NodeGRPCOptions = opts.ServerOptions()
+		}
+
+		if c.Artifacts != nil {
+			cfg.ArtifactDir = c.Artifacts.Dir
+		}
+
+		if len(c.Runtimes) > 0 {
+			registry, err := runtimes.NewRegistry(c.Runtimes...)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			cfg.NodeServerOptions = append(cfg.NodeServerOptions, node.WithRuntimeRegistry(registry))
+			cfg.DeployerOptions = append(cfg.DeployerOptions, node.WithDeployerRuntimeRegistry(registry))
+		}
+
+		if c.Signatures != nil {
+			keys := make(map[string]ed25519.PublicKey)
+			for id, k := range c.Signatures.TrustedKeys {
+				key, err := signature.ParsePublicKey(k)
+				if err != nil {
+					log.Fatalf("trusted key %s: %s", id, err)
+				}
+				keys[id] = key
+			}
+
+			verifier := signature.NewVerifier(keys)
+
+			cfg.DeployerOptions = append(cfg.DeployerOptions, node.WithSignatureVerifier(verifier))
+			cfg.SchedulerOptions = append(cfg.SchedulerOptions, scheduler.WithSignatureVerifier(verifier))
+		}
+
+		if c.Secrets != nil {
+			cfg.NodeServerOptions = append(cfg.NodeServerOptions, node.WithSecretResolver(parameters.DirResolver(c.Secrets.Dir)))
+		}
+
+		if c.Nodes.WebSocket != nil {
+			cfg.WebSocketListen = c.Nodes.WebSocket.Listen
+			cfg.WebSocketAdvertise = c.Nodes.WebSocket.AdvertiseURL
+		}
+
+		if c.State != nil {
+			addr := c.State.Advertise
+			if addr == "" {
+				addr = c.State.Listen
+			}
+
+			cfg.DeployerOptions = append(cfg.DeployerOptions, node.WithStateAddress(addr))
+		}
+
+		if c.Debug != nil && c.Debug.Port > 0 {
+			cfg.DeployerOptions = append(cfg.DeployerOptions, node.WithDebugPort(c.Debug.Port))
+		}
+
+		if c.Proxy != nil {
+			addr := c.Proxy.Advertise
+			if addr == "" {
+				addr = c.Proxy.Listen
+			}
+
+			cfg.DeployerOptions = append(cfg.DeployerOptions, node.WithProxyAddress(addr))
+		}
+
+		var metricsSink metrics.Sink
+		if c.Metrics != nil {
+			metricsSink, err = c.Metrics.Sink()
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer metricsSink.Close()
+
+			metrics.SetSink(metricsSink)
+		}
+
+		if c.Quotas != nil {
+			quotas := c.Quotas.Manager()
+
+			cfg.NodeServerOptions = append(cfg.NodeServerOptions, node.WithQuotas(quotas))
+			cfg.SchedulerOptions = append(cfg.SchedulerOptions, scheduler.WithQuotas(quotas))
+		}
+
+		cfg.NodeServerOptions = append(cfg.NodeServerOptions, node.WithGauge(metrics.Gauge))
+
+		if c.EventBuffer != nil {
+			if err := os.MkdirAll(c.EventBuffer.Dir, 0700); err != nil {
+				log.Fatal(err)
+			}
+
+			cfg.SchedulerOptions = append(cfg.SchedulerOptions, scheduler.WithEventBufferDir(c.EventBuffer.Dir, c.EventBuffer.MaxEvents))
+		}
+
+		if c.Dispatch != nil {
+			cfg.SchedulerOptions = append(cfg.SchedulerOptions,
+				scheduler.WithDispatchConcurrency(c.Dispatch.MaxConcurrent),
+				scheduler.WithMaxChainDepth(c.Dispatch.MaxChainDepth),
+				scheduler.WithDeadLetter(c.Dispatch.DeadLetter),
+			)
 		}
-		log.Printf("sigma server running on %s\n", grpcServerListener.Addr())
 
-		grpcNodeServer := grpc.NewServer()
-		sigmaV1.RegisterNodeHandlerServer(grpcNodeServer, nodeServer)
+		if c.Deletion != nil {
+			retention, err := c.Deletion.RetentionPeriod()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			cfg.SchedulerOptions = append(cfg.SchedulerOptions, scheduler.WithRetention(retention))
+		}
+
+		var authorizer authz.Authorizer
+		if c.Authorization != nil {
+			p, err := c.Authorization.Policy()
+			if err != nil {
+				log.Fatal(err)
+			}
+			authorizer = p
+			cfg.ServerOptions = append(cfg.ServerOptions, server.WithAuthorizer(authorizer))
+			cfg.SchedulerOptions = append(cfg.SchedulerOptions, scheduler.WithAuthorizer(authorizer))
+		}
 
 		l, err := logger.NewInsightLogger(logger.WithServiceType("sigma"))
 		if err != nil {
@@ -114,25 +277,233 @@ var serverCmd = &cobra.Command{
 		}
 		p.SetLogger(l)
 
-		grpcSigmaServer := grpc.NewServer(p.ServerOptions()...)
-		sigmaV1.RegisterSigmaServer(grpcSigmaServer, server)
+		cfg.APIServerOptions = p.ServerOptions()
+
+		// local is the scheduler of this instance, the API serves the
+		// federated one if federation is enabled
+		var (
+			local scheduler.Scheduler
+			fed   *federation.Federation
+		)
+
+		cfg.WrapScheduler = func(s scheduler.Scheduler) (scheduler.Scheduler, error) {
+			local = s
 
-		ch := make(chan struct{})
+			if c.Federation == nil {
+				return s, nil
+			}
+
+			f, err := getFederation(*c.Federation, s, authorizer)
+			if err != nil {
+				return nil, err
+			}
+			fed = f
+
+			return f.Scheduler(), nil
+		}
+
+		d, err := bootstrap.New(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 		go func() {
-			defer close(ch)
-			if err := grpcNodeServer.Serve(grpcNodeListener); err != nil {
+			<-signals
+			cancel()
+		}()
+
+		scheduler := d.Scheduler()
+		nodeServer := d.NodeServer()
+
+		if c.Alerting != nil {
+			alerts, err := getAlertManager(*c.Alerting, local)
+			if err != nil {
 				log.Fatal(err)
 			}
-		}()
 
-		go func() {
-			defer close(ch)
-			if err := grpcSigmaServer.Serve(grpcServerListener); err != nil {
+			go alerts.Run(ctx)
+		}
+
+		if artifacts := d.Artifacts(); artifacts != nil {
+			go collectArtifacts(*c.Artifacts, artifacts, scheduler)
+
+			if c.Artifacts.Listen != "" {
+				handler := artifact.NewHandler(artifacts, artifact.WithMaxUploadSize(c.Artifacts.MaxUploadSize))
+
+				mux := http.NewServeMux()
+				mux.Handle("/artifacts", handler)
+				mux.Handle("/artifacts/", handler)
+
+				if c.Artifacts.Build {
+					pipeline, err := build.NewPipeline(artifacts, scheduler)
+					if err != nil {
+						log.Fatal(err)
+					}
+					mux.Handle("/build", build.NewHandler(pipeline))
+				}
+
+				log.Printf("artifact store running on %s\n", c.Artifacts.Listen)
+
+				d.Go("artifacts", func() error {
+					return serveAdmin(c.Artifacts.Listen, adminToken, mux)
+				})
+			}
+		}
+
+		if fed != nil {
+			fedListener, err := net.Listen("tcp", c.Federation.Listen)
+			if err != nil {
 				log.Fatal(err)
 			}
-		}()
+			log.Printf("federation service running on %s\n", fedListener.Addr())
+
+			go fed.Run(ctx)
+
+			d.Go("federation", func() error {
+				return fed.Serve(fedListener)
+			})
+		}
+
+		if c.State != nil {
+			store, err := state.NewFileStore(c.State.Dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			stateListener, err := net.Listen("tcp", c.State.Listen)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("state service running on %s\n", stateListener.Addr())
+
+			stateServer := state.NewServer(store, func(ctx context.Context) (string, error) {
+				spec, err := nodeServer.Authenticate(ctx)
+				return spec.ID, err
+			})
+
+			d.Go("state", func() error {
+				return stateServer.Serve(stateListener)
+			})
+		}
+
+		if c.Proxy != nil {
+			egress := proxy.New(func(urn, secret string) (*sigma.ProxyPolicy, error) {
+				ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("node-urn", urn, "node-secret", secret))
+
+				spec, err := nodeServer.Authenticate(ctx)
+				if err != nil {
+					return nil, proxy.ErrUnauthenticated
+				}
+				return spec.Proxy, nil
+			})
+
+			log.Printf("egress proxy running on %s\n", c.Proxy.Listen)
+
+			d.Go("proxy", func() error {
+				return http.ListenAndServe(c.Proxy.Listen, egress)
+			})
+		}
+
+		if c.Debug != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/captures/", capture.NewHandler(scheduler.Captures))
+			mux.Handle("/sessions/", debug.NewHandler(scheduler))
+
+			log.Printf("debug API running on %s\n", c.Debug.Listen)
+
+			d.Go("debug", func() error {
+				return serveAdmin(c.Debug.Listen, adminToken, mux)
+			})
+		}
+
+		if c.Snapshot != nil {
+			var secrets *snapshot.SecretStore
+			if c.Snapshot.Key != "" {
+				if c.Secrets == nil {
+					log.Fatal("snapshot: secrets not configured")
+				}
+
+				secrets, err = snapshot.NewSecretStore(c.Secrets.Dir, c.Snapshot.Key)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/snapshot", snapshot.NewHandler(scheduler, secrets))
+
+			log.Printf("snapshot API running on %s\n", c.Snapshot.Listen)
+
+			d.Go("snapshot", func() error {
+				return serveAdmin(c.Snapshot.Listen, adminToken, mux)
+			})
+		}
+
+		if c.Plan != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/plan", plan.NewHandler(scheduler))
+
+			log.Printf("plan API running on %s\n", c.Plan.Listen)
+
+			d.Go("plan", func() error {
+				return serveAdmin(c.Plan.Listen, adminToken, mux)
+			})
+		}
+
+		if c.Maintenance != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/pause/", maintenance.NewHandler(scheduler))
+
+			log.Printf("maintenance API running on %s\n", c.Maintenance.Listen)
+
+			d.Go("maintenance", func() error {
+				return serveAdmin(c.Maintenance.Listen, adminToken, mux)
+			})
+		}
+
+		if c.Deletion != nil && c.Deletion.Listen != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/deleted", deleted.NewHandler(scheduler))
+			mux.Handle("/deleted/", deleted.NewHandler(scheduler))
+
+			log.Printf("deletion API running on %s\n", c.Deletion.Listen)
+
+			d.Go("deletion", func() error {
+				return serveAdmin(c.Deletion.Listen, adminToken, mux)
+			})
+		}
+
+		if prom, ok := metricsSink.(*metrics.Prometheus); ok {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", prom)
+
+			log.Printf("prometheus metrics available at %s/metrics\n", c.Metrics.Address)
+
+			d.Go("metrics", func() error {
+				return http.ListenAndServe(c.Metrics.Address, mux)
+			})
+		}
+
+		if registry, ok := launcher.(*agent.Registry); ok {
+			agentListener, err := net.Listen("tcp", c.Launchers.Agents.Listen)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("agent registry running on %s\n", agentListener.Addr())
+
+			d.Go("agents", func() error {
+				return registry.Serve(agentListener)
+			})
+		}
 
-		<-ch
+		if err := d.Run(ctx); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -143,7 +514,161 @@ func init() {
 	serverCmd.Flags().BoolVar(&logEvents, "log-events", false, "Log events to stderr")
 }
 
+func collectArtifacts(c config.ArtifactsConfig, s artifact.Store, sched scheduler.Scheduler) {
+	interval := time.Hour
+	grace := 24 * time.Hour
+
+	if c.GCInterval != "" {
+		d, err := time.ParseDuration(c.GCInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		interval = d
+	}
+
+	if c.GCGrace != "" {
+		d, err := time.ParseDuration(c.GCGrace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grace = d
+	}
+
+	refs := func() ([]artifact.Digest, error) {
+		functions, err := sched.Functions(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		var res []artifact.Digest
+		for _, f := range functions {
+			if f.Spec.Artifact != "" {
+				res = append(res, artifact.Digest(f.Spec.Artifact))
+			}
+		}
+
+		// artifacts of deleted functions are kept until they are
+		// purged so the functions can be restored
+		removed, err := sched.Deleted(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range removed {
+			if f.Spec.Artifact != "" {
+				res = append(res, artifact.Digest(f.Spec.Artifact))
+			}
+		}
+
+		return res, nil
+	}
+
+	for {
+		<-time.After(interval)
+
+		deleted, err := artifact.Collect(s, refs, grace)
+		if err != nil {
+			log.Printf("failed to garbage collect artifacts: %s\n", err)
+		}
+
+		for _, d := range deleted {
+			log.Printf("garbage collected artifact %s\n", d)
+		}
+	}
+}
+
+func getFederation(c config.FederationConfig, s scheduler.Scheduler, a authz.Authorizer) (*federation.Federation, error) {
+	tlsConfig, err := c.TLS.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []federation.Option{
+		federation.WithSecret(c.Secret),
+		federation.WithTLS(tlsConfig),
+	}
+
+	if a != nil {
+		opts = append(opts, federation.WithAuthorizer(a))
+	}
+
+	if c.SyncInterval != "" {
+		d, err := time.ParseDuration(c.SyncInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, federation.WithSyncInterval(d))
+	}
+
+	if c.Region != "" {
+		opts = append(opts, federation.WithRegion(c.Region))
+	}
+
+	l, err := logger.NewInsightLogger(logger.WithServiceType("sigma-federation"))
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, federation.WithLogger(l))
+
+	return federation.New(c.Name, s, c.Peers, opts...)
+}
+
+func getAlertManager(c config.AlertingConfig, s scheduler.Scheduler) (*alert.Manager, error) {
+	rules, opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := logger.NewInsightLogger(logger.WithServiceType("sigma-alerting"))
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, alert.WithLogger(l))
+
+	source := alert.SourceFunc(func(ctx context.Context) ([]alert.Function, error) {
+		regs, err := s.Functions(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fns := make([]alert.Function, 0, len(regs))
+		for _, reg := range regs {
+			fn := alert.Function{
+				Name:       reg.Name.String(),
+				QueueDepth: reg.QueueDepth,
+			}
+
+			for _, n := range reg.Nodes {
+				if n.State == node.StateActive || n.State == node.StateRunning {
+					fn.ReadyNodes++
+				}
+			}
+
+			fns = append(fns, fn)
+		}
+
+		return fns, nil
+	})
+
+	return alert.New(source, rules, opts...)
+}
+
 func getLauncher(c config.Config) launcher.Launcher {
+	if c.Launchers.Agents != nil {
+		tlsConfig, err := c.Launchers.Agents.TLS.Load()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		registry, err := agent.NewRegistry(tlsConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return registry
+	}
+
 	if c.Launchers.Process != nil {
 		types := make(map[string]process.TypeConfig)
 
@@ -154,6 +679,10 @@ func getLauncher(c config.Config) launcher.Launcher {
 		}
 
 		launcher := process.NewLauncher(types)
+		if c.Nodes.Socket != "" {
+			launcher.SetHandlerAddress(rpc.UnixScheme + c.Nodes.Socket)
+		}
+		launcher.SetScratchDir(c.Launchers.Process.ScratchDir)
 
 		return launcher
 	}
@@ -169,3 +698,14 @@ func getLauncher(c config.Config) launcher.Launcher {
 
 	return nil
 }
+
+// serveAdmin serves the admin API h on addr. Requests must carry token and
+// addresses without host are bound to loopback
+func serveAdmin(addr, token string, h http.Handler) error {
+	addr, err := admin.ListenAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	return http.ListenAndServe(addr, admin.Protect(token, h))
+}
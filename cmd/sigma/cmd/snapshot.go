@@ -0,0 +1,113 @@
+// Copyright © 2017 The IoT-Cloud Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var snapshotServerAddress string
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Export and restore the state of a sigma server",
+}
+
+// snapshotExportCmd represents the snapshot export command
+var snapshotExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the state of a sigma server to a snapshot file or stdout",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			log.Fatal("expected at most one argument: file")
+		}
+
+		res, err := adminClient.Get(snapshotURL())
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to export snapshot: %s: %s", res.Status, string(msg))
+		}
+
+		var out io.Writer = os.Stdout
+		if len(args) == 1 {
+			f, err := os.OpenFile(args[0], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+
+			out = f
+		}
+
+		if _, err := io.Copy(out, res.Body); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// snapshotRestoreCmd represents the snapshot restore command
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore [file]",
+	Short: "Restore a snapshot on a sigma server",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("expected one argument: file")
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		res, err := adminClient.Post(snapshotURL(), "application/json", f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+			log.Fatalf("failed to restore snapshot: %s: %s", res.Status, string(msg))
+		}
+
+		fmt.Println("Snapshot restored successfully")
+	},
+}
+
+func snapshotURL() string {
+	return strings.TrimRight(snapshotServerAddress, "/") + "/snapshot"
+}
+
+func init() {
+	RootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotExportCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotServerAddress, "admin", "a", "http://localhost:50056", "The address of the sigma snapshot API")
+}
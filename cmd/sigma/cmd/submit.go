@@ -28,6 +28,8 @@ import (
 	"github.com/homebot/core/utils"
 	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
 	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/signature"
+	"github.com/homebot/sigma/validation"
 
 	"github.com/spf13/cobra"
 )
@@ -52,6 +54,8 @@ var (
 	stringParams []string
 	boolParams   []string
 	idOverride   string
+	signKeyPath  string
+	signKeyID    string
 )
 
 // submitCmd represents the submit command
@@ -64,57 +68,11 @@ var submitCmd = &cobra.Command{
 			log.Fatal(errors.New("expected one argument: function-name"))
 		}
 
-		funcName := args[0]
-
-		base := ""
-		stat, err := os.Stat(funcName)
-		if err == nil && stat.IsDir() {
-			base = funcName
-			funcName = path.Join(base, path.Base(funcName)+".yaml")
-		} else if err == nil && !stat.IsDir() {
-			base = path.Dir(funcName)
-		}
-
-		f, err := os.Open(funcName)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		content, err := ioutil.ReadAll(f)
+		spec, err := loadFunctionSpec(args[0])
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		var spec FunctionSpec
-		if err := yaml.Unmarshal(content, &spec); err != nil {
-			log.Fatal(err)
-		}
-
-		if idOverride != "" {
-			spec.ID = idOverride
-		}
-
-		if err := parseParameters(spec.Parameteres); err != nil {
-			log.Fatal(err)
-		}
-
-		if spec.Content.Inline != "" && spec.Content.File != "" {
-			log.Fatalf("function spec`content`: only `inline` or `file` can be set")
-		}
-
-		if spec.Content.File != "" {
-			data, err := ioutil.ReadFile(path.Join(base, spec.Content.File))
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			spec.FunctionSpec.Content = string(data)
-		}
-
-		if spec.FunctionSpec.Content == "" {
-			log.Fatal("function does not have any content")
-		}
-
 		cli, conn, err := getClient()
 		if err != nil {
 			log.Fatal(err)
@@ -123,7 +81,7 @@ var submitCmd = &cobra.Command{
 
 		ctx, _ := getContext(context.Background())
 		res, err := cli.Create(ctx, &sigmaV1.CreateFunctionRequest{
-			Spec: spec.FunctionSpec.ToProtobuf(),
+			Spec: spec.ToProtobuf(),
 		})
 
 		if err != nil {
@@ -142,6 +100,83 @@ func init() {
 	submitCmd.Flags().StringSliceVarP(&stringParams, "param-str", "s", nil, "Additional parameters in format key=value")
 	submitCmd.Flags().StringSliceVarP(&boolParams, "param-bool", "b", nil, "Additional parameters in format key=value")
 	submitCmd.Flags().StringVarP(&idOverride, "name", "n", "", "Name for the function to submit. Overrides values from the spec")
+	submitCmd.Flags().StringVar(&signKeyPath, "sign-key", "", "Path to a base64 encoded Ed25519 private key used to sign the function")
+	submitCmd.Flags().StringVar(&signKeyID, "sign-key-id", "", "ID of the signing key as configured at the server")
+}
+
+// loadFunctionSpec loads the function spec from the file or directory
+// name, applies parameters and signs it if requested by the command flags
+func loadFunctionSpec(name string) (sigma.FunctionSpec, error) {
+	base := ""
+	stat, err := os.Stat(name)
+	if err == nil && stat.IsDir() {
+		base = name
+		name = path.Join(base, path.Base(name)+".yaml")
+	} else if err == nil && !stat.IsDir() {
+		base = path.Dir(name)
+	}
+
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return sigma.FunctionSpec{}, err
+	}
+
+	var spec FunctionSpec
+	if err := yaml.Unmarshal(content, &spec); err != nil {
+		return sigma.FunctionSpec{}, err
+	}
+
+	if idOverride != "" {
+		spec.ID = idOverride
+	}
+
+	if err := parseParameters(spec.Parameteres); err != nil {
+		return sigma.FunctionSpec{}, err
+	}
+
+	if spec.ParameterSchema != nil {
+		if err := spec.ParameterSchema.Valid(); err != nil {
+			return sigma.FunctionSpec{}, err
+		}
+	}
+
+	if _, err := validation.New(spec.Schema); err != nil {
+		return sigma.FunctionSpec{}, err
+	}
+
+	if spec.Content.Inline != "" && spec.Content.File != "" {
+		return sigma.FunctionSpec{}, errors.New("function spec`content`: only `inline` or `file` can be set")
+	}
+
+	if spec.Content.File != "" {
+		data, err := ioutil.ReadFile(path.Join(base, spec.Content.File))
+		if err != nil {
+			return sigma.FunctionSpec{}, err
+		}
+
+		spec.FunctionSpec.Content = string(data)
+	}
+
+	if spec.FunctionSpec.Content == "" && spec.Artifact == "" {
+		return sigma.FunctionSpec{}, errors.New("function does not have any content")
+	}
+
+	if signKeyPath != "" {
+		blob, err := ioutil.ReadFile(signKeyPath)
+		if err != nil {
+			return sigma.FunctionSpec{}, err
+		}
+
+		key, err := signature.ParsePrivateKey(string(blob))
+		if err != nil {
+			return sigma.FunctionSpec{}, err
+		}
+
+		spec.Signature = signature.Sign(key, spec.FunctionSpec)
+		spec.SigningKey = signKeyID
+	}
+
+	return spec.FunctionSpec, nil
 }
 
 func parseParameters(m utils.ValueMap) error {
@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/homebot/idam/token"
 	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma/admin"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
@@ -42,3 +44,32 @@ func getContext(ctx context.Context) (context.Context, string) {
 
 	return metadata.NewOutgoingContext(ctx, md), path
 }
+
+// adminClient is the HTTP client used for the sigma admin APIs. It
+// authenticates requests using the token from --admin-token
+var adminClient = &http.Client{
+	Transport: adminTransport{},
+}
+
+type adminTransport struct{}
+
+// RoundTrip implements http.RoundTripper
+func (adminTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if adminTokenFile == "" {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	t, err := admin.LoadToken(adminTokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r := *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "Bearer "+t)
+
+	return http.DefaultTransport.RoundTrip(&r)
+}
@@ -3,10 +3,22 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
+	"time"
 
+	"github.com/homebot/sigma/admin"
+	"github.com/homebot/sigma/alert"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/federation"
 	"github.com/homebot/sigma/launcher/docker"
+	"github.com/homebot/sigma/metrics"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/quota"
+	"github.com/homebot/sigma/rpc"
+	"github.com/homebot/sigma/runtimes"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -25,6 +37,472 @@ type NodeServerConfig struct {
 	// AdvertiseAddress holds the address to advertise to new node
 	// instances
 	AdvertiseAddress string `json:"advertise" yaml:"advertise"`
+
+	// Socket holds the path of a unix domain socket the node handler
+	// should listen on in addition to Listen. Nodes launched by the
+	// process launcher connect via the socket and may authenticate using
+	// their peer credentials
+	Socket string `json:"socket,omitempty" yaml:"socket,omitempty"`
+
+	// SendTimeout is the maximum time writing an event to a node may
+	// block before the node is disconnected. Defaults to 10s
+	SendTimeout string `json:"sendTimeout,omitempty" yaml:"sendTimeout,omitempty"`
+
+	// ReconcileInterval is the interval instances and connections left
+	// over by crashed launchers are garbage collected at. Defaults to 1m
+	ReconcileInterval string `json:"reconcileInterval,omitempty" yaml:"reconcileInterval,omitempty"`
+
+	// GRPC holds tuning options for the node handler gRPC server
+	GRPC *GRPCConfig `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+
+	// WebSocket enables the WebSocket node transport
+	WebSocket *WebSocketConfig `json:"websocket,omitempty" yaml:"websocket,omitempty"`
+}
+
+// WebSocketConfig configures the WebSocket node transport
+type WebSocketConfig struct {
+	// Listen holds the address the HTTP server should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// AdvertiseURL holds the base URL advertised to nodes using the
+	// WebSocket transport. Defaults to http://<listen>/nodes
+	AdvertiseURL string `json:"advertise" yaml:"advertise"`
+}
+
+// GRPCConfig holds keepalive and connection tuning options for a gRPC
+// server. Durations are parsed using time.ParseDuration
+type GRPCConfig struct {
+	// KeepaliveTime is the interval after which idle connections are pinged
+	KeepaliveTime string `json:"keepaliveTime" yaml:"keepaliveTime"`
+
+	// KeepaliveTimeout is the time to wait for a ping ack
+	KeepaliveTimeout string `json:"keepaliveTimeout" yaml:"keepaliveTimeout"`
+
+	// MinPingInterval is the minimum interval clients may send pings at
+	MinPingInterval string `json:"minPingInterval" yaml:"minPingInterval"`
+
+	// PermitWithoutStream allows client pings without active streams
+	PermitWithoutStream bool `json:"permitWithoutStream" yaml:"permitWithoutStream"`
+
+	// MaxConnectionIdle closes connections idle for the given duration
+	MaxConnectionIdle string `json:"maxConnectionIdle" yaml:"maxConnectionIdle"`
+
+	// MaxConnectionAge closes connections older than the given duration
+	MaxConnectionAge string `json:"maxConnectionAge" yaml:"maxConnectionAge"`
+
+	// MaxConnectionAgeGrace is the grace period for pending RPCs after
+	// MaxConnectionAge has been reached
+	MaxConnectionAgeGrace string `json:"maxConnectionAgeGrace" yaml:"maxConnectionAgeGrace"`
+
+	// MaxConcurrentStreams limits the number of streams per connection
+	MaxConcurrentStreams uint32 `json:"maxConcurrentStreams" yaml:"maxConcurrentStreams"`
+
+	// MaxRecvMsgSize is the maximum size of received messages in bytes
+	MaxRecvMsgSize int `json:"maxRecvMsgSize" yaml:"maxRecvMsgSize"`
+
+	// MaxSendMsgSize is the maximum size of sent messages in bytes
+	MaxSendMsgSize int `json:"maxSendMsgSize" yaml:"maxSendMsgSize"`
+}
+
+// Options returns the node handler gRPC options for c
+func (c GRPCConfig) Options() (node.GRPCOptions, error) {
+	opts := node.GRPCOptions{
+		PermitWithoutStream:  c.PermitWithoutStream,
+		MaxConcurrentStreams: c.MaxConcurrentStreams,
+		MaxRecvMsgSize:       c.MaxRecvMsgSize,
+		MaxSendMsgSize:       c.MaxSendMsgSize,
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"keepaliveTime", c.KeepaliveTime, &opts.KeepaliveTime},
+		{"keepaliveTimeout", c.KeepaliveTimeout, &opts.KeepaliveTimeout},
+		{"minPingInterval", c.MinPingInterval, &opts.MinPingInterval},
+		{"maxConnectionIdle", c.MaxConnectionIdle, &opts.MaxConnectionIdle},
+		{"maxConnectionAge", c.MaxConnectionAge, &opts.MaxConnectionAge},
+		{"maxConnectionAgeGrace", c.MaxConnectionAgeGrace, &opts.MaxConnectionAgeGrace},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return opts, fmt.Errorf("grpc.%s: %s", d.name, err)
+		}
+		*d.dest = v
+	}
+
+	return opts, nil
+}
+
+// ArtifactsConfig configures the artifact store for function bundles
+type ArtifactsConfig struct {
+	// Dir is the directory artifacts are stored in
+	Dir string `json:"dir" yaml:"dir"`
+
+	// Listen holds the address the artifact HTTP API should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// GCInterval is the interval at which unreferenced artifacts are
+	// garbage collected. Defaults to 1h
+	GCInterval string `json:"gcInterval" yaml:"gcInterval"`
+
+	// GCGrace is the minimum age of unreferenced artifacts before they
+	// are garbage collected. Defaults to 24h
+	GCGrace string `json:"gcGrace" yaml:"gcGrace"`
+
+	// MaxUploadSize is the maximum size of uploaded archives in bytes.
+	// Defaults to 256MiB
+	MaxUploadSize int64 `json:"maxUploadSize" yaml:"maxUploadSize"`
+
+	// Build enables the build pipeline API for deploying functions
+	// from source
+	Build bool `json:"build" yaml:"build"`
+}
+
+// SignaturesConfig configures signature verification of function content
+type SignaturesConfig struct {
+	// TrustedKeys holds base64 encoded Ed25519 public keys indexed by
+	// key ID
+	TrustedKeys map[string]string `json:"trustedKeys" yaml:"trustedKeys"`
+}
+
+// SecretsConfig configures the resolution of secret-ref parameters
+type SecretsConfig struct {
+	// Dir is the directory holding one file per secret
+	Dir string `json:"dir" yaml:"dir"`
+}
+
+// EventBufferConfig configures store-and-forward buffering of trigger events
+// while functions are unreachable
+type EventBufferConfig struct {
+	// Dir is the directory buffered events are persisted in
+	Dir string `json:"dir" yaml:"dir"`
+
+	// MaxEvents is the maximum number of events buffered per function.
+	// Zero means unlimited
+	MaxEvents int `json:"maxEvents" yaml:"maxEvents"`
+}
+
+// StateConfig configures the key/value state service for functions
+type StateConfig struct {
+	// Listen holds the address the state service should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// Advertise holds the address advertised to nodes. Defaults to
+	// Listen
+	Advertise string `json:"advertise,omitempty" yaml:"advertise,omitempty"`
+
+	// Dir is the directory values are persisted in
+	Dir string `json:"dir" yaml:"dir"`
+}
+
+// ProxyConfig configures the egress proxy for outbound HTTP calls of nodes
+type ProxyConfig struct {
+	// Listen holds the address the proxy should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// Advertise holds the address advertised to nodes. Defaults to
+	// Listen
+	Advertise string `json:"advertise,omitempty" yaml:"advertise,omitempty"`
+}
+
+// DispatchConfig configures the dispatcher
+type DispatchConfig struct {
+	// MaxConcurrent limits the number of concurrent dispatches. Once
+	// reached, dispatch slots are shared between functions according
+	// to their weight. Zero means unlimited
+	MaxConcurrent int `json:"maxConcurrent" yaml:"maxConcurrent"`
+
+	// MaxChainDepth limits the number of functions an event chain may
+	// pass through before it is rejected. Zero means unlimited
+	MaxChainDepth int `json:"maxChainDepth,omitempty" yaml:"maxChainDepth,omitempty"`
+
+	// DeadLetter is the function receiving events rejected due to the
+	// chain depth
+	DeadLetter string `json:"deadLetter,omitempty" yaml:"deadLetter,omitempty"`
+}
+
+// Supported metrics backends
+const (
+	MetricsPrometheus = "prometheus"
+	MetricsStatsd     = "statsd"
+	MetricsDogStatsd  = "dogstatsd"
+	MetricsOTLP       = "otlp"
+)
+
+// MetricsConfig selects the backend metrics are reported to
+type MetricsConfig struct {
+	// Backend is one of "prometheus", "statsd", "dogstatsd" or "otlp"
+	Backend string `json:"backend" yaml:"backend"`
+
+	// Address holds the listen address of the Prometheus endpoint, the
+	// address of the statsd agent or the URL of the OTLP collector
+	Address string `json:"address" yaml:"address"`
+
+	// Prefix is prepended to all metric names
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+
+	// Tags holds key:value tags attached to all metrics. Only supported
+	// by the dogstatsd and otlp backends
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// Interval is the export interval of the otlp backend. Defaults to 10s
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// Sink returns the metrics sink configured by c
+func (c MetricsConfig) Sink() (metrics.Sink, error) {
+	switch c.Backend {
+	case MetricsPrometheus:
+		return metrics.NewPrometheus(c.Prefix), nil
+
+	case MetricsStatsd:
+		return metrics.NewStatsd(c.Address, metrics.WithPrefix(c.Prefix))
+
+	case MetricsDogStatsd:
+		return metrics.NewStatsd(c.Address, metrics.WithPrefix(c.Prefix), metrics.WithTags(c.Tags...))
+
+	case MetricsOTLP:
+		opts := []metrics.OTLPOption{}
+		if c.Interval != "" {
+			d, err := time.ParseDuration(c.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("metrics: interval: %s", err)
+			}
+			opts = append(opts, metrics.WithInterval(d))
+		}
+
+		attrs := make(map[string]string)
+		for _, tag := range c.Tags {
+			parts := strings.SplitN(tag, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("metrics: invalid tag %q", tag)
+			}
+			attrs[parts[0]] = parts[1]
+		}
+		opts = append(opts, metrics.WithResourceAttributes(attrs))
+
+		return metrics.NewOTLP(c.Address, opts...), nil
+	}
+
+	return nil, fmt.Errorf("metrics: unsupported backend %q", c.Backend)
+}
+
+// DeletionConfig configures soft-deletion of functions
+type DeletionConfig struct {
+	// Retention is the time destroyed functions can be restored before
+	// they are purged, e.g. "72h". Defaults to 24h
+	Retention string `json:"retention,omitempty" yaml:"retention,omitempty"`
+
+	// Listen holds the address the HTTP API listing, restoring and
+	// purging deleted functions should listen on. Disabled if empty
+	Listen string `json:"listen,omitempty" yaml:"listen,omitempty"`
+}
+
+// RetentionPeriod returns the parsed retention window
+func (c DeletionConfig) RetentionPeriod() (time.Duration, error) {
+	if c.Retention == "" {
+		return 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(c.Retention)
+}
+
+// QuotaConfig configures per-namespace quotas
+type QuotaConfig struct {
+	// Default holds the limits of namespaces without explicit limits
+	Default quota.Limits `json:"default" yaml:"default"`
+
+	// Namespaces holds limits per namespace
+	Namespaces map[string]quota.Limits `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+}
+
+// Manager returns a quota manager for c
+func (c QuotaConfig) Manager() *quota.Manager {
+	return quota.New(c.Default, c.Namespaces)
+}
+
+// AuthorizationConfig configures invocation-level authorization
+type AuthorizationConfig struct {
+	// Default is the effect applied to invocations not matched by any
+	// rule, either "allow" or "deny". Defaults to "deny"
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// Rules holds the rules evaluated in order for each invocation
+	Rules []authz.Rule `json:"rules" yaml:"rules"`
+}
+
+// Policy returns the authorization policy for c
+func (c AuthorizationConfig) Policy() (*authz.Policy, error) {
+	return authz.NewPolicy(c.Default, c.Rules...)
+}
+
+// SnapshotConfig configures the snapshot admin API
+type SnapshotConfig struct {
+	// Listen holds the address the snapshot API should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// Key holds the hex encoded 32 byte key used to encrypt secrets in
+	// snapshots. Secrets are not exported if empty
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// PlanConfig configures the API planning function spec updates
+type PlanConfig struct {
+	// Listen holds the address the plan HTTP API should listen on
+	Listen string `json:"listen" yaml:"listen"`
+}
+
+// MaintenanceConfig configures the maintenance API
+type MaintenanceConfig struct {
+	// Listen holds the address the HTTP API pausing and resuming
+	// functions should listen on
+	Listen string `json:"listen" yaml:"listen"`
+}
+
+// AdminConfig configures access to the HTTP admin APIs (artifacts,
+// debug, snapshot, plan, maintenance and deletion)
+type AdminConfig struct {
+	// TokenFile holds the path to the file containing the bearer token
+	// required by all admin APIs
+	TokenFile string `json:"tokenFile" yaml:"tokenFile"`
+}
+
+// Token returns the admin token
+func (c AdminConfig) Token() (string, error) {
+	if c.TokenFile == "" {
+		return "", admin.ErrNoToken
+	}
+
+	return admin.LoadToken(c.TokenFile)
+}
+
+// DebugConfig configures the debug API
+type DebugConfig struct {
+	// Listen holds the address the debug HTTP API should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// Port is the port nodes open their debugger on when a debug
+	// session is attached. Zero disables debug sessions
+	Port int `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// AlertingConfig configures alerting rules and the notifiers alerts are
+// delivered to
+type AlertingConfig struct {
+	// Interval is the interval rules are evaluated at. Defaults to 30s
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	// Rules holds the alerting rules
+	Rules []AlertRuleConfig `json:"rules" yaml:"rules"`
+
+	// Webhooks holds URLs alerts are posted to
+	Webhooks []string `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+
+	// MQTT publishes alerts to an MQTT topic
+	MQTT *alert.MQTT `json:"mqtt,omitempty" yaml:"mqtt,omitempty"`
+
+	// Email sends alerts via SMTP
+	Email *alert.Email `json:"email,omitempty" yaml:"email,omitempty"`
+}
+
+// AlertRuleConfig configures an alerting rule
+type AlertRuleConfig struct {
+	// Name is the name of the rule
+	Name string `json:"name" yaml:"name"`
+
+	// Kind is one of "error-rate", "no-nodes" or "queue-depth"
+	Kind string `json:"kind" yaml:"kind"`
+
+	// Function restricts the rule to matching functions
+	Function string `json:"function,omitempty" yaml:"function,omitempty"`
+
+	// Threshold is the value the condition is compared against
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+
+	// Window is the time frame of error-rate rules
+	Window string `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// Options returns the alerting rules and the alert manager options for c
+func (c AlertingConfig) Options() ([]alert.Rule, []alert.Option, error) {
+	var rules []alert.Rule
+	for _, r := range c.Rules {
+		rule := alert.Rule{
+			Name:      r.Name,
+			Kind:      alert.Kind(r.Kind),
+			Function:  r.Function,
+			Threshold: r.Threshold,
+		}
+
+		if r.Window != "" {
+			d, err := time.ParseDuration(r.Window)
+			if err != nil {
+				return nil, nil, fmt.Errorf("alerting: rule %s: window: %s", r.Name, err)
+			}
+			rule.Window = d
+		}
+
+		rules = append(rules, rule)
+	}
+
+	var opts []alert.Option
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return nil, nil, fmt.Errorf("alerting: interval: %s", err)
+		}
+		opts = append(opts, alert.WithInterval(d))
+	}
+
+	for _, url := range c.Webhooks {
+		opts = append(opts, alert.WithNotifiers(alert.NewWebhook(url)))
+	}
+
+	if c.MQTT != nil {
+		opts = append(opts, alert.WithNotifiers(c.MQTT))
+	}
+
+	if c.Email != nil {
+		opts = append(opts, alert.WithNotifiers(c.Email))
+	}
+
+	return rules, opts, nil
+}
+
+// FederationConfig is the configuration for peering with other sigma
+// controllers
+type FederationConfig struct {
+	// Name is the name of this controller within the federation
+	Name string `json:"name" yaml:"name"`
+
+	// Region is the region of this controller. Events are forwarded to
+	// peers of the same region first
+	Region string `json:"region,omitempty" yaml:"region,omitempty"`
+
+	// Listen holds the address the federation service should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// SyncInterval is the interval at which peer functions are synchronized
+	SyncInterval string `json:"syncInterval" yaml:"syncInterval"`
+
+	// Secret is the shared secret controllers of the federation
+	// authenticate each other with. Mandatory
+	Secret string `json:"secret" yaml:"secret"`
+
+	// TLS holds the certificates for mutual TLS between controllers.
+	// Mandatory
+	TLS *rpc.TLSConfig `json:"tls" yaml:"tls"`
+
+	// Peers holds the peer controllers
+	Peers []federation.Peer `json:"peers" yaml:"peers"`
 }
 
 // ProcessTypeConfig holds type configuration values for a process launcher
@@ -37,6 +515,21 @@ type ProcessTypeConfig struct {
 type ProcessLauncherConfig struct {
 	// Types holds types supported by the launcher
 	Types map[string]ProcessTypeConfig `json:"types" yaml:"types"`
+
+	// ScratchDir holds the directory scratch volumes are created in.
+	// Defaults to the system temp directory
+	ScratchDir string `json:"scratchDir,omitempty" yaml:"scratchDir,omitempty"`
+}
+
+// AgentsLauncherConfig is the configuration for launching nodes on
+// remote hosts using sigma agents
+type AgentsLauncherConfig struct {
+	// Listen holds the address the agent registry should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// TLS holds the certificates agents and the registry authenticate
+	// each other with. Mandatory
+	TLS *rpc.TLSConfig `json:"tls" yaml:"tls"`
 }
 
 // Launcher is the configuration for a launcher
@@ -46,6 +539,51 @@ type Launcher struct {
 
 	// Process is the configuration for the process launcher
 	Process *ProcessLauncherConfig `json:"process" yaml:"process"`
+
+	// Agents is the configuration for launching nodes using sigma agents
+	Agents *AgentsLauncherConfig `json:"agents" yaml:"agents"`
+}
+
+// Types returns all node types supported by the local launchers
+func (l Launcher) Types() []string {
+	var types []string
+
+	if l.Docker != nil {
+		for typ := range l.Docker.Types {
+			types = append(types, typ)
+		}
+	}
+
+	if l.Process != nil {
+		for typ := range l.Process.Types {
+			types = append(types, typ)
+		}
+	}
+
+	return types
+}
+
+// AgentConfig is the configuration for a sigma host agent
+type AgentConfig struct {
+	// ID is the unique ID of the agent. Defaults to a random ID
+	ID string `json:"id" yaml:"id"`
+
+	// Listen holds the address the agent should listen on
+	Listen string `json:"listen" yaml:"listen"`
+
+	// AdvertiseAddress holds the address to advertise to the controller
+	AdvertiseAddress string `json:"advertise" yaml:"advertise"`
+
+	// Controller holds the address of the controller's agent registry
+	Controller string `json:"controller" yaml:"controller"`
+
+	// Slots is the maximum number of nodes the agent runs. Zero means
+	// unlimited
+	Slots int `json:"slots" yaml:"slots"`
+
+	// TLS holds the certificates the agent and the controller
+	// authenticate each other with. Mandatory
+	TLS *rpc.TLSConfig `json:"tls" yaml:"tls"`
 }
 
 // Config holds the configuration for a sigma server
@@ -58,29 +596,138 @@ type Config struct {
 
 	// Launchers holds launcher configuration values
 	Launchers Launcher `json:"launcher" yaml:"launcher"`
+
+	// Runtimes holds the runtime definitions available for functions
+	Runtimes []runtimes.Runtime `json:"runtimes,omitempty" yaml:"runtimes,omitempty"`
+
+	// Artifacts configures the artifact store
+	Artifacts *ArtifactsConfig `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+
+	// Signatures enables signature verification of function content
+	Signatures *SignaturesConfig `json:"signatures,omitempty" yaml:"signatures,omitempty"`
+
+	// Secrets configures the resolution of secret-ref parameters
+	Secrets *SecretsConfig `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+
+	// EventBuffer configures buffering of trigger events for
+	// unreachable functions
+	EventBuffer *EventBufferConfig `json:"eventBuffer,omitempty" yaml:"eventBuffer,omitempty"`
+
+	// Dispatch configures the dispatcher
+	Dispatch *DispatchConfig `json:"dispatch,omitempty" yaml:"dispatch,omitempty"`
+
+	// Metrics configures the metrics backend
+	Metrics *MetricsConfig `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+
+	// Alerting configures alerting rules for functions
+	Alerting *AlertingConfig `json:"alerting,omitempty" yaml:"alerting,omitempty"`
+
+	// Deletion keeps destroyed functions restorable for a retention
+	// window
+	Deletion *DeletionConfig `json:"deletion,omitempty" yaml:"deletion,omitempty"`
+
+	// Quotas limits the functions, nodes and memory per namespace
+	Quotas *QuotaConfig `json:"quotas,omitempty" yaml:"quotas,omitempty"`
+
+	// Authorization restricts who may invoke functions with which
+	// payloads
+	Authorization *AuthorizationConfig `json:"authorization,omitempty" yaml:"authorization,omitempty"`
+
+	// Admin configures access to the HTTP admin APIs. Required if one
+	// of them is enabled
+	Admin *AdminConfig `json:"admin,omitempty" yaml:"admin,omitempty"`
+
+	// Snapshot enables the admin API to export and restore the
+	// controller state
+	Snapshot *SnapshotConfig `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+
+	// Plan enables the API previewing and applying spec updates
+	Plan *PlanConfig `json:"plan,omitempty" yaml:"plan,omitempty"`
+
+	// Maintenance enables the API to pause and resume functions
+	Maintenance *MaintenanceConfig `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+
+	// Debug enables the debug API serving captured invocations
+	Debug *DebugConfig `json:"debug,omitempty" yaml:"debug,omitempty"`
+
+	// State enables the key/value state service for functions
+	State *StateConfig `json:"state,omitempty" yaml:"state,omitempty"`
+
+	// Proxy enables the egress proxy for nodes
+	Proxy *ProxyConfig `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+
+	// Federation holds the configuration for federating with other
+	// sigma controllers
+	Federation *FederationConfig `json:"federation,omitempty" yaml:"federation,omitempty"`
+
+	// Agent holds the configuration when running as a sigma host agent
+	Agent *AgentConfig `json:"agent,omitempty" yaml:"agent,omitempty"`
+}
+
+// ApplyRuntimes adds a launcher type for each runtime definition. Runtimes
+// with a command are added to the process launcher while runtimes with an
+// image are added to the docker launcher. Launcher types are keyed by the
+// runtime key ("name@version")
+func (c *Config) ApplyRuntimes() {
+	for _, rt := range c.Runtimes {
+		if len(rt.Command) > 0 {
+			if c.Launchers.Process == nil {
+				c.Launchers.Process = &ProcessLauncherConfig{}
+			}
+			if c.Launchers.Process.Types == nil {
+				c.Launchers.Process.Types = make(map[string]ProcessTypeConfig)
+			}
+
+			c.Launchers.Process.Types[rt.Key()] = ProcessTypeConfig{
+				Command: rt.Command,
+			}
+		}
+
+		if rt.Image != "" {
+			if c.Launchers.Docker == nil {
+				c.Launchers.Docker = &docker.Config{}
+			}
+			if c.Launchers.Docker.Types == nil {
+				c.Launchers.Docker.Types = make(map[string]docker.NodeConfig)
+			}
+
+			c.Launchers.Docker.Types[rt.Key()] = docker.NodeConfig{
+				Image: rt.Image,
+			}
+		}
+	}
+}
+
+// AdminAPIs returns true if at least one HTTP admin API is enabled
+func (c Config) AdminAPIs() bool {
+	return (c.Artifacts != nil && c.Artifacts.Listen != "") ||
+		c.Debug != nil ||
+		c.Snapshot != nil ||
+		c.Plan != nil ||
+		c.Maintenance != nil ||
+		(c.Deletion != nil && c.Deletion.Listen != "")
 }
 
 // Valid checks if the configuration is valid
 func (c Config) Valid() error {
-	if c.Launchers.Docker == nil && c.Launchers.Process == nil {
+	if c.Launchers.Docker == nil && c.Launchers.Process == nil && c.Launchers.Agents == nil {
 		return errors.New("at least one launcher needs to be configured")
 	}
 
-	types := 0
-
-	if c.Launchers.Docker != nil {
-		for range c.Launchers.Docker.Types {
-			types++
-		}
+	if c.AdminAPIs() && (c.Admin == nil || c.Admin.TokenFile == "") {
+		return errors.New("admin APIs require admin.tokenFile to be set")
 	}
 
-	if c.Launchers.Process != nil {
-		for range c.Launchers.Process.Types {
-			types++
+	// node types of agent launchers are announced by the agents
+	// themselves
+	if c.Launchers.Agents != nil {
+		if c.Launchers.Agents.TLS == nil {
+			return errors.New("agent launchers require launcher.agents.tls to be set")
 		}
+		return nil
 	}
 
-	if types == 0 {
+	if len(c.Launchers.Types()) == 0 {
 		return errors.New("no execution types configured")
 	}
 
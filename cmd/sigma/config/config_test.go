@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/homebot/sigma/node"
+	"github.com/stretchr/testify/assert"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGRPCConfig_Options(t *testing.T) {
+	assert := assert.New(t)
+
+	// unset options keep the gRPC defaults
+	opts, err := GRPCConfig{}.Options()
+	assert.NoError(err)
+	assert.Equal(node.GRPCOptions{}, opts)
+
+	var c NodeServerConfig
+	err = yaml.Unmarshal([]byte(`
+listen: ":50052"
+grpc:
+  keepaliveTime: 30s
+  keepaliveTimeout: 5s
+  minPingInterval: 10s
+  permitWithoutStream: true
+  maxConnectionIdle: 5m
+  maxConnectionAge: 1h
+  maxConnectionAgeGrace: 30s
+  maxConcurrentStreams: 100
+  maxRecvMsgSize: 1048576
+  maxSendMsgSize: 2097152
+`), &c)
+	if !assert.NoError(err) || !assert.NotNil(c.GRPC) {
+		return
+	}
+
+	opts, err = c.GRPC.Options()
+	assert.NoError(err)
+	assert.Equal(node.GRPCOptions{
+		KeepaliveTime:         30 * time.Second,
+		KeepaliveTimeout:      5 * time.Second,
+		MinPingInterval:       10 * time.Second,
+		PermitWithoutStream:   true,
+		MaxConnectionIdle:     5 * time.Minute,
+		MaxConnectionAge:      time.Hour,
+		MaxConnectionAgeGrace: 30 * time.Second,
+		MaxConcurrentStreams:  100,
+		MaxRecvMsgSize:        1 << 20,
+		MaxSendMsgSize:        2 << 20,
+	}, opts)
+	assert.Len(opts.ServerOptions(), 5)
+
+	// invalid durations name the offending option
+	_, err = GRPCConfig{MaxConnectionAge: "1 hour"}.Options()
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "grpc.maxConnectionAge")
+	}
+}
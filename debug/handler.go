@@ -0,0 +1,116 @@
+// Package debug serves debug sessions of function nodes via HTTP
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// Sessions manages debug sessions of function nodes
+type Sessions interface {
+	// Attach puts a node of a function into debug mode
+	Attach(ctx context.Context, function, node string, timeout time.Duration) (function.DebugSession, error)
+
+	// Detach ends the debug session of a node
+	Detach(ctx context.Context, function, node string) error
+
+	// DebugSessions returns the debug sessions of a function
+	DebugSessions(ctx context.Context, function string) ([]function.DebugSession, error)
+}
+
+// Handler serves debug sessions via HTTP:
+//
+//	GET    /sessions/<function>                        list debug sessions
+//	POST   /sessions/<function>?node=<id>&timeout=<d>  attach a debugger to a node
+//	DELETE /sessions/<function>?node=<id>              detach the debugger of a node
+type Handler struct {
+	sessions Sessions
+}
+
+// NewHandler returns a new HTTP handler for sessions
+func NewHandler(s Sessions) *Handler {
+	return &Handler{
+		sessions: s,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+	if fn == "" {
+		http.Error(w, "missing function", http.StatusBadRequest)
+		return
+	}
+
+	node := r.URL.Query().Get("node")
+	if r.Method != http.MethodGet && node == "" {
+		http.Error(w, "missing node", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := h.sessions.DebugSessions(r.Context(), fn)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if sessions == nil {
+			sessions = []function.DebugSession{}
+		}
+		writeJSON(w, http.StatusOK, sessions)
+
+	case http.MethodPost:
+		var timeout time.Duration
+		if t := r.URL.Query().Get("timeout"); t != "" {
+			d, err := time.ParseDuration(t)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			timeout = d
+		}
+
+		session, err := h.sessions.Attach(r.Context(), fn, node, timeout)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, session)
+
+	case http.MethodDelete:
+		if err := h.sessions.Detach(r.Context(), fn, node); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case scheduler.ErrUnknownFunction, function.ErrUnknownController:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case function.ErrAlreadyAttached, function.ErrNotAttached:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
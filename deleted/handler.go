@@ -0,0 +1,84 @@
+// Package deleted serves functions that have been destroyed but can still
+// be restored via HTTP
+package deleted
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/homebot/sigma/scheduler"
+)
+
+// Handler serves deleted functions via HTTP:
+//
+//	GET    /deleted             list deleted functions
+//	POST   /deleted/<function>  restore a deleted function
+//	DELETE /deleted/<function>  purge a deleted function
+type Handler struct {
+	scheduler scheduler.Scheduler
+}
+
+// NewHandler returns a new HTTP handler for the deleted functions of s
+func NewHandler(s scheduler.Scheduler) *Handler {
+	return &Handler{
+		scheduler: s,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn := strings.Trim(strings.TrimPrefix(r.URL.Path, "/deleted"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && fn == "":
+		deleted, err := h.scheduler.Deleted(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if deleted == nil {
+			deleted = []scheduler.DeletedFunction{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(deleted)
+
+	case fn == "":
+		http.Error(w, "missing function", http.StatusBadRequest)
+
+	case r.Method == http.MethodPost:
+		name, err := h.scheduler.Restore(r.Context(), fn)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"name": name})
+
+	case r.Method == http.MethodDelete:
+		if err := h.scheduler.Purge(r.Context(), fn); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case scheduler.ErrNotDeleted:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case scheduler.ErrFunctionExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,193 @@
+package sigma
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Effects of changing a field of a function spec
+const (
+	// EffectLive changes are applied without replacing nodes
+	EffectLive = "live"
+
+	// EffectRestart changes replace all nodes using a rolling update
+	EffectRestart = "restart"
+
+	// EffectRecreate changes are only applied once the function is
+	// destroyed and created again
+	EffectRecreate = "recreate"
+)
+
+// liveFields holds the spec fields only used by the function controller.
+// They are applied when the spec is updated
+var liveFields = map[string]bool{
+	"weight":      true,
+	"schema":      true,
+	"recycle":     true,
+	"update":      true,
+	"debug":       true,
+	"maintenance": true,
+}
+
+// recreateFields holds the spec fields evaluated once when the function
+// is created
+var recreateFields = map[string]bool{
+	"policies": true,
+	"triggers": true,
+}
+
+// SpecChange describes a changed field of a function spec
+type SpecChange struct {
+	// Field holds the JSON name of the field
+	Field string `json:"field"`
+
+	// Old and New hold the JSON encoded values, empty if unset
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+
+	// Effect is one of EffectLive, EffectRestart or EffectRecreate
+	Effect string `json:"effect"`
+}
+
+// Trigger change actions
+const (
+	TriggerAdded   = "added"
+	TriggerRemoved = "removed"
+	TriggerChanged = "changed"
+)
+
+// TriggerChange describes an added, removed or changed trigger
+type TriggerChange struct {
+	// Type holds the type of the trigger
+	Type string `json:"type"`
+
+	// Action is one of TriggerAdded, TriggerRemoved or TriggerChanged
+	Action string `json:"action"`
+}
+
+// DiffSpecs returns the fields changed between old and new ordered by
+// their name
+func DiffSpecs(old, new FunctionSpec) ([]SpecChange, error) {
+	a, err := specFields(old)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := specFields(new)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	var changes []SpecChange
+	for k := range keys {
+		if bytes.Equal(a[k], b[k]) {
+			continue
+		}
+
+		effect := EffectRestart
+		if liveFields[k] {
+			effect = EffectLive
+		} else if recreateFields[k] {
+			effect = EffectRecreate
+		}
+
+		changes = append(changes, SpecChange{
+			Field:  k,
+			Old:    a[k],
+			New:    b[k],
+			Effect: effect,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes, nil
+}
+
+// specFields returns the JSON encoded fields of spec. Unset fields are
+// omitted so they compare equal to empty values
+func specFields(spec FunctionSpec) (map[string]json.RawMessage, error) {
+	blob, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return nil, err
+	}
+
+	for k, v := range fields {
+		switch string(v) {
+		case "null", `""`, "0", "false", "{}", "[]":
+			delete(fields, k)
+		}
+	}
+
+	return fields, nil
+}
+
+// NeedsRestart returns true if one of changes requires nodes to be
+// replaced
+func NeedsRestart(changes []SpecChange) bool {
+	for _, c := range changes {
+		if c.Effect == EffectRestart {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffTriggers returns the triggers added, removed or changed between
+// old and new. Triggers are identified by their type
+func DiffTriggers(old, new []TriggerSpec) []TriggerChange {
+	a := triggersByType(old)
+	b := triggersByType(new)
+
+	var changes []TriggerChange
+
+	for typ, t := range a {
+		other, ok := b[typ]
+		if !ok {
+			changes = append(changes, TriggerChange{Type: typ, Action: TriggerRemoved})
+			continue
+		}
+
+		x, _ := json.Marshal(t)
+		y, _ := json.Marshal(other)
+		if !bytes.Equal(x, y) {
+			changes = append(changes, TriggerChange{Type: typ, Action: TriggerChanged})
+		}
+	}
+
+	for typ := range b {
+		if _, ok := a[typ]; !ok {
+			changes = append(changes, TriggerChange{Type: typ, Action: TriggerAdded})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Type < changes[j].Type
+	})
+
+	return changes
+}
+
+func triggersByType(triggers []TriggerSpec) map[string]TriggerSpec {
+	m := make(map[string]TriggerSpec)
+	for _, t := range triggers {
+		m[t.Type] = t
+	}
+	return m
+}
@@ -0,0 +1,136 @@
+package sigma
+
+import (
+	"testing"
+
+	"github.com/homebot/core/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	base := FunctionSpec{
+		ID:      "fn",
+		Type:    "js",
+		Content: "content",
+	}
+
+	cases := []struct {
+		name   string
+		change func(*FunctionSpec)
+		field  string
+		effect string
+	}{
+		{"weight", func(s *FunctionSpec) { s.Weight = 2 }, "weight", EffectLive},
+		{"schema", func(s *FunctionSpec) { s.Schema = &IOSchema{Input: `{"type": "object"}`} }, "schema", EffectLive},
+		{"recycle", func(s *FunctionSpec) { s.Recycle = &RecyclePolicy{MaxAge: "1h"} }, "recycle", EffectLive},
+		{"update", func(s *FunctionSpec) { s.Update = &UpdatePolicy{MaxUnavailable: 1} }, "update", EffectLive},
+		{"debug", func(s *FunctionSpec) { s.Debug = &DebugCapture{SampleRate: 0.5} }, "debug", EffectLive},
+		{"maintenance", func(s *FunctionSpec) {
+			s.Maintenance = []MaintenanceWindow{{Start: "2018-01-01T00:00:00Z", End: "2018-01-01T01:00:00Z"}}
+		}, "maintenance", EffectLive},
+		{"policies", func(s *FunctionSpec) {
+			s.Policies = map[string]map[string]string{"cpu": {"max": "2"}}
+		}, "policies", EffectRecreate},
+		{"triggers", func(s *FunctionSpec) { s.Triggers = []TriggerSpec{{Type: "cron"}} }, "triggers", EffectRecreate},
+		{"content", func(s *FunctionSpec) { s.Content = "changed" }, "content", EffectRestart},
+		{"type", func(s *FunctionSpec) { s.Type = "go" }, "type", EffectRestart},
+		{"parameters", func(s *FunctionSpec) { s.Parameteres = utils.ValueMap{"key": "value"} }, "parameters", EffectRestart},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			spec := base
+			c.change(&spec)
+
+			changes, err := DiffSpecs(base, spec)
+			assert.NoError(err)
+			if !assert.Len(changes, 1) {
+				return
+			}
+
+			change := changes[0]
+			assert.Equal(c.field, change.Field)
+			assert.Equal(c.effect, change.Effect)
+			assert.NotEqual(string(change.Old), string(change.New))
+			assert.Equal(c.effect == EffectRestart, NeedsRestart(changes))
+
+			// reverting the change has the same effect
+			changes, err = DiffSpecs(spec, base)
+			assert.NoError(err)
+			if assert.Len(changes, 1) {
+				assert.Equal(c.effect, changes[0].Effect)
+				assert.Equal(change.Old, changes[0].New)
+				assert.Equal(change.New, changes[0].Old)
+			}
+		})
+	}
+}
+
+func TestDiffSpecs_Unchanged(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := FunctionSpec{ID: "fn", Type: "js", Weight: 1}
+
+	changes, err := DiffSpecs(spec, spec)
+	assert.NoError(err)
+	assert.Empty(changes)
+	assert.False(NeedsRestart(changes))
+
+	// empty values compare equal to unset ones
+	empty := spec
+	empty.Policies = map[string]map[string]string{}
+	empty.Triggers = []TriggerSpec{}
+	empty.Parameteres = utils.ValueMap{}
+
+	changes, err = DiffSpecs(spec, empty)
+	assert.NoError(err)
+	assert.Empty(changes)
+
+	// changes are ordered by field
+	changed := spec
+	changed.Weight = 2
+	changed.Content = "changed"
+	changed.Triggers = []TriggerSpec{{Type: "cron"}}
+
+	changes, err = DiffSpecs(spec, changed)
+	assert.NoError(err)
+	if assert.Len(changes, 3) {
+		assert.Equal("content", changes[0].Field)
+		assert.Equal("triggers", changes[1].Field)
+		assert.Equal("weight", changes[2].Field)
+	}
+	assert.True(NeedsRestart(changes))
+}
+
+func TestDiffTriggers(t *testing.T) {
+	cron := TriggerSpec{Type: "cron", Options: map[string]string{"schedule": "@every 1m"}}
+	mqtt := TriggerSpec{Type: "mqtt", Options: map[string]string{"topic": "a"}}
+
+	cases := []struct {
+		name     string
+		old, new []TriggerSpec
+		expected []TriggerChange
+	}{
+		{"unchanged", []TriggerSpec{cron, mqtt}, []TriggerSpec{mqtt, cron}, nil},
+		{"added", []TriggerSpec{cron}, []TriggerSpec{cron, mqtt}, []TriggerChange{{Type: "mqtt", Action: TriggerAdded}}},
+		{"removed", []TriggerSpec{cron, mqtt}, []TriggerSpec{mqtt}, []TriggerChange{{Type: "cron", Action: TriggerRemoved}}},
+		{"options", []TriggerSpec{cron}, []TriggerSpec{{Type: "cron", Options: map[string]string{"schedule": "@every 2m"}}},
+			[]TriggerChange{{Type: "cron", Action: TriggerChanged}}},
+		{"condition", []TriggerSpec{mqtt}, []TriggerSpec{{Type: "mqtt", Condition: "x > 1", Options: mqtt.Options}},
+			[]TriggerChange{{Type: "mqtt", Action: TriggerChanged}}},
+		{"rules", []TriggerSpec{mqtt}, []TriggerSpec{{Type: "mqtt", Options: mqtt.Options, Rules: []RuleSpec{{When: "x > 1"}}}},
+			[]TriggerChange{{Type: "mqtt", Action: TriggerChanged}}},
+		{"replaced", []TriggerSpec{cron}, []TriggerSpec{mqtt}, []TriggerChange{
+			{Type: "cron", Action: TriggerRemoved},
+			{Type: "mqtt", Action: TriggerAdded},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, DiffTriggers(c.old, c.new))
+		})
+	}
+}
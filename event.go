@@ -5,7 +5,10 @@ type Event interface {
 	// Type returns the type of the event
 	Type() string
 
-	// Payload returns the payload of the event
+	// Payload returns the payload of the event. The payload is passed to
+	// functions without copying and may be shared by multiple readers so
+	// it must be treated as read-only and must not be backed by a pooled
+	// buffer
 	Payload() []byte
 }
 
@@ -27,7 +30,7 @@ func (s *SimpleEvent) Payload() []byte {
 }
 
 // NewSimpleEvent returns a new sigma.Event from the given type and
-// payload
+// payload. The payload is not copied and must not be modified afterwards
 func NewSimpleEvent(typ string, payload []byte) Event {
 	return &SimpleEvent{
 		typ:     typ,
@@ -0,0 +1,373 @@
+package federation
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/homebot/insight/logger"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/metrics"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/rpc"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// DefaultSyncInterval is the default interval at which peer advertisements
+// are synchronized
+const DefaultSyncInterval = 30 * time.Second
+
+// Headers used to authenticate calls between peers. Each call carries the
+// name of the calling controller and the shared secret of the federation.
+// Headers are only accepted on mutually authenticated TLS connections
+const (
+	PeerHeader   = "federation-peer"
+	SecretHeader = "federation-secret"
+)
+
+type peer struct {
+	Peer
+
+	conn   *grpc.ClientConn
+	client FederationServer
+
+	rw        sync.RWMutex
+	functions map[string]struct{}
+
+	// region holds the region of the peer
+	region string
+
+	// latency holds the moving average of the round-trip latency to
+	// the peer
+	latency time.Duration
+
+	// healthy is false if the last call to the peer failed
+	healthy bool
+}
+
+func (p *peer) hosts(fn string) bool {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	_, ok := p.functions[fn]
+	return ok
+}
+
+func (p *peer) setFunctions(fns []string) {
+	m := make(map[string]struct{}, len(fns))
+	for _, fn := range fns {
+		m[fn] = struct{}{}
+	}
+
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	p.functions = m
+}
+
+// Federation peers a sigma controller with other controllers. It advertises
+// the functions hosted by the local scheduler and forwards invocations for
+// functions that are only available (or healthy) on a peer
+type Federation struct {
+	name     string
+	region   string
+	local    scheduler.Scheduler
+	interval time.Duration
+	log      logger.Logger
+
+	// secret is the shared secret peers authenticate with
+	secret string
+
+	// tls holds the certificates for mutual TLS between peers
+	tls *tls.Config
+
+	// authorizer authorizes forwarded events, may be nil
+	authorizer authz.Authorizer
+
+	peers []*peer
+}
+
+// New creates a new federation for the local scheduler
+func New(name string, local scheduler.Scheduler, peers []Peer, opts ...Option) (*Federation, error) {
+	if name == "" {
+		return nil, errors.New("federation: controller name is mandatory")
+	}
+
+	f := &Federation{
+		name:     name,
+		local:    local,
+		interval: DefaultSyncInterval,
+	}
+
+	for _, fn := range opts {
+		if err := fn(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.log == nil {
+		f.log = logger.NopLogger{}
+	}
+
+	if f.secret == "" {
+		return nil, errors.New("federation: shared secret is mandatory")
+	}
+
+	// the shared secret must never be sent in plaintext
+	if f.tls == nil {
+		return nil, errors.New("federation: TLS configuration is mandatory")
+	}
+
+	for _, p := range peers {
+		conn, err := grpc.Dial(p.Address, grpc.WithTransportCredentials(rpc.ClientCredentials(f.tls)), rpc.DialOption())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		f.peers = append(f.peers, &peer{
+			Peer:      p,
+			conn:      conn,
+			client:    &federationClient{cc: conn, name: name, secret: f.secret},
+			functions: make(map[string]struct{}),
+			region:    p.Region,
+		})
+	}
+
+	return f, nil
+}
+
+// Serve serves the federation gRPC service on lis. Only peers presenting a
+// certificate signed by the configured CA are accepted
+func (f *Federation) Serve(lis net.Listener) error {
+	srv := grpc.NewServer(rpc.ServerOption(), grpc.Creds(rpc.ServerCredentials(f.tls)))
+	RegisterFederationServer(srv, f)
+
+	return srv.Serve(lis)
+}
+
+// Run synchronizes the functions hosted by peers until ctx is cancelled
+func (f *Federation) Run(ctx context.Context) error {
+	for {
+		f.sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.interval):
+		}
+	}
+}
+
+// Close closes the connections to all peers
+func (f *Federation) Close() error {
+	var first error
+	for _, p := range f.peers {
+		if err := p.conn.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Scheduler returns a scheduler.Scheduler that dispatches events to the local
+// scheduler and transparently forwards them to peers if the function is not
+// hosted locally or the local copy is down
+func (f *Federation) Scheduler() scheduler.Scheduler {
+	return &federatedScheduler{
+		Scheduler: f.local,
+		f:         f,
+	}
+}
+
+// authenticate returns the name of the calling peer. Only configured peers
+// presenting the shared secret over a mutually authenticated TLS
+// connection are accepted
+func (f *Federation) authenticate(ctx context.Context) (string, error) {
+	if _, err := rpc.AuthenticatedPeer(ctx); err != nil {
+		return "", err
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if len(md[PeerHeader]) != 1 || len(md[SecretHeader]) != 1 {
+		return "", status.Error(codes.Unauthenticated, "missing federation credentials")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(md[SecretHeader][0]), []byte(f.secret)) != 1 {
+		return "", status.Error(codes.Unauthenticated, "invalid federation secret")
+	}
+
+	name := md[PeerHeader][0]
+	for _, p := range f.peers {
+		if p.Name == name {
+			return name, nil
+		}
+	}
+
+	return "", status.Error(codes.PermissionDenied, "unknown peer "+name)
+}
+
+// Functions returns the functions hosted by the local scheduler and
+// implements FederationServer
+func (f *Federation) Functions(ctx context.Context, _ *Empty) (*Advertisement, error) {
+	if _, err := f.authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	regs, err := f.local.Functions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	adv := &Advertisement{
+		Controller: f.name,
+		Region:     f.region,
+	}
+
+	for _, reg := range regs {
+		adv.Functions = append(adv.Functions, reg.Name.String())
+	}
+
+	return adv, nil
+}
+
+// Dispatch dispatches a forwarded event to the local scheduler and implements
+// FederationServer. Forwarded events are authorized using the identity of
+// the original caller and are never forwarded again
+func (f *Federation) Dispatch(ctx context.Context, in *ForwardRequest) (*ForwardResponse, error) {
+	origin, err := f.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Origin != origin {
+		return nil, status.Error(codes.PermissionDenied, "origin does not match peer "+origin)
+	}
+
+	f.log.Infof("received forwarded event for %s from %s", in.Function, in.Origin)
+
+	event := sigma.NewEventWithMetadata(in.Type, in.Payload, in.Metadata)
+
+	if f.authorizer != nil {
+		req := authz.Request{
+			Identity: in.Metadata[sigma.MetadataCaller],
+			Function: in.Function,
+			Event:    event,
+		}
+
+		if err := f.authorizer.Authorize(ctx, req); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	node, res, err := f.local.Dispatch(ctx, in.Function, event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ForwardResponse{
+		Node:   node,
+		Result: res,
+	}, nil
+}
+
+func (f *Federation) sync(ctx context.Context) {
+	for _, p := range f.peers {
+		start := time.Now()
+
+		callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		adv, err := p.client.Functions(callCtx, &Empty{})
+		cancel()
+
+		if err != nil {
+			f.log.Warnf("failed to sync functions of peer %s: %s", p.Name, err)
+			p.fail()
+			continue
+		}
+
+		p.observe(time.Since(start))
+		p.setRegion(adv.Region)
+		p.setFunctions(adv.Functions)
+
+		_, latency, _ := p.status()
+		metrics.Gauge("federation.latency_ms."+p.Name, float64(latency)/float64(time.Millisecond))
+	}
+}
+
+// forward forwards the event to the first peer hosting fn that executes it
+// successfully. Peers are tried in the order returned by route
+func (f *Federation) forward(ctx context.Context, fn string, event sigma.Event) (string, []byte, error) {
+	err := error(scheduler.ErrUnknownFunction)
+
+	for _, p := range route(f.peers, fn, f.region) {
+		var res *ForwardResponse
+		res, err = p.client.Dispatch(ctx, &ForwardRequest{
+			Origin:   f.name,
+			Function: fn,
+			Type:     event.Type(),
+			Payload:  event.Payload(),
+			Metadata: sigma.EventMetadata(event),
+		})
+		if err != nil {
+			f.log.Warnf("failed to forward event for %s to peer %s: %s", fn, p.Name, err)
+			if ctx.Err() == nil {
+				p.fail()
+			}
+			continue
+		}
+
+		f.log.Infof("forwarded event for %s to peer %s", fn, p.Name)
+		return p.Name + "/" + res.Node, res.Result, nil
+	}
+
+	return "", nil, err
+}
+
+type federatedScheduler struct {
+	scheduler.Scheduler
+
+	f *Federation
+}
+
+// Dispatch dispatches the event to the local function and fails over to a
+// peer if the function is unknown, has no selectable nodes or the event
+// could not be delivered to the selected node
+func (s *federatedScheduler) Dispatch(ctx context.Context, fn string, event sigma.Event) (string, []byte, error) {
+	node, res, err := s.Scheduler.Dispatch(ctx, fn, event)
+	if !failover(err) {
+		return node, res, err
+	}
+
+	if rnode, rres, rerr := s.f.forward(ctx, fn, event); rerr == nil {
+		return rnode, rres, nil
+	}
+
+	return node, res, err
+}
+
+// failover returns true if a local dispatch error means that the event
+// has not been executed and should be forwarded to a peer
+func failover(err error) bool {
+	switch err {
+	case scheduler.ErrUnknownFunction, function.ErrNoSelectableNodes, node.ErrSendTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// compile time check
+var _ FederationServer = &Federation{}
@@ -0,0 +1,105 @@
+package federation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/homebot/insight/logger"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+
+	f := &Federation{
+		secret: "secret",
+		log:    logger.NopLogger{},
+		peers:  []*peer{{Peer: Peer{Name: "east"}}},
+	}
+
+	// calls arrive over mutually authenticated TLS connections
+	verified := grpcpeer.NewContext(context.Background(), &grpcpeer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "east"}}}},
+		}},
+	})
+
+	call := func(kv ...string) context.Context {
+		return metadata.NewIncomingContext(verified, metadata.Pairs(kv...))
+	}
+
+	name, err := f.authenticate(call(PeerHeader, "east", SecretHeader, "secret"))
+	assert.NoError(err)
+	assert.Equal("east", name)
+
+	_, err = f.authenticate(verified)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// the secret is refused on insecure connections
+	insecure := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PeerHeader, "east", SecretHeader, "secret"))
+	_, err = f.authenticate(insecure)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	_, err = f.authenticate(call(PeerHeader, "east", SecretHeader, "wrong"))
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	_, err = f.authenticate(call(PeerHeader, "west", SecretHeader, "secret"))
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	// forwarded events must come from the authenticated peer
+	_, err = f.Dispatch(call(PeerHeader, "east", SecretHeader, "secret"), &ForwardRequest{Origin: "west", Function: "fn"})
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	// forwarded events are authorized using the original caller
+	var identity string
+	f.authorizer = authz.AuthorizerFunc(func(ctx context.Context, req authz.Request) error {
+		identity = req.Identity
+		return authz.ErrDenied
+	})
+
+	_, err = f.Dispatch(call(PeerHeader, "east", SecretHeader, "secret"), &ForwardRequest{
+		Origin:   "east",
+		Function: "fn",
+		Metadata: sigma.Metadata{sigma.MetadataCaller: "alice"},
+	})
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	assert.Equal("alice", identity)
+}
+
+func TestFailover(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(failover(scheduler.ErrUnknownFunction))
+	assert.True(failover(function.ErrNoSelectableNodes))
+	assert.True(failover(node.ErrSendTimeout))
+
+	// events that may have been executed are not forwarded
+	assert.False(failover(nil))
+	assert.False(failover(node.ExecutionError("failed")))
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New("east", nil, nil, WithSecret("secret"))
+	assert.Error(err)
+
+	f, err := New("east", nil, []Peer{{Name: "west", Address: "west:50052"}}, WithSecret("secret"), WithTLS(&tls.Config{}))
+	if assert.NoError(err) {
+		assert.NoError(f.Close())
+	}
+}
@@ -0,0 +1,66 @@
+package federation
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/homebot/insight/logger"
+	"github.com/homebot/sigma/authz"
+)
+
+// Option is a Federation option
+type Option func(f *Federation) error
+
+// WithSyncInterval configures the interval at which the functions hosted by
+// peers are synchronized
+func WithSyncInterval(d time.Duration) Option {
+	return func(f *Federation) error {
+		f.interval = d
+		return nil
+	}
+}
+
+// WithRegion configures the region of the local controller. Events that
+// cannot be handled locally are forwarded to peers of the same region
+// before peers of other regions
+func WithRegion(region string) Option {
+	return func(f *Federation) error {
+		f.region = region
+		return nil
+	}
+}
+
+// WithLogger configures the logger to use
+func WithLogger(l logger.Logger) Option {
+	return func(f *Federation) error {
+		f.log = l
+		return nil
+	}
+}
+
+// WithSecret configures the shared secret peers authenticate with. All
+// controllers of a federation must use the same secret
+func WithSecret(secret string) Option {
+	return func(f *Federation) error {
+		f.secret = secret
+		return nil
+	}
+}
+
+// WithTLS configures the certificates used for mutual TLS between peers.
+// Peers must present a certificate signed by one of cfg.RootCAs
+func WithTLS(cfg *tls.Config) Option {
+	return func(f *Federation) error {
+		f.tls = cfg
+		return nil
+	}
+}
+
+// WithAuthorizer configures the authorizer evaluated for forwarded
+// events. If not set, all forwarded events are allowed
+func WithAuthorizer(a authz.Authorizer) Option {
+	return func(f *Federation) error {
+		f.authorizer = a
+		return nil
+	}
+}
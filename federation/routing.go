@@ -0,0 +1,94 @@
+package federation
+
+import (
+	"sort"
+	"time"
+)
+
+// latencyWeight is the weight of a new round-trip measurement in the
+// moving average of a peer's latency
+const latencyWeight = 0.3
+
+// observe records a successful round-trip to the peer
+func (p *peer) observe(rtt time.Duration) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if p.latency == 0 {
+		p.latency = rtt
+	} else {
+		p.latency = time.Duration(latencyWeight*float64(rtt) + (1-latencyWeight)*float64(p.latency))
+	}
+	p.healthy = true
+}
+
+// fail marks the peer unhealthy until the next successful round-trip
+func (p *peer) fail() {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	p.healthy = false
+}
+
+// status returns the region, the moving average of the round-trip latency
+// and the health of the peer
+func (p *peer) status() (string, time.Duration, bool) {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	return p.region, p.latency, p.healthy
+}
+
+func (p *peer) setRegion(region string) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	// a configured region takes precedence over the advertised one
+	if p.Region == "" {
+		p.region = region
+	}
+}
+
+// route returns the peers hosting fn in the order they should be tried:
+// healthy peers first, peers of region before peers of other regions and
+// peers with lower latency first
+func route(peers []*peer, fn, region string) []*peer {
+	type candidate struct {
+		p       *peer
+		local   bool
+		latency time.Duration
+		healthy bool
+	}
+
+	var candidates []candidate
+	for _, p := range peers {
+		if !p.hosts(fn) {
+			continue
+		}
+
+		r, latency, healthy := p.status()
+		candidates = append(candidates, candidate{
+			p:       p,
+			local:   region != "" && r == region,
+			latency: latency,
+			healthy: healthy,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		if a.local != b.local {
+			return a.local
+		}
+		return a.latency < b.latency
+	})
+
+	res := make([]*peer, len(candidates))
+	for i, c := range candidates {
+		res[i] = c.p
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package federation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	newPeer := func(name, region string, latency time.Duration) *peer {
+		p := &peer{
+			Peer:      Peer{Name: name},
+			functions: map[string]struct{}{"fn": {}},
+		}
+		p.setRegion(region)
+		p.observe(latency)
+		return p
+	}
+
+	near := newPeer("near", "eu", 50*time.Millisecond)
+	nearFast := newPeer("near-fast", "eu", 10*time.Millisecond)
+	far := newPeer("far", "us", time.Millisecond)
+	down := newPeer("down", "eu", time.Millisecond)
+	down.fail()
+	other := newPeer("other", "eu", time.Millisecond)
+	other.setFunctions(nil)
+
+	names := func(peers []*peer) []string {
+		var res []string
+		for _, p := range peers {
+			res = append(res, p.Name)
+		}
+		return res
+	}
+
+	peers := []*peer{far, down, near, other, nearFast}
+
+	assert.Equal([]string{"near-fast", "near", "far", "down"}, names(route(peers, "fn", "eu")))
+	assert.Equal([]string{"far", "near-fast", "near", "down"}, names(route(peers, "fn", "")))
+	assert.Empty(route(peers, "unknown", "eu"))
+
+	// measurements are smoothed
+	far.observe(101 * time.Millisecond)
+	_, latency, healthy := far.status()
+	assert.Equal(31*time.Millisecond, latency)
+	assert.True(healthy)
+}
@@ -0,0 +1,77 @@
+package federation
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// FederationServer is served by each federated controller
+type FederationServer interface {
+	// Functions returns the functions hosted by the controller
+	Functions(context.Context, *Empty) (*Advertisement, error)
+
+	// Dispatch dispatches a forwarded event to a local function
+	Dispatch(context.Context, *ForwardRequest) (*ForwardResponse, error)
+}
+
+// RegisterFederationServer registers srv at the gRPC server s. The server
+// must be configured to use rpc.ServerOption()
+func RegisterFederationServer(s *grpc.Server, srv FederationServer) {
+	s.RegisterService(&federationServiceDesc, srv)
+}
+
+var federationServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sigma.federation.Federation",
+	HandlerType: (*FederationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Functions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(Empty)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(FederationServer).Functions(ctx, in)
+			},
+		},
+		{
+			MethodName: "Dispatch",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(ForwardRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(FederationServer).Dispatch(ctx, in)
+			},
+		},
+	},
+}
+
+type federationClient struct {
+	cc *grpc.ClientConn
+
+	// name and secret authenticate the local controller at the peer
+	name   string
+	secret string
+}
+
+func (c *federationClient) context(ctx context.Context) context.Context {
+	return metadata.NewOutgoingContext(ctx, metadata.Pairs(PeerHeader, c.name, SecretHeader, c.secret))
+}
+
+func (c *federationClient) Functions(ctx context.Context, in *Empty) (*Advertisement, error) {
+	out := new(Advertisement)
+	if err := grpc.Invoke(c.context(ctx), "/sigma.federation.Federation/Functions", in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *federationClient) Dispatch(ctx context.Context, in *ForwardRequest) (*ForwardResponse, error) {
+	out := new(ForwardResponse)
+	if err := grpc.Invoke(c.context(ctx), "/sigma.federation.Federation/Dispatch", in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package federation
+
+import "github.com/homebot/sigma"
+
+// Peer describes a remote sigma controller
+type Peer struct {
+	// Name is the name of the peer controller
+	Name string `json:"name" yaml:"name"`
+
+	// Address is the address of the peer's federation service
+	Address string `json:"address" yaml:"address"`
+
+	// Region is the region of the peer. If empty, the region advertised
+	// by the peer is used
+	Region string `json:"region,omitempty" yaml:"region,omitempty"`
+}
+
+// Advertisement lists the functions hosted by a controller
+type Advertisement struct {
+	// Controller is the name of the advertising controller
+	Controller string `json:"controller"`
+
+	// Region is the region of the advertising controller
+	Region string `json:"region,omitempty"`
+
+	// Functions holds the names of all functions hosted by the controller
+	Functions []string `json:"functions"`
+}
+
+// ForwardRequest is sent to a peer to dispatch an event to a function
+// hosted by the peer
+type ForwardRequest struct {
+	// Origin is the name of the controller that forwarded the event
+	Origin string `json:"origin"`
+
+	// Function is the name of the target function
+	Function string `json:"function"`
+
+	// Type is the type of the event
+	Type string `json:"type"`
+
+	// Payload is the payload of the event
+	Payload []byte `json:"payload"`
+
+	// Metadata holds the invocation metadata of the event
+	Metadata sigma.Metadata `json:"metadata,omitempty"`
+}
+
+// ForwardResponse holds the result of a forwarded invocation
+type ForwardResponse struct {
+	// Node is the node that executed the function
+	Node string `json:"node"`
+
+	// Result holds the result of the function
+	Result []byte `json:"result"`
+}
+
+// Empty is an empty message
+type Empty struct{}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -16,10 +17,15 @@ import (
 	"github.com/homebot/insight/logger"
 	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
 	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/authz"
 	"github.com/homebot/sigma/autoscale"
+	"github.com/homebot/sigma/capture"
 	"github.com/homebot/sigma/metrics"
 	"github.com/homebot/sigma/node"
 	"github.com/homebot/sigma/trigger"
+	"github.com/homebot/sigma/trigger/buffer"
+	"github.com/homebot/sigma/urn"
+	"github.com/homebot/sigma/validation"
 )
 
 var (
@@ -30,6 +36,11 @@ var (
 	// ErrRunning is returned  when the controller registry is assumed to be stopped
 	ErrRunning = errors.New("controller registry already running")
 
+	// ErrRecreateRequired is returned by Update if the spec changes fields
+	// that are only evaluated when the function is created, e.g. triggers
+	// or scaling policies
+	ErrRecreateRequired = errors.New("changes require the function to be recreated")
+
 	// ErrUnknownController is returned when the node controller in question does not
 	// exist
 	ErrUnknownController = errors.New("unknown node controller")
@@ -50,6 +61,13 @@ var (
 	ErrMissingDeployer = errors.New("auto-scaling can only be used with a node launcher")
 )
 
+// EventRouter dispatches an event to another function
+type EventRouter func(function string, event sigma.Event) error
+
+// TriggerDispatcher dispatches trigger events to the function itself. It
+// returns the ID of the selected node, the result and any error encountered
+type TriggerDispatcher func(event sigma.Event) (string, []byte, error)
+
 // ControlLoopHook is executed during each interation of the function controllers
 // control loop
 type ControlLoopHook func(c Controller)
@@ -95,6 +113,35 @@ type Controller interface {
 	// DetachControlLoopHook removes a control loop hook from the function
 	// controller
 	DetachControlLoopHook(hook ControlLoopHook) error
+
+	// Update replaces the function spec. If the update requires a
+	// restart, nodes are notified about the update and replaced by the
+	// control loop using a rolling restart. Triggers and scaling
+	// policies are not rebuilt, changing them returns
+	// ErrRecreateRequired
+	Update(spec sigma.FunctionSpec) error
+
+	// Captures returns the captured invocations of the function
+	Captures() []capture.Record
+
+	// Attach puts a node into debug mode for at most the given duration
+	Attach(node string, timeout time.Duration) (DebugSession, error)
+
+	// Detach ends the debug session of a node
+	Detach(node string) error
+
+	// DebugSessions returns all active debug sessions
+	DebugSessions() []DebugSession
+
+	// Pause pauses the function until Resume is called
+	Pause(Pause) error
+
+	// Resume resumes a function paused using Pause
+	Resume() error
+
+	// Paused returns the pause of the function, either requested using
+	// Pause or due to a maintenance window. Nil if it is not paused
+	Paused() *Pause
 }
 
 type controller struct {
@@ -103,13 +150,58 @@ type controller struct {
 	event          event.Dispatcher
 	deployer       node.Deployer
 	triggerBuilder trigger.Builder
+	router         EventRouter
+	dispatcher     TriggerDispatcher
+
+	// authorizer authorizes trigger events, may be nil
+	authorizer authz.Authorizer
 
 	triggers map[string]trigger.Trigger
 
+	// buffer holds trigger events that could not be dispatched
+	// because no node was reachable
+	buffer buffer.Buffer
+
+	// validator validates event payloads and results, may be nil
+	validator *validation.Validator
+
+	// recorder captures sampled invocations, may be nil
+	recorder *capture.Recorder
+
 	// registered controllers
 	rw          sync.RWMutex
 	controllers map[string]node.Controller
 
+	// draining holds nodes that are about to be recycled and must not
+	// be selected for new events
+	draining map[string]struct{}
+
+	// debugging holds nodes with an attached debugger. Those nodes are
+	// not selected for events and excluded from scaling and replacement
+	debugging map[string]DebugSession
+
+	// inflight tracks the pending invocations of each node
+	inflight map[string]*sync.WaitGroup
+
+	// paused is set while the function is paused using Pause. windows
+	// holds the maintenance windows of the spec
+	paused  *Pause
+	windows []window
+
+	// drained is set once the nodes of a paused function have been
+	// drained and holds the number of nodes to redeploy on resume
+	drained      bool
+	drainedNodes int
+
+	// node recycling limits, zero if disabled
+	recycleAge         time.Duration
+	recycleInvocations int64
+
+	// generation is incremented on every spec update. generations holds
+	// the generation each node has been deployed with
+	generation  int
+	generations map[string]int
+
 	// control loop management
 	stop chan struct{}
 	wg   sync.WaitGroup
@@ -125,7 +217,7 @@ type controller struct {
 }
 
 func (ctrl *controller) Name() resource.Name {
-	return resource.Name(ctrl.spec.ID)
+	return resource.Name(ctrl.FunctionSpec().ID)
 }
 
 // Start starts the function controllers' control loop
@@ -159,6 +251,11 @@ func (ctrl *controller) Start() error {
 	ctrl.wg.Add(1)
 	go ctrl.controlLoop(ctrl.stop)
 
+	if ctrl.buffer != nil {
+		ctrl.wg.Add(1)
+		go ctrl.flushLoop(ctrl.stop)
+	}
+
 	return nil
 }
 
@@ -174,11 +271,14 @@ func (ctrl *controller) handleTrigger(t trigger.Trigger, tSpec sigma.TriggerSpec
 
 		ok, err := trigger.Evaluate(tSpec.Condition, evt, values)
 		if ok && err == nil {
-			_, res, err := ctrl.Dispatch(evt)
-			if err != nil {
-				ctrl.l.Errorf("failed to dispatch trigger event %q: %s", evt.Type(), err)
+			evt = sigma.WithMetadata(evt, sigma.Metadata{
+				sigma.MetadataSource: tSpec.Type,
+			})
+
+			if len(tSpec.Rules) == 0 {
+				ctrl.dispatchTriggerEvent(evt, t)
 			} else {
-				ctrl.l.Infof("dispatched trigger event %q: %s", evt.Type(), string(res))
+				ctrl.routeTriggerEvent(t, tSpec, evt, values)
 			}
 		} else if err != nil {
 			ctrl.l.Errorf("trigger spec %q: failed to evaluate condition %q: %s", tSpec.Type, tSpec.Condition, err)
@@ -188,6 +288,167 @@ func (ctrl *controller) handleTrigger(t trigger.Trigger, tSpec sigma.TriggerSpec
 	}
 }
 
+// routeTriggerEvent applies the rules of the trigger spec and dispatches
+// the resulting events. Events not matched by any rule are dropped
+func (ctrl *controller) routeTriggerEvent(t trigger.Trigger, tSpec sigma.TriggerSpec, evt sigma.Event, values utils.ValueMap) {
+	routes, err := trigger.Apply(tSpec.Rules, evt, values)
+	if err != nil {
+		ctrl.l.Errorf("trigger spec %q: failed to apply rules: %s", tSpec.Type, err)
+		return
+	}
+
+	if len(routes) == 0 {
+		ctrl.l.Debugf("trigger spec %s: no rule matched event %q", tSpec.Type, evt.Type())
+		return
+	}
+
+	self := ctrl.Name().String()
+
+	for _, route := range routes {
+		if len(route.Functions) == 0 {
+			ctrl.dispatchTriggerEvent(route.Event, t)
+			continue
+		}
+
+		for _, fn := range route.Functions {
+			if fn == self {
+				ctrl.dispatchTriggerEvent(route.Event, t)
+				continue
+			}
+
+			if ctrl.router == nil {
+				ctrl.l.Errorf("trigger spec %s: cannot route event %q to %s: no event router", tSpec.Type, evt.Type(), fn)
+				continue
+			}
+
+			if err := ctrl.router(fn, route.Event); err != nil {
+				ctrl.l.Errorf("trigger spec %s: failed to route event %q to %s: %s", tSpec.Type, evt.Type(), fn, err)
+			}
+		}
+	}
+}
+
+// dispatchTriggerEvent dispatches a trigger event. If an event buffer is
+// configured and the function is unreachable the event is buffered and
+// will be dispatched by the flush loop once the function is reachable again.
+// If t is a trigger.Responder it receives the result of the function
+func (ctrl *controller) dispatchTriggerEvent(evt sigma.Event, t trigger.Trigger) {
+	if !ctrl.authorizeTriggerEvent(evt) {
+		return
+	}
+
+	if p := ctrl.Paused(); p != nil {
+		ctrl.holdTriggerEvent(evt, p)
+		return
+	}
+
+	// while events are buffered, new events must be queued as well
+	// so they are dispatched in order
+	if ctrl.buffer != nil && ctrl.buffer.Len() > 0 {
+		ctrl.bufferEvent(evt)
+		return
+	}
+
+	_, res, err := ctrl.dispatchTrigger(evt)
+	if err != nil && ctrl.buffer != nil && isUnreachable(err) {
+		ctrl.l.Warnf("function unreachable, buffering trigger event %q: %s", evt.Type(), err)
+		ctrl.bufferEvent(evt)
+	} else if err != nil {
+		ctrl.l.Errorf("failed to dispatch trigger event %q: %s", evt.Type(), err)
+	} else {
+		ctrl.l.Infof("dispatched trigger event %q: %s", evt.Type(), string(res))
+
+		if r, ok := t.(trigger.Responder); ok {
+			if err := r.Respond(evt, res); err != nil {
+				ctrl.l.Errorf("failed to handle result of trigger event %q: %s", evt.Type(), err)
+			}
+		}
+	}
+}
+
+// dispatchTrigger dispatches a trigger event using the trigger dispatcher
+// or directly if none has been configured
+func (ctrl *controller) dispatchTrigger(evt sigma.Event) (string, []byte, error) {
+	if ctrl.dispatcher != nil {
+		return ctrl.dispatcher(evt)
+	}
+
+	return ctrl.Dispatch(evt)
+}
+
+// authorizeTriggerEvent returns true if the authorizer permits evt to be
+// dispatched to the function. Trigger events do not carry an identity
+func (ctrl *controller) authorizeTriggerEvent(evt sigma.Event) bool {
+	if ctrl.authorizer == nil {
+		return true
+	}
+
+	err := ctrl.authorizer.Authorize(context.Background(), authz.Request{
+		Function: ctrl.Name().String(),
+		Event:    evt,
+	})
+	if err != nil {
+		ctrl.l.Warnf("trigger event %q denied: %s", evt.Type(), err)
+		return false
+	}
+
+	return true
+}
+
+func (ctrl *controller) bufferEvent(evt sigma.Event) {
+	if err := ctrl.buffer.Push(evt); err != nil {
+		ctrl.l.Errorf("failed to buffer trigger event %q: %s", evt.Type(), err)
+	}
+}
+
+// flushLoop dispatches buffered trigger events in order as soon as the
+// function is reachable again
+func (ctrl *controller) flushLoop(stop chan struct{}) {
+	defer ctrl.wg.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Second):
+		}
+
+		for {
+			evt, err := ctrl.buffer.Peek()
+			if err != nil {
+				break
+			}
+
+			_, _, err = ctrl.dispatchTrigger(evt)
+			if err != nil && isUnreachable(err) {
+				break
+			}
+
+			if err != nil {
+				ctrl.l.Errorf("failed to dispatch buffered trigger event %q: %s", evt.Type(), err)
+			} else {
+				ctrl.l.Infof("dispatched buffered trigger event %q", evt.Type())
+			}
+
+			if err := ctrl.buffer.Pop(); err != nil {
+				ctrl.l.Errorf("failed to remove trigger event from buffer: %s", err)
+				break
+			}
+		}
+	}
+}
+
+// isUnreachable returns true if err indicates that the function could not be
+// reached rather than the function reporting an error
+func isUnreachable(err error) bool {
+	switch err.(type) {
+	case node.ExecutionError, node.BudgetExceededError, *validation.Error:
+		return false
+	default:
+		return true
+	}
+}
+
 // Stop stops the function controller control loop
 func (ctrl *controller) Stop() error {
 	ctrl.rw.Lock()
@@ -233,6 +494,7 @@ func (ctrl *controller) DestroyAll() error {
 			ctrl.l.Warnf("failed to destroy node %s: %s", key, err)
 		}
 		delete(ctrl.controllers, key)
+		delete(ctrl.inflight, key)
 	}
 
 	return firstErr
@@ -244,6 +506,10 @@ func (ctrl *controller) AddNodeController(n node.Controller) error {
 	defer ctrl.rw.Unlock()
 
 	ctrl.controllers[n.URN()] = n
+	if _, ok := ctrl.inflight[n.URN()]; !ok {
+		ctrl.inflight[n.URN()] = &sync.WaitGroup{}
+	}
+	ctrl.generations[n.URN()] = ctrl.generation
 
 	ctrl.l.Infof("node %s attached to controller", n.URN())
 
@@ -265,6 +531,10 @@ func (ctrl *controller) DestroyNode(u string) error {
 	ctrl.l.Infof("destroying node %s", u)
 
 	delete(ctrl.controllers, u)
+	delete(ctrl.draining, u)
+	delete(ctrl.debugging, u)
+	delete(ctrl.generations, u)
+	delete(ctrl.inflight, u)
 
 	//ctrl.dispatchEvent(urn.SigmaEventNodeDestroyed, u.Resource(), nil)
 
@@ -277,8 +547,18 @@ func (ctrl *controller) Nodes() map[string]node.State {
 	defer ctrl.rw.RUnlock()
 
 	m := make(map[string]node.State)
-	for key, node := range ctrl.controllers {
-		m[key] = node.State()
+	for key, n := range ctrl.controllers {
+		if _, ok := ctrl.draining[key]; ok {
+			m[key] = node.StateDisabled
+			continue
+		}
+
+		state := n.State()
+		if _, ok := ctrl.debugging[key]; ok && state.IsHealthy() {
+			state = node.StateDebugging
+		}
+
+		m[key] = state
 	}
 
 	return m
@@ -299,13 +579,109 @@ func (ctrl *controller) Stats() map[string]node.Stats {
 
 // FunctionSpec returns the function spec of the controller registry
 func (ctrl *controller) FunctionSpec() sigma.FunctionSpec {
+	ctrl.rw.RLock()
+	defer ctrl.rw.RUnlock()
+
 	return ctrl.spec
 }
 
+// Update replaces the function spec. Changes to fields only used by the
+// controller are applied immediately, otherwise all nodes are notified
+// about the update and replaced by the control loop
+func (ctrl *controller) Update(spec sigma.FunctionSpec) error {
+	validator, err := validation.New(spec.Schema)
+	if err != nil {
+		return err
+	}
+
+	recorder, err := capture.New(spec.Debug)
+	if err != nil {
+		return err
+	}
+
+	windows, err := parseWindows(spec.Maintenance)
+	if err != nil {
+		return err
+	}
+
+	recycleAge, recycleInvocations, err := parseRecycle(spec.Recycle)
+	if err != nil {
+		return err
+	}
+
+	if ctrl.deployer == nil && (recycleAge > 0 || recycleInvocations > 0) {
+		return ErrMissingDeployer
+	}
+
+	ctrl.rw.Lock()
+	if spec.ID != ctrl.spec.ID {
+		ctrl.rw.Unlock()
+		return errors.New("function ID must not change")
+	}
+
+	changes, err := sigma.DiffSpecs(ctrl.spec, spec)
+	if err != nil {
+		ctrl.rw.Unlock()
+		return err
+	}
+
+	// storing the spec without applying those changes would hide them
+	// from future plans
+	for _, c := range changes {
+		if c.Effect == sigma.EffectRecreate {
+			ctrl.rw.Unlock()
+			return ErrRecreateRequired
+		}
+	}
+
+	ctrl.spec = spec
+	ctrl.validator = validator
+	ctrl.recorder = recorder
+	ctrl.windows = windows
+	ctrl.recycleAge = recycleAge
+	ctrl.recycleInvocations = recycleInvocations
+
+	if !sigma.NeedsRestart(changes) {
+		ctrl.rw.Unlock()
+
+		ctrl.l.Infof("function updated without restart")
+		return nil
+	}
+
+	ctrl.generation++
+
+	ctrl.l.Infof("function updated to generation %d", ctrl.generation)
+
+	notifiers := make(map[string]node.Notifier)
+	for id, n := range ctrl.controllers {
+		if notifier, ok := n.(node.Notifier); ok {
+			notifiers[id] = notifier
+		}
+	}
+	ctrl.rw.Unlock()
+
+	// sending may block while a node is disconnected so don't hold
+	// the lock
+	for id, notifier := range notifiers {
+		if err := notifier.Notify(node.EventUpdateAvailable, nil); err != nil {
+			ctrl.l.Warnf("failed to notify node %s about update: %s", id, err)
+		}
+	}
+
+	return nil
+}
+
 // Dispatch dispatches an event to a healthy and idle controller
 func (ctrl *controller) Dispatch(event sigma.Event) (selectedNode string, result []byte, err error) {
 	defer func() {
+		metrics.Inc("function.invocations." + ctrl.Name().String())
 		if err != nil {
+			metrics.Inc("function.failures." + ctrl.Name().String())
+
+			if _, ok := err.(node.BudgetExceededError); ok {
+				metrics.Inc("function.budget_exceeded." + ctrl.Name().String())
+			}
+
 			n := selectedNode
 			if n == "" {
 				n = ctrl.Name().String()
@@ -317,31 +693,110 @@ func (ctrl *controller) Dispatch(event sigma.Event) (selectedNode string, result
 	}()
 
 	ctrl.rw.RLock()
-	defer ctrl.rw.RUnlock()
+	validator := ctrl.validator
+	recorder := ctrl.recorder
+	paused := ctrl.pause(time.Now()) != nil
+	ctrl.rw.RUnlock()
 
-	for id, node := range ctrl.controllers {
-		if node.State().CanSelect() {
-			selectedNode = id
-			result, err = node.Dispatch(context.Background(), &sigmaV1.DispatchEvent{
-				Urn:     id,
-				Payload: event.Payload(),
-			})
+	if paused {
+		err = ErrPaused
+		return
+	}
 
-			if err == nil {
-				ctrl.l.Infof("dispatched event to %s", selectedNode)
-			} else {
-				ctrl.l.Warnf("failed to dispatch event: %s (selected-node %s)", err, selectedNode)
+	if recorder.Sample() {
+		start := time.Now()
+
+		defer func() {
+			rec := capture.Record{
+				ID:       uuid.NewV4().String(),
+				Node:     selectedNode,
+				Time:     start,
+				Duration: time.Since(start),
+				Metadata: sigma.EventMetadata(event),
+				Request:  event.Payload(),
+				Response: result,
+			}
+			if err != nil {
+				rec.Error = err.Error()
 			}
 
-			return
+			recorder.Record(rec)
+		}()
+	}
+
+	if err = ctrl.validate(validator, validator.Input(event.Payload())); err != nil {
+		return
+	}
+
+	defer func() {
+		if err == nil {
+			err = ctrl.validate(validator, validator.Output(result))
+			if err != nil {
+				result = nil
+			}
+		}
+	}()
+
+	ctx := node.WithMetadata(context.Background(), sigma.EventMetadata(event))
+
+	// the invocation is tracked so nodes are only taken out of the pool
+	// once it finished
+	var (
+		selected node.Controller
+		inflight *sync.WaitGroup
+	)
+
+	ctrl.rw.RLock()
+	for id, n := range ctrl.controllers {
+		if _, ok := ctrl.draining[id]; ok {
+			continue
+		}
+
+		if _, ok := ctrl.debugging[id]; ok {
+			continue
+		}
+
+		if n.State().CanSelect() {
+			selectedNode, selected = id, n
+			inflight = ctrl.inflight[id]
+			inflight.Add(1)
+			break
 		}
 	}
+	ctrl.rw.RUnlock()
 
-	err = ErrNoSelectableNodes
+	if selected == nil {
+		err = ErrNoSelectableNodes
+		return
+	}
+	defer inflight.Done()
+
+	result, err = selected.Dispatch(ctx, &sigmaV1.DispatchEvent{
+		Urn:     selectedNode,
+		Payload: event.Payload(),
+	})
+
+	if err == nil {
+		ctrl.l.Infof("dispatched event to %s", selectedNode)
+	} else {
+		ctrl.l.Warnf("failed to dispatch event: %s (selected-node %s)", err, selectedNode)
+	}
 
 	return
 }
 
+// waitIdle waits until all pending invocations of node id finished. The
+// node must already be excluded from selection
+func (ctrl *controller) waitIdle(id string) {
+	ctrl.rw.RLock()
+	inflight := ctrl.inflight[id]
+	ctrl.rw.RUnlock()
+
+	if inflight != nil {
+		inflight.Wait()
+	}
+}
+
 // AttachControlLoopHook attaches a new control loop hook to the function controller
 func (ctrl *controller) AttachControlLoopHook(hook ControlLoopHook) error {
 	ctrl.hookLock.Lock()
@@ -387,6 +842,10 @@ func NewController(spec sigma.FunctionSpec, opts ...ControllerOption) (Controlle
 		spec:        spec,
 		metrics:     metrics.GetMetrics(),
 		controllers: make(map[string]node.Controller),
+		draining:    make(map[string]struct{}),
+		debugging:   make(map[string]DebugSession),
+		inflight:    make(map[string]*sync.WaitGroup),
+		generations: make(map[string]int),
 		triggers:    make(map[string]trigger.Trigger),
 	}
 
@@ -401,6 +860,32 @@ func NewController(spec sigma.FunctionSpec, opts ...ControllerOption) (Controlle
 		return nil, ErrMissingDeployer
 	}
 
+	var err error
+	ctrl.recycleAge, ctrl.recycleInvocations, err = parseRecycle(spec.Recycle)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctrl.deployer == nil && (ctrl.recycleAge > 0 || ctrl.recycleInvocations > 0) {
+		return nil, ErrMissingDeployer
+	}
+
+	validator, err := validation.New(spec.Schema)
+	if err != nil {
+		return nil, err
+	}
+	ctrl.validator = validator
+
+	ctrl.recorder, err = capture.New(spec.Debug)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrl.windows, err = parseWindows(spec.Maintenance)
+	if err != nil {
+		return nil, err
+	}
+
 	if ctrl.l == nil {
 		ctrl.l, _ = logger.NewInsightLogger(logger.WithResource(spec.ID))
 	}
@@ -408,6 +893,53 @@ func NewController(spec sigma.FunctionSpec, opts ...ControllerOption) (Controlle
 	return ctrl, nil
 }
 
+// parseRecycle returns the node recycling limits of policy
+func parseRecycle(policy *sigma.RecyclePolicy) (time.Duration, int64, error) {
+	if policy == nil {
+		return 0, 0, nil
+	}
+
+	var age time.Duration
+	if policy.MaxAge != "" {
+		d, err := time.ParseDuration(policy.MaxAge)
+		if err != nil {
+			return 0, 0, err
+		}
+		age = d
+	}
+
+	return age, policy.MaxInvocations, nil
+}
+
+// Captures returns the captured invocations and implements Controller
+func (ctrl *controller) Captures() []capture.Record {
+	ctrl.rw.RLock()
+	defer ctrl.rw.RUnlock()
+
+	return ctrl.recorder.Records()
+}
+
+// validate handles a schema validation result. Violations are counted
+// and returned if the schema is enforced, otherwise they are only logged
+func (ctrl *controller) validate(validator *validation.Validator, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	counter := "function.schema.input_violations"
+	if verr, ok := err.(*validation.Error); ok && verr.Output {
+		counter = "function.schema.output_violations"
+	}
+	metrics.Inc(counter)
+
+	if validator.Enforce() {
+		return err
+	}
+
+	ctrl.l.Warnf("schema violation: %s", err)
+	return nil
+}
+
 func (ctrl *controller) runHooks() {
 	ctrl.hookLock.RLock()
 	defer ctrl.hookLock.RUnlock()
@@ -451,22 +983,158 @@ func (ctrl *controller) deployNode(ch chan error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
+	ch <- ctrl.deploy(ctx)
+}
+
+// deploy deploys a new node, waits for it to register and attaches it to
+// the function controller
+func (ctrl *controller) deploy(ctx context.Context) error {
 	ctrl.l.Infof("deploying a new node ...")
 
-	newUrn := uuid.NewV4().String() //urn.SigmaInstanceResource.BuildURN(u.Namespace(), u.AccountID(), fmt.Sprintf("%s/%s", u.Resource(), uuid.NewV4().String()))
+	ctrl.rw.RLock()
+	spec, generation := ctrl.spec, ctrl.generation
+	ctrl.rw.RUnlock()
 
-	controller, err := ctrl.deployer.Deploy(ctx, newUrn, ctrl.spec)
+	newUrn, err := urn.NewInstance(spec.ID, strconv.Itoa(generation))
 	if err != nil {
-		ch <- err
-		return
+		return err
+	}
+
+	controller, err := ctrl.deployer.Deploy(ctx, newUrn.String(), spec)
+	if err != nil {
+		return err
 	}
 
 	if err := ctrl.AddNodeController(controller); err != nil {
-		ch <- err
+		return err
+	}
+
+	// the spec may have been updated while the node was deployed
+	ctrl.rw.Lock()
+	ctrl.generations[controller.URN()] = generation
+	ctrl.rw.Unlock()
+
+	return nil
+}
+
+// outdatedNodes returns all nodes deployed with a previous version of the
+// function spec
+func (ctrl *controller) outdatedNodes() []string {
+	ctrl.rw.RLock()
+	defer ctrl.rw.RUnlock()
+
+	var res []string
+	for id := range ctrl.controllers {
+		if _, ok := ctrl.debugging[id]; ok {
+			continue
+		}
+
+		if ctrl.generations[id] < ctrl.generation {
+			res = append(res, id)
+		}
+	}
+
+	return res
+}
+
+// rollout replaces outdated nodes in batches of at most MaxUnavailable
+// nodes. If MaxUnavailable is zero, each replacement is deployed before
+// the outdated node is removed
+func (ctrl *controller) rollout() {
+	outdated := ctrl.outdatedNodes()
+	if len(outdated) == 0 {
 		return
 	}
 
-	ch <- nil
+	if ctrl.deployer == nil {
+		ctrl.l.Warnf("%d outdated nodes but no deployer configured", len(outdated))
+		return
+	}
+
+	maxUnavailable := sigma.DefaultMaxUnavailable
+	if policy := ctrl.FunctionSpec().Update; policy != nil {
+		maxUnavailable = policy.MaxUnavailable
+	}
+
+	ctrl.l.Infof("rolling update of %d nodes (max-unavailable %d)", len(outdated), maxUnavailable)
+
+	if maxUnavailable <= 0 {
+		for _, id := range outdated {
+			ctrl.recycleNode(id)
+		}
+		return
+	}
+
+	for len(outdated) > 0 {
+		n := maxUnavailable
+		if n > len(outdated) {
+			n = len(outdated)
+		}
+
+		batch := outdated[:n]
+		outdated = outdated[n:]
+
+		for _, id := range batch {
+			ctrl.drainNode(id)
+		}
+
+		ctrl.scaleUp(n)
+	}
+}
+
+// needsRecycling returns true if a node with the given statistics exceeds
+// the recycling policy of the function
+func (ctrl *controller) needsRecycling(stats node.Stats) bool {
+	if ctrl.recycleAge > 0 && !stats.CreatedAt.IsZero() && time.Since(stats.CreatedAt) > ctrl.recycleAge {
+		return true
+	}
+
+	return ctrl.recycleInvocations > 0 && stats.Invocations >= ctrl.recycleInvocations
+}
+
+// recycleNodes replaces all nodes that exceed the recycling policy
+func (ctrl *controller) recycleNodes() {
+	if ctrl.recycleAge == 0 && ctrl.recycleInvocations == 0 {
+		return
+	}
+
+	for id, stats := range ctrl.Stats() {
+		if ctrl.needsRecycling(stats) && !ctrl.isDebugging(id) {
+			ctrl.recycleNode(id)
+		}
+	}
+}
+
+// recycleNode replaces the node id. A replacement is deployed and registered
+// before the old node is drained and destroyed so no invocations are dropped.
+// If the replacement cannot be deployed, the old node is kept
+func (ctrl *controller) recycleNode(id string) {
+	ctrl.l.Infof("recycling node %s", id)
+
+	// Deploying the node should not take longer than 10 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if err := ctrl.deploy(ctx); err != nil {
+		ctrl.l.Errorf("failed to deploy replacement for node %s: %s", id, err)
+		return
+	}
+
+	ctrl.drainNode(id)
+}
+
+// drainNode stops selecting the node for new events and destroys it once
+// all pending invocations have finished
+func (ctrl *controller) drainNode(id string) {
+	ctrl.rw.Lock()
+	ctrl.draining[id] = struct{}{}
+	ctrl.rw.Unlock()
+
+	ctrl.waitIdle(id)
+
+	if err := ctrl.DestroyNode(id); err != nil {
+		ctrl.l.Warnf("failed to destroy node %s: %s", id, err)
+	}
 }
 
 func (ctrl *controller) scaleDown(amount int) {
@@ -523,14 +1191,37 @@ func (ctrl *controller) controlLoop(stop chan struct{}) {
 			}
 		}
 
+		// return nodes to the pool once their debug session expired
+		ctrl.expireDebugSessions()
+
+		// paused functions keep no nodes and the auto-scaler is frozen
+		// until they are resumed
+		paused := ctrl.Paused() != nil
+		if paused {
+			ctrl.drainAll()
+		} else {
+			// redeploy the nodes drained while the function was paused
+			// or within a maintenance window
+			ctrl.restoreNodes()
+
+			// replace nodes that exceed the recycling policy or have
+			// been deployed with an outdated spec
+			ctrl.recycleNodes()
+			ctrl.rollout()
+		}
+
 		// Next, we'll update the current node statistics
 		ctrl.rw.Lock()
-		metrics := ctrl.metrics.Update(ctrl.controllers)
+		values := ctrl.metrics.Update(ctrl.controllers)
 		ctrl.rw.Unlock()
 
+		for key, value := range values {
+			metrics.Gauge("function."+key+"."+ctrl.Name().String(), value)
+		}
+
 		// Now, run the auto-scaler (if we have one)
-		if ctrl.autoScaler != nil {
-			selected, direction, amount := ctrl.autoScaler.Check(metrics, ctrl.Nodes())
+		if ctrl.autoScaler != nil && !paused {
+			selected, direction, amount := ctrl.autoScaler.Check(values, ctrl.Nodes())
 
 			if direction != autoscale.ScaleNop {
 				what := "create"
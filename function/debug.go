@@ -0,0 +1,146 @@
+package function
+
+import (
+	"errors"
+	"time"
+
+	"github.com/homebot/sigma/node"
+)
+
+// DefaultDebugSessionTimeout is the duration of debug sessions if no
+// timeout has been requested
+const DefaultDebugSessionTimeout = 30 * time.Minute
+
+var (
+	// ErrAlreadyAttached is returned by Attach if a debugger is already
+	// attached to the node
+	ErrAlreadyAttached = errors.New("debugger already attached")
+
+	// ErrNotAttached is returned by Detach if no debugger is attached to
+	// the node
+	ErrNotAttached = errors.New("no debugger attached")
+)
+
+// DebugSession describes a node in debug mode
+type DebugSession struct {
+	// Node is the ID of the node
+	Node string `json:"node"`
+
+	// Address is the address the debugger of the node can be reached at
+	Address string `json:"address"`
+
+	// Expires is the time the node is put back into the pool if the
+	// session has not been detached before
+	Expires time.Time `json:"expires"`
+}
+
+// Attach puts the node id into debug mode. The node is no longer selected
+// for events and asked to open its debugger until the session is detached
+// or timeout elapsed
+func (ctrl *controller) Attach(id string, timeout time.Duration) (DebugSession, error) {
+	if timeout <= 0 {
+		timeout = DefaultDebugSessionTimeout
+	}
+
+	ctrl.rw.Lock()
+	n, ok := ctrl.controllers[id]
+	if _, draining := ctrl.draining[id]; !ok || draining {
+		ctrl.rw.Unlock()
+		return DebugSession{}, ErrUnknownController
+	}
+
+	if _, ok := ctrl.debugging[id]; ok {
+		ctrl.rw.Unlock()
+		return DebugSession{}, ErrAlreadyAttached
+	}
+
+	dbg, ok := n.(node.Debugger)
+	if !ok {
+		ctrl.rw.Unlock()
+		return DebugSession{}, node.ErrNotDebuggable
+	}
+
+	session := DebugSession{
+		Node:    id,
+		Expires: time.Now().Add(timeout),
+	}
+	ctrl.debugging[id] = session
+	ctrl.rw.Unlock()
+
+	// pending invocations finish before the node is taken out of the pool
+	ctrl.waitIdle(id)
+
+	addr, err := dbg.Attach(timeout)
+
+	ctrl.rw.Lock()
+	defer ctrl.rw.Unlock()
+
+	if err != nil {
+		delete(ctrl.debugging, id)
+		return DebugSession{}, err
+	}
+
+	session.Address = addr
+	ctrl.debugging[id] = session
+
+	ctrl.l.Infof("debugger of node %s attached at %s until %s", id, addr, session.Expires)
+
+	return session, nil
+}
+
+// Detach ends the debug session of node id and puts the node back into
+// the pool
+func (ctrl *controller) Detach(id string) error {
+	ctrl.rw.Lock()
+	if _, ok := ctrl.debugging[id]; !ok {
+		ctrl.rw.Unlock()
+		return ErrNotAttached
+	}
+
+	n := ctrl.controllers[id]
+	delete(ctrl.debugging, id)
+	ctrl.rw.Unlock()
+
+	ctrl.l.Infof("debugger of node %s detached", id)
+
+	if dbg, ok := n.(node.Debugger); ok {
+		return dbg.Detach()
+	}
+	return nil
+}
+
+// DebugSessions returns all active debug sessions
+func (ctrl *controller) DebugSessions() []DebugSession {
+	ctrl.rw.RLock()
+	defer ctrl.rw.RUnlock()
+
+	var res []DebugSession
+	for _, s := range ctrl.debugging {
+		res = append(res, s)
+	}
+	return res
+}
+
+// isDebugging returns true if a debugger is attached to node id
+func (ctrl *controller) isDebugging(id string) bool {
+	ctrl.rw.RLock()
+	defer ctrl.rw.RUnlock()
+
+	_, ok := ctrl.debugging[id]
+	return ok
+}
+
+// expireDebugSessions detaches all expired debug sessions
+func (ctrl *controller) expireDebugSessions() {
+	now := time.Now()
+
+	for _, s := range ctrl.DebugSessions() {
+		if now.After(s.Expires) {
+			ctrl.l.Infof("debug session of node %s expired", s.Node)
+
+			if err := ctrl.Detach(s.Node); err != nil && err != ErrNotAttached {
+				ctrl.l.Warnf("failed to detach debugger of node %s: %s", s.Node, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package function
+
+import (
+	"testing"
+	"time"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainNode(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := newTestController(t, sigma.FunctionSpec{ID: "fn"})
+
+	hung := &testNode{urn: "hung", started: make(chan struct{}), block: make(chan struct{})}
+	assert.NoError(ctrl.AddNodeController(hung))
+
+	dispatched := make(chan error, 1)
+	go func() {
+		_, _, err := ctrl.Dispatch(sigma.NewSimpleEvent("test", nil))
+		dispatched <- err
+	}()
+
+	<-hung.started
+
+	drained := make(chan struct{})
+	go func() {
+		ctrl.drainNode("hung")
+		close(drained)
+	}()
+
+	// pending invocations do not block other nodes from being managed
+	added := make(chan error, 1)
+	go func() { added <- ctrl.AddNodeController(&testNode{urn: "other"}) }()
+
+	select {
+	case err := <-added:
+		assert.NoError(err)
+	case <-time.After(time.Second):
+		t.Fatal("pending invocation blocked the controller")
+	}
+
+	// ... but the drained node is only destroyed once they finished
+	select {
+	case <-drained:
+		t.Fatal("node drained while an invocation was pending")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(hung.block)
+	assert.NoError(<-dispatched)
+	<-drained
+
+	_, ok := ctrl.Nodes()["hung"]
+	assert.False(ok)
+}
@@ -6,8 +6,10 @@ import (
 
 	"github.com/homebot/sigma/node"
 	"github.com/homebot/sigma/trigger"
+	"github.com/homebot/sigma/trigger/buffer"
 
 	"github.com/homebot/core/event"
+	"github.com/homebot/sigma/authz"
 	"github.com/homebot/sigma/autoscale"
 )
 
@@ -24,6 +26,15 @@ func WithEventDispatcher(disp event.Dispatcher) ControllerOption {
 	}
 }
 
+// WithAuthorizer configures the authorizer for trigger events. Events
+// denied by a are dropped
+func WithAuthorizer(a authz.Authorizer) ControllerOption {
+	return func(c *controller) error {
+		c.authorizer = a
+		return nil
+	}
+}
+
 // WithControlLoopInterval configures the interval for the function controllers
 // control loop
 func WithControlLoopInterval(duration time.Duration) ControllerOption {
@@ -113,3 +124,31 @@ func WithTriggerBuilder(b trigger.Builder) ControllerOption {
 		return nil
 	}
 }
+
+// WithEventRouter sets the router used to dispatch trigger events to other
+// functions as selected by trigger rules
+func WithEventRouter(r EventRouter) ControllerOption {
+	return func(c *controller) error {
+		c.router = r
+		return nil
+	}
+}
+
+// WithTriggerDispatcher sets the dispatcher used for trigger events and
+// buffered events instead of dispatching them to the function directly
+func WithTriggerDispatcher(d TriggerDispatcher) ControllerOption {
+	return func(c *controller) error {
+		c.dispatcher = d
+		return nil
+	}
+}
+
+// WithEventBuffer configures a buffer for trigger events that cannot be
+// dispatched because the function is unreachable. Buffered events are
+// dispatched in order once the function becomes reachable again
+func WithEventBuffer(b buffer.Buffer) ControllerOption {
+	return func(c *controller) error {
+		c.buffer = b
+		return nil
+	}
+}
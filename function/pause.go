@@ -0,0 +1,206 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/metrics"
+)
+
+var (
+	// ErrPaused is returned by Dispatch while the function is paused or
+	// within a maintenance window
+	ErrPaused = errors.New("function paused")
+
+	// ErrNotPaused is returned by Resume if the function has not been
+	// paused using Pause
+	ErrNotPaused = errors.New("function not paused")
+)
+
+// Pause describes why and how a function is paused
+type Pause struct {
+	// Reason describes why the function is paused
+	Reason string `json:"reason,omitempty"`
+
+	// Buffer buffers trigger events while the function is paused.
+	// Requires event buffering to be enabled, events are dropped
+	// otherwise
+	Buffer bool `json:"buffer"`
+
+	// Since is the time the function has been paused
+	Since time.Time `json:"since"`
+
+	// Until is the end of the maintenance window the function is paused
+	// for. Zero if the function has been paused using Pause
+	Until time.Time `json:"until,omitempty"`
+}
+
+// window is a parsed maintenance window
+type window struct {
+	start  time.Time
+	end    time.Time
+	reason string
+	buffer bool
+}
+
+// parseWindows parses the maintenance windows of a function spec
+func parseWindows(specs []sigma.MaintenanceWindow) ([]window, error) {
+	var res []window
+
+	for i, w := range specs {
+		start, err := time.Parse(time.RFC3339, w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %d: invalid start: %s", i, err)
+		}
+
+		end, err := time.Parse(time.RFC3339, w.End)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %d: invalid end: %s", i, err)
+		}
+
+		if !end.After(start) {
+			return nil, fmt.Errorf("maintenance window %d: end must be after start", i)
+		}
+
+		res = append(res, window{
+			start:  start,
+			end:    end,
+			reason: w.Reason,
+			buffer: w.Buffer,
+		})
+	}
+
+	return res, nil
+}
+
+// Pause pauses the function until Resume is called. Triggers stop
+// dispatching, the auto-scaler is frozen and all nodes are drained.
+// Pause blocks until pending invocations have finished
+func (ctrl *controller) Pause(p Pause) error {
+	if p.Since.IsZero() {
+		p.Since = time.Now()
+	}
+	p.Until = time.Time{}
+
+	ctrl.rw.Lock()
+	ctrl.paused = &p
+	ctrl.rw.Unlock()
+
+	ctrl.l.Infof("function paused: %s", p.Reason)
+
+	ctrl.drainAll()
+
+	return nil
+}
+
+// Resume resumes a function paused using Pause and redeploys the nodes
+// drained by it, at least one. Functions within a maintenance window stay
+// paused until the window ends
+func (ctrl *controller) Resume() error {
+	ctrl.rw.Lock()
+	if ctrl.paused == nil {
+		ctrl.rw.Unlock()
+		return ErrNotPaused
+	}
+	ctrl.paused = nil
+	ctrl.rw.Unlock()
+
+	ctrl.l.Infof("function resumed")
+
+	ctrl.restoreNodes()
+
+	return nil
+}
+
+// Paused returns the pause of the function or nil if it is not paused
+func (ctrl *controller) Paused() *Pause {
+	ctrl.rw.RLock()
+	defer ctrl.rw.RUnlock()
+
+	return ctrl.pause(time.Now())
+}
+
+// pause returns the manual pause or the maintenance window active at now.
+// Must be called with ctrl.rw held
+func (ctrl *controller) pause(now time.Time) *Pause {
+	if ctrl.paused != nil {
+		p := *ctrl.paused
+		return &p
+	}
+
+	for _, w := range ctrl.windows {
+		if !now.Before(w.start) && now.Before(w.end) {
+			return &Pause{
+				Reason: w.reason,
+				Buffer: w.buffer,
+				Since:  w.start,
+				Until:  w.end,
+			}
+		}
+	}
+
+	return nil
+}
+
+// holdTriggerEvent buffers or drops a trigger event received while the
+// function is paused
+func (ctrl *controller) holdTriggerEvent(evt sigma.Event, p *Pause) {
+	if p.Buffer && ctrl.buffer != nil {
+		ctrl.bufferEvent(evt)
+		return
+	}
+
+	metrics.Inc("function.paused_drops." + ctrl.Name().String())
+	ctrl.l.Warnf("function paused, dropping trigger event %q", evt.Type())
+}
+
+// drainAll drains all nodes that are not being debugged. The number of
+// nodes drained first is recorded so restoreNodes can redeploy them
+func (ctrl *controller) drainAll() {
+	ctrl.rw.Lock()
+	var ids []string
+	for id := range ctrl.controllers {
+		if _, ok := ctrl.debugging[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	if !ctrl.drained {
+		ctrl.drained = true
+		ctrl.drainedNodes = len(ids)
+	}
+	ctrl.rw.Unlock()
+
+	for _, id := range ids {
+		ctrl.drainNode(id)
+	}
+}
+
+// restoreNodes redeploys the nodes drained by drainAll once the function
+// is no longer paused. At least one node is deployed as the auto-scaler
+// cannot scale up a function without nodes
+func (ctrl *controller) restoreNodes() {
+	ctrl.rw.Lock()
+	if !ctrl.drained || ctrl.pause(time.Now()) != nil {
+		ctrl.rw.Unlock()
+		return
+	}
+
+	amount := ctrl.drainedNodes
+	if amount < 1 {
+		amount = 1
+	}
+	amount -= len(ctrl.controllers) - len(ctrl.debugging)
+
+	ctrl.drained = false
+	ctrl.drainedNodes = 0
+	ctrl.rw.Unlock()
+
+	if amount <= 0 || ctrl.deployer == nil {
+		return
+	}
+
+	ctrl.l.Infof("redeploying %d nodes after pause", amount)
+	ctrl.scaleUp(amount)
+}
@@ -0,0 +1,139 @@
+package function
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/node"
+	"github.com/stretchr/testify/assert"
+)
+
+type testNode struct {
+	urn string
+
+	// started receives a value when Dispatch is called and block blocks
+	// Dispatch until closed, if set
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (n *testNode) URN() string                     { return n.urn }
+func (n *testNode) State() node.State               { return node.StateActive }
+func (n *testNode) Stats() node.Stats               { return node.Stats{} }
+func (n *testNode) OnDestroy(func(node.Controller)) {}
+func (n *testNode) Close() error                    { return nil }
+
+func (n *testNode) Dispatch(context.Context, *sigmaV1.DispatchEvent) ([]byte, error) {
+	if n.started != nil {
+		n.started <- struct{}{}
+	}
+	if n.block != nil {
+		<-n.block
+	}
+	return nil, nil
+}
+
+// newTestController returns a controller deploying test nodes
+func newTestController(t *testing.T, spec sigma.FunctionSpec) *controller {
+	deployer := node.DeployFunc(func(ctx context.Context, u string, spec sigma.FunctionSpec) (node.Controller, error) {
+		return &testNode{urn: u}, nil
+	})
+
+	ctrl, err := NewController(spec, WithDeployer(deployer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ctrl.(*controller)
+}
+
+func TestPauseResume(t *testing.T) {
+	assert := assert.New(t)
+
+	ctrl := newTestController(t, sigma.FunctionSpec{ID: "fn"})
+	assert.Equal(ErrNotPaused, ctrl.Resume())
+
+	ctrl.scaleUp(3)
+	assert.Len(ctrl.Nodes(), 3)
+
+	assert.NoError(ctrl.Pause(Pause{Reason: "test"}))
+	assert.Len(ctrl.Nodes(), 0)
+	assert.Equal("test", ctrl.Paused().Reason)
+
+	_, _, err := ctrl.Dispatch(sigma.NewSimpleEvent("test", nil))
+	assert.Equal(ErrPaused, err)
+
+	// the control loop keeps draining paused functions
+	ctrl.drainAll()
+
+	// the drained nodes are redeployed on resume
+	assert.NoError(ctrl.Resume())
+	assert.Nil(ctrl.Paused())
+	assert.Len(ctrl.Nodes(), 3)
+
+	// ... but only once
+	ctrl.restoreNodes()
+	assert.Len(ctrl.Nodes(), 3)
+
+	// functions without nodes get at least one
+	ctrl.DestroyAll()
+	assert.NoError(ctrl.Pause(Pause{}))
+	assert.NoError(ctrl.Resume())
+	assert.Len(ctrl.Nodes(), 1)
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, w := range [][]sigma.MaintenanceWindow{
+		{{Start: "invalid", End: "2017-01-01T02:00:00Z"}},
+		{{Start: "2017-01-01T01:00:00Z", End: "invalid"}},
+		{{Start: "2017-01-01T02:00:00Z", End: "2017-01-01T01:00:00Z"}},
+	} {
+		_, err := parseWindows(w)
+		assert.Error(err)
+	}
+
+	windows, err := parseWindows([]sigma.MaintenanceWindow{
+		{Start: "2017-01-01T01:00:00Z", End: "2017-01-01T02:00:00Z", Reason: "upgrade", Buffer: true},
+	})
+	assert.NoError(err)
+
+	ctrl := newTestController(t, sigma.FunctionSpec{ID: "fn"})
+	ctrl.windows = windows
+
+	start := windows[0].start
+	assert.Nil(ctrl.pause(start.Add(-time.Second)))
+	assert.Nil(ctrl.pause(windows[0].end))
+
+	p := ctrl.pause(start.Add(time.Minute))
+	if assert.NotNil(p) {
+		assert.Equal("upgrade", p.Reason)
+		assert.True(p.Buffer)
+		assert.Equal(windows[0].end, p.Until)
+	}
+
+	// a manual pause takes precedence
+	ctrl.paused = &Pause{Reason: "manual"}
+	assert.Equal("manual", ctrl.pause(start.Add(time.Minute)).Reason)
+	ctrl.paused = nil
+
+	// nodes are drained within the window and redeployed after it
+	now := time.Now()
+	ctrl.windows = []window{{start: now.Add(-time.Hour), end: now.Add(time.Hour)}}
+
+	ctrl.scaleUp(2)
+	ctrl.drainAll()
+	assert.Len(ctrl.Nodes(), 0)
+
+	ctrl.restoreNodes()
+	assert.Len(ctrl.Nodes(), 0)
+	assert.Equal(ErrNotPaused, ctrl.Resume())
+
+	ctrl.windows = nil
+	ctrl.restoreNodes()
+	assert.Len(ctrl.Nodes(), 2)
+}
@@ -0,0 +1,31 @@
+package function
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchTriggerEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	var dispatched []sigma.Event
+
+	ctrl := newTestController(t, sigma.FunctionSpec{ID: "fn"})
+	ctrl.dispatcher = func(evt sigma.Event) (string, []byte, error) {
+		dispatched = append(dispatched, evt)
+		return "", nil, nil
+	}
+
+	// trigger events are passed to the trigger dispatcher
+	ctrl.dispatchTriggerEvent(sigma.NewSimpleEvent("test", nil), nil)
+	if assert.Len(dispatched, 1) {
+		assert.Equal("test", dispatched[0].Type())
+	}
+
+	// ... but not while the function is paused
+	assert.NoError(ctrl.Pause(Pause{}))
+	ctrl.dispatchTriggerEvent(sigma.NewSimpleEvent("test", nil), nil)
+	assert.Len(dispatched, 1)
+}
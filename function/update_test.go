@@ -0,0 +1,58 @@
+package function
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	base := sigma.FunctionSpec{ID: "fn", Type: "js", Content: "content"}
+
+	cases := []struct {
+		name       string
+		change     func(*sigma.FunctionSpec)
+		err        error
+		generation int
+	}{
+		{"unchanged", func(*sigma.FunctionSpec) {}, nil, 0},
+		{"live", func(s *sigma.FunctionSpec) {
+			s.Weight = 2
+			s.Update = &sigma.UpdatePolicy{MaxUnavailable: 1}
+		}, nil, 0},
+		{"restart", func(s *sigma.FunctionSpec) { s.Content = "changed" }, nil, 1},
+		{"policies", func(s *sigma.FunctionSpec) {
+			s.Policies = map[string]map[string]string{"cpu": {"max": "2"}}
+		}, ErrRecreateRequired, 0},
+		{"triggers", func(s *sigma.FunctionSpec) { s.Triggers = []sigma.TriggerSpec{{Type: "cron"}} }, ErrRecreateRequired, 0},
+		{"recreate and restart", func(s *sigma.FunctionSpec) {
+			s.Content = "changed"
+			s.Triggers = []sigma.TriggerSpec{{Type: "cron"}}
+		}, ErrRecreateRequired, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			ctrl := newTestController(t, base)
+
+			spec := base
+			c.change(&spec)
+
+			assert.Equal(c.err, ctrl.Update(spec))
+			assert.Equal(c.generation, ctrl.generation)
+
+			// rejected specs are not stored so later plans still show
+			// the changes
+			if c.err != nil {
+				assert.Equal(base, ctrl.FunctionSpec())
+			} else {
+				assert.Equal(spec, ctrl.FunctionSpec())
+			}
+		})
+	}
+
+	assert.Error(t, newTestController(t, base).Update(sigma.FunctionSpec{ID: "other", Type: "js"}))
+}
@@ -0,0 +1,50 @@
+package function
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatch_Schema(t *testing.T) {
+	schema := `{"type": "object", "required": ["temp"]}`
+
+	cases := []struct {
+		name    string
+		schema  sigma.IOSchema
+		payload string
+		err     bool
+		output  bool
+	}{
+		{"valid input", sigma.IOSchema{Input: schema}, `{"temp": 21}`, false, false},
+		{"enforced input", sigma.IOSchema{Input: schema}, `{}`, true, false},
+		{"warned input", sigma.IOSchema{Input: schema, Mode: sigma.SchemaWarn}, `{}`, false, false},
+
+		// test nodes return an empty result which is not valid JSON
+		{"enforced output", sigma.IOSchema{Output: schema}, `{}`, true, true},
+		{"warned output", sigma.IOSchema{Output: schema, Mode: sigma.SchemaWarn}, `{}`, false, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			schema := c.schema
+			ctrl := newTestController(t, sigma.FunctionSpec{ID: "fn", Schema: &schema})
+			ctrl.scaleUp(1)
+
+			_, _, err := ctrl.Dispatch(sigma.NewSimpleEvent("test", []byte(c.payload)))
+			if !c.err {
+				assert.NoError(err)
+				return
+			}
+
+			verr, ok := err.(*validation.Error)
+			if assert.True(ok, "%v", err) {
+				assert.Equal(c.output, verr.Output)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package healthcheck reports the status of sigma subsystems using the
+// standard gRPC health checking protocol (grpc.health.v1) so load
+// balancers, Kubernetes probes and tools like grpcurl can check the
+// controller
+package healthcheck
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// DefaultInterval is the default interval subsystems are checked at
+const DefaultInterval = 10 * time.Second
+
+// DefaultTimeout is the default time a single check may take
+const DefaultTimeout = 5 * time.Second
+
+// Subsystems reported by the sigma controller. The status of the server
+// as a whole is reported for the empty service name and is only serving
+// if all subsystems are
+const (
+	Scheduler  = "sigma.scheduler"
+	NodeServer = "sigma.nodes"
+	Store      = "sigma.store"
+)
+
+// Check returns an error if a subsystem is unhealthy
+type Check func(context.Context) error
+
+// Checker periodically runs the checks of all subsystems and reports
+// their status via a gRPC health server
+type Checker struct {
+	interval time.Duration
+	timeout  time.Duration
+	server   *health.Server
+
+	mu     sync.Mutex
+	checks map[string]Check
+}
+
+// Option configures a Checker
+type Option func(c *Checker) error
+
+// WithInterval configures the interval subsystems are checked at
+func WithInterval(d time.Duration) Option {
+	return func(c *Checker) error {
+		if d > 0 {
+			c.interval = d
+		}
+		return nil
+	}
+}
+
+// WithTimeout configures the time a single check may take before the
+// subsystem is considered unhealthy
+func WithTimeout(d time.Duration) Option {
+	return func(c *Checker) error {
+		if d > 0 {
+			c.timeout = d
+		}
+		return nil
+	}
+}
+
+// New creates a new health checker
+func New(opts ...Option) (*Checker, error) {
+	c := &Checker{
+		interval: DefaultInterval,
+		timeout:  DefaultTimeout,
+		server:   health.NewServer(),
+		checks:   make(map[string]Check),
+	}
+
+	for _, fn := range opts {
+		if err := fn(c); err != nil {
+			return nil, err
+		}
+	}
+
+	// nothing has been checked yet
+	c.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return c, nil
+}
+
+// Add adds the check of a subsystem. The subsystem is reported as not
+// serving until it has been checked
+func (c *Checker) Add(service string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[service] = check
+	c.server.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Register registers the health service and server reflection at s
+func (c *Checker) Register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, c.server)
+	reflection.Register(s)
+}
+
+// Run checks all subsystems every interval until ctx is cancelled
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks all subsystems once and updates their status. It
+// returns true if all subsystems are serving
+func (c *Checker) CheckAll(ctx context.Context) bool {
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for service, check := range c.checks {
+		checks[service] = check
+	}
+	c.mu.Unlock()
+
+	serving := true
+	for service, check := range checks {
+		status := healthpb.HealthCheckResponse_SERVING
+		if err := c.check(ctx, check); err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			serving = false
+		}
+
+		c.server.SetServingStatus(service, status)
+	}
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		overall = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	c.server.SetServingStatus("", overall)
+
+	return serving
+}
+
+func (c *Checker) check(ctx context.Context, check Check) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return check(ctx)
+}
@@ -0,0 +1,46 @@
+package healthcheck
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func status(c *Checker, service string) healthpb.HealthCheckResponse_ServingStatus {
+	res, err := c.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN
+	}
+	return res.Status
+}
+
+func TestChecker(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New()
+	if !assert.NoError(err) {
+		return
+	}
+
+	var storeErr error
+	c.Add(Scheduler, func(context.Context) error { return nil })
+	c.Add(Store, func(context.Context) error { return storeErr })
+
+	// subsystems are not serving until checked
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, status(c, Scheduler))
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, status(c, ""))
+
+	assert.True(c.CheckAll(context.Background()))
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, status(c, Scheduler))
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, status(c, ""))
+
+	storeErr = errors.New("disk full")
+	assert.False(c.CheckAll(context.Background()))
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, status(c, Scheduler))
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, status(c, Store))
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, status(c, ""))
+}
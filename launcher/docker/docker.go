@@ -2,12 +2,19 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/go-connections/nat"
 	"github.com/homebot/sigma/launcher"
 	"github.com/moby/moby/client"
 )
@@ -19,9 +26,39 @@ type NodeConfig struct {
 	Image string `json:"image" yaml:"image"`
 }
 
+// ScratchPath is the mount point of scratch volumes inside containers
+const ScratchPath = "/scratch"
+
+// Container labels used to recover instances created by the launcher
+const (
+	LabelURN       = "io.sigma.urn"
+	LabelEgress    = "io.sigma.egress"
+	LabelDebugPort = "io.sigma.debug-port"
+)
+
 // Config is the configuration for a docker launcher
 type Config struct {
 	Types map[string]NodeConfig `json:"types" yaml:"types"`
+
+	// Egress enables enforcement of function network policies. If nil,
+	// functions with a network policy cannot be launched
+	Egress *EgressConfig `json:"egress,omitempty" yaml:"egress,omitempty"`
+
+	// SeccompProfiles maps the names of seccomp profiles functions may
+	// select in their security profile to profile files on the host
+	SeccompProfiles map[string]string `json:"seccompProfiles,omitempty" yaml:"seccompProfiles,omitempty"`
+
+	// AllowSeccompUnconfined allows functions to disable seccomp
+	// confinement. Refused by default
+	AllowSeccompUnconfined bool `json:"allowSeccompUnconfined,omitempty" yaml:"allowSeccompUnconfined,omitempty"`
+
+	// AppArmorProfiles holds the AppArmor profiles functions may select.
+	// Functions cannot select a profile if empty
+	AppArmorProfiles []string `json:"apparmorProfiles,omitempty" yaml:"apparmorProfiles,omitempty"`
+
+	// SELinuxLabels holds the SELinux labels functions may set. Functions
+	// cannot set labels if empty
+	SELinuxLabels []string `json:"selinuxLabels,omitempty" yaml:"selinuxLabels,omitempty"`
 }
 
 // Launcher is a sigma node launcher based on Docker
@@ -44,8 +81,19 @@ func New(cfg Config) (*Launcher, error) {
 }
 
 // NewWithClient creates a new docker launcher with
-// the given moby client
+// the given moby client. If egress enforcement is enabled, the guard
+// rules of the egress network are installed
 func NewWithClient(cfg Config, cli *client.Client) (*Launcher, error) {
+	if cfg.Egress != nil {
+		if err := cfg.Egress.Valid(); err != nil {
+			return nil, err
+		}
+
+		if err := cfg.Egress.ensureGuard(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Launcher{
 		cli: cli,
 		cfg: cfg,
@@ -61,12 +109,62 @@ func (l *Launcher) Create(ctx context.Context, typ string, config launcher.Confi
 		return nil, errors.New("unknown execution type")
 	}
 
+	if config.Network != nil && l.cfg.Egress == nil {
+		return nil, errors.New("docker launcher: network policies not enabled")
+	}
+
+	image := cfg.Image
+	if config.Image != "" {
+		image = config.Image
+	}
+
+	hostConfig := &container.HostConfig{}
+
+	// scratch volumes are backed by tmpfs so they are limited in size
+	// and wiped together with the container
+	if config.ScratchSize > 0 {
+		config.ScratchDir = ScratchPath
+		hostConfig.Tmpfs = map[string]string{
+			ScratchPath: fmt.Sprintf("size=%d", config.ScratchSize),
+		}
+	}
+
+	if config.MemoryLimit > 0 {
+		hostConfig.Memory = config.MemoryLimit
+	}
+
+	if err := applySecurityProfile(hostConfig, config.Security, l.cfg); err != nil {
+		return nil, err
+	}
+
 	launcherConfig := &container.Config{
-		Image: cfg.Image,
+		Image: image,
 		Env:   config.Env(),
+		Labels: map[string]string{
+			LabelURN: config.URN,
+		},
+	}
+
+	// containers of the egress network have no network access until
+	// their policy has been applied
+	if config.Network != nil {
+		launcherConfig.Labels[LabelEgress] = "true"
+		hostConfig.NetworkMode = container.NetworkMode(l.cfg.Egress.Network)
 	}
 
-	res, err := l.cli.ContainerCreate(ctx, launcherConfig, nil, nil, "")
+	// the debugger port is published on a random port of the loopback
+	// interface so it is only reachable from the controller host
+	if config.DebugPort > 0 {
+		port := nat.Port(fmt.Sprintf("%d/tcp", config.DebugPort))
+
+		launcherConfig.ExposedPorts = nat.PortSet{port: struct{}{}}
+		launcherConfig.Labels[LabelDebugPort] = strconv.Itoa(config.DebugPort)
+		hostConfig.PortBindings = nat.PortMap{
+			port: []nat.PortBinding{{HostIP: "127.0.0.1"}},
+		}
+	}
+
+	res, err := l.cli.ContainerCreate(ctx, launcherConfig, hostConfig, nil, "")
 	if err != nil {
 		return nil, err
 	}
@@ -91,18 +189,63 @@ func (l *Launcher) Create(ctx context.Context, typ string, config launcher.Confi
 	}
 	log.Printf("[docker] container started successfully: %s\n", res.ID)
 
-	return &Instance{
-		id:       res.ID,
-		launcher: l,
-	}, nil
+	i := &Instance{
+		id:        res.ID,
+		launcher:  l,
+		debugPort: config.DebugPort,
+	}
+
+	if config.Network != nil {
+		if err := l.applyNetworkPolicy(ctx, res.ID, config); err != nil {
+			log.Printf("[docker] failed to apply network policy: %s\n", err)
+			if err := i.Stop(); err != nil {
+				log.Printf("[docker] ERROR: failed to clean up container: %s\n", err)
+			}
+			return nil, err
+		}
+		i.egress = true
+	}
+
+	return i, nil
+}
+
+// Instances returns all containers created by the launcher, including
+// containers of previous runs, and implements launcher.Lister
+func (l *Launcher) Instances(ctx context.Context) (map[string]launcher.Instance, error) {
+	args := filters.NewArgs()
+	args.Add("label", LabelURN)
+
+	containers, err := l.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]launcher.Instance, len(containers))
+	for _, c := range containers {
+		debugPort, _ := strconv.Atoi(c.Labels[LabelDebugPort])
+
+		res[c.Labels[LabelURN]] = &Instance{
+			id:        c.ID,
+			launcher:  l,
+			egress:    c.Labels[LabelEgress] == "true",
+			debugPort: debugPort,
+		}
+	}
+
+	return res, nil
 }
 
 // Instance represents a sigma function node instance
 // running in a docker container. It implements the
 // github.com/homebot/sigma/launcher.Instance interface
 type Instance struct {
-	id       string
-	launcher *Launcher
+	id        string
+	launcher  *Launcher
+	egress    bool
+	debugPort int
 }
 
 // Healthy returns nil if the container is healthy
@@ -123,11 +266,82 @@ func (i *Instance) Healthy() error {
 	return nil
 }
 
+// DebugAddress returns the host address the debugger port of the
+// container is published on and implements launcher.Debuggable
+func (i *Instance) DebugAddress() (string, error) {
+	if i.debugPort == 0 {
+		return "", errors.New("debugging not enabled")
+	}
+
+	inspect, err := i.launcher.cli.ContainerInspect(context.Background(), i.id)
+	if err != nil {
+		return "", err
+	}
+
+	if inspect.NetworkSettings != nil {
+		port := nat.Port(fmt.Sprintf("%d/tcp", i.debugPort))
+		for _, b := range inspect.NetworkSettings.Ports[port] {
+			return net.JoinHostPort(b.HostIP, b.HostPort), nil
+		}
+	}
+
+	return "", errors.New("debugger port not published")
+}
+
 // Stop stops the container node and removes it
 func (i *Instance) Stop() error {
 	err := i.launcher.cli.ContainerRemove(context.Background(), i.id, types.ContainerRemoveOptions{
 		Force: true,
 	})
 
+	if i.egress {
+		if rerr := i.launcher.cfg.Egress.removeEgress(context.Background(), i.id); rerr != nil {
+			log.Printf("[docker] ERROR: failed to remove network policy of %s: %s\n", i.id, rerr)
+		}
+	}
+
 	return err
 }
+
+// CPUTime returns the CPU time consumed by the container and implements
+// launcher.CPUAccountant
+func (i *Instance) CPUTime() (time.Duration, error) {
+	res, err := i.launcher.cli.ContainerStats(context.Background(), i.id, false)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(stats.CPUStats.CPUUsage.TotalUsage), nil
+}
+
+// applyNetworkPolicy installs the egress rules of config.Network for the
+// started container
+func (l *Launcher) applyNetworkPolicy(ctx context.Context, id string, config launcher.Config) error {
+	inspect, err := l.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var ips []string
+	if inspect.NetworkSettings != nil {
+		if ep, ok := inspect.NetworkSettings.Networks[l.cfg.Egress.Network]; ok && ep != nil {
+			for _, ip := range []string{ep.IPAddress, ep.GlobalIPv6Address} {
+				if ip != "" {
+					ips = append(ips, ip)
+				}
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return errors.New("container has no IP address")
+	}
+
+	log.Printf("[docker] applying network policy for %s (%s)\n", id, strings.Join(ips, ", "))
+	return l.cfg.Egress.applyEgress(ctx, id, ips, config.Address, config.Network)
+}
@@ -0,0 +1,335 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/homebot/sigma"
+)
+
+// DefaultEgressChain is the iptables chain used for egress rules if
+// none is configured
+const DefaultEgressChain = "DOCKER-USER"
+
+// guardComment marks the rules dropping traffic of containers whose
+// network policy has not been applied yet
+const guardComment = "sigma:guard"
+
+// EgressConfig configures how network policies are enforced for
+// containers. Policies are enforced by iptables and ip6tables rules
+// inserted into a chain of the FORWARD table which requires the launcher
+// to have CAP_NET_ADMIN on the docker host.
+//
+// Containers with a network policy are attached to a dedicated docker
+// network. All traffic originating from its subnets is dropped unless
+// allowed by the rules of a container, so containers have no network
+// access until their policy has been applied
+type EgressConfig struct {
+	// IPTables holds the path to the iptables binary. Defaults to
+	// "iptables"
+	IPTables string `json:"iptables" yaml:"iptables"`
+
+	// IP6Tables holds the path to the ip6tables binary. Defaults to
+	// "ip6tables"
+	IP6Tables string `json:"ip6tables" yaml:"ip6tables"`
+
+	// Chain holds the chain to insert rules into. Defaults to
+	// DefaultEgressChain
+	Chain string `json:"chain" yaml:"chain"`
+
+	// Network holds the name of the docker network containers with a
+	// network policy are attached to
+	Network string `json:"network" yaml:"network"`
+
+	// Subnets holds the IPv4 and IPv6 subnets of Network
+	Subnets []string `json:"subnets" yaml:"subnets"`
+
+	// Resolvers holds the addresses of the DNS servers containers may
+	// query if their network policy allows DNS
+	Resolvers []string `json:"resolvers,omitempty" yaml:"resolvers,omitempty"`
+}
+
+// Valid returns an error if the configuration is incomplete
+func (e *EgressConfig) Valid() error {
+	if e.Network == "" {
+		return errors.New("docker launcher: egress network not configured")
+	}
+
+	if len(e.Subnets) == 0 {
+		return errors.New("docker launcher: egress subnets not configured")
+	}
+
+	for _, cidr := range e.Subnets {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("docker launcher: invalid egress subnet %q: %s", cidr, err)
+		}
+	}
+
+	for _, r := range e.Resolvers {
+		if net.ParseIP(r) == nil {
+			return fmt.Errorf("docker launcher: invalid resolver address %q", r)
+		}
+	}
+
+	return nil
+}
+
+// binary returns the iptables binary for the address family of ip
+func (e *EgressConfig) binary(ip string) string {
+	if !isIPv4(ip) {
+		if e.IP6Tables != "" {
+			return e.IP6Tables
+		}
+		return "ip6tables"
+	}
+
+	if e.IPTables != "" {
+		return e.IPTables
+	}
+	return "iptables"
+}
+
+func (e *EgressConfig) chain() string {
+	if e.Chain != "" {
+		return e.Chain
+	}
+	return DefaultEgressChain
+}
+
+func ruleComment(containerID string) string {
+	return "sigma:" + containerID
+}
+
+// isIPv4 returns true if the address or network s is an IPv4 one
+func isIPv4(s string) bool {
+	if ip, _, err := net.ParseCIDR(s); err == nil {
+		return ip.To4() != nil
+	}
+
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil
+}
+
+// egressRules returns the iptables rule specifications enforcing policy
+// for traffic originating at ip. Only destinations of the address family
+// of ip are included. The node handler address is always allowed, DNS
+// queries are only allowed to resolvers
+func egressRules(policy *sigma.NetworkPolicy, ip, handler string, resolvers []string, comment string) ([][]string, error) {
+	v4 := isIPv4(ip)
+
+	base := []string{"-s", ip, "-m", "comment", "--comment", comment}
+
+	var rules [][]string
+	add := func(spec ...string) {
+		rules = append(rules, append(append([]string{}, base...), spec...))
+	}
+
+	add("-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT")
+
+	host, port, err := net.SplitHostPort(handler)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node handler address %q: %s", handler, err)
+	}
+	handlerIPs, err := resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range handlerIPs {
+		if isIPv4(h) == v4 {
+			add("-d", h, "-p", "tcp", "--dport", port, "-j", "ACCEPT")
+		}
+	}
+
+	if policy.AllowDNS {
+		if len(resolvers) == 0 {
+			return nil, errors.New("network policy allows DNS but no resolvers are configured")
+		}
+
+		for _, r := range resolvers {
+			if isIPv4(r) != v4 {
+				continue
+			}
+			add("-d", r, "-p", "udp", "--dport", "53", "-j", "ACCEPT")
+			add("-d", r, "-p", "tcp", "--dport", "53", "-j", "ACCEPT")
+		}
+	}
+
+	var destinations []string
+	for _, cidr := range policy.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %s", cidr, err)
+		}
+		destinations = append(destinations, cidr)
+	}
+	for _, h := range policy.AllowedHosts {
+		ips, err := resolve(h)
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, ips...)
+	}
+
+	var ports []string
+	for _, p := range policy.AllowedPorts {
+		if p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port %d", p)
+		}
+		ports = append(ports, strconv.Itoa(p))
+	}
+
+	for _, d := range destinations {
+		if isIPv4(d) != v4 {
+			continue
+		}
+
+		if len(ports) == 0 {
+			add("-d", d, "-j", "ACCEPT")
+			continue
+		}
+		for _, proto := range []string{"tcp", "udp"} {
+			add("-d", d, "-p", proto, "-m", "multiport", "--dports", strings.Join(ports, ","), "-j", "ACCEPT")
+		}
+	}
+
+	add("-j", "DROP")
+
+	return rules, nil
+}
+
+func resolve(host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+
+	addrs, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %s", host, err)
+	}
+
+	var res []string
+	for _, a := range addrs {
+		res = append(res, a.String())
+	}
+	return res, nil
+}
+
+// guardRule returns the rule specification dropping all traffic from
+// subnet
+func guardRule(subnet string) []string {
+	return []string{"-s", subnet, "-m", "comment", "--comment", guardComment, "-j", "DROP"}
+}
+
+// ensureGuard installs the guard rules for all subnets of the egress
+// network. Guards are inserted below the rules of existing containers so
+// they keep their network access
+func (e *EgressConfig) ensureGuard(ctx context.Context) error {
+	for _, subnet := range e.Subnets {
+		binary := e.binary(subnet)
+		spec := guardRule(subnet)
+
+		if e.run(ctx, binary, append([]string{"-C", e.chain()}, spec...)...) == nil {
+			continue
+		}
+
+		rules, err := e.list(ctx, binary)
+		if err != nil {
+			return err
+		}
+
+		pos := 1
+		for i, r := range rules {
+			if strings.Contains(r, "sigma:") {
+				pos = i + 2
+			}
+		}
+
+		args := append([]string{"-I", e.chain(), strconv.Itoa(pos)}, spec...)
+		if err := e.run(ctx, binary, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyEgress installs the rules for policy at the top of the chain for
+// each address of the container
+func (e *EgressConfig) applyEgress(ctx context.Context, containerID string, ips []string, handler string, policy *sigma.NetworkPolicy) error {
+	for _, ip := range ips {
+		rules, err := egressRules(policy, ip, handler, e.Resolvers, ruleComment(containerID))
+		if err != nil {
+			e.removeEgress(context.Background(), containerID)
+			return err
+		}
+
+		// rules are inserted at position 1 so we need to insert them in
+		// reverse order
+		for i := len(rules) - 1; i >= 0; i-- {
+			args := append([]string{"-I", e.chain(), "1"}, rules[i]...)
+			if err := e.run(ctx, e.binary(ip), args...); err != nil {
+				e.removeEgress(context.Background(), containerID)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeEgress deletes all rules installed for the container
+func (e *EgressConfig) removeEgress(ctx context.Context, containerID string) error {
+	comment := ruleComment(containerID)
+
+	for _, binary := range []string{e.binary("0.0.0.0"), e.binary("::")} {
+		rules, err := e.list(ctx, binary)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range rules {
+			if !strings.Contains(r, comment) {
+				continue
+			}
+
+			// iptables -S quotes comments only if they contain spaces which
+			// ours never do so splitting on whitespace is safe
+			if err := e.run(ctx, binary, append([]string{"-D", e.chain()}, strings.Fields(r)...)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// list returns the specifications of all rules in the chain in order
+func (e *EgressConfig) list(ctx context.Context, binary string) ([]string, error) {
+	out, err := exec.CommandContext(ctx, binary, "-S", e.chain()).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s rules: %s", binary, err)
+	}
+
+	prefix := "-A " + e.chain() + " "
+
+	var rules []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			rules = append(rules, strings.TrimPrefix(line, prefix))
+		}
+	}
+
+	return rules, nil
+}
+
+func (e *EgressConfig) run(ctx context.Context, binary string, args ...string) error {
+	out, err := exec.CommandContext(ctx, binary, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s: %s", binary, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
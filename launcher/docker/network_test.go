@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressRules(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := &sigma.NetworkPolicy{
+		AllowedHosts: []string{"192.0.2.10", "2001:db8::10"},
+		AllowedCIDRs: []string{"198.51.100.0/24", "2001:db8:1::/48"},
+		AllowedPorts: []int{443},
+		AllowDNS:     true,
+	}
+	resolvers := []string{"192.0.2.53", "2001:db8::53"}
+
+	rules, err := egressRules(policy, "172.30.0.2", "172.30.0.1:50051", resolvers, "sigma:c1")
+	assert.NoError(err)
+
+	var specs []string
+	for _, r := range rules {
+		assert.Equal([]string{"-s", "172.30.0.2", "-m", "comment", "--comment", "sigma:c1"}, r[:6])
+		specs = append(specs, strings.Join(r[6:], " "))
+	}
+
+	assert.Equal([]string{
+		"-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+		"-d 172.30.0.1 -p tcp --dport 50051 -j ACCEPT",
+		"-d 192.0.2.53 -p udp --dport 53 -j ACCEPT",
+		"-d 192.0.2.53 -p tcp --dport 53 -j ACCEPT",
+		"-d 198.51.100.0/24 -p tcp -m multiport --dports 443 -j ACCEPT",
+		"-d 198.51.100.0/24 -p udp -m multiport --dports 443 -j ACCEPT",
+		"-d 192.0.2.10 -p tcp -m multiport --dports 443 -j ACCEPT",
+		"-d 192.0.2.10 -p udp -m multiport --dports 443 -j ACCEPT",
+		"-j DROP",
+	}, specs)
+
+	// IPv6 rules only contain IPv6 destinations
+	rules, err = egressRules(policy, "fd00::2", "172.30.0.1:50051", resolvers, "sigma:c1")
+	assert.NoError(err)
+
+	specs = nil
+	for _, r := range rules {
+		specs = append(specs, strings.Join(r[6:], " "))
+	}
+
+	assert.Equal([]string{
+		"-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+		"-d 2001:db8::53 -p udp --dport 53 -j ACCEPT",
+		"-d 2001:db8::53 -p tcp --dport 53 -j ACCEPT",
+		"-d 2001:db8:1::/48 -p tcp -m multiport --dports 443 -j ACCEPT",
+		"-d 2001:db8:1::/48 -p udp -m multiport --dports 443 -j ACCEPT",
+		"-d 2001:db8::10 -p tcp -m multiport --dports 443 -j ACCEPT",
+		"-d 2001:db8::10 -p udp -m multiport --dports 443 -j ACCEPT",
+		"-j DROP",
+	}, specs)
+
+	// DNS requires resolvers
+	_, err = egressRules(&sigma.NetworkPolicy{AllowDNS: true}, "172.30.0.2", "172.30.0.1:50051", nil, "sigma:c1")
+	assert.Error(err)
+
+	_, err = egressRules(&sigma.NetworkPolicy{AllowedCIDRs: []string{"invalid"}}, "172.30.0.2", "172.30.0.1:50051", nil, "sigma:c1")
+	assert.Error(err)
+
+	_, err = egressRules(&sigma.NetworkPolicy{AllowedPorts: []int{70000}}, "172.30.0.2", "172.30.0.1:50051", nil, "sigma:c1")
+	assert.Error(err)
+
+	_, err = egressRules(&sigma.NetworkPolicy{}, "172.30.0.2", "handler", nil, "sigma:c1")
+	assert.Error(err)
+}
+
+func TestEgressConfig_Valid(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &EgressConfig{
+		Network: "sigma-egress",
+		Subnets: []string{"172.30.0.0/16", "fd00::/64"},
+	}
+	assert.NoError(cfg.Valid())
+	assert.Equal("iptables", cfg.binary("172.30.0.2"))
+	assert.Equal("ip6tables", cfg.binary("fd00::2"))
+
+	assert.Error((&EgressConfig{Subnets: cfg.Subnets}).Valid())
+	assert.Error((&EgressConfig{Network: "sigma-egress"}).Valid())
+	assert.Error((&EgressConfig{Network: "sigma-egress", Subnets: cfg.Subnets, Resolvers: []string{"dns"}}).Valid())
+}
@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/homebot/sigma"
+)
+
+// applySecurityProfile applies p to the host configuration of a new
+// container. Options that may weaken the isolation of nodes are refused
+// unless allowed by cfg. Named seccomp profiles are looked up in
+// cfg.SeccompProfiles
+func applySecurityProfile(hostConfig *container.HostConfig, p *sigma.SecurityProfile, cfg Config) error {
+	if p == nil {
+		return nil
+	}
+
+	switch p.Seccomp {
+	case sigma.SeccompDefault:
+	case sigma.SeccompUnconfined:
+		if !cfg.AllowSeccompUnconfined {
+			return fmt.Errorf("docker launcher: seccomp profile %q not allowed", p.Seccomp)
+		}
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp=unconfined")
+	default:
+		path, ok := cfg.SeccompProfiles[p.Seccomp]
+		if !ok {
+			return fmt.Errorf("docker launcher: unknown seccomp profile %q", p.Seccomp)
+		}
+
+		// the docker API expects the content of the profile rather
+		// than its path
+		profile, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("docker launcher: seccomp profile %q: %s", p.Seccomp, err)
+		}
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+string(profile))
+	}
+
+	if p.AppArmor != "" {
+		if !contains(cfg.AppArmorProfiles, p.AppArmor) {
+			return fmt.Errorf("docker launcher: AppArmor profile %q not allowed", p.AppArmor)
+		}
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "apparmor="+p.AppArmor)
+	}
+
+	for _, label := range p.SELinux {
+		if !contains(cfg.SELinuxLabels, label) {
+			return fmt.Errorf("docker launcher: SELinux label %q not allowed", label)
+		}
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "label="+label)
+	}
+
+	if p.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	}
+
+	hostConfig.ReadonlyRootfs = p.ReadOnlyRootFS
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplySecurityProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &sigma.SecurityProfile{
+		AppArmor:        "sigma-node",
+		SELinux:         []string{"type:sigma_node_t"},
+		NoNewPrivileges: true,
+		ReadOnlyRootFS:  true,
+	}
+
+	// options weakening isolation are refused by default
+	for _, p := range []*sigma.SecurityProfile{
+		{Seccomp: sigma.SeccompUnconfined},
+		{AppArmor: "unconfined"},
+		{SELinux: []string{"type:spc_t"}},
+		{Seccomp: "unknown"},
+	} {
+		assert.Error(applySecurityProfile(&container.HostConfig{}, p, Config{}))
+	}
+
+	hc := &container.HostConfig{}
+	assert.Error(applySecurityProfile(hc, p, Config{}))
+
+	cfg := Config{
+		AllowSeccompUnconfined: true,
+		AppArmorProfiles:       []string{"sigma-node"},
+		SELinuxLabels:          []string{"type:sigma_node_t"},
+	}
+
+	hc = &container.HostConfig{}
+	assert.NoError(applySecurityProfile(hc, p, cfg))
+	assert.Equal([]string{"apparmor=sigma-node", "label=type:sigma_node_t", "no-new-privileges"}, hc.SecurityOpt)
+	assert.True(hc.ReadonlyRootfs)
+
+	hc = &container.HostConfig{}
+	assert.NoError(applySecurityProfile(hc, &sigma.SecurityProfile{Seccomp: sigma.SeccompUnconfined}, cfg))
+	assert.Equal([]string{"seccomp=unconfined"}, hc.SecurityOpt)
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/homebot/sigma"
 )
 
 // Instance is an instance created and managed by a launcher
@@ -16,20 +20,133 @@ type Instance interface {
 	Stop() error
 }
 
+// ProcessInstance is implemented by instances running as processes on
+// the local host
+type ProcessInstance interface {
+	Instance
+
+	// PID returns the process ID of the instance
+	PID() int
+}
+
+// Debuggable is implemented by instances exposing the debugger port of
+// the node
+type Debuggable interface {
+	// DebugAddress returns the address the debugger of the node can be
+	// reached at from the controller host
+	DebugAddress() (string, error)
+}
+
+// CPUAccountant is implemented by instances that report the CPU time
+// they consumed. It is used to enforce CPU budgets
+type CPUAccountant interface {
+	// CPUTime returns the total CPU time consumed by the instance
+	CPUTime() (time.Duration, error)
+}
+
+// Lister is implemented by launchers that can enumerate the instances
+// they manage. It is used to garbage collect orphaned instances
+type Lister interface {
+	// Instances returns all running instances indexed by the URN of
+	// their node
+	Instances(context.Context) (map[string]Instance, error)
+}
+
 // Config holds the launch configuration for a new instance
 type Config struct {
 	Address string
 	Secret  string
 	URN     string
+
+	// Transport holds the transport the node must use to connect to
+	// Address. An empty value means gRPC
+	Transport string
+
+	// Image holds an OCI image reference that should be used instead
+	// of the launcher's default image for the node type
+	Image string
+
+	// ContentType holds the media type of the function content sent
+	// to the node during registration
+	ContentType string
+
+	// Digest holds the expected digest ("sha256:<hex>") of the function
+	// content sent to the node during registration
+	Digest string
+
+	// Parameters holds the environment variable form of typed function
+	// parameters (see parameters.Schema.Env)
+	Parameters map[string]string
+
+	// Network holds the egress policy the launcher must enforce for the
+	// instance. Launchers that cannot enforce network policies must
+	// refuse to create the instance
+	Network *sigma.NetworkPolicy
+
+	// Proxy holds the URL of the egress proxy including the node
+	// credentials. Empty if the proxy is disabled
+	Proxy string
+
+	// State holds the address of the state service. Empty if the
+	// state service is disabled
+	State string
+
+	// ScratchSize holds the size of the scratch volume in bytes. If zero,
+	// no scratch volume is created
+	ScratchSize int64
+
+	// MemoryLimit holds the memory limit of the instance in bytes. Zero
+	// means unlimited
+	MemoryLimit int64
+
+	// Security holds the security profile the launcher must apply to
+	// the instance. Launchers that cannot apply a setting of the profile
+	// must refuse to create the instance
+	Security *sigma.SecurityProfile
+
+	// ScratchDir holds the path of the scratch volume as seen by the
+	// node and is set by the launcher
+	ScratchDir string
+
+	// DebugPort holds the port the node opens its debugger on when a
+	// debug session is attached. Launchers may override the port. Zero
+	// disables debugging
+	DebugPort int
 }
 
 // EnvVars returns the current configuration as a map[string]string
 func (c Config) EnvVars() map[string]string {
-	return map[string]string{
+	env := map[string]string{
 		"SIGMA_HANDLER_ADDRESS": c.Address,
+		"SIGMA_TRANSPORT":       c.Transport,
 		"SIGMA_ACCESS_SECRET":   c.Secret,
 		"SIGMA_INSTANCE_URN":    c.URN,
+		"SIGMA_CONTENT_TYPE":    c.ContentType,
+		"SIGMA_CONTENT_DIGEST":  c.Digest,
+	}
+
+	if c.State != "" {
+		env["SIGMA_STATE_ADDRESS"] = c.State
+	}
+
+	if c.Proxy != "" {
+		env["HTTP_PROXY"] = c.Proxy
+		env["HTTPS_PROXY"] = c.Proxy
 	}
+
+	if c.ScratchDir != "" {
+		env["SIGMA_SCRATCH_DIR"] = c.ScratchDir
+	}
+
+	if c.DebugPort > 0 {
+		env["SIGMA_DEBUG_PORT"] = strconv.Itoa(c.DebugPort)
+	}
+
+	for key, value := range c.Parameters {
+		env[key] = value
+	}
+
+	return env
 }
 
 // Env returns a slice of strings containing environment variables
@@ -49,6 +166,13 @@ func ConfigFromEnv() Config {
 	c.Secret = os.Getenv("SIGMA_ACCESS_SECRET")
 	c.URN = os.Getenv("SIGMA_INSTANCE_URN")
 	c.Address = os.Getenv("SIGMA_HANDLER_ADDRESS")
+	c.Transport = os.Getenv("SIGMA_TRANSPORT")
+	c.ContentType = os.Getenv("SIGMA_CONTENT_TYPE")
+	c.Digest = os.Getenv("SIGMA_CONTENT_DIGEST")
+	c.ScratchDir = os.Getenv("SIGMA_SCRATCH_DIR")
+	c.State = os.Getenv("SIGMA_STATE_ADDRESS")
+	c.Proxy = os.Getenv("HTTP_PROXY")
+	c.DebugPort, _ = strconv.Atoi(os.Getenv("SIGMA_DEBUG_PORT"))
 
 	return c
 }
@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second used by
+// /proc/<pid>/stat. It is 100 on all supported architectures
+const clockTicks = 100
+
+// CPUTime returns the user and system CPU time consumed by the process
+// and implements launcher.CPUAccountant
+func (i *Instance) CPUTime() (time.Duration, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", i.cmd.Process.Pid))
+	if err != nil {
+		return 0, err
+	}
+
+	return parseCPUTime(string(stat))
+}
+
+// parseCPUTime parses the utime and stime fields of /proc/<pid>/stat.
+// The command name may contain spaces so fields are counted after its
+// closing parenthesis
+func parseCPUTime(stat string) (time.Duration, error) {
+	idx := strings.LastIndex(stat, ")")
+	if idx < 0 {
+		return 0, errors.New("malformed process stat")
+	}
+
+	// fields start with the state (field 3), utime and stime are
+	// fields 14 and 15
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 13 {
+		return 0, errors.New("malformed process stat")
+	}
+
+	var ticks int64
+	for _, f := range fields[11:13] {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += n
+	}
+
+	return time.Duration(ticks) * time.Second / clockTicks, nil
+}
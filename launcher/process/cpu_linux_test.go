@@ -0,0 +1,22 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUTime(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := parseCPUTime("4242 (node main) S 1 4242 4242 0 -1 4194560 1337 0 0 0 250 130 0 0 20 0 8 0 123 0 0")
+	assert.NoError(err)
+	assert.Equal(3800*time.Millisecond, d)
+
+	_, err = parseCPUTime("4242 (node")
+	assert.Error(err)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"errors"
+	"time"
+)
+
+// CPUTime is not supported on this platform
+func (i *Instance) CPUTime() (time.Duration, error) {
+	return 0, errors.New("cpu accounting not supported")
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"os"
 	"os/exec"
+	"strconv"
+	"sync"
 
 	"github.com/homebot/sigma/launcher"
 )
@@ -21,13 +24,21 @@ type Instance struct {
 	closed  chan struct{}
 	cmd     *exec.Cmd
 	exitErr error
+	scratch *launcher.ScratchDir
+
+	// debugPort is the local port the node opens its debugger on
+	debugPort int
 }
 
-func (i *Instance) watch() {
+func (i *Instance) watch(l *Launcher, urn string) {
 	err := i.cmd.Wait()
 	i.exitErr = err
 
 	close(i.closed)
+
+	l.mu.Lock()
+	delete(l.instances, urn)
+	l.mu.Unlock()
 }
 
 // Healthy returns nil as long as the process instance is healthy
@@ -39,13 +50,48 @@ func (i *Instance) Healthy() error {
 		}
 		return errors.New("exited")
 	default:
-		return nil
 	}
+
+	if i.scratch != nil {
+		return i.scratch.Check()
+	}
+
+	return nil
 }
 
-// Stop stops the instance and terminates the process
+// Stop stops the instance, terminates the process and wipes the scratch
+// directory
 func (i *Instance) Stop() error {
-	return i.cmd.Process.Kill()
+	err := i.cmd.Process.Kill()
+
+	if i.scratch != nil {
+		// wait for the process to exit so it cannot write to the
+		// scratch directory anymore
+		if err == nil {
+			<-i.closed
+		}
+
+		if rerr := i.scratch.Remove(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+
+	return err
+}
+
+// DebugAddress returns the address of the node's debugger and implements
+// launcher.Debuggable
+func (i *Instance) DebugAddress() (string, error) {
+	if i.debugPort == 0 {
+		return "", errors.New("debugging not enabled")
+	}
+
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(i.debugPort)), nil
+}
+
+// PID returns the process ID of the instance
+func (i *Instance) PID() int {
+	return i.cmd.Process.Pid
 }
 
 // NewLauncher creates a new process launcher supporting the
@@ -53,12 +99,32 @@ func (i *Instance) Stop() error {
 func NewLauncher(types map[string]TypeConfig) *Launcher {
 	return &Launcher{
 		nodeTypes: types,
+		instances: make(map[string]*Instance),
 	}
 }
 
 // Launcher is a process launcher and implements launcher.Launcher
 type Launcher struct {
 	nodeTypes map[string]TypeConfig
+
+	handlerAddress string
+	scratchBase    string
+
+	mu        sync.Mutex
+	instances map[string]*Instance
+}
+
+// SetHandlerAddress overrides the node handler address passed to new
+// instances using the gRPC transport, e.g. to connect nodes using a unix
+// domain socket
+func (l *Launcher) SetHandlerAddress(addr string) {
+	l.handlerAddress = addr
+}
+
+// SetScratchDir sets the directory scratch volumes of new instances are
+// created in. If empty, the system temp directory is used
+func (l *Launcher) SetScratchDir(dir string) {
+	l.scratchBase = dir
 }
 
 // Create creates a new instance
@@ -73,7 +139,20 @@ func (l *Launcher) Create(ctx context.Context, typ string, c launcher.Config) (l
 		return nil, errors.New("no command configured for type")
 	}
 
-	cmd := exec.Command(typCfg.Command[0], typCfg.Command[1:]...)
+	if c.Image != "" {
+		return nil, errors.New("process launcher cannot run OCI images")
+	}
+
+	if c.Network != nil {
+		return nil, errors.New("process launcher cannot enforce network policies")
+	}
+
+	command, err := secureCommand(c.Security, typCfg.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -88,18 +167,75 @@ func (l *Launcher) Create(ctx context.Context, typ string, c launcher.Config) (l
 	go io.Copy(os.Stdout, stdout)
 	go io.Copy(os.Stderr, stderr)
 
-	cmd.Env = c.Env()
+	if l.handlerAddress != "" && c.Transport == "" {
+		c.Address = l.handlerAddress
+	}
 
 	instance := &Instance{
 		cmd:    cmd,
 		closed: make(chan struct{}),
 	}
 
+	if c.ScratchSize > 0 {
+		instance.scratch, err = launcher.NewScratchDir(l.scratchBase, c.ScratchSize)
+		if err != nil {
+			return nil, err
+		}
+		c.ScratchDir = instance.scratch.Path()
+	}
+
+	// all processes share the host network so each instance gets its
+	// own debugger port
+	if c.DebugPort > 0 {
+		c.DebugPort, err = freePort()
+		if err != nil {
+			if instance.scratch != nil {
+				instance.scratch.Remove()
+			}
+			return nil, err
+		}
+		instance.debugPort = c.DebugPort
+	}
+
+	cmd.Env = c.Env()
+
 	if err := cmd.Start(); err != nil {
+		if instance.scratch != nil {
+			instance.scratch.Remove()
+		}
 		return nil, err
 	}
 
-	go instance.watch()
+	l.mu.Lock()
+	l.instances[c.URN] = instance
+	l.mu.Unlock()
+
+	go instance.watch(l, c.URN)
 
 	return instance, nil
 }
+
+// Instances returns all running process instances and implements
+// launcher.Lister
+func (l *Launcher) Instances(ctx context.Context) (map[string]launcher.Instance, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := make(map[string]launcher.Instance, len(l.instances))
+	for urn, i := range l.instances {
+		res[urn] = i
+	}
+
+	return res, nil
+}
+
+// freePort returns a currently unused local TCP port
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,70 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/homebot/sigma"
+)
+
+// Helpers used to apply security profiles to processes. They must be
+// installed on the host if functions use the respective settings
+const (
+	runconCommand = "runcon"
+	aaExecCommand = "aa-exec"
+	setprivCmd    = "setpriv"
+)
+
+// selinuxFlags maps the fields of SELinux labels to runcon flags
+var selinuxFlags = map[string]string{
+	"user":  "-u",
+	"role":  "-r",
+	"type":  "-t",
+	"level": "-l",
+}
+
+// secureCommand wraps command so p is applied to the process. SELinux
+// labels are applied using runcon, AppArmor profiles using aa-exec and
+// no-new-privileges using setpriv. Seccomp profiles and read-only root
+// filesystems are not supported
+func secureCommand(p *sigma.SecurityProfile, command []string) ([]string, error) {
+	if p == nil {
+		return command, nil
+	}
+
+	if p.Seccomp != sigma.SeccompDefault && p.Seccomp != sigma.SeccompUnconfined {
+		return nil, errors.New("process launcher cannot apply seccomp profiles")
+	}
+
+	if p.ReadOnlyRootFS {
+		return nil, errors.New("process launcher cannot mount a read-only root filesystem")
+	}
+
+	var wrapper []string
+
+	if len(p.SELinux) > 0 {
+		wrapper = append(wrapper, runconCommand)
+		for _, label := range p.SELinux {
+			parts := strings.SplitN(label, ":", 2)
+			flag, ok := selinuxFlags[parts[0]]
+			if len(parts) != 2 || !ok || parts[1] == "" {
+				return nil, fmt.Errorf("process launcher: unsupported SELinux label %q", label)
+			}
+			wrapper = append(wrapper, flag, parts[1])
+		}
+		wrapper = append(wrapper, "--")
+	}
+
+	// the profile transition happens before no-new-privileges is set
+	// since it would prevent the transition
+	if p.AppArmor != "" {
+		wrapper = append(wrapper, aaExecCommand, "-p", p.AppArmor, "--")
+	}
+
+	if p.NoNewPrivileges {
+		wrapper = append(wrapper, setprivCmd, "--no-new-privs", "--")
+	}
+
+	return append(wrapper, command...), nil
+}
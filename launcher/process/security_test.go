@@ -0,0 +1,40 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecureCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := []string{"node", "main.js"}
+
+	res, err := secureCommand(nil, cmd)
+	assert.NoError(err)
+	assert.Equal(cmd, res)
+
+	res, err = secureCommand(&sigma.SecurityProfile{
+		SELinux:         []string{"type:sigma_t", "level:s0"},
+		AppArmor:        "sigma-node",
+		NoNewPrivileges: true,
+	}, cmd)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"runcon", "-t", "sigma_t", "-l", "s0", "--",
+		"aa-exec", "-p", "sigma-node", "--",
+		"setpriv", "--no-new-privs", "--",
+		"node", "main.js",
+	}, res)
+
+	_, err = secureCommand(&sigma.SecurityProfile{Seccomp: "strict"}, cmd)
+	assert.Error(err)
+
+	_, err = secureCommand(&sigma.SecurityProfile{ReadOnlyRootFS: true}, cmd)
+	assert.Error(err)
+
+	_, err = secureCommand(&sigma.SecurityProfile{SELinux: []string{"disable"}}, cmd)
+	assert.Error(err)
+}
@@ -0,0 +1,94 @@
+package launcher
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrScratchExceeded is returned by ScratchDir.Check if the scratch
+// directory grew beyond its size limit
+var ErrScratchExceeded = errors.New("scratch volume size exceeded")
+
+// ScratchCheckInterval is the minimum interval between two usage scans
+// of a scratch directory
+var ScratchCheckInterval = 5 * time.Second
+
+// ScratchDir is a per-node scratch volume backed by a temporary directory
+// on the host. As directories cannot be limited in size the usage is
+// checked periodically and nodes exceeding the limit should be reported
+// as unhealthy
+type ScratchDir struct {
+	path string
+	size int64
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	lastErr   error
+}
+
+// NewScratchDir creates a new scratch directory below base (or the
+// system temp directory if empty) limited to size bytes
+func NewScratchDir(base string, size int64) (*ScratchDir, error) {
+	path, err := ioutil.TempDir(base, "sigma-scratch-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScratchDir{
+		path: path,
+		size: size,
+	}, nil
+}
+
+// Path returns the path of the scratch directory
+func (s *ScratchDir) Path() string {
+	return s.path
+}
+
+// Usage returns the number of bytes used by the scratch directory
+func (s *ScratchDir) Usage() (int64, error) {
+	var usage int64
+	err := filepath.Walk(s.path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			usage += info.Size()
+		}
+		return nil
+	})
+
+	return usage, err
+}
+
+// Check returns ErrScratchExceeded if the scratch directory is larger than
+// its limit. The result of the last scan is returned if it is more recent
+// than ScratchCheckInterval
+func (s *ScratchDir) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastCheck) < ScratchCheckInterval {
+		return s.lastErr
+	}
+
+	usage, err := s.Usage()
+	if err == nil && usage > s.size {
+		err = ErrScratchExceeded
+	}
+
+	s.lastCheck = time.Now()
+	s.lastErr = err
+
+	return err
+}
+
+// Remove wipes the scratch directory
+func (s *ScratchDir) Remove() error {
+	return os.RemoveAll(s.path)
+}
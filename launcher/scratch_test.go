@@ -0,0 +1,32 @@
+package launcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratchDir(t *testing.T) {
+	assert := assert.New(t)
+
+	interval := ScratchCheckInterval
+	ScratchCheckInterval = 0
+	defer func() { ScratchCheckInterval = interval }()
+
+	s, err := NewScratchDir("", 10)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(s.Check())
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(s.Path(), "data"), make([]byte, 11), 0600))
+	assert.Equal(ErrScratchExceeded, s.Check())
+
+	assert.NoError(s.Remove())
+	_, err = os.Stat(s.Path())
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,114 @@
+// Package maintenance serves pausing and resuming functions via HTTP
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/core/resource"
+	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// Scheduler pauses and resumes functions
+type Scheduler interface {
+	// Inspect returns details about a function including its pause
+	Inspect(context.Context, resource.Name) (scheduler.FunctionRegistration, error)
+
+	// Pause pauses a function until it is resumed
+	Pause(ctx context.Context, function string, p function.Pause) error
+
+	// Resume resumes a paused function
+	Resume(ctx context.Context, function string) error
+}
+
+// Handler serves pausing and resuming functions via HTTP:
+//
+//	GET    /pause/<function>                           get the pause of a function
+//	POST   /pause/<function>?reason=<r>&buffer=<bool>  pause a function
+//	DELETE /pause/<function>                           resume a function
+type Handler struct {
+	scheduler Scheduler
+}
+
+// NewHandler returns a new HTTP handler pausing functions of s
+func NewHandler(s Scheduler) *Handler {
+	return &Handler{
+		scheduler: s,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn := strings.Trim(strings.TrimPrefix(r.URL.Path, "/pause"), "/")
+	if fn == "" {
+		http.Error(w, "missing function", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		reg, err := h.scheduler.Inspect(r.Context(), resource.Name(fn))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if reg.Paused == nil {
+			http.Error(w, function.ErrNotPaused.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, reg.Paused)
+
+	case http.MethodPost:
+		p := function.Pause{
+			Reason: r.URL.Query().Get("reason"),
+		}
+
+		if b := r.URL.Query().Get("buffer"); b != "" {
+			buffer, err := strconv.ParseBool(b)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			p.Buffer = buffer
+		}
+
+		if err := h.scheduler.Pause(r.Context(), fn, p); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if err := h.scheduler.Resume(r.Context(), fn); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case scheduler.ErrUnknownFunction:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case function.ErrNotPaused:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,150 @@
+package sigma
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Well-known invocation metadata keys
+const (
+	// MetadataSource identifies the source of an event, e.g. the
+	// trigger type or "api"
+	MetadataSource = "source"
+
+	// MetadataCaller holds the identity of the caller
+	MetadataCaller = "caller"
+
+	// MetadataCorrelationID holds an ID to correlate an invocation
+	// with downstream systems
+	MetadataCorrelationID = "correlation-id"
+
+	// MetadataTenant holds the tenant the invocation belongs to
+	MetadataTenant = "tenant"
+
+	// MetadataHops holds the number of functions an event chain has
+	// passed through
+	MetadataHops = "hops"
+
+	// MetadataLineage holds a comma separated list of the functions an
+	// event chain has passed through
+	MetadataLineage = "lineage"
+
+	// MetadataDeadLetter holds the function a dead-lettered event was
+	// originally dispatched to
+	MetadataDeadLetter = "dead-letter"
+)
+
+// Metadata holds structured context of an invocation that is
+// propagated to nodes alongside the event payload
+type Metadata map[string]string
+
+// Copy returns a copy of the metadata
+func (md Metadata) Copy() Metadata {
+	if md == nil {
+		return nil
+	}
+
+	res := make(Metadata, len(md))
+	for k, v := range md {
+		res[k] = v
+	}
+	return res
+}
+
+// Hops returns the number of functions the invocation chain has passed
+// through
+func (md Metadata) Hops() int {
+	n, _ := strconv.Atoi(md[MetadataHops])
+	return n
+}
+
+// Lineage returns the functions the invocation chain has passed through
+func (md Metadata) Lineage() []string {
+	if md[MetadataLineage] == "" {
+		return nil
+	}
+	return strings.Split(md[MetadataLineage], ",")
+}
+
+// Hop returns a copy of the metadata with the hop count incremented and
+// fn appended to the lineage
+func (md Metadata) Hop(fn string) Metadata {
+	res := md.Copy()
+	if res == nil {
+		res = make(Metadata, 2)
+	}
+
+	res[MetadataHops] = strconv.Itoa(md.Hops() + 1)
+	res[MetadataLineage] = strings.Join(append(md.Lineage(), fn), ",")
+
+	return res
+}
+
+// Cycle returns the cycle closed by dispatching to fn, starting and
+// ending with fn. It returns nil if fn is not part of the lineage
+func (md Metadata) Cycle(fn string) []string {
+	lineage := md.Lineage()
+	for i := len(lineage) - 1; i >= 0; i-- {
+		if lineage[i] == fn {
+			return append(lineage[i:], fn)
+		}
+	}
+	return nil
+}
+
+// MetadataEvent is an event carrying invocation metadata
+type MetadataEvent interface {
+	Event
+
+	// Metadata returns the metadata of the event. The returned map
+	// must not be modified
+	Metadata() Metadata
+}
+
+// EventMetadata returns the metadata of the event or nil if the
+// event does not carry any
+func EventMetadata(e Event) Metadata {
+	if m, ok := e.(MetadataEvent); ok {
+		return m.Metadata()
+	}
+	return nil
+}
+
+// WithMetadata returns a copy of event with md merged into its metadata.
+// Existing keys are not overwritten
+func WithMetadata(e Event, md Metadata) Event {
+	merged := EventMetadata(e).Copy()
+	if merged == nil {
+		merged = make(Metadata, len(md))
+	}
+
+	for k, v := range md {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+
+	return NewEventWithMetadata(e.Type(), e.Payload(), merged)
+}
+
+type metadataEvent struct {
+	SimpleEvent
+	md Metadata
+}
+
+// Metadata returns the metadata of the event and implements MetadataEvent
+func (e *metadataEvent) Metadata() Metadata {
+	return e.md
+}
+
+// NewEventWithMetadata returns a new sigma.Event carrying the given
+// metadata. Like NewSimpleEvent the payload is not copied
+func NewEventWithMetadata(typ string, payload []byte, md Metadata) Event {
+	return &metadataEvent{
+		SimpleEvent: SimpleEvent{
+			typ:     typ,
+			payload: payload,
+		},
+		md: md,
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// Counters holds named monotonic counters
+type Counters struct {
+	rw     sync.RWMutex
+	values map[string]int64
+}
+
+// NewCounters returns a new set of counters
+func NewCounters() *Counters {
+	return &Counters{
+		values: make(map[string]int64),
+	}
+}
+
+// Inc increments the counter name by one
+func (c *Counters) Inc(name string) {
+	c.Add(name, 1)
+}
+
+// Add adds delta to the counter name
+func (c *Counters) Add(name string, delta int64) {
+	c.rw.Lock()
+	defer c.rw.Unlock()
+
+	c.values[name] += delta
+}
+
+// Get returns the current value of the counter name
+func (c *Counters) Get(name string) int64 {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	return c.values[name]
+}
+
+// Snapshot returns the current value of all counters
+func (c *Counters) Snapshot() map[string]int64 {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	res := make(map[string]int64, len(c.values))
+	for k, v := range c.values {
+		res[k] = v
+	}
+	return res
+}
+
+// DefaultCounters holds process wide counters
+var DefaultCounters = NewCounters()
+
+// Inc increments the default counter name by one and forwards the
+// update to the configured sink
+func Inc(name string) {
+	Add(name, 1)
+}
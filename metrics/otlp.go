@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOTLPInterval is the default interval metrics are exported at
+const DefaultOTLPInterval = 10 * time.Second
+
+// OTLP is a Sink periodically exporting cumulative metrics to an
+// OpenTelemetry collector using OTLP/HTTP with JSON encoding
+type OTLP struct {
+	*store
+
+	endpoint   string
+	interval   time.Duration
+	attributes map[string]string
+	client     *http.Client
+	start      time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// OTLPOption configures an OTLP sink
+type OTLPOption func(o *OTLP)
+
+// WithInterval configures the export interval
+func WithInterval(d time.Duration) OTLPOption {
+	return func(o *OTLP) {
+		o.interval = d
+	}
+}
+
+// WithResourceAttributes attaches the attributes (e.g. "service.name")
+// to the exported resource
+func WithResourceAttributes(attrs map[string]string) OTLPOption {
+	return func(o *OTLP) {
+		for k, v := range attrs {
+			o.attributes[k] = v
+		}
+	}
+}
+
+// NewOTLP returns a new OTLP sink exporting to the collector at endpoint,
+// e.g. http://localhost:4318
+func NewOTLP(endpoint string, opts ...OTLPOption) *OTLP {
+	o := &OTLP{
+		store:    newStore(),
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/metrics",
+		interval: DefaultOTLPInterval,
+		attributes: map[string]string{
+			"service.name": "sigma",
+		},
+		client: &http.Client{Timeout: 10 * time.Second},
+		start:  time.Now(),
+		stop:   make(chan struct{}),
+	}
+
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	o.wg.Add(1)
+	go o.exportLoop()
+
+	return o
+}
+
+// Close stops the export loop and exports all metrics a last time
+func (o *OTLP) Close() error {
+	close(o.stop)
+	o.wg.Wait()
+
+	return o.Export()
+}
+
+func (o *OTLP) exportLoop() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// failed exports are retried with the next interval as all
+			// values are cumulative
+			o.Export()
+		case <-o.stop:
+			return
+		}
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	StartTimeUnixNano string   `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string   `json:"timeUnixNano"`
+	AsInt             string   `json:"asInt,omitempty"`
+	AsDouble          *float64 `json:"asDouble,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+// aggregationTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+const aggregationTemporalityCumulative = 2
+
+// Export exports the current value of all metrics
+func (o *OTLP) Export() error {
+	counters, gauges := o.snapshot()
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(o.start.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for name, value := range counters {
+		metrics = append(metrics, otlpMetric{
+			Name: name,
+			Sum: &otlpSum{
+				DataPoints: []otlpDataPoint{{
+					StartTimeUnixNano: start,
+					TimeUnixNano:      now,
+					AsInt:             strconv.FormatInt(value, 10),
+				}},
+				AggregationTemporality: aggregationTemporalityCumulative,
+				IsMonotonic:            true,
+			},
+		})
+	}
+
+	for name, value := range gauges {
+		value := value
+		metrics = append(metrics, otlpMetric{
+			Name: name,
+			Gauge: &otlpGauge{
+				DataPoints: []otlpDataPoint{{
+					TimeUnixNano: now,
+					AsDouble:     &value,
+				}},
+			},
+		})
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var attrs []otlpAttribute
+	for k, v := range o.attributes {
+		attrs = append(attrs, otlpAttribute{k, otlpValue{v}})
+	}
+
+	req := map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": attrs,
+				},
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{
+							"name": "github.com/homebot/sigma",
+						},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+
+	blob, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.Post(o.endpoint, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Prometheus is a Sink that exposes all metrics using the Prometheus text
+// exposition format. It implements http.Handler
+type Prometheus struct {
+	namespace string
+	*store
+}
+
+// NewPrometheus returns a new Prometheus sink. Metric names are prefixed
+// with namespace, if set
+func NewPrometheus(namespace string) *Prometheus {
+	return &Prometheus{
+		namespace: namespace,
+		store:     newStore(),
+	}
+}
+
+// Close implements Sink
+func (p *Prometheus) Close() error { return nil }
+
+func (p *Prometheus) name(n string) string {
+	if p.namespace != "" {
+		n = p.namespace + "_" + n
+	}
+
+	n = sanitize(n, func(r rune) bool {
+		return r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+	})
+
+	if n != "" && n[0] >= '0' && n[0] <= '9' {
+		n = "_" + n
+	}
+
+	return n
+}
+
+// ServeHTTP writes all metrics to w and implements http.Handler
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	counters, gauges := p.snapshot()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	names := make([]string, 0, len(counters))
+	for k := range counters {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		n := p.name(k)
+		fmt.Fprintf(w, "# TYPE %s counter\n%s %d\n", n, n, counters[k])
+	}
+
+	names = names[:0]
+	for k := range gauges {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		n := p.name(k)
+		fmt.Fprintf(w, "# TYPE %s gauge\n%s %s\n", n, n, strconv.FormatFloat(gauges[k], 'g', -1, 64))
+	}
+}
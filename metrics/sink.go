@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// Sink receives metric updates and forwards them to a metrics backend
+type Sink interface {
+	// Count adds delta to the counter name
+	Count(name string, delta int64)
+
+	// Gauge sets the gauge name to value
+	Gauge(name string, value float64)
+
+	// Close flushes pending updates and releases all resources
+	Close() error
+}
+
+// NopSink is a Sink that discards all updates
+type NopSink struct{}
+
+// Count implements Sink
+func (NopSink) Count(string, int64) {}
+
+// Gauge implements Sink
+func (NopSink) Gauge(string, float64) {}
+
+// Close implements Sink
+func (NopSink) Close() error { return nil }
+
+var (
+	sinkLock sync.RWMutex
+	sink     Sink = NopSink{}
+)
+
+// SetSink configures the backend all process wide metrics are forwarded
+// to. Passing nil disables forwarding
+func SetSink(s Sink) {
+	if s == nil {
+		s = NopSink{}
+	}
+
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+
+	sink = s
+}
+
+func currentSink() Sink {
+	sinkLock.RLock()
+	defer sinkLock.RUnlock()
+
+	return sink
+}
+
+// Add adds delta to the default counter name and forwards the update to
+// the configured sink
+func Add(name string, delta int64) {
+	DefaultCounters.Add(name, delta)
+	currentSink().Count(name, delta)
+}
+
+// Gauge forwards the value of the gauge name to the configured sink
+func Gauge(name string, value float64) {
+	currentSink().Gauge(name, value)
+}
+
+// store keeps the cumulative state required by pull based backends and
+// backends exporting cumulative values
+type store struct {
+	counters *Counters
+
+	rw     sync.RWMutex
+	gauges map[string]float64
+}
+
+func newStore() *store {
+	return &store{
+		counters: NewCounters(),
+		gauges:   make(map[string]float64),
+	}
+}
+
+func (s *store) Count(name string, delta int64) {
+	s.counters.Add(name, delta)
+}
+
+func (s *store) Gauge(name string, value float64) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.gauges[name] = value
+}
+
+func (s *store) snapshot() (map[string]int64, map[string]float64) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	gauges := make(map[string]float64, len(s.gauges))
+	for k, v := range s.gauges {
+		gauges[k] = v
+	}
+
+	return s.counters.Snapshot(), gauges
+}
+
+// sanitize replaces all characters of name not accepted by valid
+func sanitize(name string, valid func(rune) bool) string {
+	return strings.Map(func(r rune) rune {
+		if valid(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
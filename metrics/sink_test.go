@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	p := NewPrometheus("sigma")
+	p.Count("scheduler.dispatches.urn:fn", 2)
+	p.Count("scheduler.dispatches.urn:fn", 1)
+	p.Gauge("function.nodes", 1.5)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "# TYPE sigma_scheduler_dispatches_urn:fn counter\nsigma_scheduler_dispatches_urn:fn 3\n"+
+		"# TYPE sigma_function_nodes gauge\nsigma_function_nodes 1.5\n", rec.Body.String())
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	s, err := NewStatsd(conn.LocalAddr().String(), WithPrefix("sigma"), WithTags("env:test"))
+	assert.NoError(t, err)
+	defer s.Close()
+
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	s.Count("dispatches.urn:fn", 2)
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "sigma.dispatches.urn_fn:2|c|#env:test", string(buf[:n]))
+
+	s.Gauge("nodes", 0.5)
+	n, _, err = conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "sigma.nodes:0.5|g|#env:test", string(buf[:n]))
+}
+
+func TestOTLP(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	}))
+	defer srv.Close()
+
+	o := NewOTLP(srv.URL, WithInterval(time.Hour))
+	o.Count("dispatches", 3)
+	assert.NoError(t, o.Close())
+
+	body := <-received
+	rm := body["resourceMetrics"].([]interface{})[0].(map[string]interface{})
+	sm := rm["scopeMetrics"].([]interface{})[0].(map[string]interface{})
+	metric := sm["metrics"].([]interface{})[0].(map[string]interface{})
+
+	assert.Equal(t, "dispatches", metric["name"])
+	point := metric["sum"].(map[string]interface{})["dataPoints"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "3", point["asInt"])
+}
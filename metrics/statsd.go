@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Statsd is a Sink sending metrics to a statsd or DogStatsD agent via UDP
+type Statsd struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+// StatsdOption configures a Statsd sink
+type StatsdOption func(s *Statsd)
+
+// WithPrefix prefixes all metric names with prefix
+func WithPrefix(prefix string) StatsdOption {
+	return func(s *Statsd) {
+		s.prefix = prefix
+	}
+}
+
+// WithTags attaches the tags (e.g. "env:prod") to all metrics using the
+// DogStatsD extension of the protocol
+func WithTags(tags ...string) StatsdOption {
+	return func(s *Statsd) {
+		s.tags = strings.Join(tags, ",")
+	}
+}
+
+// NewStatsd returns a new Statsd sink sending to the agent at address
+func NewStatsd(address string, opts ...StatsdOption) (*Statsd, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Statsd{
+		conn: conn,
+	}
+
+	for _, fn := range opts {
+		fn(s)
+	}
+
+	return s, nil
+}
+
+// Count implements Sink
+func (s *Statsd) Count(name string, delta int64) {
+	s.send(name, strconv.FormatInt(delta, 10), "c")
+}
+
+// Gauge implements Sink
+func (s *Statsd) Gauge(name string, value float64) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+// Close implements Sink
+func (s *Statsd) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Statsd) send(name, value, typ string) {
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+
+	// ':', '|' and '@' separate fields of the protocol
+	name = sanitize(name, func(r rune) bool {
+		return r != ':' && r != '|' && r != '@' && r != '#' && r != '\n'
+	})
+
+	msg := name + ":" + value + "|" + typ
+	if s.tags != "" {
+		msg += "|#" + s.tags
+	}
+
+	// metrics are best effort, delivery errors are ignored
+	s.conn.Write([]byte(msg))
+}
@@ -0,0 +1,41 @@
+package sigma
+
+// NetworkPolicy restricts the egress traffic of function nodes. If a
+// function has a network policy, all outgoing connections except those
+// to the sigma node handler and the allowed destinations are blocked
+type NetworkPolicy struct {
+	// AllowedHosts holds host names nodes may connect to. Host names are
+	// resolved when the node is launched
+	AllowedHosts []string `json:"allowedHosts,omitempty" yaml:"allowedHosts,omitempty"`
+
+	// AllowedCIDRs holds networks nodes may connect to
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty" yaml:"allowedCIDRs,omitempty"`
+
+	// AllowedPorts restricts connections to allowed destinations to the
+	// given TCP/UDP ports. All ports are allowed if empty
+	AllowedPorts []int `json:"allowedPorts,omitempty" yaml:"allowedPorts,omitempty"`
+
+	// AllowDNS allows DNS queries to the resolvers configured for the
+	// launcher
+	AllowDNS bool `json:"allowDNS,omitempty" yaml:"allowDNS,omitempty"`
+}
+
+// ProxyPolicy configures outbound HTTP calls of function nodes routed
+// through the sigma egress proxy
+type ProxyPolicy struct {
+	// AllowedHosts holds the hosts nodes may call through the proxy. A
+	// leading "*." matches all subdomains. All hosts are denied if empty
+	AllowedHosts []string `json:"allowedHosts,omitempty" yaml:"allowedHosts,omitempty"`
+
+	// AllowedCIDRs holds loopback, link-local and private networks allowed
+	// hosts may resolve to. Those addresses are blocked otherwise
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty" yaml:"allowedCIDRs,omitempty"`
+
+	// AllowedPorts holds the ports CONNECT tunnels may be opened to. Only
+	// port 443 is allowed if empty
+	AllowedPorts []int `json:"allowedPorts,omitempty" yaml:"allowedPorts,omitempty"`
+
+	// Retries is the number of times idempotent requests are retried
+	// if the upstream connection fails
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+}
@@ -0,0 +1,180 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/launcher"
+)
+
+// budgetSampleInterval is the interval the CPU time of nodes with a CPU
+// budget is sampled at
+var budgetSampleInterval = 10 * time.Second
+
+// budgetWindow is the window CPU budgets apply to
+const budgetWindow = time.Hour
+
+// Budgets exceeded by an invocation
+const (
+	BudgetWallTime = "wall time"
+	BudgetCPU      = "cpu"
+)
+
+// BudgetExceededError is returned by Dispatch if an invocation exceeded
+// an execution budget of the function. It holds the exceeded budget
+type BudgetExceededError string
+
+// Error implements the error interface
+func (e BudgetExceededError) Error() string {
+	return string(e) + " budget exceeded"
+}
+
+// cpuBudget accounts the CPU time consumed by all nodes of a function
+// within the current window
+type cpuBudget struct {
+	mu    sync.Mutex
+	limit time.Duration
+	start time.Time
+	used  time.Duration
+	nowFn func() time.Time
+}
+
+// add adds CPU time consumed by a node and returns false if the budget is
+// exhausted
+func (b *cpuBudget) add(d time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate()
+	b.used += d
+
+	return b.used <= b.limit
+}
+
+// exhausted returns true if the budget of the current window is used up
+func (b *cpuBudget) exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate()
+
+	return b.used > b.limit
+}
+
+func (b *cpuBudget) setLimit(limit time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limit = limit
+}
+
+func (b *cpuBudget) rotate() {
+	now := b.now()
+	if now.Sub(b.start) >= budgetWindow {
+		b.start = now
+		b.used = 0
+	}
+}
+
+func (b *cpuBudget) now() time.Time {
+	if b.nowFn != nil {
+		return b.nowFn()
+	}
+	return time.Now()
+}
+
+// executionBudget holds the budgets of a node
+type executionBudget struct {
+	wallTime time.Duration
+
+	// cpu is shared by all nodes of the function, may be nil
+	cpu *cpuBudget
+}
+
+// newExecutionBudget creates the execution budget of a node from spec or
+// returns nil if the function does not have a budget. CPU budgets are
+// shared by all nodes of a function and looked up in budgets
+func newExecutionBudget(spec *sigma.ExecutionBudget, id string, budgets map[string]*cpuBudget) (*executionBudget, error) {
+	if spec == nil || (spec.MaxWallTime == "" && spec.MaxCPUSecondsPerHour <= 0) {
+		return nil, nil
+	}
+
+	b := &executionBudget{}
+
+	if spec.MaxWallTime != "" {
+		d, err := time.ParseDuration(spec.MaxWallTime)
+		if err != nil {
+			return nil, err
+		}
+		b.wallTime = d
+	}
+
+	if spec.MaxCPUSecondsPerHour > 0 {
+		limit := time.Duration(spec.MaxCPUSecondsPerHour * float64(time.Second))
+
+		cpu, ok := budgets[id]
+		if !ok {
+			cpu = &cpuBudget{start: time.Now()}
+			budgets[id] = cpu
+		}
+		cpu.setLimit(limit)
+
+		b.cpu = cpu
+	}
+
+	return b, nil
+}
+
+// watchBudget samples the CPU time of the node until stop is closed. Once
+// the CPU budget of the function is exhausted, the node is killed if it
+// still consumes CPU time
+func (ctrl *controller) watchBudget(stop chan struct{}) {
+	accountant, ok := ctrl.instance.(launcher.CPUAccountant)
+	if !ok {
+		glog.Warning(ctrl.urn, " launcher does not support cpu accounting, cpu budget not enforced")
+		return
+	}
+
+	var last time.Duration
+
+	ticker := time.NewTicker(budgetSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		total, err := accountant.CPUTime()
+		if err != nil {
+			glog.Error(ctrl.urn, " failed to sample cpu time: ", err)
+			continue
+		}
+
+		delta := total - last
+		last = total
+
+		// idle nodes consume a little CPU time in the background and
+		// are kept so they can serve events once the budget resets
+		if !ctrl.budget.cpu.add(delta) && delta > budgetSampleInterval/100 {
+			ctrl.kill(BudgetCPU)
+			return
+		}
+	}
+}
+
+// kill hard-kills the instance of a node that exceeded a budget. The
+// node is marked unhealthy and replaced by its function controller
+func (ctrl *controller) kill(budget string) {
+	glog.Warningf("%s %s budget exceeded, killing node", ctrl.urn, budget)
+
+	ctrl.setState(StateUnhealthy)
+
+	if err := ctrl.instance.Stop(); err != nil {
+		glog.Error(ctrl.urn, " failed to kill node: ", err)
+	}
+}
@@ -0,0 +1,74 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+// hangingRouter never answers dispatched events
+type hangingRouter struct{}
+
+func (hangingRouter) Dispatch(ctx context.Context, in *sigmaV1.DispatchEvent) (*sigmaV1.ExecutionResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingRouter) Close() error     { return nil }
+func (hangingRouter) Connected() bool  { return true }
+func (hangingRouter) Registered() bool { return true }
+
+func TestCPUBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	budgets := make(map[string]*cpuBudget)
+
+	b, err := newExecutionBudget(&sigma.ExecutionBudget{MaxCPUSecondsPerHour: 10}, "fn", budgets)
+	assert.NoError(err)
+	b.cpu.start = now
+	b.cpu.nowFn = func() time.Time { return now }
+
+	// nodes of the same function share the budget
+	other, err := newExecutionBudget(&sigma.ExecutionBudget{MaxCPUSecondsPerHour: 10}, "fn", budgets)
+	assert.NoError(err)
+	assert.True(b.cpu == other.cpu)
+
+	assert.True(b.cpu.add(6 * time.Second))
+	assert.False(b.cpu.exhausted())
+	assert.False(other.cpu.add(6 * time.Second))
+	assert.True(b.cpu.exhausted())
+
+	now = now.Add(budgetWindow)
+	assert.False(b.cpu.exhausted())
+
+	b, err = newExecutionBudget(nil, "fn", budgets)
+	assert.NoError(err)
+	assert.Nil(b)
+}
+
+func TestDispatch_WallTimeBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	budget, err := newExecutionBudget(&sigma.ExecutionBudget{MaxWallTime: "10ms"}, "fn", nil)
+	assert.NoError(err)
+
+	instance := &fakeInstance{}
+	ctrl := &controller{
+		urn:      "urn:sigma:default:fn:1:node",
+		router:   hangingRouter{},
+		instance: instance,
+		state:    StateActive,
+		budget:   budget,
+	}
+
+	_, err = ctrl.Dispatch(context.Background(), &sigmaV1.DispatchEvent{})
+	assert.Equal(BudgetExceededError(BudgetWallTime), err)
+	assert.True(instance.stopped)
+	assert.Equal(StateUnhealthy, ctrl.state)
+}
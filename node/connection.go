@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -30,6 +31,13 @@ type Conn interface {
 	Close() error
 }
 
+// nodeChannel holds the request and response channels of a node
+// connection. The channels are owned by the nodeConn, live as long as the
+// connection and are never closed so subscriptions may come and go
+// without invalidating channels held by routers. Events queued in the
+// request channel are sent once the node (re)subscribes. Credits are only
+// checked by the subscription, events it picked up but could not send
+// before it ended are failed
 type nodeChannel struct {
 	request  chan *sigmaV1.DispatchEvent
 	response chan *sigmaV1.ExecutionResult
@@ -40,11 +48,48 @@ type nodeConn struct {
 	URN    string
 	spec   sigma.FunctionSpec
 
+	// nodeType is the node type the node must report during
+	// registration. Any node type is accepted if empty
+	nodeType string
+
+	// memoryMB is the memory reserved for the node by the quota manager.
+	// Zero if unlimited
+	memoryMB int64
+
+	// peerPID is the PID of the node process allowed to authenticate
+	// using unix peer credentials. Zero disables peer authentication.
+	// peerReady is created before the node is launched and closed once
+	// peerPID is known
+	peerPID   int
+	peerReady chan struct{}
+
 	closed chan struct{}
 
+	channel *nodeChannel
+
 	rw         sync.Mutex
-	channel    *nodeChannel
+	connected  bool
 	registered bool
+	slow       bool
+
+	// readiness reports of the node
+	ready         bool
+	readyFailures int
+
+	// sendTimeoutOverride replaces the send timeout of the node server
+	// while a debugger is attached
+	sendTimeoutOverride time.Duration
+
+	// protocol holds the protocol negotiated during registration
+	protocol protocol
+
+	// credits holds the credits granted by the node if it negotiated
+	// FeatureCredits
+	credits *creditWindow
+
+	// failures holds the errors of events failed locally until the
+	// router picked up their result
+	failures map[string]error
 }
 
 func newNodeConn(urn string, secret string, spec sigma.FunctionSpec) *nodeConn {
@@ -53,6 +98,11 @@ func newNodeConn(urn string, secret string, spec sigma.FunctionSpec) *nodeConn {
 		URN:    urn,
 		closed: make(chan struct{}),
 		spec:   spec,
+		channel: &nodeChannel{
+			request:  make(chan *sigmaV1.DispatchEvent, 100),
+			response: make(chan *sigmaV1.ExecutionResult, 100),
+		},
+		credits: newCreditWindow(),
 	}
 }
 
@@ -60,7 +110,7 @@ func (n *nodeConn) Connected() bool {
 	n.rw.Lock()
 	defer n.rw.Unlock()
 
-	return n.channel != nil
+	return n.connected
 }
 
 func (n *nodeConn) Close() error {
@@ -79,6 +129,12 @@ func (n *nodeConn) Close() error {
 }
 
 func (n *nodeConn) Send(in *sigmaV1.DispatchEvent) error {
+	return n.SendContext(context.Background(), in)
+}
+
+// SendContext queues a dispatch event and blocks while the request queue
+// is full until the connection is closed or ctx is cancelled
+func (n *nodeConn) SendContext(ctx context.Context, in *sigmaV1.DispatchEvent) error {
 	req, _, err := n.getChannels()
 	if err != nil {
 		return err
@@ -88,18 +144,21 @@ func (n *nodeConn) Send(in *sigmaV1.DispatchEvent) error {
 	case req <- in:
 	case <-n.closed:
 		return io.EOF
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 	return nil
 }
 
 func (n *nodeConn) Receive(ctx context.Context) (*sigmaV1.ExecutionResult, error) {
-	_, res, err := n.getChannels()
-	if err != nil {
-		return nil, err
+	// results are only delivered while connected but receiving must not
+	// fail while the node reconnects
+	if !n.Registered() {
+		return nil, errors.New("not yet registered")
 	}
 
 	select {
-	case out := <-res:
+	case out := <-n.channel.response:
 		return out, nil
 	case <-n.closed:
 		return nil, io.EOF
@@ -122,6 +181,28 @@ func (n *nodeConn) setRegistered(b bool) {
 	n.registered = b
 }
 
+func (n *nodeConn) setProtocol(p protocol) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	n.protocol = p
+}
+
+func (n *nodeConn) protocolVersion() int {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	return n.protocol.version
+}
+
+// supports returns true if the node negotiated f during registration
+func (n *nodeConn) supports(f Feature) bool {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	return n.protocol.supports(f)
+}
+
 func (n *nodeConn) getChannels() (chan *sigmaV1.DispatchEvent, chan *sigmaV1.ExecutionResult, error) {
 	n.rw.Lock()
 	defer n.rw.Unlock()
@@ -130,7 +211,7 @@ func (n *nodeConn) getChannels() (chan *sigmaV1.DispatchEvent, chan *sigmaV1.Exe
 		return nil, nil, errors.New("not yet registered")
 	}
 
-	if n.channel != nil {
+	if n.connected {
 		return n.channel.request, n.channel.response, nil
 	}
 
@@ -146,9 +227,81 @@ func (n *nodeConn) isClosed() bool {
 	}
 }
 
-func (n *nodeConn) setConnected(channel *nodeChannel) {
+// connect marks the connection as connected. It returns false if the
+// connection is already established
+func (n *nodeConn) connect() bool {
 	n.rw.Lock()
 	defer n.rw.Unlock()
 
-	n.channel = channel
+	if n.connected {
+		return false
+	}
+
+	n.connected = true
+	n.slow = false
+	return true
+}
+
+func (n *nodeConn) setConnected(b bool) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	n.connected = b
+	n.slow = false
+}
+
+// setReadiness records a readiness report of the node
+func (n *nodeConn) setReadiness(msg *sigmaV1.ExecutionResult) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	if _, failed := msg.GetExecutionResult().(*sigmaV1.ExecutionResult_Error); failed {
+		n.readyFailures++
+		return
+	}
+
+	n.ready = true
+}
+
+func (n *nodeConn) readiness() (bool, int) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	return n.ready, n.readyFailures
+}
+
+// Slow returns true if the node has been flagged as a slow consumer
+func (n *nodeConn) Slow() bool {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	return n.slow
+}
+
+func (n *nodeConn) setSlow(b bool) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	n.slow = b
+}
+
+// setSendTimeout overrides the send timeout of the connection. Zero
+// restores the default
+func (n *nodeConn) setSendTimeout(d time.Duration) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	n.sendTimeoutOverride = d
+}
+
+// sendTimeout returns the send timeout of the connection or def if it
+// has not been overridden
+func (n *nodeConn) sendTimeout(def time.Duration) time.Duration {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	if n.sendTimeoutOverride > 0 {
+		return n.sendTimeoutOverride
+	}
+	return def
 }
@@ -0,0 +1,103 @@
+package node
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// connShards is the number of shards of a connMap. It must be a power
+// of two
+const connShards = 32
+
+// connMap is a concurrency safe map of node connections indexed by URN.
+// Connections are distributed across multiple shards each guarded by its
+// own lock to reduce lock contention with thousands of nodes
+type connMap struct {
+	shards [connShards]connShard
+}
+
+type connShard struct {
+	rw    sync.RWMutex
+	conns map[string]*nodeConn
+}
+
+func newConnMap() *connMap {
+	m := &connMap{}
+	for i := range m.shards {
+		m.shards[i].conns = make(map[string]*nodeConn)
+	}
+	return m
+}
+
+func (m *connMap) shard(urn string) *connShard {
+	h := fnv.New32a()
+	h.Write([]byte(urn))
+	return &m.shards[h.Sum32()&(connShards-1)]
+}
+
+// get returns the connection for urn
+func (m *connMap) get(urn string) (*nodeConn, bool) {
+	s := m.shard(urn)
+
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	c, ok := s.conns[urn]
+	return c, ok
+}
+
+// add adds conn unless a connection with the same URN exists. The
+// existing connection is returned in that case
+func (m *connMap) add(conn *nodeConn) (*nodeConn, bool) {
+	s := m.shard(conn.URN)
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if e, ok := s.conns[conn.URN]; ok {
+		return e, false
+	}
+
+	s.conns[conn.URN] = conn
+	return nil, true
+}
+
+// remove removes and returns the connection for urn
+func (m *connMap) remove(urn string) (*nodeConn, bool) {
+	s := m.shard(urn)
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	c, ok := s.conns[urn]
+	if ok {
+		delete(s.conns, urn)
+	}
+	return c, ok
+}
+
+// len returns the number of connections
+func (m *connMap) len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.rw.RLock()
+		n += len(s.conns)
+		s.rw.RUnlock()
+	}
+	return n
+}
+
+// all returns a snapshot of all connections
+func (m *connMap) all() map[string]*nodeConn {
+	res := make(map[string]*nodeConn)
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.rw.RLock()
+		for urn, c := range s.conns {
+			res[urn] = c
+		}
+		s.rw.RUnlock()
+	}
+	return res
+}
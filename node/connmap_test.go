@@ -0,0 +1,142 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+// lockedConnMap is the single-lock map previously used by nodeServer. It
+// is kept as a baseline for the benchmarks below
+type lockedConnMap struct {
+	rw    sync.RWMutex
+	conns map[string]*nodeConn
+}
+
+func (m *lockedConnMap) get(urn string) (*nodeConn, bool) {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	c, ok := m.conns[urn]
+	return c, ok
+}
+
+func (m *lockedConnMap) add(conn *nodeConn) (*nodeConn, bool) {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	if e, ok := m.conns[conn.URN]; ok {
+		return e, false
+	}
+	m.conns[conn.URN] = conn
+	return nil, true
+}
+
+func (m *lockedConnMap) remove(urn string) (*nodeConn, bool) {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	c, ok := m.conns[urn]
+	delete(m.conns, urn)
+	return c, ok
+}
+
+type connStore interface {
+	get(string) (*nodeConn, bool)
+	add(*nodeConn) (*nodeConn, bool)
+	remove(string) (*nodeConn, bool)
+}
+
+func TestConnMap(t *testing.T) {
+	m := newConnMap()
+
+	c := newNodeConn("urn:sigma:node:1", "secret", sigma.FunctionSpec{})
+
+	_, ok := m.add(c)
+	assert.True(t, ok)
+
+	e, ok := m.add(newNodeConn("urn:sigma:node:1", "other", sigma.FunctionSpec{}))
+	assert.False(t, ok)
+	assert.Equal(t, c, e)
+
+	got, ok := m.get("urn:sigma:node:1")
+	assert.True(t, ok)
+	assert.Equal(t, c, got)
+	assert.Equal(t, 1, m.len())
+
+	got, ok = m.remove("urn:sigma:node:1")
+	assert.True(t, ok)
+	assert.Equal(t, c, got)
+	assert.Equal(t, 0, m.len())
+
+	_, ok = m.get("urn:sigma:node:1")
+	assert.False(t, ok)
+}
+
+const benchmarkNodes = 10000
+
+func populate(m connStore) []string {
+	urns := make([]string, benchmarkNodes)
+	for i := range urns {
+		urns[i] = fmt.Sprintf("urn:sigma:node:%d", i)
+		m.add(newNodeConn(urns[i], "secret", sigma.FunctionSpec{}))
+	}
+	return urns
+}
+
+// benchmarkMixed runs a workload of 90% lookups (dispatch and
+// authentication) and 10% add/remove (node churn)
+func benchmarkMixed(b *testing.B, m connStore) {
+	urns := populate(m)
+	var counter uint64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddUint64(&counter, 1)
+			urn := urns[i%benchmarkNodes]
+
+			if i%10 == 0 {
+				if c, ok := m.remove(urn); ok {
+					m.add(c)
+				}
+				continue
+			}
+
+			m.get(urn)
+		}
+	})
+}
+
+func BenchmarkConnMapMixed(b *testing.B) {
+	benchmarkMixed(b, newConnMap())
+}
+
+func BenchmarkLockedConnMapMixed(b *testing.B) {
+	benchmarkMixed(b, &lockedConnMap{conns: make(map[string]*nodeConn)})
+}
+
+func benchmarkRegister(b *testing.B, m connStore) {
+	var counter uint64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			urn := fmt.Sprintf("urn:sigma:node:%d", atomic.AddUint64(&counter, 1))
+			m.add(newNodeConn(urn, "secret", sigma.FunctionSpec{}))
+			m.remove(urn)
+		}
+	})
+}
+
+func BenchmarkConnMapRegister(b *testing.B) {
+	benchmarkRegister(b, newConnMap())
+}
+
+func BenchmarkLockedConnMapRegister(b *testing.B) {
+	benchmarkRegister(b, &lockedConnMap{conns: make(map[string]*nodeConn)})
+}
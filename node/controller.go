@@ -1,7 +1,6 @@
 package node
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -113,8 +112,39 @@ const (
 
 	// StateRunning is set when the node is currently executing
 	StateRunning = State("running")
+
+	// StateStarting is set while a node has not yet reported readiness
+	StateStarting = State("starting")
 )
 
+// ExecutionError is returned by Dispatch if the function reported an
+// error. Any other error returned by Dispatch means that the node could
+// not be reached
+type ExecutionError string
+
+// Error implements the error interface
+func (e ExecutionError) Error() string {
+	return string(e)
+}
+
+// EventUpdateAvailable is the type of the control event sent to nodes
+// when a new version of their function has been deployed. Control events
+// do not have an ID and must not be answered
+const EventUpdateAvailable = "sigma.update-available"
+
+// Notifier is implemented by controllers that can push control events
+// to their node
+type Notifier interface {
+	// Notify sends a control event to the node without waiting for a
+	// result
+	Notify(typ string, payload []byte) error
+}
+
+// slowConn is implemented by connections that detect slow consumers
+type slowConn interface {
+	Slow() bool
+}
+
 // Controller manages a given function node
 type Controller interface {
 	URN() string
@@ -125,7 +155,9 @@ type Controller interface {
 	// Stats returns some statistics for this node instance controller
 	Stats() Stats
 
-	// Dispatch dispatches an event to the node
+	// Dispatch dispatches an event to the node. The event payload is
+	// sent without copying and must not be modified until Dispatch
+	// returns. The returned result is owned by the caller
 	Dispatch(context.Context, *sigmaV1.DispatchEvent) ([]byte, error)
 
 	// OnDestroy registers an on-destroy handler
@@ -140,8 +172,21 @@ type controller struct {
 	urn string
 
 	router   Router
+	conn     Conn
 	instance launcher.Instance
 
+	// probe is set if the node must report readiness before it can be
+	// selected
+	probe *readinessProbe
+
+	// lifecycle holds the lifecycle events to dispatch, may be nil
+	lifecycle *lifecycleHooks
+
+	// budget holds the execution budget of the node, may be nil
+	budget      *executionBudget
+	stopBudget  chan struct{}
+	budgetClose sync.Once
+
 	rw        sync.RWMutex
 	state     State
 	stats     Stats
@@ -164,6 +209,19 @@ func (ctrl *controller) State() State {
 		return StateUnhealthy
 	}
 
+	if ctrl.probe != nil && ctrl.supports(FeatureReadiness) {
+		if s := ctrl.probe.state(ctrl.conn, ctrl.stats.CreatedAt); s != "" {
+			return s
+		}
+	}
+
+	// nodes flagged as slow consumers are not selected until they
+	// catch up. They are disabled rather than unhealthy so they are not
+	// destroyed
+	if s, ok := ctrl.conn.(slowConn); ok && s.Slow() {
+		return StateDisabled
+	}
+
 	return ctrl.state
 }
 
@@ -174,12 +232,29 @@ func (ctrl *controller) URN() string {
 // Dispatch dispatches the given event to the node and returns
 // the execution result
 func (ctrl *controller) Dispatch(ctx context.Context, event *sigmaV1.DispatchEvent) ([]byte, error) {
+	if ctrl.budget != nil {
+		if ctrl.budget.cpu != nil && ctrl.budget.cpu.exhausted() {
+			return nil, BudgetExceededError(BudgetCPU)
+		}
+
+		if ctrl.budget.wallTime > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ctrl.budget.wallTime)
+			defer cancel()
+		}
+	}
+
 	start := time.Now()
 
 	ctrl.setState(StateRunning)
 
 	res, err := ctrl.router.Dispatch(ctx, event)
 	if err != nil {
+		if err == context.DeadlineExceeded && ctrl.budget != nil && ctrl.budget.wallTime > 0 && time.Since(start) >= ctrl.budget.wallTime {
+			ctrl.kill(BudgetWallTime)
+			return nil, BudgetExceededError(BudgetWallTime)
+		}
+
 		ctrl.setState(StateUnhealthy)
 		return nil, err
 	}
@@ -199,7 +274,7 @@ func (ctrl *controller) Dispatch(ctx context.Context, event *sigmaV1.DispatchEve
 
 	switch v := res.GetExecutionResult().(type) {
 	case *sigmaV1.ExecutionResult_Error:
-		return nil, errors.New(v.Error)
+		return nil, ExecutionError(v.Error)
 	case *sigmaV1.ExecutionResult_Result:
 		return v.Result, nil
 	default:
@@ -207,6 +282,14 @@ func (ctrl *controller) Dispatch(ctx context.Context, event *sigmaV1.DispatchEve
 	}
 }
 
+// Notify sends a control event to the node and implements Notifier
+func (ctrl *controller) Notify(typ string, payload []byte) error {
+	return ctrl.conn.Send(&sigmaV1.DispatchEvent{
+		Type:    typ,
+		Payload: payload,
+	})
+}
+
 func (ctrl *controller) Stats() Stats {
 	ctrl.rw.RLock()
 	defer ctrl.rw.RUnlock()
@@ -216,6 +299,12 @@ func (ctrl *controller) Stats() Stats {
 
 // Close closes the connection to the node and removes the node instance
 func (ctrl *controller) Close() error {
+	if ctrl.stopBudget != nil {
+		ctrl.budgetClose.Do(func() { close(ctrl.stopBudget) })
+	}
+
+	ctrl.runShutdown()
+
 	ctrl.rw.Lock()
 	defer ctrl.rw.Unlock()
 
@@ -236,10 +325,18 @@ func (ctrl *controller) setState(s State) {
 
 // CreateController creates a new controller for the given node
 func CreateController(u string, instance launcher.Instance, conn Conn) Controller {
+	return createController(u, instance, conn)
+}
+
+func createController(u string, instance launcher.Instance, conn Conn) *controller {
 	return &controller{
 		urn:      u,
 		router:   NewRouter(conn),
+		conn:     conn,
 		instance: instance,
 		state:    StateActive,
+		stats: Stats{
+			CreatedAt: time.Now(),
+		},
 	}
 }
@@ -0,0 +1,174 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"golang.org/x/net/context"
+)
+
+// CreditID is the ID of the execution result a node sends to grant
+// credits. The result payload holds the number of credits as decimal
+// string. Each credit allows the node server to send one more event.
+// Nodes sharing a multiplexed stream must append "/<node-urn>" to the ID
+const CreditID = "sigma.credit"
+
+// isCredit returns the number of credits granted by msg and true if msg is
+// a credit grant. For multiplexed streams the URN of the granting node is
+// returned as well. Grants with an invalid count return zero credits
+func isCredit(msg *sigmaV1.ExecutionResult) (urn string, credits int, ok bool) {
+	id := msg.GetId()
+
+	switch {
+	case id == CreditID:
+	case strings.HasPrefix(id, CreditID+"/"):
+		urn = strings.TrimPrefix(id, CreditID+"/")
+	default:
+		return "", 0, false
+	}
+
+	n, err := strconv.Atoi(string(msg.GetResult()))
+	if err != nil || n < 0 {
+		return urn, 0, true
+	}
+
+	return urn, n, true
+}
+
+// creditWindow holds the credits granted by a node for the current
+// subscription. Events are only sent to the node while credits are
+// available
+type creditWindow struct {
+	mu      sync.Mutex
+	credits int
+
+	// granted is signalled whenever credits are granted
+	granted chan struct{}
+}
+
+func newCreditWindow() *creditWindow {
+	return &creditWindow{
+		granted: make(chan struct{}, 1),
+	}
+}
+
+// grant adds n credits to the window
+func (w *creditWindow) grant(n int) {
+	if n <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	w.credits += n
+	w.mu.Unlock()
+
+	select {
+	case w.granted <- struct{}{}:
+	default:
+	}
+}
+
+// acquire takes a credit from the window and blocks until one is granted,
+// ctx is cancelled or closed is closed
+func (w *creditWindow) acquire(ctx context.Context, closed <-chan struct{}) error {
+	for {
+		w.mu.Lock()
+		if w.credits > 0 {
+			w.credits--
+			w.mu.Unlock()
+			return nil
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-w.granted:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return errConnClosed
+		}
+	}
+}
+
+// reset drops all credits. Nodes grant a new window for each
+// subscription
+func (w *creditWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.credits = 0
+
+	select {
+	case <-w.granted:
+	default:
+	}
+}
+
+// available returns the number of credits left
+func (w *creditWindow) available() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.credits
+}
+
+// acquireCredit takes a credit before req is sent to a node that
+// negotiated FeatureCredits. Control events do not expect a result and
+// are sent without credits
+func (n *nodeConn) acquireCredit(ctx context.Context, req *sigmaV1.DispatchEvent) error {
+	if req.GetId() == "" || !n.usesCredits() {
+		return nil
+	}
+
+	return n.credits.acquire(ctx, n.closed)
+}
+
+// usesCredits returns true if the node negotiated FeatureCredits. Unlike
+// other features credits must be negotiated explicitly as nodes that do
+// not grant credits would never receive events
+func (n *nodeConn) usesCredits() bool {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	return n.protocol.features[FeatureCredits]
+}
+
+// fail answers req with an error result so the route waiting for it fails
+// instead of waiting for a result that never arrives. Used for events
+// picked up by a subscription that ended or failed before they could be
+// sent. The router returns err as is to the dispatcher. Control events do
+// not expect a result and are dropped
+func (n *nodeConn) fail(req *sigmaV1.DispatchEvent, err error) {
+	if req.GetId() == "" {
+		return
+	}
+
+	n.rw.Lock()
+	if n.failures == nil {
+		n.failures = make(map[string]error)
+	}
+	n.failures[req.GetId()] = err
+	n.rw.Unlock()
+
+	select {
+	case n.channel.response <- &sigmaV1.ExecutionResult{
+		Id:              req.GetId(),
+		ExecutionResult: &sigmaV1.ExecutionResult_Error{Error: err.Error()},
+	}:
+	case <-n.closed:
+		n.failure(req.GetId())
+	}
+}
+
+// failure returns and forgets the error the event id has been failed with
+// or nil if the event has not been failed locally
+func (n *nodeConn) failure(id string) error {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	err := n.failures[id]
+	delete(n.failures, id)
+	return err
+}
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCredit(t *testing.T) {
+	assert := assert.New(t)
+
+	urn, n, ok := isCredit(&sigmaV1.ExecutionResult{
+		Id:              CreditID,
+		ExecutionResult: &sigmaV1.ExecutionResult_Result{Result: []byte("16")},
+	})
+	assert.True(ok)
+	assert.Equal("", urn)
+	assert.Equal(16, n)
+
+	urn, n, ok = isCredit(&sigmaV1.ExecutionResult{
+		Id:              CreditID + "/urn:sigma:default:test:1:node",
+		ExecutionResult: &sigmaV1.ExecutionResult_Result{Result: []byte("-1")},
+	})
+	assert.True(ok)
+	assert.Equal("urn:sigma:default:test:1:node", urn)
+	assert.Equal(0, n)
+
+	_, _, ok = isCredit(&sigmaV1.ExecutionResult{Id: ReadyID})
+	assert.False(ok)
+}
+
+func TestSubscribe_Credits(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	p, _ := negotiate("3", nil)
+	conn.setProtocol(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+	go h.subscribe(conn, stream)
+	waitConnected(t, conn, true)
+
+	for i := 0; i < 3; i++ {
+		go conn.Send(&sigmaV1.DispatchEvent{Id: "event"})
+	}
+
+	grant := func(n string) {
+		stream.results <- &sigmaV1.ExecutionResult{
+			Id:              CreditID,
+			ExecutionResult: &sigmaV1.ExecutionResult_Result{Result: []byte(n)},
+		}
+	}
+
+	received := func() bool {
+		select {
+		case <-stream.events:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	// nothing is sent before the node granted credits
+	assert.False(received())
+
+	grant("2")
+	assert.True(received())
+	assert.True(received())
+	assert.False(received())
+
+	grant("1")
+	assert.True(received())
+
+	// control events do not need credits
+	go conn.Send(&sigmaV1.DispatchEvent{Type: "control"})
+	assert.True(received())
+}
+
+func TestSubscribe_CreditsFailPending(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	p, _ := negotiate("3", nil)
+	conn.setProtocol(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := newFakeStream(ctx)
+	done := make(chan struct{})
+	go func() {
+		h.subscribe(conn, stream)
+		close(done)
+	}()
+	waitConnected(t, conn, true)
+
+	assert.NoError(conn.Send(&sigmaV1.DispatchEvent{Id: "event"}))
+
+	// the subscription ends while the event waits for a credit
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	res, err := conn.Receive(context.Background())
+	assert.NoError(err)
+	assert.Equal("event", res.GetId())
+	assert.NotEmpty(res.GetError())
+}
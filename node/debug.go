@@ -0,0 +1,68 @@
+package node
+
+import (
+	"errors"
+	"time"
+
+	"github.com/homebot/sigma/launcher"
+)
+
+// Control events sent to nodes when a debugger is attached or detached.
+// Nodes open their debugger on the port passed in SIGMA_DEBUG_PORT
+const (
+	EventDebugAttach = "sigma.debug.attach"
+	EventDebugDetach = "sigma.debug.detach"
+)
+
+// StateDebugging is reported for nodes with an attached debugger. Those
+// nodes are not selected for events
+const StateDebugging = State("debugging")
+
+// ErrNotDebuggable is returned by Attach if the node instance does not
+// expose a debugger port or the node did not negotiate FeatureDebug
+var ErrNotDebuggable = errors.New("node instance does not expose a debugger")
+
+// Debugger is implemented by node controllers supporting debug sessions
+type Debugger interface {
+	// Attach asks the node to open its debugger and returns the address
+	// the debugger can be reached at. While attached, sends to the node
+	// may block for up to sendTimeout, e.g. while paused at a breakpoint
+	Attach(sendTimeout time.Duration) (string, error)
+
+	// Detach asks the node to close its debugger and restores the send
+	// timeout
+	Detach() error
+}
+
+// Attach implements Debugger
+func (ctrl *controller) Attach(sendTimeout time.Duration) (string, error) {
+	dbg, ok := ctrl.instance.(launcher.Debuggable)
+	if !ok || !ctrl.supports(FeatureDebug) {
+		return "", ErrNotDebuggable
+	}
+
+	addr, err := dbg.DebugAddress()
+	if err != nil {
+		return "", err
+	}
+
+	if nc, ok := ctrl.conn.(*nodeConn); ok {
+		nc.setSendTimeout(sendTimeout)
+	}
+
+	if err := ctrl.Notify(EventDebugAttach, nil); err != nil {
+		ctrl.Detach()
+		return "", err
+	}
+
+	return addr, nil
+}
+
+// Detach implements Debugger
+func (ctrl *controller) Detach() error {
+	if nc, ok := ctrl.conn.(*nodeConn); ok {
+		nc.setSendTimeout(0)
+	}
+
+	return ctrl.Notify(EventDebugDetach, nil)
+}
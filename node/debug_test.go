@@ -0,0 +1,128 @@
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/launcher"
+	"github.com/stretchr/testify/assert"
+)
+
+type debuggableInstance struct {
+	fakeInstance
+	addr string
+}
+
+func (i *debuggableInstance) DebugAddress() (string, error) { return i.addr, nil }
+
+func TestAttach(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+	go h.subscribe(conn, stream)
+	waitConnected(t, conn, true)
+
+	ctrl := &controller{
+		urn:      conn.URN,
+		conn:     conn,
+		instance: &debuggableInstance{addr: "127.0.0.1:9229"},
+		state:    StateActive,
+	}
+
+	received := func() string {
+		select {
+		case ev := <-stream.events:
+			return ev.Type
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	var (
+		addr string
+		err  error
+	)
+	done := make(chan struct{})
+	go func() {
+		addr, err = ctrl.Attach(time.Hour)
+		close(done)
+	}()
+
+	assert.Equal(EventDebugAttach, received())
+	<-done
+	assert.NoError(err)
+	assert.Equal("127.0.0.1:9229", addr)
+
+	// sends may block while the node is paused at a breakpoint
+	assert.Equal(time.Hour, conn.sendTimeout(time.Second))
+
+	done = make(chan struct{})
+	go func() {
+		err = ctrl.Detach()
+		close(done)
+	}()
+
+	assert.Equal(EventDebugDetach, received())
+	<-done
+	assert.NoError(err)
+	assert.Equal(time.Second, conn.sendTimeout(time.Second))
+}
+
+func TestAttach_Failed(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	// instances without a debugger port cannot be debugged
+	ctrl := &controller{urn: conn.URN, conn: conn, instance: &fakeInstance{}}
+	_, err := ctrl.Attach(time.Hour)
+	assert.Equal(ErrNotDebuggable, err)
+	assert.Equal(time.Second, conn.sendTimeout(time.Second))
+
+	// ... as well as nodes that did not negotiate the debug feature
+	p, _ := negotiate("2", []string{"lifecycle"})
+	conn.setProtocol(p)
+
+	ctrl.instance = &debuggableInstance{addr: "127.0.0.1:9229"}
+	_, err = ctrl.Attach(time.Hour)
+	assert.Equal(ErrNotDebuggable, err)
+
+	// the send timeout is restored if the node cannot be notified, e.g.
+	// because it is not connected
+	p, _ = negotiate("3", nil)
+	conn.setProtocol(p)
+	_, err = ctrl.Attach(time.Hour)
+	assert.Error(err)
+	assert.Equal(time.Second, conn.sendTimeout(time.Second))
+}
+
+func TestDeploy_DebugPort(t *testing.T) {
+	assert := assert.New(t)
+
+	var cfg launcher.Config
+	l := launcher.CreateFunc(func(_ context.Context, _ string, c launcher.Config) (launcher.Instance, error) {
+		cfg = c
+		return nil, errors.New("not supported")
+	})
+
+	d := NewDeployer(NewNodeServer(), l, "127.0.0.1:50052", WithDebugPort(9229))
+	_, err := d.Deploy(context.Background(), "urn:sigma:default:fn:1:node", sigma.FunctionSpec{ID: "fn", Type: "js"})
+	assert.Error(err)
+	assert.Equal(9229, cfg.DebugPort)
+
+	d = NewDeployer(NewNodeServer(), l, "127.0.0.1:50052")
+	_, err = d.Deploy(context.Background(), "urn:sigma:default:fn:1:node", sigma.FunctionSpec{ID: "fn", Type: "js"})
+	assert.Error(err)
+	assert.Equal(0, cfg.DebugPort)
+}
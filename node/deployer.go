@@ -1,10 +1,17 @@
 package node
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/artifact"
 	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/runtimes"
+	"github.com/homebot/sigma/signature"
 	uuid "github.com/satori/go.uuid"
 	"golang.org/x/net/context"
 )
@@ -29,12 +36,38 @@ type deployer struct {
 	service          NodeServer
 	launcher         launcher.Launcher
 	advertiseAddress string
+	artifacts        artifact.Store
+	runtimes         *runtimes.Registry
+	verifier         *signature.Verifier
+	webSocketAddress string
+	stateAddress     string
+	proxyAddress     string
+	debugPort        int
+
+	mu sync.Mutex
+
+	// nodes holds the controllers of deployed nodes by URN
+	nodes map[string]*controller
+
+	// pending holds the URNs of nodes currently being deployed
+	pending map[string]struct{}
+
+	// suspects holds the URNs of orphans found by the last
+	// reconciliation pass
+	suspects map[string]struct{}
+
+	// adopted holds the URNs of nodes kept although the launcher lost
+	// track of their instance
+	adopted map[string]struct{}
+
+	// budgets holds the CPU budgets of functions by ID
+	budgets map[string]*cpuBudget
 }
 
 // NewDeployer creates a new node deployer. The new deployer will
 // setup `svc` to accept the new node and use `launcher` to create
 // a new instance. See `Deploy()` for more information
-func NewDeployer(svc NodeServer, launcher launcher.Launcher, handlerAddress string) Deployer {
+func NewDeployer(svc NodeServer, launcher launcher.Launcher, handlerAddress string, opts ...DeployerOption) Deployer {
 	if svc == nil {
 		panic("NewDeployer(): NodeServer parameter is mandatory")
 	}
@@ -43,11 +76,22 @@ func NewDeployer(svc NodeServer, launcher launcher.Launcher, handlerAddress stri
 		panic("NewDeployer(): Launcher parameter is mandatory")
 	}
 
-	return &deployer{
+	d := &deployer{
 		service:          svc,
 		launcher:         launcher,
 		advertiseAddress: handlerAddress,
+		nodes:            make(map[string]*controller),
+		pending:          make(map[string]struct{}),
+		suspects:         make(map[string]struct{}),
+		adopted:          make(map[string]struct{}),
+		budgets:          make(map[string]*cpuBudget),
+	}
+
+	for _, fn := range opts {
+		fn(d)
 	}
+
+	return d
 }
 
 // Deploy deploys a new node
@@ -56,22 +100,150 @@ func (d *deployer) Deploy(ctx context.Context, u string, spec sigma.FunctionSpec
 	// as it is ready
 	secret := uuid.NewV4().String()
 
+	d.mu.Lock()
+	d.pending[u] = struct{}{}
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, u)
+		d.mu.Unlock()
+	}()
+
+	if d.verifier != nil {
+		if err := d.verifier.Verify(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := launcher.Config{
+		URN:       u,
+		Secret:    secret,
+		Address:   d.advertiseAddress,
+		Network:   spec.Network,
+		Security:  spec.Security,
+		State:     d.stateAddress,
+		DebugPort: d.debugPort,
+	}
+
+	if spec.Artifact == "" {
+		cfg.Digest = signature.ContentDigest(spec)
+	}
+
+	if d.proxyAddress != "" {
+		proxyURL := url.URL{
+			Scheme: "http",
+			User:   url.UserPassword(u, secret),
+			Host:   d.proxyAddress,
+		}
+		cfg.Proxy = proxyURL.String()
+	}
+
+	if spec.Scratch != nil {
+		cfg.ScratchSize = spec.Scratch.SizeMB << 20
+	}
+
+	if spec.Resources != nil {
+		cfg.MemoryLimit = spec.Resources.MemoryMB << 20
+	}
+
+	if err := d.resolveArtifact(spec, &cfg); err != nil {
+		return nil, err
+	}
+
+	if spec.ParameterSchema != nil {
+		// secrets are resolved by the node server and never exposed as
+		// environment variables so keep the references here
+		params, err := spec.ParameterSchema.Validate(spec.Parameteres, func(ref string) (string, error) { return ref, nil })
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Parameters, err = spec.ParameterSchema.Env(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch spec.Transport {
+	case "", sigma.TransportGRPC:
+	case sigma.TransportWebSocket:
+		if d.webSocketAddress == "" {
+			return nil, errors.New("websocket transport not configured")
+		}
+
+		cfg.Address = d.webSocketAddress
+		cfg.Transport = sigma.TransportWebSocket
+	default:
+		return nil, fmt.Errorf("unsupported transport %q", spec.Transport)
+	}
+
+	probe, err := newReadinessProbe(spec.Readiness)
+	if err != nil {
+		return nil, err
+	}
+
+	lifecycle, err := newLifecycleHooks(spec.Lifecycle)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	budget, err := newExecutionBudget(spec.Budget, spec.ID, d.budgets)
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	typ := spec.Type
+	if d.runtimes != nil {
+		rt, err := d.runtimes.Resolve(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := rt.Validate(spec); err != nil {
+			return nil, err
+		}
+
+		typ = rt.Key()
+	}
+
 	conn, err := d.service.Prepare(u, secret, spec)
 	if err != nil {
 		return nil, err
 	}
 
+	// nodes of functions without resources are limited to the memory
+	// reserved by their namespace quota
+	nc, _ := conn.(*nodeConn)
+	if nc != nil && cfg.MemoryLimit == 0 {
+		cfg.MemoryLimit = nc.memoryMB << 20
+	}
+
+	// nodes running as local processes may authenticate using their
+	// peer credentials when connecting via unix domain socket. The node
+	// may connect before Create returns so peer authentication must be
+	// expected before the process is started
+	if nc != nil {
+		nc.expectPeer()
+	}
+
 	// Next, instruct the launcher to deploy a new instance
-	instance, err := d.launcher.Create(ctx, spec.Type, launcher.Config{
-		URN:     u,
-		Secret:  secret,
-		Address: d.advertiseAddress,
-	})
+	instance, err := d.launcher.Create(ctx, typ, cfg)
 	if err != nil {
 		d.service.Remove(u)
 		return nil, err
 	}
 
+	if nc != nil {
+		pid := 0
+		if p, ok := instance.(launcher.ProcessInstance); ok {
+			pid = p.PID()
+		}
+		nc.allowPeer(pid)
+	}
+
 	// now the instance has been deployed successfully,
 	// we now wait until the instance connects
 	for {
@@ -89,11 +261,58 @@ func (d *deployer) Deploy(ctx context.Context, u string, spec sigma.FunctionSpec
 		}
 	}
 
-	ctrl := CreateController(u, instance, conn)
+	ctrl := createController(u, instance, conn)
+	ctrl.probe = probe
+	ctrl.lifecycle = lifecycle
+	ctrl.budget = budget
 
-	removeController := func(ctrl Controller) { d.service.Remove(ctrl.URN()) }
+	removeController := func(ctrl Controller) {
+		d.untrack(ctrl.URN())
+		d.service.Remove(ctrl.URN())
+	}
 
 	ctrl.OnDestroy(removeController)
 
+	if err := ctrl.runInit(ctx); err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+
+	if budget != nil && budget.cpu != nil {
+		ctrl.stopBudget = make(chan struct{})
+		go ctrl.watchBudget(ctrl.stopBudget)
+	}
+
+	d.mu.Lock()
+	d.nodes[u] = ctrl
+	d.mu.Unlock()
+
 	return ctrl, nil
 }
+
+// resolveArtifact updates the launcher configuration for the function
+// artifact referenced by spec
+func (d *deployer) resolveArtifact(spec sigma.FunctionSpec, cfg *launcher.Config) error {
+	if spec.Artifact == "" {
+		return nil
+	}
+
+	if d.artifacts == nil {
+		return errors.New("artifact store not configured")
+	}
+
+	desc, err := d.artifacts.Stat(artifact.Digest(spec.Artifact))
+	if err != nil {
+		return err
+	}
+
+	switch desc.Kind {
+	case artifact.KindOCI:
+		cfg.Image = desc.Reference
+	case artifact.KindArchive:
+		cfg.ContentType = desc.MediaType
+		cfg.Digest = desc.Digest.String()
+	}
+
+	return nil
+}
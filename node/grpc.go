@@ -0,0 +1,85 @@
+package node
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// GRPCOptions holds tuning options for the gRPC server serving the node
+// handler. Zero values keep the gRPC defaults
+type GRPCOptions struct {
+	// KeepaliveTime is the interval after which the server pings idle
+	// connections. Keep it below the idle timeout of any load balancer
+	// between nodes and the controller
+	KeepaliveTime time.Duration
+
+	// KeepaliveTimeout is the time the server waits for a ping ack
+	// before closing the connection
+	KeepaliveTimeout time.Duration
+
+	// MinPingInterval is the minimum interval clients may send pings at.
+	// Clients pinging more often are disconnected
+	MinPingInterval time.Duration
+
+	// PermitWithoutStream allows client pings without active streams
+	PermitWithoutStream bool
+
+	// MaxConnectionIdle closes connections idle for the given duration
+	MaxConnectionIdle time.Duration
+
+	// MaxConnectionAge closes connections older than the given duration
+	MaxConnectionAge time.Duration
+
+	// MaxConnectionAgeGrace is the time pending RPCs are given to
+	// complete after MaxConnectionAge has been reached
+	MaxConnectionAgeGrace time.Duration
+
+	// MaxConcurrentStreams limits the number of concurrent streams per
+	// connection
+	MaxConcurrentStreams uint32
+
+	// MaxRecvMsgSize is the maximum size of messages the server accepts
+	MaxRecvMsgSize int
+
+	// MaxSendMsgSize is the maximum size of messages the server sends
+	MaxSendMsgSize int
+}
+
+// ServerOptions returns the gRPC server options for o
+func (o GRPCOptions) ServerOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+
+	params := keepalive.ServerParameters{
+		Time:                  o.KeepaliveTime,
+		Timeout:               o.KeepaliveTimeout,
+		MaxConnectionIdle:     o.MaxConnectionIdle,
+		MaxConnectionAge:      o.MaxConnectionAge,
+		MaxConnectionAgeGrace: o.MaxConnectionAgeGrace,
+	}
+	if params != (keepalive.ServerParameters{}) {
+		opts = append(opts, grpc.KeepaliveParams(params))
+	}
+
+	if o.MinPingInterval > 0 || o.PermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             o.MinPingInterval,
+			PermitWithoutStream: o.PermitWithoutStream,
+		}))
+	}
+
+	if o.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(o.MaxConcurrentStreams))
+	}
+
+	if o.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(o.MaxRecvMsgSize))
+	}
+
+	if o.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(o.MaxSendMsgSize))
+	}
+
+	return opts
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoService returns the received message
+var echoService = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Echo",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(wrappers.BytesValue)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return in, nil
+			},
+		},
+	},
+}
+
+// echo serves the echo service using opts and sends size bytes
+func echo(t *testing.T, opts GRPCOptions, size int) error {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer(opts.ServerOptions()...)
+	srv.RegisterService(&echoService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return conn.Invoke(ctx, "/test.Echo/Echo", &wrappers.BytesValue{Value: make([]byte, size)}, new(wrappers.BytesValue))
+}
+
+func TestGRPCOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	// zero values keep the gRPC defaults
+	assert.Empty(GRPCOptions{}.ServerOptions())
+
+	cases := []struct {
+		opts  GRPCOptions
+		count int
+	}{
+		{GRPCOptions{KeepaliveTime: time.Minute}, 1},
+		{GRPCOptions{KeepaliveTimeout: time.Second, MaxConnectionIdle: time.Minute}, 1},
+		{GRPCOptions{MaxConnectionAge: time.Hour, MaxConnectionAgeGrace: time.Minute}, 1},
+		{GRPCOptions{MinPingInterval: time.Second}, 1},
+		{GRPCOptions{PermitWithoutStream: true}, 1},
+		{GRPCOptions{MaxConcurrentStreams: 10}, 1},
+		{GRPCOptions{MaxRecvMsgSize: 1024}, 1},
+		{GRPCOptions{MaxSendMsgSize: 1024}, 1},
+		{GRPCOptions{
+			KeepaliveTime:        time.Minute,
+			MinPingInterval:      time.Second,
+			MaxConcurrentStreams: 10,
+			MaxRecvMsgSize:       1024,
+			MaxSendMsgSize:       1024,
+		}, 5},
+	}
+
+	for _, c := range cases {
+		assert.Len(c.opts.ServerOptions(), c.count, "%+v", c.opts)
+	}
+}
+
+func TestGRPCOptions_MessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(echo(t, GRPCOptions{}, 2048))
+	assert.NoError(echo(t, GRPCOptions{MaxRecvMsgSize: 4096, MaxSendMsgSize: 4096}, 2048))
+
+	// requests exceeding the limit are rejected ...
+	err := echo(t, GRPCOptions{MaxRecvMsgSize: 1024}, 2048)
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+
+	// ... as well as responses
+	err = echo(t, GRPCOptions{MaxSendMsgSize: 1024}, 2048)
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+}
@@ -2,14 +2,23 @@ package node
 
 import (
 	"errors"
-	"sync"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 
 	"github.com/golang/glog"
 	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
 	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/artifact"
+	"github.com/homebot/sigma/parameters"
+	"github.com/homebot/sigma/quota"
+	"github.com/homebot/sigma/runtimes"
+	"github.com/homebot/sigma/urn"
 	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
 )
 
 // NodeServer handles communication with function nodes
@@ -17,39 +26,98 @@ import (
 type NodeServer interface {
 	sigmaV1.NodeHandlerServer
 
+	// ServeHTTP serves the WebSocket node transport
+	http.Handler
+
 	Prepare(string, string, sigma.FunctionSpec) (Conn, error)
 
 	Remove(string) error
+
+	// Connections returns all prepared connections indexed by URN
+	Connections() map[string]Conn
+
+	// Authenticate authenticates the calling node using the same
+	// credentials as the node handler and returns the spec of the
+	// function the node belongs to
+	Authenticate(context.Context) (sigma.FunctionSpec, error)
 }
 
 // nodeServer provides a `protobuf/api/sigma` node handler server
 type nodeServer struct {
-	rw    sync.RWMutex
-	conns map[string]*nodeConn
+	conns *connMap
+	send  sendPolicy
+
+	secrets parameters.SecretResolver
+
+	artifacts artifact.Store
+	runtimes  *runtimes.Registry
+
+	// quotas limits the nodes and memory per namespace. Nil if
+	// unlimited
+	quotas *quota.Manager
+
+	// protocols counts registered nodes per protocol version
+	protocols protocolStats
 }
 
 // NewNodeServer returns a new handler service
-func NewNodeServer() NodeServer {
-	return &nodeServer{
-		conns: make(map[string]*nodeConn),
+func NewNodeServer(opts ...ServerOption) NodeServer {
+	h := &nodeServer{
+		conns: newConnMap(),
+		send: sendPolicy{
+			timeout:   DefaultSendTimeout,
+			slowAfter: DefaultSlowSendThreshold,
+			slowLimit: DefaultSlowSendLimit,
+		},
+	}
+
+	for _, fn := range opts {
+		fn(h)
 	}
+
+	return h
 }
 
 // Register implements sigma.NodeHandlerServer
 func (h *nodeServer) Register(ctx context.Context, in *sigmaV1.NodeRegistrationRequest) (*sigmaV1.NodeRegistrationResponse, error) {
-	urn, secret, err := getAuth(ctx)
+	conn, err := h.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var version string
+	if v := md[ProtocolHeader]; len(v) > 0 {
+		version = v[0]
+	}
+
+	p, err := negotiate(version, md[FeaturesHeader])
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := h.register(conn, in, p)
 	if err != nil {
 		return nil, err
 	}
 
+	v, features := p.headers()
+	grpc.SetHeader(ctx, metadata.Pairs(ProtocolHeader, v, FeaturesHeader, features))
+
+	return res, nil
+}
+
+// register registers the node of conn using the negotiated protocol p. It
+// is shared by all node transports
+func (h *nodeServer) register(conn *nodeConn, in *sigmaV1.NodeRegistrationRequest, p protocol) (*sigmaV1.NodeRegistrationResponse, error) {
 	typ := in.GetNodeType()
 	if typ == "" {
 		return nil, errors.New("missing node type")
 	}
 
-	conn, err := h.getConnection(urn, secret)
-	if err != nil {
-		return nil, err
+	if conn.nodeType != "" && conn.nodeType != typ {
+		return nil, fmt.Errorf("unexpected node type %q, expected %q", typ, conn.nodeType)
 	}
 
 	if conn.Registered() {
@@ -60,126 +128,330 @@ func (h *nodeServer) Register(ctx context.Context, in *sigmaV1.NodeRegistrationR
 		return nil, errors.New("node marked for shutdown")
 	}
 
+	content, err := h.getContent(conn.spec)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.setProtocol(p)
 	conn.setRegistered(true)
+	h.protocols.add(p.version, 1)
 
 	return &sigmaV1.NodeRegistrationResponse{
 		Urn:        in.GetUrn(),
-		Content:    []byte(conn.spec.Content),
+		Content:    content,
 		Parameters: conn.spec.Parameteres.ToProto(),
 	}, nil
 }
 
+// getContent returns the function content to send to a node. Archive
+// artifacts are loaded from the artifact store while OCI artifacts
+// already contain the function
+func (h *nodeServer) getContent(spec sigma.FunctionSpec) ([]byte, error) {
+	if spec.Artifact == "" {
+		return []byte(spec.Content), nil
+	}
+
+	if h.artifacts == nil {
+		return nil, errors.New("artifact store not configured")
+	}
+
+	rc, desc, err := h.artifacts.Get(artifact.Digest(spec.Artifact))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	if desc.Kind != artifact.KindArchive {
+		return nil, nil
+	}
+
+	return ioutil.ReadAll(rc)
+}
+
 // Subscribe implements sigmaV1.NodeHandlerServer
 func (h *nodeServer) Subscribe(stream sigmaV1.NodeHandler_SubscribeServer) error {
-	urn, secret, err := getAuth(stream.Context())
-	if err != nil {
-		return err
+	if isMultiplexed(stream.Context()) {
+		conns, err := h.authenticateAll(stream.Context())
+		if err != nil {
+			return err
+		}
+
+		return h.subscribeMultiplexed(conns, stream)
 	}
 
-	conn, err := h.getConnection(urn, secret)
+	conn, err := h.authenticate(stream.Context())
 	if err != nil {
 		return err
 	}
 
+	return h.subscribe(conn, stream)
+}
+
+// eventStream is a bidirectional stream of dispatch events and execution
+// results between the node server and a node
+type eventStream interface {
+	Context() context.Context
+	Send(*sigmaV1.DispatchEvent) error
+	Recv() (*sigmaV1.ExecutionResult, error)
+}
+
+// errConnClosed is returned when a subscription ends because the node
+// connection has been closed
+var errConnClosed = errors.New("closed")
+
+// subscribe serves the event stream of the node of conn until the node
+// disconnects or the connection is closed. It is shared by all node
+// transports.
+//
+// Nodes that negotiated FeatureCredits only receive events within the
+// window of credits they granted, other nodes receive events as fast as
+// the stream accepts them.
+//
+// The sender is owned by an errgroup and stops as soon as the stream
+// fails, the stream context is cancelled or the connection is closed.
+// The receiver cannot be part of the group as stream.Recv only returns
+// once the stream has been torn down, which happens after subscribe
+// returned. It therefore never blocks on anything but Recv and exits as
+// soon as the transport closes the stream
+func (h *nodeServer) subscribe(conn *nodeConn, stream eventStream) error {
+	urn := conn.URN
+
 	if !conn.Registered() {
 		return errors.New("connection not registered")
 	}
 
-	if conn.Connected() {
+	if !conn.connect() {
 		return errors.New("connection already established")
 	}
+	defer conn.setConnected(false)
 
-	channel := &nodeChannel{
-		request:  make(chan *sigmaV1.DispatchEvent, 100),
-		response: make(chan *sigmaV1.ExecutionResult, 100),
-	}
+	channel := conn.channel
+
+	conn.credits.reset()
 
-	conn.setConnected(channel)
-	defer conn.setConnected(nil)
+	g, ctx := errgroup.WithContext(stream.Context())
 
-	ch := make(chan struct{})
+	recvErr := make(chan error, 1)
+	go receive(ctx, conn, stream, channel.response, recvErr)
+
+	g.Go(func() error {
+		select {
+		case err := <-recvErr:
+			glog.Error(urn, " connection failed ", err)
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	g.Go(func() error {
+		writer := newStreamWriter(stream, h.send)
+		defer writer.Close()
 
-	go func() {
 		for {
-			msg, err := stream.Recv()
-			if err != nil {
-				glog.Error(urn, " connection failed ", err)
-				close(ch)
-				return
+			select {
+			case req := <-channel.request:
+				if err := conn.acquireCredit(ctx, req); err != nil {
+					conn.fail(req, err)
+					return err
+				}
+
+				writer.policy.timeout = conn.sendTimeout(h.send.timeout)
+
+				slow, err := writer.Send(req)
+				conn.setSlow(slow)
+				if err != nil {
+					glog.Error(urn, " connection failed ", err)
+					conn.fail(req, err)
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-conn.closed:
+				return errConnClosed
 			}
+		}
+	})
 
-			if conn.isClosed() {
-				return
-			}
+	return g.Wait()
+}
 
-			channel.response <- msg
+// receive reads execution results from stream and forwards them to res
+// until Recv fails. The error is reported on errc which must be buffered
+func receive(ctx context.Context, conn *nodeConn, stream eventStream, res chan<- *sigmaV1.ExecutionResult, errc chan<- error) {
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			errc <- err
+			return
 		}
-	}()
 
-	for {
-		select {
-		case req, ok := <-channel.request:
-			if !ok {
-				return errors.New("request channel terminated")
-			}
+		if _, ok := isReadiness(msg); ok {
+			conn.setReadiness(msg)
+			continue
+		}
 
-			if err := stream.Send(req); err != nil {
-				glog.Error(urn, " connection failed ", err)
-				return err
-			}
-		case <-ch:
-			return errors.New("internal server error")
+		if _, n, ok := isCredit(msg); ok {
+			conn.credits.grant(n)
+			continue
+		}
+
+		select {
+		case res <- msg:
+		case <-ctx.Done():
+			// the subscription has been torn down, drop results until
+			// the transport closes the stream
 		case <-conn.closed:
-			return errors.New("closed")
 		}
 	}
 }
 
-func (h *nodeServer) Prepare(urn string, secret string, spec sigma.FunctionSpec) (Conn, error) {
-	node := newNodeConn(urn, secret, spec)
+func (h *nodeServer) Prepare(u string, secret string, spec sigma.FunctionSpec) (Conn, error) {
+	id, err := urn.ParseInstance(u)
+	if err != nil {
+		return nil, err
+	}
 
-	return node, h.addPendingConn(node)
-}
+	if spec.ID != "" && id.FunctionURN() != urn.ForFunction(spec.ID) {
+		return nil, fmt.Errorf("URN %s does not belong to function %s", u, spec.ID)
+	}
 
-func (h *nodeServer) Remove(urn string) error {
-	h.rw.Lock()
-	conn, ok := h.conns[urn]
-	if ok {
-		delete(h.conns, urn)
+	if spec.ParameterSchema != nil {
+		params, err := spec.ParameterSchema.Validate(spec.Parameteres, h.secrets)
+		if err != nil {
+			return nil, err
+		}
+
+		spec.Parameteres = params
+	}
+
+	node := newNodeConn(u, secret, spec)
+
+	if h.runtimes != nil {
+		rt, err := h.runtimes.Resolve(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		node.nodeType = rt.ExpectedNodeType()
+	}
+
+	var memory int64
+	if spec.Resources != nil {
+		memory = spec.Resources.MemoryMB
+	}
+
+	memory, err = h.quotas.AcquireNode(spec.ID, u, memory)
+	if err != nil {
+		return nil, err
 	}
-	h.rw.Unlock()
+	node.memoryMB = memory
 
+	if err := h.addPendingConn(node); err != nil {
+		h.quotas.ReleaseNode(u)
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func (h *nodeServer) Remove(urn string) error {
+	conn, ok := h.conns.remove(urn)
 	if !ok {
 		return errors.New("unknown connection")
 	}
 
+	h.quotas.ReleaseNode(urn)
+
+	if v := conn.protocolVersion(); v != 0 {
+		h.protocols.add(v, -1)
+	}
+
 	return conn.Close()
 }
 
-func (h *nodeServer) addPendingConn(conn *nodeConn) error {
-	h.rw.Lock()
-	defer h.rw.Unlock()
+func (h *nodeServer) Connections() map[string]Conn {
+	all := h.conns.all()
+
+	res := make(map[string]Conn, len(all))
+	for urn, c := range all {
+		res[urn] = c
+	}
 
-	if e, ok := h.conns[conn.URN]; ok {
+	return res
+}
+
+func (h *nodeServer) addPendingConn(conn *nodeConn) error {
+	if e, ok := h.conns.add(conn); !ok {
 		if e.secret == conn.secret {
 			return errors.New("URN collision with different secrets")
 		}
 		return errors.New("connection already added")
 	}
 
-	h.conns[conn.URN] = conn
 	return nil
 }
 
-func (h *nodeServer) getConnection(urn string, secret string) (*nodeConn, error) {
-	h.rw.RLock()
-	defer h.rw.RUnlock()
+// authenticate returns the connection of the calling node. Nodes connected
+// via unix domain sockets may authenticate using their peer credentials
+// instead of a secret
+func (h *nodeServer) authenticate(ctx context.Context) (*nodeConn, error) {
+	if cred, ok := peerFromContext(ctx); ok {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md["node-secret"]) == 0 {
+			urnList := md["node-urn"]
+			if len(urnList) != 1 {
+				return nil, errors.New("invalid URN header")
+			}
+
+			c, err := h.lookupConnection(urnList[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if err := c.checkPeer(ctx, cred); err != nil {
+				return nil, err
+			}
+
+			return c, nil
+		}
+	}
+
+	urn, secret, err := getAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.getConnection(urn, secret)
+}
 
-	c, ok := h.conns[urn]
+// Authenticate returns the function spec of the calling node and
+// implements NodeServer
+func (h *nodeServer) Authenticate(ctx context.Context) (sigma.FunctionSpec, error) {
+	c, err := h.authenticate(ctx)
+	if err != nil {
+		return sigma.FunctionSpec{}, err
+	}
+
+	return c.spec, nil
+}
+
+func (h *nodeServer) lookupConnection(urn string) (*nodeConn, error) {
+	c, ok := h.conns.get(urn)
 	if !ok {
 		return nil, errors.New("unknown URN")
 	}
 
+	return c, nil
+}
+
+func (h *nodeServer) getConnection(urn string, secret string) (*nodeConn, error) {
+	c, err := h.lookupConnection(urn)
+	if err != nil {
+		return nil, err
+	}
+
 	if c.secret != secret {
 		return nil, errors.New("invalid secret")
 	}
@@ -195,7 +467,10 @@ func getAuth(ctx context.Context) (string, string, error) {
 		return "", "", errors.New("invalid URN header")
 	}
 
-	urn := urnList[0]
+	u := urnList[0]
+	if _, err := urn.ParseInstance(u); err != nil {
+		return "", "", err
+	}
 
 	secretList, ok := md["node-secret"]
 	if len(secretList) != 1 || !ok {
@@ -204,5 +479,5 @@ func getAuth(ctx context.Context) (string, string, error) {
 
 	secret := secretList[0]
 
-	return urn, secret, nil
+	return u, secret, nil
 }
@@ -0,0 +1,326 @@
+package node
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStream emulates a gRPC subscribe stream. Like gRPC, Recv only
+// returns once the node disconnects or the stream context is cancelled
+type fakeStream struct {
+	ctx     context.Context
+	events  chan *sigmaV1.DispatchEvent
+	results chan *sigmaV1.ExecutionResult
+	failed  chan struct{}
+}
+
+func newFakeStream(ctx context.Context) *fakeStream {
+	return &fakeStream{
+		ctx:     ctx,
+		events:  make(chan *sigmaV1.DispatchEvent),
+		results: make(chan *sigmaV1.ExecutionResult),
+		failed:  make(chan struct{}),
+	}
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStream) Send(ev *sigmaV1.DispatchEvent) error {
+	select {
+	case s.events <- ev:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *fakeStream) Recv() (*sigmaV1.ExecutionResult, error) {
+	select {
+	case res := <-s.results:
+		return res, nil
+	case <-s.failed:
+		return nil, errors.New("disconnected")
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// echo answers all events with their payload until the stream context is
+// cancelled
+func (s *fakeStream) echo() {
+	for {
+		select {
+		case ev := <-s.events:
+			select {
+			case s.results <- &sigmaV1.ExecutionResult{
+				Id: ev.GetId(),
+				ExecutionResult: &sigmaV1.ExecutionResult_Result{
+					Result: ev.GetPayload(),
+				},
+			}:
+			case <-s.ctx.Done():
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func prepareTestConn(t *testing.T, h *nodeServer) *nodeConn {
+	c, err := h.Prepare("urn:sigma:default:test:1:node", "secret", sigma.FunctionSpec{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	conn := c.(*nodeConn)
+	conn.setRegistered(true)
+	return conn
+}
+
+func waitConnected(t *testing.T, conn *nodeConn, connected bool) {
+	for i := 0; i < 1000; i++ {
+		if conn.Connected() == connected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for connected=%v", connected)
+}
+
+// waitGoroutines waits until the number of goroutines dropped to at most n
+func waitGoroutines(n int) int {
+	var current int
+	for i := 0; i < 100; i++ {
+		current = runtime.NumGoroutine()
+		if current <= n {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return current
+}
+
+func TestSubscribe_ReconnectStorm(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	before := runtime.NumGoroutine()
+
+	router := NewRouter(conn)
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := newFakeStream(ctx)
+		go stream.echo()
+
+		done := make(chan error, 1)
+		go func() { done <- h.subscribe(conn, stream) }()
+
+		waitConnected(t, conn, true)
+
+		dispatchCtx, dispatchCancel := context.WithTimeout(context.Background(), time.Second)
+		res, err := router.Dispatch(dispatchCtx, &sigmaV1.DispatchEvent{Payload: []byte("ping")})
+		dispatchCancel()
+
+		if assert.NoError(err) {
+			assert.Equal([]byte("ping"), res.GetResult())
+		}
+
+		// the node disconnects, then the transport tears down the stream
+		close(stream.failed)
+		assert.Error(<-done)
+		cancel()
+
+		waitConnected(t, conn, false)
+	}
+
+	router.Close()
+
+	after := waitGoroutines(before)
+	assert.True(after <= before, "leaked goroutines: before=%d after=%d", before, after)
+}
+
+func TestSubscribe_ConnClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- h.subscribe(conn, stream) }()
+
+	waitConnected(t, conn, true)
+	assert.NoError(conn.Close())
+
+	select {
+	case err := <-done:
+		assert.Equal(errConnClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("subscribe did not return after the connection was closed")
+	}
+
+	// gRPC cancels the stream context once the handler returned
+	cancel()
+
+	after := waitGoroutines(before)
+	assert.True(after <= before, "leaked goroutines: before=%d after=%d", before, after)
+}
+
+func TestSubscribe_DropsResultsAfterTeardown(t *testing.T) {
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newFakeStream(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- h.subscribe(conn, stream) }()
+	waitConnected(t, conn, true)
+
+	// fill the response channel without a router consuming it
+	go func() {
+		for i := 0; i < 200; i++ {
+			select {
+			case stream.results <- &sigmaV1.ExecutionResult{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// gRPC cancels the stream context if the node goes away
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscribe blocked on a full response channel")
+	}
+}
+
+func TestSubscribe_Readiness(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	probe, err := newReadinessProbe(&sigma.ReadinessProbe{FailureThreshold: 2})
+	if !assert.NoError(err) {
+		return
+	}
+
+	created := time.Now()
+	assert.Equal(StateStarting, probe.state(conn, created))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+	go h.subscribe(conn, stream)
+	waitConnected(t, conn, true)
+
+	// a failed attempt below the threshold keeps the node starting
+	stream.results <- &sigmaV1.ExecutionResult{
+		Id:              ReadyID,
+		ExecutionResult: &sigmaV1.ExecutionResult_Error{Error: "init failed"},
+	}
+	stream.results <- &sigmaV1.ExecutionResult{
+		Id:              ReadyID,
+		ExecutionResult: &sigmaV1.ExecutionResult_Result{},
+	}
+
+	for i := 0; i < 1000; i++ {
+		if ready, _ := conn.readiness(); ready {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ready, failures := conn.readiness()
+	assert.True(ready)
+	assert.Equal(1, failures)
+	assert.Equal(State(""), probe.state(conn, created))
+
+	// readiness reports are never routed as results
+	select {
+	case <-conn.channel.response:
+		t.Fatal("readiness report forwarded as result")
+	default:
+	}
+
+	assert.Equal(StateUnhealthy, probe.state(newNodeConn("other", "", sigma.FunctionSpec{}), created.Add(-time.Minute)))
+}
+
+func TestLifecycleInit(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+	go stream.echo()
+	go h.subscribe(conn, stream)
+	waitConnected(t, conn, true)
+
+	hooks, err := newLifecycleHooks(&sigma.LifecycleHooks{Init: true, InitTimeout: "1s"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	ctrl := createController(conn.URN, nil, conn)
+	defer ctrl.router.Close()
+
+	ctrl.lifecycle = hooks
+	assert.NoError(ctrl.runInit(context.Background()))
+}
+
+func TestSubscribe_SendTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer(WithSendTimeout(20 * time.Millisecond)).(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the node never reads events
+	stream := newFakeStream(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- h.subscribe(conn, stream) }()
+	waitConnected(t, conn, true)
+
+	router := NewRouter(conn)
+	defer router.Close()
+
+	dispatchCtx, dispatchCancel := context.WithTimeout(context.Background(), time.Second)
+	defer dispatchCancel()
+
+	// the dispatcher sees the timeout instead of waiting for its context
+	_, err := router.Dispatch(dispatchCtx, &sigmaV1.DispatchEvent{Payload: []byte("ping")})
+	assert.Equal(ErrSendTimeout, err)
+	assert.Equal(ErrSendTimeout, <-done)
+}
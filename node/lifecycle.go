@@ -0,0 +1,107 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/glog"
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+)
+
+// Lifecycle event types. Lifecycle events are dispatched like regular
+// events and must be answered by the node
+const (
+	// EventInit is dispatched once after the node registered
+	EventInit = "sigma.init"
+
+	// EventShutdown is dispatched before the node is stopped
+	EventShutdown = "sigma.shutdown"
+)
+
+// DefaultLifecycleTimeout is the time a node has to answer a lifecycle
+// event if the spec does not configure a timeout
+const DefaultLifecycleTimeout = 10 * time.Second
+
+type lifecycleHooks struct {
+	init            bool
+	initTimeout     time.Duration
+	shutdown        bool
+	shutdownTimeout time.Duration
+}
+
+// newLifecycleHooks creates the lifecycle hooks from spec or returns nil
+// if no lifecycle events should be sent
+func newLifecycleHooks(spec *sigma.LifecycleHooks) (*lifecycleHooks, error) {
+	if spec == nil || (!spec.Init && !spec.Shutdown) {
+		return nil, nil
+	}
+
+	h := &lifecycleHooks{
+		init:            spec.Init,
+		initTimeout:     DefaultLifecycleTimeout,
+		shutdown:        spec.Shutdown,
+		shutdownTimeout: DefaultLifecycleTimeout,
+	}
+
+	if spec.InitTimeout != "" {
+		d, err := time.ParseDuration(spec.InitTimeout)
+		if err != nil {
+			return nil, err
+		}
+		h.initTimeout = d
+	}
+
+	if spec.ShutdownTimeout != "" {
+		d, err := time.ParseDuration(spec.ShutdownTimeout)
+		if err != nil {
+			return nil, err
+		}
+		h.shutdownTimeout = d
+	}
+
+	return h, nil
+}
+
+// lifecycleEvent dispatches a lifecycle event to the node and waits for
+// the result
+func (ctrl *controller) lifecycleEvent(ctx context.Context, typ string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res, err := ctrl.router.Dispatch(ctx, &sigmaV1.DispatchEvent{
+		Type: typ,
+	})
+	if err != nil {
+		return err
+	}
+
+	if v, ok := res.GetExecutionResult().(*sigmaV1.ExecutionResult_Error); ok {
+		return fmt.Errorf("%s: %s", typ, v.Error)
+	}
+
+	return nil
+}
+
+// runInit dispatches the init event if configured
+func (ctrl *controller) runInit(ctx context.Context) error {
+	if ctrl.lifecycle == nil || !ctrl.lifecycle.init || !ctrl.supports(FeatureLifecycle) {
+		return nil
+	}
+
+	return ctrl.lifecycleEvent(ctx, EventInit, ctrl.lifecycle.initTimeout)
+}
+
+// runShutdown dispatches the shutdown event if configured. Errors are
+// logged as the node is stopped anyway
+func (ctrl *controller) runShutdown() {
+	if ctrl.lifecycle == nil || !ctrl.lifecycle.shutdown || !ctrl.supports(FeatureLifecycle) || !ctrl.conn.Connected() {
+		return
+	}
+
+	if err := ctrl.lifecycleEvent(context.Background(), EventShutdown, ctrl.lifecycle.shutdownTimeout); err != nil {
+		glog.Warning(ctrl.urn, " shutdown hook failed: ", err)
+	}
+}
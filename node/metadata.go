@@ -0,0 +1,67 @@
+package node
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+)
+
+// Invocation metadata is transported as a URL encoded query appended to
+// the ID of a DispatchEvent:
+//
+//	<event-id>?source=timer&correlation-id=1234
+//
+// Nodes echo the event ID in the ExecutionResult so the metadata is
+// returned to the controller with every result
+
+type metadataKey struct{}
+
+// WithMetadata returns a new context carrying the invocation metadata md.
+// The metadata is attached to events dispatched using the context
+func WithMetadata(ctx context.Context, md sigma.Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext returns the invocation metadata attached to ctx
+func MetadataFromContext(ctx context.Context) sigma.Metadata {
+	md, _ := ctx.Value(metadataKey{}).(sigma.Metadata)
+	return md
+}
+
+// EncodeEventID returns the event ID carrying the given metadata
+func EncodeEventID(id string, md sigma.Metadata) string {
+	if len(md) == 0 {
+		return id
+	}
+
+	values := make(url.Values, len(md))
+	for k, v := range md {
+		values.Set(k, v)
+	}
+
+	return id + "?" + values.Encode()
+}
+
+// DecodeEventID splits an event ID into the plain ID and the metadata
+// it carries
+func DecodeEventID(id string) (string, sigma.Metadata) {
+	idx := strings.IndexByte(id, '?')
+	if idx < 0 {
+		return id, nil
+	}
+
+	values, err := url.ParseQuery(id[idx+1:])
+	if err != nil {
+		return id[:idx], nil
+	}
+
+	md := make(sigma.Metadata, len(values))
+	for k := range values {
+		md[k] = values.Get(k)
+	}
+
+	return id[:idx], md
+}
@@ -0,0 +1,40 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventIDMetadata(t *testing.T) {
+	id := EncodeEventID("1234", nil)
+	assert.Equal(t, "1234", id)
+
+	plain, md := DecodeEventID(id)
+	assert.Equal(t, "1234", plain)
+	assert.Nil(t, md)
+
+	id = EncodeEventID("1234", sigma.Metadata{
+		sigma.MetadataSource:        "timer",
+		sigma.MetadataCorrelationID: "a b&c",
+	})
+
+	plain, md = DecodeEventID(id)
+	assert.Equal(t, "1234", plain)
+	assert.Equal(t, sigma.Metadata{
+		sigma.MetadataSource:        "timer",
+		sigma.MetadataCorrelationID: "a b&c",
+	}, md)
+}
+
+func TestEventIDLineage(t *testing.T) {
+	md := sigma.Metadata(nil).Hop("a").Hop("b").Hop("c")
+
+	_, md = DecodeEventID(EncodeEventID("1234", md))
+	assert.Equal(t, 3, md.Hops())
+	assert.Equal(t, []string{"a", "b", "c"}, md.Lineage())
+
+	assert.Equal(t, []string{"b", "c", "b"}, md.Cycle("b"))
+	assert.Nil(t, md.Cycle("d"))
+}
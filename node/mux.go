@@ -0,0 +1,237 @@
+package node
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/golang/glog"
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/metadata"
+)
+
+// isMultiplexed returns true if the caller subscribes for more than one
+// node URN
+func isMultiplexed(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md["node-urn"]) > 1
+}
+
+// authenticateAll returns the connections for all node URNs of a
+// multiplexed subscription. The node-urn and node-secret headers must
+// hold the same number of values, the n-th secret authenticating the n-th
+// URN
+func (h *nodeServer) authenticateAll(ctx context.Context) ([]*nodeConn, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	urns := md["node-urn"]
+	secrets := md["node-secret"]
+
+	if len(urns) != len(secrets) {
+		return nil, errors.New("number of node-urn and node-secret headers does not match")
+	}
+
+	seen := make(map[string]bool, len(urns))
+	conns := make([]*nodeConn, len(urns))
+	for i := range urns {
+		if seen[urns[i]] {
+			return nil, errors.New("duplicate node-urn: " + urns[i])
+		}
+		seen[urns[i]] = true
+
+		c, err := h.getConnection(urns[i], secrets[i])
+		if err != nil {
+			return nil, err
+		}
+		conns[i] = c
+	}
+
+	return conns, nil
+}
+
+// subscribeMultiplexed serves the event streams of multiple nodes over a
+// single stream. Dispatch events carry the URN of the target node and
+// execution results are routed back using the event ID. The stream is
+// served until the node disconnects or all connections are closed
+func (h *nodeServer) subscribeMultiplexed(conns []*nodeConn, stream eventStream) error {
+	for _, c := range conns {
+		if !c.Registered() {
+			return errors.New("connection not registered: " + c.URN)
+		}
+	}
+
+	for i, c := range conns {
+		if !c.connect() {
+			for _, prev := range conns[:i] {
+				prev.setConnected(false)
+			}
+			return errors.New("connection already established: " + c.URN)
+		}
+	}
+	defer func() {
+		for _, c := range conns {
+			c.setConnected(false)
+		}
+	}()
+
+	type outbound struct {
+		event *sigmaV1.DispatchEvent
+		conn  *nodeConn
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = make(map[string]*nodeConn)
+		out     = make(chan outbound)
+		fwd     sync.WaitGroup
+	)
+
+	g, ctx := errgroup.WithContext(stream.Context())
+
+	for _, c := range conns {
+		channel := c.channel
+
+		c.credits.reset()
+
+		// forward requests of all connections to the shared sender
+		fwd.Add(1)
+		go func(c *nodeConn) {
+			defer fwd.Done()
+
+			for {
+				select {
+				case req := <-channel.request:
+					// a node without credits only blocks its own
+					// forwarder
+					if err := c.acquireCredit(ctx, req); err != nil {
+						c.fail(req, err)
+						return
+					}
+
+					select {
+					case out <- outbound{req, c}:
+					case <-ctx.Done():
+						c.fail(req, ctx.Err())
+						return
+					}
+				case <-c.closed:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(c)
+	}
+
+	// the subscription ends once all connections have been closed
+	allClosed := make(chan struct{})
+	go func() {
+		fwd.Wait()
+		close(allClosed)
+	}()
+
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+
+			if urn, ok := isReadiness(msg); ok {
+				for _, c := range conns {
+					if c.URN == urn {
+						c.setReadiness(msg)
+					}
+				}
+				continue
+			}
+
+			if urn, n, ok := isCredit(msg); ok {
+				for _, c := range conns {
+					if c.URN == urn {
+						c.credits.grant(n)
+					}
+				}
+				continue
+			}
+
+			mu.Lock()
+			c, ok := pending[msg.GetId()]
+			delete(pending, msg.GetId())
+			mu.Unlock()
+
+			if !ok {
+				continue
+			}
+
+			select {
+			case c.channel.response <- msg:
+			case <-c.closed:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	g.Go(func() error {
+		select {
+		case err := <-recvErr:
+			glog.Error("multiplexed connection failed ", err)
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	g.Go(func() error {
+		writer := newStreamWriter(stream, h.send)
+		defer writer.Close()
+
+		for {
+			select {
+			case o := <-out:
+				o.event.Urn = o.conn.URN
+
+				mu.Lock()
+				pending[o.event.GetId()] = o.conn
+				mu.Unlock()
+
+				writer.policy.timeout = o.conn.sendTimeout(h.send.timeout)
+
+				slow, err := writer.Send(o.event)
+				for _, c := range conns {
+					c.setSlow(slow)
+				}
+				if err != nil {
+					glog.Error(o.conn.URN, " connection failed ", err)
+					return err
+				}
+			case <-allClosed:
+				return errConnClosed
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	err := g.Wait()
+
+	// wait for the forwarders so no request is picked up after the
+	// connections have been disconnected
+	fwd.Wait()
+
+	// results of events sent but not answered will never arrive on this
+	// stream
+	mu.Lock()
+	unanswered := pending
+	pending = make(map[string]*nodeConn)
+	mu.Unlock()
+
+	for id, c := range unanswered {
+		c.fail(&sigmaV1.DispatchEvent{Id: id}, err)
+	}
+
+	return err
+}
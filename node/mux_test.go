@@ -0,0 +1,86 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticateAll(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	call := func(kv ...string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+	}
+
+	_, err := h.authenticateAll(call("node-urn", conn.URN, "node-secret", "secret", "node-urn", conn.URN))
+	assert.Error(err)
+
+	// each node may only be subscribed once per stream
+	_, err = h.authenticateAll(call("node-urn", conn.URN, "node-secret", "secret", "node-urn", conn.URN, "node-secret", "secret"))
+	assert.Error(err)
+}
+
+func TestSubscribeMultiplexed_Connected(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	first := prepareTestConn(t, h)
+
+	c, err := h.Prepare("urn:sigma:default:test:1:other", "secret", sigma.FunctionSpec{})
+	if !assert.NoError(err) {
+		return
+	}
+	second := c.(*nodeConn)
+	second.setRegistered(true)
+	second.setConnected(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.Error(h.subscribeMultiplexed([]*nodeConn{first, second}, newFakeStream(ctx)))
+	assert.False(first.Connected())
+	assert.True(second.Connected())
+}
+
+func TestSubscribeMultiplexed_FailPending(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	conn := prepareTestConn(t, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- h.subscribeMultiplexed([]*nodeConn{conn}, stream) }()
+	waitConnected(t, conn, true)
+
+	// the node receives the event but disconnects before answering
+	assert.NoError(conn.Send(&sigmaV1.DispatchEvent{Id: "event"}))
+	<-stream.events
+	close(stream.failed)
+
+	select {
+	case err := <-done:
+		assert.Error(err)
+	case <-time.After(time.Second):
+		t.Fatal("subscription did not end")
+	}
+
+	res, err := conn.Receive(context.Background())
+	assert.NoError(err)
+	assert.Equal("event", res.GetId())
+	assert.NotEmpty(res.GetError())
+}
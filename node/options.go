@@ -0,0 +1,137 @@
+package node
+
+import (
+	"time"
+
+	"github.com/homebot/sigma/artifact"
+	"github.com/homebot/sigma/parameters"
+	"github.com/homebot/sigma/quota"
+	"github.com/homebot/sigma/runtimes"
+	"github.com/homebot/sigma/signature"
+)
+
+// ServerOption configures a NodeServer
+type ServerOption func(h *nodeServer)
+
+// WithArtifactStore configures the artifact store used to serve function
+// bundles to nodes during registration
+func WithArtifactStore(s artifact.Store) ServerOption {
+	return func(h *nodeServer) {
+		h.artifacts = s
+	}
+}
+
+// WithQuotas configures the quota manager used to limit the number of
+// nodes and their memory per namespace
+func WithQuotas(m *quota.Manager) ServerOption {
+	return func(h *nodeServer) {
+		h.quotas = m
+	}
+}
+
+// WithGauge configures the function used to report the number of nodes
+// per protocol version and the number of nodes running a deprecated
+// protocol version, e.g. metrics.Gauge
+func WithGauge(fn func(name string, value float64)) ServerOption {
+	return func(h *nodeServer) {
+		h.protocols.gauge = fn
+	}
+}
+
+// DeployerOption configures a Deployer
+type DeployerOption func(d *deployer)
+
+// WithDeployerArtifactStore configures the artifact store used to resolve
+// function artifacts before launching new nodes
+func WithDeployerArtifactStore(s artifact.Store) DeployerOption {
+	return func(d *deployer) {
+		d.artifacts = s
+	}
+}
+
+// WithRuntimeRegistry configures the runtime registry used to verify the
+// node type reported by nodes during registration
+func WithRuntimeRegistry(r *runtimes.Registry) ServerOption {
+	return func(h *nodeServer) {
+		h.runtimes = r
+	}
+}
+
+// WithDeployerRuntimeRegistry configures the runtime registry used to
+// validate function specs and select the launcher type for new nodes
+func WithDeployerRuntimeRegistry(r *runtimes.Registry) DeployerOption {
+	return func(d *deployer) {
+		d.runtimes = r
+	}
+}
+
+// WithSignatureVerifier configures the verifier used to check function
+// signatures before new nodes are prepared. Unsigned functions are rejected
+func WithSignatureVerifier(v *signature.Verifier) DeployerOption {
+	return func(d *deployer) {
+		d.verifier = v
+	}
+}
+
+// WithWebSocketAddress configures the URL advertised to nodes using the
+// WebSocket transport, e.g. "http://controller:8090/nodes". Nodes
+// register at "<addr>/register" and subscribe at "<addr>/subscribe"
+func WithWebSocketAddress(addr string) DeployerOption {
+	return func(d *deployer) {
+		d.webSocketAddress = addr
+	}
+}
+
+// WithStateAddress configures the address of the state service advertised
+// to nodes
+func WithStateAddress(addr string) DeployerOption {
+	return func(d *deployer) {
+		d.stateAddress = addr
+	}
+}
+
+// WithProxyAddress configures the address ("host:port") of the egress
+// proxy nodes route outbound HTTP calls through
+func WithProxyAddress(addr string) DeployerOption {
+	return func(d *deployer) {
+		d.proxyAddress = addr
+	}
+}
+
+// WithDebugPort enables debug sessions for new nodes. Nodes open their
+// debugger on port once a debug session is attached
+func WithDebugPort(port int) DeployerOption {
+	return func(d *deployer) {
+		d.debugPort = port
+	}
+}
+
+// WithSendTimeout configures the maximum time writing a dispatch event to
+// a node may block before the node connection is closed. A zero or
+// negative duration selects DefaultSendTimeout
+func WithSendTimeout(d time.Duration) ServerOption {
+	return func(h *nodeServer) {
+		if d <= 0 {
+			d = DefaultSendTimeout
+		}
+		h.send.timeout = d
+	}
+}
+
+// WithSlowConsumerDetection flags nodes as slow consumers after limit
+// consecutive sends took longer than threshold. Slow nodes are reported
+// as disabled so the scheduler routes around them until they catch up.
+// A limit of zero disables slow consumer detection
+func WithSlowConsumerDetection(threshold time.Duration, limit int) ServerOption {
+	return func(h *nodeServer) {
+		h.send.slowAfter = threshold
+		h.send.slowLimit = limit
+	}
+}
+
+// WithSecretResolver configures the resolver for secret-ref parameters
+func WithSecretResolver(r parameters.SecretResolver) ServerOption {
+	return func(h *nodeServer) {
+		h.secrets = r
+	}
+}
@@ -0,0 +1,147 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerCredentials holds the credentials of a node process connected via
+// a unix domain socket
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// AuthType implements credentials.AuthInfo
+func (p PeerCredentials) AuthType() string {
+	return "peercred"
+}
+
+// peerCredentials implements credentials.TransportCredentials for unix
+// domain socket listeners. It does not alter the connection but reads the
+// peer credentials of the connecting process
+type peerCredentials struct{}
+
+// UnixSocketCredentials returns gRPC transport credentials that expose the
+// peer credentials of processes connecting via unix domain sockets. Nodes
+// authenticated using peer credentials do not need to present a secret
+func UnixSocketCredentials() credentials.TransportCredentials {
+	return peerCredentials{}
+}
+
+func (peerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, nil, nil
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil, errors.New("peer credentials require a unix domain socket")
+	}
+
+	cred, err := getPeerCredentials(uc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conn, cred, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "peercred",
+	}
+}
+
+func (p peerCredentials) Clone() credentials.TransportCredentials {
+	return p
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// peerFromContext returns the peer credentials of the calling node, if any
+func peerFromContext(ctx context.Context) (PeerCredentials, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return PeerCredentials{}, false
+	}
+
+	cred, ok := p.AuthInfo.(PeerCredentials)
+	return cred, ok
+}
+
+// checkPeer checks if the process identified by cred has been launched
+// for the connection. Child processes of the launched process are
+// accepted as well. Nodes may connect before the PID of the launched
+// process is known so checkPeer waits for allowPeer
+func (n *nodeConn) checkPeer(ctx context.Context, cred PeerCredentials) error {
+	n.rw.Lock()
+	ready := n.peerReady
+	n.rw.Unlock()
+
+	if ready == nil {
+		return errors.New("peer credentials not accepted for node")
+	}
+
+	select {
+	case <-ready:
+	case <-n.closed:
+		return errConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	n.rw.Lock()
+	pid := n.peerPID
+	n.rw.Unlock()
+
+	if pid == 0 {
+		return errors.New("peer credentials not accepted for node")
+	}
+
+	if !isProcessDescendant(int(cred.PID), pid) {
+		return fmt.Errorf("unexpected peer process %d", cred.PID)
+	}
+
+	return nil
+}
+
+// expectPeer prepares the connection for peer authentication. It must be
+// called before the node is launched, peer credentials are checked once
+// allowPeer has been called
+func (n *nodeConn) expectPeer() {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	if n.peerReady == nil {
+		n.peerReady = make(chan struct{})
+	}
+}
+
+// allowPeer allows the process with the given PID (and its children) to
+// authenticate using peer credentials. A PID of zero rejects peer
+// authentication
+func (n *nodeConn) allowPeer(pid int) {
+	n.rw.Lock()
+	defer n.rw.Unlock()
+
+	n.peerPID = pid
+
+	if n.peerReady == nil {
+		n.peerReady = make(chan struct{})
+	}
+
+	select {
+	case <-n.peerReady:
+	default:
+		close(n.peerReady)
+	}
+}
@@ -0,0 +1,81 @@
+//go:build linux
+// +build linux
+
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func getPeerCredentials(conn *net.UnixConn) (PeerCredentials, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+
+	var (
+		cred    *syscall.Ucred
+		sockErr error
+	)
+
+	err = raw.Control(func(fd uintptr) {
+		cred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+	if sockErr != nil {
+		return PeerCredentials{}, fmt.Errorf("SO_PEERCRED: %s", sockErr)
+	}
+
+	return PeerCredentials{
+		PID: cred.Pid,
+		UID: cred.Uid,
+		GID: cred.Gid,
+	}, nil
+}
+
+// isProcessDescendant returns true if pid equals ancestor or is one of its
+// descendants. The process tree is walked using /proc
+func isProcessDescendant(pid, ancestor int) bool {
+	for pid > 1 {
+		if pid == ancestor {
+			return true
+		}
+
+		ppid, err := parentPID(pid)
+		if err != nil {
+			return false
+		}
+		pid = ppid
+	}
+
+	return false
+}
+
+func parentPID(pid int) (int, error) {
+	blob, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// the command name may contain spaces so skip until the closing
+	// parenthesis. The fields following are "state ppid ..."
+	stat := string(blob)
+	idx := strings.LastIndex(stat, ")")
+	if idx < 0 {
+		return 0, fmt.Errorf("invalid stat for process %d", pid)
+	}
+
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid stat for process %d", pid)
+	}
+
+	return strconv.Atoi(fields[1])
+}
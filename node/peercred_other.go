@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package node
+
+import (
+	"errors"
+	"net"
+)
+
+func getPeerCredentials(conn *net.UnixConn) (PeerCredentials, error) {
+	return PeerCredentials{}, errors.New("peer credentials are only supported on linux")
+}
+
+func isProcessDescendant(pid, ancestor int) bool {
+	return pid == ancestor
+}
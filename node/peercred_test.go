@@ -0,0 +1,45 @@
+package node
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPeer(t *testing.T) {
+	assert := assert.New(t)
+
+	cred := PeerCredentials{PID: int32(os.Getpid())}
+
+	// peer credentials are rejected unless expected
+	conn := newNodeConn("urn", "secret", sigma.FunctionSpec{})
+	assert.Error(conn.checkPeer(context.Background(), cred))
+
+	// nodes connecting before their PID is known wait for it
+	conn.expectPeer()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conn.allowPeer(os.Getpid())
+	}()
+	assert.NoError(conn.checkPeer(context.Background(), cred))
+
+	assert.Error(conn.checkPeer(context.Background(), PeerCredentials{PID: 1}))
+
+	// instances without a process do not accept peer credentials
+	conn = newNodeConn("urn", "secret", sigma.FunctionSpec{})
+	conn.expectPeer()
+	conn.allowPeer(0)
+	assert.Error(conn.checkPeer(context.Background(), cred))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	conn = newNodeConn("urn", "secret", sigma.FunctionSpec{})
+	conn.expectPeer()
+	assert.Equal(context.DeadlineExceeded, conn.checkPeer(ctx, cred))
+}
@@ -0,0 +1,182 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Protocol versions of the node handler. Nodes advertise the version they
+// implement in the node-protocol header of the registration request.
+// Nodes that do not send the header are assumed to implement ProtocolV1
+const (
+	// ProtocolV1 is the protocol of nodes that predate version
+	// negotiation. All features are enabled for them
+	ProtocolV1 = 1
+
+	// ProtocolV2 adds version and feature negotiation. Nodes may
+	// request a subset of features using the node-features header
+	ProtocolV2 = 2
+
+	// ProtocolV3 adds credit based flow control
+	ProtocolV3 = 3
+
+	// ProtocolVersion is the latest protocol version supported
+	ProtocolVersion = ProtocolV3
+
+	// MinProtocolVersion is the oldest protocol version supported. Nodes
+	// implementing older versions are rejected
+	MinProtocolVersion = ProtocolV1
+
+	// DeprecatedProtocolVersion is the latest deprecated protocol
+	// version. Nodes implementing it still work but should be upgraded
+	DeprecatedProtocolVersion = ProtocolV1
+)
+
+// Headers used to negotiate the protocol during registration. The server
+// answers with the negotiated version and features using the same
+// headers
+const (
+	ProtocolHeader = "node-protocol"
+	FeaturesHeader = "node-features"
+)
+
+// Feature is an optional part of the node protocol
+type Feature string
+
+// Features of the node protocol
+const (
+	// FeatureLifecycle enables the init and shutdown lifecycle events
+	FeatureLifecycle = Feature("lifecycle")
+
+	// FeatureReadiness enables readiness reports
+	FeatureReadiness = Feature("readiness")
+
+	// FeatureDebug enables the debugger attach and detach events
+	FeatureDebug = Feature("debug")
+
+	// FeatureCredits enables credit based flow control. Events are only
+	// sent to the node within the window of credits it granted
+	FeatureCredits = Feature("credits")
+)
+
+// protocolFeatures holds the features available in each protocol version
+var protocolFeatures = map[int][]Feature{
+	ProtocolV1: {FeatureLifecycle, FeatureReadiness, FeatureDebug},
+	ProtocolV2: {FeatureLifecycle, FeatureReadiness, FeatureDebug},
+	ProtocolV3: {FeatureLifecycle, FeatureReadiness, FeatureDebug, FeatureCredits},
+}
+
+// protocol is the protocol negotiated with a node. The zero value is used
+// for nodes that did not register yet and supports all features
+type protocol struct {
+	version  int
+	features map[Feature]bool
+}
+
+// negotiate returns the protocol used with a node that advertised version
+// and requested features. An empty version means ProtocolV1 and nil
+// features request all features of the version. Versions newer than
+// ProtocolVersion are downgraded
+func negotiate(version string, features []string) (protocol, error) {
+	v := ProtocolV1
+	if version != "" {
+		var err error
+		v, err = strconv.Atoi(version)
+		if err != nil {
+			return protocol{}, fmt.Errorf("invalid protocol version %q", version)
+		}
+	}
+
+	if v < MinProtocolVersion {
+		return protocol{}, fmt.Errorf("protocol version %d not supported, minimum is %d", v, MinProtocolVersion)
+	}
+
+	if v > ProtocolVersion {
+		v = ProtocolVersion
+	}
+
+	requested := make(map[Feature]bool)
+	for _, value := range features {
+		for _, f := range strings.Split(value, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				requested[Feature(f)] = true
+			}
+		}
+	}
+
+	p := protocol{
+		version:  v,
+		features: make(map[Feature]bool),
+	}
+
+	for _, f := range protocolFeatures[v] {
+		if features == nil || requested[f] {
+			p.features[f] = true
+		}
+	}
+
+	return p, nil
+}
+
+// supports returns true if f has been negotiated
+func (p protocol) supports(f Feature) bool {
+	if p.version == 0 {
+		return true
+	}
+
+	return p.features[f]
+}
+
+// headers returns the negotiated version and features as header values
+func (p protocol) headers() (string, string) {
+	var features []string
+	for f := range p.features {
+		features = append(features, string(f))
+	}
+	sort.Strings(features)
+
+	return strconv.Itoa(p.version), strings.Join(features, ",")
+}
+
+// supports returns true if the node negotiated f. Nodes not connected
+// through the node server support all features
+func (ctrl *controller) supports(f Feature) bool {
+	if nc, ok := ctrl.conn.(*nodeConn); ok {
+		return nc.supports(f)
+	}
+
+	return true
+}
+
+// protocolStats counts registered nodes per protocol version and reports
+// them as gauges
+type protocolStats struct {
+	mu     sync.Mutex
+	counts map[int]int
+	gauge  func(name string, value float64)
+}
+
+func (s *protocolStats) add(version, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts == nil {
+		s.counts = make(map[int]int)
+	}
+	s.counts[version] += delta
+
+	deprecated := 0
+	for v, n := range s.counts {
+		if v <= DeprecatedProtocolVersion {
+			deprecated += n
+		}
+	}
+
+	if s.gauge != nil {
+		s.gauge(fmt.Sprintf("nodes.protocol.v%d", version), float64(s.counts[version]))
+		s.gauge("nodes.protocol.deprecated", float64(deprecated))
+	}
+}
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"testing"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	// nodes without version support all features of the legacy protocol
+	p, err := negotiate("", nil)
+	assert.NoError(err)
+	assert.Equal(ProtocolV1, p.version)
+	assert.True(p.supports(FeatureLifecycle))
+	assert.True(p.supports(FeatureDebug))
+
+	p, err = negotiate("2", []string{"readiness, lifecycle", "unknown"})
+	assert.NoError(err)
+	assert.Equal(ProtocolV2, p.version)
+	assert.True(p.supports(FeatureReadiness))
+	assert.False(p.supports(FeatureDebug))
+
+	version, features := p.headers()
+	assert.Equal("2", version)
+	assert.Equal("lifecycle,readiness", features)
+
+	// newer nodes are downgraded to the latest supported version
+	p, err = negotiate("99", nil)
+	assert.NoError(err)
+	assert.Equal(ProtocolVersion, p.version)
+
+	_, err = negotiate("0", nil)
+	assert.Error(err)
+
+	_, err = negotiate("v2", nil)
+	assert.Error(err)
+
+	// nodes that did not register support everything
+	assert.True(protocol{}.supports(FeatureDebug))
+}
+
+func TestRegister_Protocol(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	c, err := h.Prepare("urn:sigma:default:test:1:node", "secret", sigma.FunctionSpec{})
+	if !assert.NoError(err) {
+		return
+	}
+	conn := c.(*nodeConn)
+
+	p, _ := negotiate("2", []string{"readiness"})
+	_, err = h.register(conn, &sigmaV1.NodeRegistrationRequest{NodeType: "test"}, p)
+	assert.NoError(err)
+	assert.True(conn.supports(FeatureReadiness))
+	assert.False(conn.supports(FeatureLifecycle))
+	assert.Equal(1, h.protocols.counts[ProtocolV2])
+
+	assert.NoError(h.Remove(conn.URN))
+	assert.Equal(0, h.protocols.counts[ProtocolV2])
+}
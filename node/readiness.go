@@ -0,0 +1,99 @@
+package node
+
+import (
+	"strings"
+	"time"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+)
+
+// ReadyID is the ID of the execution result a node sends once its user
+// init code has completed. An error result reports a failed attempt and
+// counts against the failure threshold. Nodes sharing a multiplexed
+// stream must append "/<node-urn>" to the ID
+const ReadyID = "sigma.ready"
+
+const (
+	// DefaultReadinessTimeout is the time a node has to report readiness
+	// if the probe does not configure a timeout
+	DefaultReadinessTimeout = 30 * time.Second
+
+	// DefaultReadinessFailureThreshold is the number of failed readiness
+	// reports after which a node is considered unhealthy
+	DefaultReadinessFailureThreshold = 1
+)
+
+// isReadiness returns true if msg is a readiness report. For multiplexed
+// streams the URN of the reporting node is returned as well
+func isReadiness(msg *sigmaV1.ExecutionResult) (urn string, ok bool) {
+	id := msg.GetId()
+	if id == ReadyID {
+		return "", true
+	}
+
+	if strings.HasPrefix(id, ReadyID+"/") {
+		return strings.TrimPrefix(id, ReadyID+"/"), true
+	}
+
+	return "", false
+}
+
+// readinessProbe keeps a node out of the dispatch pool until it reported
+// readiness
+type readinessProbe struct {
+	timeout   time.Duration
+	threshold int
+}
+
+// newReadinessProbe creates a readiness probe from the spec or returns
+// nil if the function does not require a readiness handshake
+func newReadinessProbe(spec *sigma.ReadinessProbe) (*readinessProbe, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	p := &readinessProbe{
+		timeout:   DefaultReadinessTimeout,
+		threshold: DefaultReadinessFailureThreshold,
+	}
+
+	if spec.Timeout != "" {
+		d, err := time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		p.timeout = d
+	}
+
+	if spec.FailureThreshold > 0 {
+		p.threshold = spec.FailureThreshold
+	}
+
+	return p, nil
+}
+
+// readyConn is implemented by connections that track readiness reports
+type readyConn interface {
+	readiness() (ready bool, failures int)
+}
+
+// state returns the state of a node created at the given time or an empty
+// state if the node is ready
+func (p *readinessProbe) state(conn Conn, created time.Time) State {
+	rc, ok := conn.(readyConn)
+	if !ok {
+		return ""
+	}
+
+	ready, failures := rc.readiness()
+	if ready {
+		return ""
+	}
+
+	if failures >= p.threshold || time.Since(created) > p.timeout {
+		return StateUnhealthy
+	}
+
+	return StateStarting
+}
@@ -0,0 +1,179 @@
+package node
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/homebot/sigma/launcher"
+	"golang.org/x/net/context"
+)
+
+// DefaultReconcileInterval is the default interval between two
+// reconciliation passes
+const DefaultReconcileInterval = time.Minute
+
+// ErrListNotSupported is returned if the launcher cannot enumerate its
+// instances
+var ErrListNotSupported = errors.New("launcher cannot list instances")
+
+// ReconcileResult holds the URNs of the nodes handled during a
+// reconciliation pass
+type ReconcileResult struct {
+	// Stopped holds the URNs of orphaned instances that have been
+	// stopped
+	Stopped []string
+
+	// Removed holds the URNs of orphaned connections that have been
+	// removed
+	Removed []string
+
+	// Adopted holds the URNs of nodes whose instance is no longer
+	// reported by the launcher but which are still connected and have
+	// been kept
+	Adopted []string
+}
+
+// Empty returns true if the pass did not handle any node
+func (r ReconcileResult) Empty() bool {
+	return len(r.Stopped) == 0 && len(r.Removed) == 0 && len(r.Adopted) == 0
+}
+
+// Reconciler garbage collects instances and connections that are left
+// over by crashed launchers or controllers
+type Reconciler interface {
+	// Reconcile compares the instances reported by the launcher with
+	// the connection table and deployed nodes and cleans up orphans
+	Reconcile(context.Context) (ReconcileResult, error)
+}
+
+// RunReconciler calls r.Reconcile every interval until ctx is cancelled
+// or the launcher turns out not to support listing instances
+func RunReconciler(ctx context.Context, r Reconciler, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		res, err := r.Reconcile(ctx)
+		if err == ErrListNotSupported {
+			glog.Warning("reconciliation disabled: ", err)
+			return
+		}
+
+		if err != nil {
+			glog.Error("reconciliation failed: ", err)
+			continue
+		}
+
+		if !res.Empty() {
+			glog.Infof("reconciliation: stopped %v, removed %v, adopted %v", res.Stopped, res.Removed, res.Adopted)
+		}
+	}
+}
+
+// Reconcile implements Reconciler. Orphans are only cleaned up if they
+// have been found by two consecutive passes so nodes that are being
+// deployed or destroyed are not interrupted
+func (d *deployer) Reconcile(ctx context.Context) (ReconcileResult, error) {
+	var res ReconcileResult
+
+	lister, ok := d.launcher.(launcher.Lister)
+	if !ok {
+		return res, ErrListNotSupported
+	}
+
+	instances, err := lister.Instances(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	conns := d.service.Connections()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	urns := make(map[string]struct{})
+	for urn := range instances {
+		urns[urn] = struct{}{}
+	}
+	for urn := range conns {
+		urns[urn] = struct{}{}
+	}
+	for urn := range d.nodes {
+		urns[urn] = struct{}{}
+	}
+
+	suspects := make(map[string]struct{})
+
+	for urn := range urns {
+		if _, ok := d.pending[urn]; ok {
+			continue
+		}
+
+		instance, hasInstance := instances[urn]
+		conn, hasConn := conns[urn]
+		_, tracked := d.nodes[urn]
+
+		// nothing to do for healthy nodes. Nodes whose instance and
+		// connection are both gone are unhealthy and replaced by
+		// their function controller
+		if hasInstance == hasConn && (tracked || !hasInstance) {
+			delete(d.adopted, urn)
+			continue
+		}
+
+		// the launcher lost track of the instance but the node is
+		// still connected so keep it
+		if tracked && !hasInstance && conn.Connected() {
+			if _, ok := d.adopted[urn]; !ok {
+				d.adopted[urn] = struct{}{}
+				res.Adopted = append(res.Adopted, urn)
+			}
+			continue
+		}
+
+		if _, ok := d.suspects[urn]; !ok {
+			suspects[urn] = struct{}{}
+			continue
+		}
+
+		if hasInstance {
+			if err := instance.Stop(); err != nil {
+				glog.Error(urn, " failed to stop orphaned instance: ", err)
+			} else {
+				res.Stopped = append(res.Stopped, urn)
+			}
+		}
+
+		if hasConn {
+			if err := d.service.Remove(urn); err != nil {
+				glog.Error(urn, " failed to remove orphaned connection: ", err)
+			} else {
+				res.Removed = append(res.Removed, urn)
+			}
+		}
+	}
+
+	d.suspects = suspects
+
+	return res, nil
+}
+
+// untrack removes a destroyed node from the deployer
+func (d *deployer) untrack(urn string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.nodes, urn)
+	delete(d.adopted, urn)
+}
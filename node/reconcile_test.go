@@ -0,0 +1,67 @@
+package node
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/launcher"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeInstance struct {
+	stopped bool
+}
+
+func (i *fakeInstance) Healthy() error { return nil }
+
+func (i *fakeInstance) Stop() error {
+	i.stopped = true
+	return nil
+}
+
+type fakeLister map[string]launcher.Instance
+
+func (l fakeLister) Create(context.Context, string, launcher.Config) (launcher.Instance, error) {
+	return nil, nil
+}
+
+func (l fakeLister) Instances(context.Context) (map[string]launcher.Instance, error) {
+	return l, nil
+}
+
+func TestReconcile(t *testing.T) {
+	assert := assert.New(t)
+
+	orphan := &fakeInstance{}
+	deploying := &fakeInstance{}
+
+	h := NewNodeServer()
+	d := NewDeployer(h, fakeLister{
+		"orphan-instance": orphan,
+		"deploying":       deploying,
+	}, "").(*deployer)
+
+	d.pending["deploying"] = struct{}{}
+
+	_, err := h.Prepare("urn:sigma:default:test:1:orphan-conn", "secret", sigma.FunctionSpec{})
+	assert.NoError(err)
+
+	// orphans are only cleaned up once they have been seen twice
+	res, err := d.Reconcile(context.Background())
+	assert.NoError(err)
+	assert.True(res.Empty())
+	assert.False(orphan.stopped)
+
+	res, err = d.Reconcile(context.Background())
+	assert.NoError(err)
+	assert.Equal([]string{"orphan-instance"}, res.Stopped)
+	assert.Equal([]string{"urn:sigma:default:test:1:orphan-conn"}, res.Removed)
+	assert.True(orphan.stopped)
+	assert.False(deploying.stopped)
+	assert.Empty(h.Connections())
+
+	_, err = NewDeployer(h, launcher.CreateFunc(nil), "").(Reconciler).Reconcile(context.Background())
+	assert.Equal(ErrListNotSupported, err)
+}
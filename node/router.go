@@ -3,6 +3,7 @@ package node
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/satori/go.uuid"
 
@@ -27,10 +28,27 @@ type Router interface {
 	Registered() bool
 }
 
+// receiveRetryInterval is the time to wait before receiving again after
+// Receive failed
+const receiveRetryInterval = 10 * time.Millisecond
+
+// failureSource is implemented by connections that fail events locally,
+// e.g. if sending them timed out
+type failureSource interface {
+	failure(id string) error
+}
+
+// routed is the result of a dispatched event. err is set if the
+// connection failed the event before it reached the node
+type routed struct {
+	res *sigmaV1.ExecutionResult
+	err error
+}
+
 type router struct {
 	wg     sync.WaitGroup
 	mu     sync.Mutex
-	routes map[string]chan *sigmaV1.ExecutionResult
+	routes map[string]chan routed
 	close  chan struct{}
 
 	conn Conn
@@ -39,7 +57,7 @@ type router struct {
 // NewRouter returns a new router for the node connection
 func NewRouter(conn Conn) Router {
 	router := &router{
-		routes: make(map[string]chan *sigmaV1.ExecutionResult),
+		routes: make(map[string]chan routed),
 		close:  make(chan struct{}),
 		conn:   conn,
 	}
@@ -59,21 +77,24 @@ func (r *router) Connected() bool { return r.conn.Connected() }
 
 // Dispatch dispatches an event and returns the result
 func (r *router) Dispatch(ctx context.Context, in *sigmaV1.DispatchEvent) (*sigmaV1.ExecutionResult, error) {
-	res := make(chan *sigmaV1.ExecutionResult, 1)
+	res := make(chan routed, 1)
 
-	id := uuid.NewV4().String()
+	id := EncodeEventID(uuid.NewV4().String(), MetadataFromContext(ctx))
 
 	in.Id = id
 	r.addRoute(id, res)
 	defer r.deleteRoute(id)
 
-	if err := r.conn.Send(in); err != nil {
+	if err := r.send(ctx, in); err != nil {
 		return nil, err
 	}
 
 	select {
 	case response := <-res:
-		return response, nil
+		if response.err != nil {
+			return nil, response.err
+		}
+		return response.res, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-r.close:
@@ -81,6 +102,22 @@ func (r *router) Dispatch(ctx context.Context, in *sigmaV1.DispatchEvent) (*sigm
 	}
 }
 
+// contextSender is implemented by connections that can abort sending
+// once a context is cancelled
+type contextSender interface {
+	SendContext(context.Context, *sigmaV1.DispatchEvent) error
+}
+
+// send sends in to the node. Waiting for the node to accept the event is
+// bounded by ctx if the connection supports it
+func (r *router) send(ctx context.Context, in *sigmaV1.DispatchEvent) error {
+	if cs, ok := r.conn.(contextSender); ok {
+		return cs.SendContext(ctx, in)
+	}
+
+	return r.conn.Send(in)
+}
+
 // Close closes the router, abort pending calls and closes the connection
 // to the node
 func (r *router) Close() error {
@@ -103,14 +140,14 @@ func (r *router) deleteRoute(id string) {
 	delete(r.routes, id)
 }
 
-func (r *router) addRoute(id string, ch chan *sigmaV1.ExecutionResult) {
+func (r *router) addRoute(id string, ch chan routed) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.routes[id] = ch
 }
 
-func (r *router) getRoute(id string) (chan *sigmaV1.ExecutionResult, bool) {
+func (r *router) getRoute(id string) (chan routed, bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -135,17 +172,24 @@ func (r *router) receive() {
 	for {
 		msg, err := r.conn.Receive(ctx)
 		if err != nil {
+			// Receive fails immediately while the node is disconnected
+			// so back off instead of spinning until it reconnects
 			select {
 			case <-ctx.Done():
 				return
-			default:
+			case <-time.After(receiveRetryInterval):
 				continue
 			}
 		}
 
+		var failed error
+		if fs, ok := r.conn.(failureSource); ok {
+			failed = fs.failure(msg.GetId())
+		}
+
 		route, ok := r.getRoute(msg.GetId())
 		if ok {
-			route <- msg
+			route <- routed{msg, failed}
 		}
 	}
 }
@@ -61,13 +61,13 @@ func TestRouter_Routing(t *testing.T) {
 		return
 	}
 
-	res := make(chan *sigmaV1.ExecutionResult, 1)
+	res := make(chan routed, 1)
 	router.addRoute("foobar", res)
 
 	conn.send <- struct{}{}
 	conn.send <- struct{}{}
 	r := <-res
-	assert.Equal("foobar", r.Id)
+	assert.Equal("foobar", r.res.Id)
 
 	assert.NoError(router.Close())
 	assert.Error(router.Close())
@@ -112,13 +112,16 @@ func TestRouter_Dispatch(t *testing.T) {
 
 	<-time.After(time.Millisecond)
 
+	router.mu.Lock()
 	if !assert.NotEmpty(router.routes) {
+		router.mu.Unlock()
 		return
 	}
 
 	for key := range router.routes {
 		res.Id = key
 	}
+	router.mu.Unlock()
 
 	conn.send <- struct{}{}
 
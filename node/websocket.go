@@ -0,0 +1,151 @@
+package node
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma/bufpool"
+	sigmaURN "github.com/homebot/sigma/urn"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+)
+
+// ServeHTTP serves the WebSocket node transport for runtimes that cannot
+// speak gRPC. It provides the same semantics as the gRPC node handler:
+//
+//	POST .../register   registers the node. The request and response
+//	                    bodies hold the JSON encoded NodeRegistrationRequest
+//	                    and NodeRegistrationResponse
+//	GET  .../subscribe  upgrades to a WebSocket connection. Each text frame
+//	                    holds a JSON encoded DispatchEvent (controller to
+//	                    node) or ExecutionResult (node to controller)
+//
+// Nodes authenticate using the node-urn and node-secret headers or, for
+// clients that cannot set headers, the urn and secret query parameters
+func (h *nodeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urn, secret, err := getHTTPAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := h.getConnection(urn, secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/register"):
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req sigmaV1.NodeRegistrationRequest
+		if err := jsonpb.Unmarshal(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		p, err := negotiate(r.Header.Get(ProtocolHeader), r.Header[http.CanonicalHeaderKey(FeaturesHeader)])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.register(conn, &req, p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		version, features := p.headers()
+		w.Header().Set(ProtocolHeader, version)
+		w.Header().Set(FeaturesHeader, features)
+		w.Header().Set("Content-Type", "application/json")
+		if err := (&jsonpb.Marshaler{}).Marshal(w, res); err != nil {
+			glog.Error(urn, " failed to send registration response ", err)
+		}
+
+	case strings.HasSuffix(r.URL.Path, "/subscribe"):
+		websocket.Server{
+			Handler: func(ws *websocket.Conn) {
+				defer ws.Close()
+
+				if err := h.subscribe(conn, &wsStream{ws: ws}); err != nil {
+					glog.Error(urn, " websocket subscription terminated ", err)
+				}
+			},
+		}.ServeHTTP(w, r)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// wsStream implements eventStream on top of a WebSocket connection
+type wsStream struct {
+	ws *websocket.Conn
+}
+
+func (s *wsStream) Context() context.Context {
+	return s.ws.Request().Context()
+}
+
+// Send writes e as a single text frame. The frame is encoded into a pooled
+// buffer which is returned once the frame has been written
+func (s *wsStream) Send(e *sigmaV1.DispatchEvent) error {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
+	if err := (&jsonpb.Marshaler{}).Marshal(buf, e); err != nil {
+		return err
+	}
+
+	s.ws.PayloadType = websocket.TextFrame
+	_, err := s.ws.Write(buf.Bytes())
+	return err
+}
+
+func (s *wsStream) Recv() (*sigmaV1.ExecutionResult, error) {
+	var msg string
+	if err := websocket.Message.Receive(s.ws, &msg); err != nil {
+		return nil, err
+	}
+
+	var res sigmaV1.ExecutionResult
+	if err := jsonpb.UnmarshalString(msg, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func getHTTPAuth(r *http.Request) (string, string, error) {
+	urn := r.Header.Get("node-urn")
+	secret := r.Header.Get("node-secret")
+
+	if urn == "" && secret == "" {
+		urn = r.URL.Query().Get("urn")
+		secret = r.URL.Query().Get("secret")
+	}
+
+	if urn == "" {
+		return "", "", errors.New("invalid URN header")
+	}
+
+	if _, err := sigmaURN.ParseInstance(urn); err != nil {
+		return "", "", err
+	}
+
+	if secret == "" {
+		return "", "", errors.New("missing or invalid node-secret header")
+	}
+
+	return urn, secret, nil
+}
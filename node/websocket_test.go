@@ -0,0 +1,122 @@
+package node
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+
+	"github.com/golang/protobuf/jsonpb"
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeHTTP_RoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	h := NewNodeServer().(*nodeServer)
+	c, err := h.Prepare("urn:sigma:default:test:1:node", "secret", sigma.FunctionSpec{Content: "code"})
+	if !assert.NoError(err) {
+		return
+	}
+	conn := c.(*nodeConn)
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	register := func(method, secret string) *http.Response {
+		body := fmt.Sprintf(`{"urn": %q, "nodeType": "test"}`, conn.URN)
+
+		req, _ := http.NewRequest(method, srv.URL+"/nodes/register", strings.NewReader(body))
+		req.Header.Set("node-urn", conn.URN)
+		req.Header.Set("node-secret", secret)
+		req.Header.Set(ProtocolHeader, "2")
+		req.Header.Set(FeaturesHeader, "readiness")
+
+		res, err := http.DefaultClient.Do(req)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		return res
+	}
+
+	res := register(http.MethodPost, "invalid")
+	res.Body.Close()
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	res = register(http.MethodGet, "secret")
+	res.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+
+	res = register(http.MethodPost, "secret")
+	defer res.Body.Close()
+
+	if !assert.Equal(http.StatusOK, res.StatusCode) {
+		return
+	}
+	assert.Equal("2", res.Header.Get(ProtocolHeader))
+	assert.Equal("readiness", res.Header.Get(FeaturesHeader))
+
+	var reg sigmaV1.NodeRegistrationResponse
+	assert.NoError(jsonpb.Unmarshal(res.Body, &reg))
+	assert.Equal([]byte("code"), reg.GetContent())
+	assert.True(conn.Registered())
+
+	// browsers cannot set headers and authenticate using query parameters
+	q := url.Values{"urn": {conn.URN}, "secret": {"secret"}}
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/nodes/subscribe?"+q.Encode(), "", srv.URL)
+	if !assert.NoError(err) {
+		return
+	}
+	defer ws.Close()
+
+	waitConnected(t, conn, true)
+
+	router := NewRouter(conn)
+	defer router.Close()
+
+	type result struct {
+		res *sigmaV1.ExecutionResult
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		res, err := router.Dispatch(ctx, &sigmaV1.DispatchEvent{Payload: []byte("ping")})
+		done <- result{res, err}
+	}()
+
+	// the node receives the event as JSON text frame and answers with
+	// the execution result
+	var msg string
+	if !assert.NoError(websocket.Message.Receive(ws, &msg)) {
+		return
+	}
+
+	var ev sigmaV1.DispatchEvent
+	if !assert.NoError(jsonpb.UnmarshalString(msg, &ev)) {
+		return
+	}
+	assert.Equal([]byte("ping"), ev.GetPayload())
+
+	reply := fmt.Sprintf(`{"id": %q, "result": %q}`, ev.GetId(), base64.StdEncoding.EncodeToString([]byte("pong")))
+	assert.NoError(websocket.Message.Send(ws, reply))
+
+	r := <-done
+	if assert.NoError(r.err) {
+		assert.Equal([]byte("pong"), r.res.GetResult())
+	}
+
+	ws.Close()
+	waitConnected(t, conn, false)
+}
@@ -0,0 +1,111 @@
+package node
+
+import (
+	"errors"
+	"time"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+)
+
+// Default settings for writing dispatch events to node streams
+const (
+	// DefaultSendTimeout is the maximum time a single send may block
+	// before the node connection is closed
+	DefaultSendTimeout = 10 * time.Second
+
+	// DefaultSlowSendThreshold is the send duration after which a send
+	// is considered slow
+	DefaultSlowSendThreshold = time.Second
+
+	// DefaultSlowSendLimit is the number of consecutive slow sends after
+	// which a node is flagged as a slow consumer
+	DefaultSlowSendLimit = 5
+)
+
+// ErrSendTimeout is returned if a dispatch event could not be written to
+// the node stream within the send timeout
+var ErrSendTimeout = errors.New("send timeout")
+
+// sendPolicy configures deadlines and slow consumer detection for
+// stream writers
+type sendPolicy struct {
+	timeout   time.Duration
+	slowAfter time.Duration
+	slowLimit int
+}
+
+// streamWriter writes dispatch events to a stream with a deadline per
+// send. Sends are performed by a dedicated goroutine so a stalled
+// connection does not wedge the caller
+type streamWriter struct {
+	stream eventStream
+	policy sendPolicy
+
+	reqs chan *sigmaV1.DispatchEvent
+	errs chan error
+	done chan struct{}
+
+	slowSends int
+}
+
+func newStreamWriter(stream eventStream, policy sendPolicy) *streamWriter {
+	w := &streamWriter{
+		stream: stream,
+		policy: policy,
+		reqs:   make(chan *sigmaV1.DispatchEvent),
+		// buffered so the send goroutine can exit after a timeout
+		errs: make(chan error, 1),
+		done: make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+func (w *streamWriter) run() {
+	for {
+		select {
+		case ev := <-w.reqs:
+			w.errs <- w.stream.Send(ev)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Send writes ev to the stream. It returns ErrSendTimeout if the send did
+// not complete within the send timeout. slow reports whether the consumer
+// is currently considered slow
+func (w *streamWriter) Send(ev *sigmaV1.DispatchEvent) (slow bool, err error) {
+	start := time.Now()
+
+	timer := time.NewTimer(w.policy.timeout)
+	defer timer.Stop()
+
+	select {
+	case w.reqs <- ev:
+	case <-timer.C:
+		return true, ErrSendTimeout
+	}
+
+	select {
+	case err = <-w.errs:
+	case <-timer.C:
+		return true, ErrSendTimeout
+	}
+
+	if w.policy.slowAfter > 0 && time.Since(start) > w.policy.slowAfter {
+		w.slowSends++
+	} else {
+		w.slowSends = 0
+	}
+
+	return w.policy.slowLimit > 0 && w.slowSends >= w.policy.slowLimit, err
+}
+
+// Close stops the send goroutine. A send blocked on a stalled connection
+// returns once the stream is torn down
+func (w *streamWriter) Close() {
+	close(w.done)
+}
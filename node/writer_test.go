@@ -0,0 +1,54 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := newFakeStream(ctx)
+	go func() {
+		for range stream.events {
+		}
+	}()
+
+	// every send is slow, the consumer is flagged after the second one
+	w := newStreamWriter(stream, sendPolicy{timeout: time.Second, slowAfter: time.Nanosecond, slowLimit: 2})
+	defer w.Close()
+
+	slow, err := w.Send(&sigmaV1.DispatchEvent{})
+	assert.NoError(err)
+	assert.False(slow)
+
+	slow, err = w.Send(&sigmaV1.DispatchEvent{})
+	assert.NoError(err)
+	assert.True(slow)
+
+	// stalled streams time out
+	stalled := newStreamWriter(newFakeStream(ctx), sendPolicy{timeout: 10 * time.Millisecond})
+	defer stalled.Close()
+
+	_, err = stalled.Send(&sigmaV1.DispatchEvent{})
+	assert.Equal(ErrSendTimeout, err)
+}
+
+func TestWithSendTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	h := &nodeServer{}
+	WithSendTimeout(0)(h)
+	assert.Equal(DefaultSendTimeout, h.send.timeout)
+
+	WithSendTimeout(time.Second)(h)
+	assert.Equal(time.Second, h.send.timeout)
+}
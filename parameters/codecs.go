@@ -0,0 +1,93 @@
+package parameters
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+type stringCodec struct{}
+
+func (stringCodec) Normalize(def Definition, v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+	return s, nil
+}
+
+func (stringCodec) FormatEnv(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", ErrInvalidType
+	}
+	return s, nil
+}
+
+func (stringCodec) ParseEnv(def Definition, s string) (interface{}, error) {
+	return s, nil
+}
+
+type intCodec struct{}
+
+func (intCodec) Normalize(def Definition, v interface{}) (interface{}, error) {
+	switch i := v.(type) {
+	case int:
+		return i, nil
+	case int32:
+		return int(i), nil
+	case int64:
+		return int(i), nil
+	case float64:
+		// JSON and YAML decoders may produce floats for numbers
+		if i != math.Trunc(i) {
+			return nil, fmt.Errorf("%v is not an integer", i)
+		}
+		return int(i), nil
+	case string:
+		n, err := strconv.Atoi(i)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	default:
+		return nil, ErrInvalidType
+	}
+}
+
+func (intCodec) FormatEnv(v interface{}) (string, error) {
+	i, ok := v.(int)
+	if !ok {
+		return "", ErrInvalidType
+	}
+	return strconv.Itoa(i), nil
+}
+
+func (intCodec) ParseEnv(def Definition, s string) (interface{}, error) {
+	return strconv.Atoi(s)
+}
+
+type enumCodec struct{}
+
+func (enumCodec) Normalize(def Definition, v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+
+	for _, allowed := range def.Values {
+		if s == allowed {
+			return s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%q is not one of %v", s, def.Values)
+}
+
+func (enumCodec) FormatEnv(v interface{}) (string, error) {
+	return stringCodec{}.FormatEnv(v)
+}
+
+func (c enumCodec) ParseEnv(def Definition, s string) (interface{}, error) {
+	return c.Normalize(def, s)
+}
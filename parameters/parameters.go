@@ -0,0 +1,267 @@
+// Package parameters provides typed parameter schemas for function specs.
+// A schema declares the type of each parameter and is used to validate and
+// normalize parameter values before nodes are prepared. Parameter types are
+// pluggable using Register.
+package parameters
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/homebot/core/utils"
+)
+
+// Type is the type of a parameter
+type Type string
+
+// Built-in parameter types
+const (
+	// TypeString is a string parameter
+	TypeString = Type("string")
+
+	// TypeInt is an integer parameter
+	TypeInt = Type("int")
+
+	// TypeSecretRef is a reference to a secret that is resolved when the
+	// node is prepared. Secret values are never exposed as environment
+	// variables
+	TypeSecretRef = Type("secret-ref")
+
+	// TypeEnum is a string parameter restricted to a set of values
+	TypeEnum = Type("enum")
+)
+
+// ErrInvalidType is returned if a value has an unexpected type
+var ErrInvalidType = errors.New("invalid value type")
+
+// Definition describes a single parameter
+type Definition struct {
+	// Type is the type of the parameter
+	Type Type `json:"type" yaml:"type"`
+
+	// Description describes the parameter
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Required marks the parameter as required
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+
+	// Default holds the default value used if the parameter is not set
+	Default interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// Values holds the allowed values of enum parameters
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// Schema describes the parameters of a function indexed by name
+type Schema map[string]Definition
+
+// SecretResolver resolves secret references to their values
+type SecretResolver func(ref string) (string, error)
+
+// Codec validates and converts values of a parameter type
+type Codec interface {
+	// Normalize validates v against def and returns the normalized value
+	Normalize(def Definition, v interface{}) (interface{}, error)
+
+	// FormatEnv returns the environment variable form of a normalized
+	// value
+	FormatEnv(v interface{}) (string, error)
+
+	// ParseEnv parses the environment variable form of a value
+	ParseEnv(def Definition, s string) (interface{}, error)
+}
+
+var (
+	codecsLock sync.RWMutex
+	codecs     = map[Type]Codec{
+		TypeString:    stringCodec{},
+		TypeInt:       intCodec{},
+		TypeSecretRef: stringCodec{},
+		TypeEnum:      enumCodec{},
+	}
+)
+
+// Register registers a codec for a parameter type. Registering a codec for
+// an existing type replaces it
+func Register(typ Type, c Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+
+	codecs[typ] = c
+}
+
+func getCodec(typ Type) (Codec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	c, ok := codecs[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter type %q", typ)
+	}
+	return c, nil
+}
+
+// Valid checks if the schema itself is valid
+func (s Schema) Valid() error {
+	for name, def := range s {
+		if _, err := getCodec(def.Type); err != nil {
+			return fmt.Errorf("parameter %q: %s", name, err)
+		}
+
+		if def.Type == TypeEnum && len(def.Values) == 0 {
+			return fmt.Errorf("parameter %q: enum without values", name)
+		}
+	}
+	return nil
+}
+
+// Validate validates values against the schema, applies defaults and
+// returns the normalized values. Secret references are resolved using
+// resolve which may be nil if the schema does not contain secrets.
+// Parameters not declared in the schema are rejected
+func (s Schema) Validate(values utils.ValueMap, resolve SecretResolver) (utils.ValueMap, error) {
+	if err := s.Valid(); err != nil {
+		return nil, err
+	}
+
+	res := make(utils.ValueMap)
+
+	for name := range values {
+		if _, ok := s[name]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	for _, name := range s.names() {
+		def := s[name]
+
+		v, ok := values[name]
+		if !ok || v == nil {
+			if def.Default == nil {
+				if def.Required {
+					return nil, fmt.Errorf("missing required parameter %q", name)
+				}
+				continue
+			}
+			v = def.Default
+		}
+
+		codec, _ := getCodec(def.Type)
+		n, err := codec.Normalize(def, v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %s", name, err)
+		}
+
+		if def.Type == TypeSecretRef {
+			if resolve == nil {
+				return nil, fmt.Errorf("parameter %q: no secret resolver configured", name)
+			}
+
+			n, err = resolve(n.(string))
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %s", name, err)
+			}
+		}
+
+		res[name] = n
+	}
+
+	return res, nil
+}
+
+// EnvName returns the environment variable name of a parameter
+func EnvName(name string) string {
+	return "SIGMA_PARAM_" + strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name))
+}
+
+// Env returns the environment variable form of normalized values. Secret
+// parameters are omitted
+func (s Schema) Env(values utils.ValueMap) (map[string]string, error) {
+	env := make(map[string]string)
+
+	for _, name := range s.names() {
+		def := s[name]
+		v, ok := values[name]
+		if !ok || def.Type == TypeSecretRef {
+			continue
+		}
+
+		codec, err := getCodec(def.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		str, err := codec.FormatEnv(v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %s", name, err)
+		}
+
+		env[EnvName(name)] = str
+	}
+
+	return env, nil
+}
+
+// FromEnv parses parameter values from environment variables as returned
+// by Env. lookup is usually os.LookupEnv
+func (s Schema) FromEnv(lookup func(string) (string, bool)) (utils.ValueMap, error) {
+	res := make(utils.ValueMap)
+
+	for _, name := range s.names() {
+		def := s[name]
+
+		str, ok := lookup(EnvName(name))
+		if !ok {
+			continue
+		}
+
+		codec, err := getCodec(def.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := codec.ParseEnv(def, str)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %s", name, err)
+		}
+		res[name] = v
+	}
+
+	return res, nil
+}
+
+func (s Schema) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DirResolver returns a SecretResolver reading secrets from files in dir.
+// The secret reference is the file name
+func DirResolver(dir string) SecretResolver {
+	return func(ref string) (string, error) {
+		if ref == "" || strings.ContainsAny(ref, `/\`) || ref == "." || ref == ".." {
+			return "", fmt.Errorf("invalid secret reference %q", ref)
+		}
+
+		blob, err := ioutil.ReadFile(filepath.Join(dir, ref))
+		if err != nil {
+			return "", fmt.Errorf("secret %q: %s", ref, err)
+		}
+
+		return strings.TrimRight(string(blob), "\r\n"), nil
+	}
+}
@@ -0,0 +1,88 @@
+package parameters
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/homebot/core/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	schema := Schema{
+		"name":     {Type: TypeString, Required: true},
+		"replicas": {Type: TypeInt, Default: 1},
+		"level":    {Type: TypeEnum, Values: []string{"debug", "info"}},
+		"token":    {Type: TypeSecretRef},
+	}
+
+	resolve := func(ref string) (string, error) {
+		if ref == "api-token" {
+			return "s3cret", nil
+		}
+		return "", errors.New("unknown secret")
+	}
+
+	res, err := schema.Validate(utils.ValueMap{
+		"name":  "foo",
+		"level": "info",
+		"token": "api-token",
+	}, resolve)
+	if assert.NoError(err) {
+		assert.Equal("foo", res["name"])
+		assert.Equal(1, res["replicas"])
+		assert.Equal("info", res["level"])
+		assert.Equal("s3cret", res["token"])
+	}
+
+	_, err = schema.Validate(utils.ValueMap{}, resolve)
+	assert.Error(err, "missing required parameter")
+
+	_, err = schema.Validate(utils.ValueMap{"name": "foo", "level": "trace"}, resolve)
+	assert.Error(err, "invalid enum value")
+
+	_, err = schema.Validate(utils.ValueMap{"name": "foo", "replicas": "many"}, resolve)
+	assert.Error(err, "invalid int")
+
+	_, err = schema.Validate(utils.ValueMap{"name": "foo", "unknown": 1}, resolve)
+	assert.Error(err, "unknown parameter")
+
+	_, err = schema.Validate(utils.ValueMap{"name": "foo", "token": "other"}, resolve)
+	assert.Error(err, "unknown secret")
+}
+
+func TestSchema_Env(t *testing.T) {
+	assert := assert.New(t)
+
+	schema := Schema{
+		"name":      {Type: TypeString},
+		"max-items": {Type: TypeInt},
+		"token":     {Type: TypeSecretRef},
+	}
+
+	values := utils.ValueMap{
+		"name":      "foo",
+		"max-items": 10,
+		"token":     "s3cret",
+	}
+
+	env, err := schema.Env(values)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(map[string]string{
+		"SIGMA_PARAM_NAME":      "foo",
+		"SIGMA_PARAM_MAX_ITEMS": "10",
+	}, env)
+
+	parsed, err := schema.FromEnv(func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	if assert.NoError(err) {
+		assert.Equal(utils.ValueMap{"name": "foo", "max-items": 10}, parsed)
+	}
+}
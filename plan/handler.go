@@ -0,0 +1,77 @@
+// Package plan serves change plans of function spec updates via HTTP.
+// Submitting a spec returns the fields that change, whether nodes are
+// restarted and which triggers change before anything is applied
+package plan
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// Applier creates change plans and applies them
+type Applier interface {
+	// Apply returns the change plan for spec and applies it unless
+	// dryRun is set
+	Apply(ctx context.Context, spec sigma.FunctionSpec, dryRun bool) (scheduler.Plan, error)
+}
+
+// Handler serves change plans via HTTP:
+//
+//	POST /plan?dryRun=<bool>  plan and apply the spec sent as request body
+//
+// dryRun defaults to true so specs are only applied if requested
+type Handler struct {
+	applier Applier
+}
+
+// NewHandler returns a new HTTP handler planning updates using a
+func NewHandler(a Applier) *Handler {
+	return &Handler{
+		applier: a,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun := true
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dryRun = b
+	}
+
+	var spec sigma.FunctionSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if spec.ID == "" || spec.Type == "" {
+		http.Error(w, "invalid function spec", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.applier.Apply(r.Context(), spec, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+}
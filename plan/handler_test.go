@@ -0,0 +1,90 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+// testApplier records the last applied spec
+type testApplier struct {
+	spec   sigma.FunctionSpec
+	dryRun bool
+	err    error
+}
+
+func (a *testApplier) Apply(ctx context.Context, spec sigma.FunctionSpec, dryRun bool) (scheduler.Plan, error) {
+	a.spec = spec
+	a.dryRun = dryRun
+
+	changes, err := sigma.DiffSpecs(sigma.FunctionSpec{ID: spec.ID, Type: spec.Type}, spec)
+	if err != nil {
+		return scheduler.Plan{}, err
+	}
+
+	return scheduler.Plan{
+		Function: spec.ID,
+		Changes:  changes,
+		Restart:  sigma.NeedsRestart(changes),
+		Applied:  !dryRun,
+	}, a.err
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &testApplier{}
+	h := NewHandler(a)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	spec := `{"id": "fn", "type": "js", "weight": 2}`
+
+	// specs are only applied if requested
+	rec := serve(http.MethodPost, "/plan", spec)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.True(a.dryRun)
+	assert.Equal("fn", a.spec.ID)
+	assert.Equal(2, a.spec.Weight)
+
+	var p scheduler.Plan
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&p))
+	assert.Equal("fn", p.Function)
+	assert.False(p.Restart)
+	assert.False(p.Applied)
+	if assert.Len(p.Changes, 1) {
+		assert.Equal("weight", p.Changes[0].Field)
+		assert.Equal(sigma.EffectLive, p.Changes[0].Effect)
+	}
+
+	rec = serve(http.MethodPost, "/plan?dryRun=false", spec)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.False(a.dryRun)
+
+	p = scheduler.Plan{}
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&p))
+	assert.True(p.Applied)
+
+	assert.Equal(http.StatusMethodNotAllowed, serve(http.MethodGet, "/plan", "").Code)
+	assert.Equal(http.StatusBadRequest, serve(http.MethodPost, "/plan?dryRun=maybe", spec).Code)
+	assert.Equal(http.StatusBadRequest, serve(http.MethodPost, "/plan", "{").Code)
+	assert.Equal(http.StatusBadRequest, serve(http.MethodPost, "/plan", `{"id": "fn"}`).Code)
+
+	a.err = errors.New("recreate required")
+	rec = serve(http.MethodPost, "/plan?dryRun=false", spec)
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	assert.Contains(rec.Body.String(), "recreate required")
+}
@@ -0,0 +1,378 @@
+// Package proxy implements an HTTP egress proxy for function nodes. Calls
+// of all nodes share a pooled upstream transport and are checked against
+// the proxy policy of the calling function
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/homebot/sigma"
+)
+
+var (
+	// ErrUnauthenticated is returned by an Authenticator if the node
+	// credentials are invalid
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	// ErrAddressNotAllowed is returned when dialing a loopback, link-local
+	// or private address not allowed by the proxy policy
+	ErrAddressNotAllowed = errors.New("address not allowed")
+)
+
+// DefaultTunnelPort is the only port CONNECT tunnels may be opened to if
+// the proxy policy does not allow other ports
+const DefaultTunnelPort = 443
+
+// Authenticator returns the proxy policy of the function a node belongs to.
+// Nodes authenticate using their URN and secret as proxy basic auth
+// credentials. A nil policy denies all hosts
+type Authenticator func(urn, secret string) (*sigma.ProxyPolicy, error)
+
+// Option configures a proxy
+type Option func(p *Proxy)
+
+// WithTransport sets the upstream transport. Its DialContext is replaced
+// to enforce the proxy policy on resolved addresses
+func WithTransport(t *http.Transport) Option {
+	return func(p *Proxy) {
+		p.transport = t
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing CONNECT tunnels
+func WithDialTimeout(d time.Duration) Option {
+	return func(p *Proxy) {
+		p.dialTimeout = d
+	}
+}
+
+// Proxy is an HTTP forward proxy for function nodes
+type Proxy struct {
+	auth        Authenticator
+	transport   *http.Transport
+	dialTimeout time.Duration
+}
+
+// New creates a new egress proxy
+func New(auth Authenticator, opts ...Option) *Proxy {
+	p := &Proxy{
+		auth: auth,
+		transport: &http.Transport{
+			Proxy:               nil,
+			MaxIdleConns:        256,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		dialTimeout: 10 * time.Second,
+	}
+
+	for _, fn := range opts {
+		fn(p)
+	}
+
+	p.transport.DialContext = p.dial
+
+	return p
+}
+
+type policyKey struct{}
+
+// ServeHTTP proxies plain HTTP requests and CONNECT tunnels
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	policy, err := p.authenticate(r)
+	if err != nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="sigma"`)
+		http.Error(w, err.Error(), http.StatusProxyAuthRequired)
+		return
+	}
+
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		var port string
+		host, port, _ = net.SplitHostPort(r.Host)
+
+		if !allowedPort(policy, port) {
+			http.Error(w, "port not allowed: "+port, http.StatusForbidden)
+			return
+		}
+	}
+
+	if !Allowed(policy, host) {
+		http.Error(w, "host not allowed: "+host, http.StatusForbidden)
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), policyKey{}, policy))
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	p.forward(w, r, policy)
+}
+
+func (p *Proxy) authenticate(r *http.Request) (*sigma.ProxyPolicy, error) {
+	hdr := r.Header.Get("Proxy-Authorization")
+	if !strings.HasPrefix(hdr, "Basic ") {
+		return nil, ErrUnauthenticated
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hdr, "Basic "))
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	// URNs may contain colons but secrets don't
+	creds := string(blob)
+	idx := strings.LastIndex(creds, ":")
+	if idx < 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	return p.auth(creds[:idx], creds[idx+1:])
+}
+
+// Allowed returns true if policy allows calls to host. Calls are denied
+// if the policy is nil or does not allow any hosts
+func Allowed(policy *sigma.ProxyPolicy, host string) bool {
+	if policy == nil {
+		return false
+	}
+
+	host = strings.ToLower(host)
+	for _, allowed := range policy.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+			continue
+		}
+
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedPort returns true if policy allows CONNECT tunnels to port
+func allowedPort(policy *sigma.ProxyPolicy, port string) bool {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+
+	if policy == nil || len(policy.AllowedPorts) == 0 {
+		return n == DefaultTunnelPort
+	}
+
+	for _, allowed := range policy.AllowedPorts {
+		if n == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedIP returns true if ip is a public address or part of the networks
+// allowed by policy
+func allowedIP(policy *sigma.ProxyPolicy, ip net.IP) bool {
+	internal := ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified()
+
+	if !internal {
+		return true
+	}
+
+	if policy == nil {
+		return false
+	}
+
+	for _, cidr := range policy.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve resolves host and checks all addresses against policy
+func resolve(ctx context.Context, policy *sigma.ProxyPolicy, host string) ([]net.IPAddr, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+
+	for _, ip := range ips {
+		if !allowedIP(policy, ip.IP) {
+			return nil, ErrAddressNotAllowed
+		}
+	}
+
+	return ips, nil
+}
+
+// dial connects to addr after checking the addresses the host resolves to
+// against the proxy policy stored in ctx. The checked address is dialed
+// so the check cannot be bypassed by changing DNS records in between
+func (p *Proxy) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	policy, _ := ctx.Value(policyKey{}).(*sigma.ProxyPolicy)
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := resolve(ctx, policy, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: p.dialTimeout}
+	return d.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+}
+
+// hop-by-hop headers that must not be forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+	default:
+		return false
+	}
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, policy *sigma.ProxyPolicy) {
+	out := r.WithContext(r.Context())
+	out.RequestURI = ""
+	out.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		out.Header[k] = v
+	}
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	// the body of incoming requests cannot be replayed
+	if r.ContentLength == 0 {
+		out.Body = http.NoBody
+	}
+
+	// pooled connections may have been dialed on behalf of another
+	// function, so the policy is checked for every request
+	if _, err := resolve(r.Context(), policy, r.URL.Hostname()); err != nil {
+		status := http.StatusBadGateway
+		if err == ErrAddressNotAllowed {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	retries := 0
+	if policy != nil && isIdempotent(out) {
+		retries = policy.Retries
+	}
+
+	var (
+		res *http.Response
+		err error
+	)
+	for attempt := 0; attempt <= retries; attempt++ {
+		res, err = p.transport.RoundTrip(out)
+		if err == nil || errors.Is(err, ErrAddressNotAllowed) {
+			break
+		}
+	}
+	if errors.Is(err, ErrAddressNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for _, h := range hopHeaders {
+		res.Header.Del(h)
+	}
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dial(r.Context(), "tcp", r.Host)
+	if err == ErrAddressNotAllowed {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	client, _, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(upstream, client)
+		upstream.Close()
+	}()
+
+	io.Copy(client, upstream)
+	client.Close()
+}
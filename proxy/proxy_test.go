@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := &sigma.ProxyPolicy{
+		AllowedHosts: []string{"api.example.com", "*.storage.example.com"},
+	}
+
+	assert.False(Allowed(nil, "anything"))
+	assert.False(Allowed(&sigma.ProxyPolicy{}, "anything"))
+	assert.True(Allowed(policy, "API.example.com"))
+	assert.True(Allowed(policy, "eu.storage.example.com"))
+	assert.False(Allowed(policy, "storage.example.com"))
+	assert.False(Allowed(policy, "example.com"))
+}
+
+func TestAllowedIP(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := &sigma.ProxyPolicy{AllowedCIDRs: []string{"10.1.0.0/16"}}
+
+	assert.True(allowedIP(nil, net.ParseIP("93.184.216.34")))
+	assert.True(allowedIP(policy, net.ParseIP("10.1.2.3")))
+	assert.False(allowedIP(policy, net.ParseIP("10.2.0.1")))
+
+	for _, ip := range []string{"127.0.0.1", "::1", "169.254.169.254", "fe80::1", "192.168.1.1", "172.16.0.1", "fd00::1", "0.0.0.0"} {
+		assert.False(allowedIP(policy, net.ParseIP(ip)), ip)
+	}
+}
+
+func TestAllowedPort(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(allowedPort(nil, "443"))
+	assert.False(allowedPort(nil, "22"))
+	assert.False(allowedPort(nil, ""))
+
+	policy := &sigma.ProxyPolicy{AllowedPorts: []int{8443}}
+	assert.True(allowedPort(policy, "8443"))
+	assert.False(allowedPort(policy, "443"))
+}
+
+func TestProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(r.Header.Get("Proxy-Authorization"))
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	policy := &sigma.ProxyPolicy{AllowedHosts: []string{"127.0.0.1"}}
+
+	p := httptest.NewServer(New(func(urn, secret string) (*sigma.ProxyPolicy, error) {
+		if urn != "urn:sigma:node:1" || secret != "secret" {
+			return nil, ErrUnauthenticated
+		}
+		return policy, nil
+	}))
+	defer p.Close()
+
+	get := func(user *url.Userinfo, target string) *http.Response {
+		proxyURL, _ := url.Parse(p.URL)
+		proxyURL.User = user
+
+		cli := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		res, err := cli.Get(target)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		return res
+	}
+
+	// loopback addresses must be allowed explicitly
+	res := get(url.UserPassword("urn:sigma:node:1", "secret"), upstream.URL)
+	res.Body.Close()
+	assert.Equal(http.StatusForbidden, res.StatusCode)
+
+	policy.AllowedCIDRs = []string{"127.0.0.0/8"}
+
+	res = get(url.UserPassword("urn:sigma:node:1", "secret"), upstream.URL)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("hello", string(body))
+
+	res = get(url.UserPassword("urn:sigma:node:1", "wrong"), upstream.URL)
+	res.Body.Close()
+	assert.Equal(http.StatusProxyAuthRequired, res.StatusCode)
+
+	res = get(url.UserPassword("urn:sigma:node:1", "secret"), "http://localhost:1/")
+	res.Body.Close()
+	assert.Equal(http.StatusForbidden, res.StatusCode)
+}
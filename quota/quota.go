@@ -0,0 +1,227 @@
+// Package quota enforces per-namespace limits on the number of functions,
+// the number of nodes and the total memory reserved by nodes so a single
+// tenant cannot exhaust the host
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/homebot/sigma/state"
+)
+
+// Resources that may be limited
+const (
+	ResourceFunctions = "functions"
+	ResourceNodes     = "nodes"
+	ResourceMemory    = "memory"
+)
+
+// Limits holds the quota of a namespace. Zero values mean unlimited
+type Limits struct {
+	// MaxFunctions is the maximum number of functions
+	MaxFunctions int `json:"maxFunctions,omitempty" yaml:"maxFunctions,omitempty"`
+
+	// MaxNodes is the maximum number of nodes across all functions
+	MaxNodes int `json:"maxNodes,omitempty" yaml:"maxNodes,omitempty"`
+
+	// MaxMemoryMB is the maximum memory in megabytes reserved by all
+	// nodes
+	MaxMemoryMB int64 `json:"maxMemoryMB,omitempty" yaml:"maxMemoryMB,omitempty"`
+
+	// DefaultNodeMemoryMB is the memory in megabytes reserved for nodes
+	// of functions that do not declare resources. If zero, those nodes
+	// are refused while MaxMemoryMB is set
+	DefaultNodeMemoryMB int64 `json:"defaultNodeMemoryMB,omitempty" yaml:"defaultNodeMemoryMB,omitempty"`
+}
+
+// ErrResourcesRequired is returned by AcquireNode if the memory of a node
+// is unknown but the namespace has a memory quota
+var ErrResourcesRequired = errors.New("quota: functions must declare resources while a memory quota is set")
+
+// Usage holds the current resource usage of a namespace
+type Usage struct {
+	Functions int   `json:"functions"`
+	Nodes     int   `json:"nodes"`
+	MemoryMB  int64 `json:"memoryMB"`
+}
+
+// Error is returned if a request would exceed the quota of a namespace
+type Error struct {
+	Namespace string
+	Resource  string
+	Limit     int64
+	Usage     Usage
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("quota exceeded: namespace %q: %s limit %d (usage: functions=%d nodes=%d memory=%dMB)",
+		e.Namespace, e.Resource, e.Limit, e.Usage.Functions, e.Usage.Nodes, e.Usage.MemoryMB)
+}
+
+// IsExceeded returns true if err is a quota error
+func IsExceeded(err error) bool {
+	_, ok := err.(*Error)
+	return ok
+}
+
+type node struct {
+	namespace string
+	memoryMB  int64
+}
+
+// Manager tracks the resource usage of namespaces and enforces their
+// limits. A nil Manager does not enforce any quota
+type Manager struct {
+	defaults   Limits
+	namespaces map[string]Limits
+
+	mu        sync.Mutex
+	functions map[string]string
+	nodes     map[string]node
+}
+
+// New creates a new quota manager. Namespaces without an entry in
+// namespaces are limited by defaults
+func New(defaults Limits, namespaces map[string]Limits) *Manager {
+	return &Manager{
+		defaults:   defaults,
+		namespaces: namespaces,
+		functions:  make(map[string]string),
+		nodes:      make(map[string]node),
+	}
+}
+
+// Limits returns the limits of the namespace ns
+func (m *Manager) Limits(ns string) Limits {
+	if m == nil {
+		return Limits{}
+	}
+
+	if l, ok := m.namespaces[ns]; ok {
+		return l
+	}
+
+	return m.defaults
+}
+
+// Usage returns the current usage of the namespace ns
+func (m *Manager) Usage(ns string) Usage {
+	if m == nil {
+		return Usage{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.usage(ns)
+}
+
+// AddFunction reserves quota for the function with the given ID
+func (m *Manager) AddFunction(functionID string) error {
+	if m == nil {
+		return nil
+	}
+
+	ns := state.Namespace(functionID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.functions[functionID]; ok {
+		return nil
+	}
+
+	usage := m.usage(ns)
+	if max := m.Limits(ns).MaxFunctions; max > 0 && usage.Functions+1 > max {
+		return &Error{ns, ResourceFunctions, int64(max), usage}
+	}
+
+	m.functions[functionID] = ns
+	return nil
+}
+
+// RemoveFunction releases the quota reserved for a function
+func (m *Manager) RemoveFunction(functionID string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.functions, functionID)
+}
+
+// AcquireNode reserves quota for a node of the function with the given ID
+// requiring memoryMB megabytes of memory. If memoryMB is zero and the
+// namespace has a memory quota, the default node memory is reserved. The
+// reserved memory is returned and must be enforced as the memory limit of
+// the node
+func (m *Manager) AcquireNode(functionID, urn string, memoryMB int64) (int64, error) {
+	if m == nil {
+		return memoryMB, nil
+	}
+
+	ns := state.Namespace(functionID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n, ok := m.nodes[urn]; ok {
+		return n.memoryMB, nil
+	}
+
+	limits := m.Limits(ns)
+	usage := m.usage(ns)
+
+	if limits.MaxNodes > 0 && usage.Nodes+1 > limits.MaxNodes {
+		return 0, &Error{ns, ResourceNodes, int64(limits.MaxNodes), usage}
+	}
+
+	if limits.MaxMemoryMB > 0 && memoryMB <= 0 {
+		memoryMB = limits.DefaultNodeMemoryMB
+		if memoryMB <= 0 {
+			return 0, ErrResourcesRequired
+		}
+	}
+
+	if limits.MaxMemoryMB > 0 && usage.MemoryMB+memoryMB > limits.MaxMemoryMB {
+		return 0, &Error{ns, ResourceMemory, limits.MaxMemoryMB, usage}
+	}
+
+	m.nodes[urn] = node{ns, memoryMB}
+	return memoryMB, nil
+}
+
+// ReleaseNode releases the quota reserved for a node
+func (m *Manager) ReleaseNode(urn string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.nodes, urn)
+}
+
+func (m *Manager) usage(ns string) Usage {
+	var u Usage
+
+	for _, n := range m.functions {
+		if n == ns {
+			u.Functions++
+		}
+	}
+
+	for _, n := range m.nodes {
+		if n.namespace == ns {
+			u.Nodes++
+			u.MemoryMB += n.memoryMB
+		}
+	}
+
+	return u
+}
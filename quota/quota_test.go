@@ -0,0 +1,86 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New(Limits{MaxFunctions: 1}, map[string]Limits{
+		"acme": {MaxNodes: 2, MaxMemoryMB: 256},
+	})
+
+	assert.NoError(m.AddFunction("default/functions/a"))
+	assert.NoError(m.AddFunction("default/functions/a"))
+
+	err := m.AddFunction("default/functions/b")
+	if assert.True(IsExceeded(err)) {
+		assert.Equal(ResourceFunctions, err.(*Error).Resource)
+		assert.Equal(1, err.(*Error).Usage.Functions)
+	}
+
+	m.RemoveFunction("default/functions/a")
+	assert.NoError(m.AddFunction("default/functions/b"))
+
+	// namespaces are limited independently
+	assert.NoError(m.AddFunction("acme/functions/a"))
+	assert.NoError(m.AddFunction("acme/functions/b"))
+
+	_, err = m.AcquireNode("acme/functions/a", "node-1", 128)
+	assert.NoError(err)
+	_, err = m.AcquireNode("acme/functions/a", "node-2", 256)
+	if assert.True(IsExceeded(err)) {
+		assert.Equal(ResourceMemory, err.(*Error).Resource)
+	}
+
+	_, err = m.AcquireNode("acme/functions/b", "node-2", 128)
+	assert.NoError(err)
+	_, err = m.AcquireNode("acme/functions/a", "node-3", 64)
+	if assert.True(IsExceeded(err)) {
+		assert.Equal(ResourceNodes, err.(*Error).Resource)
+		assert.Equal(Usage{Functions: 2, Nodes: 2, MemoryMB: 256}, err.(*Error).Usage)
+	}
+
+	m.ReleaseNode("node-1")
+	assert.Equal(Usage{Functions: 2, Nodes: 1, MemoryMB: 128}, m.Usage("acme"))
+
+	// a nil manager does not enforce quotas
+	var nop *Manager
+	assert.NoError(nop.AddFunction("acme/functions/c"))
+	_, err = nop.AcquireNode("acme/functions/c", "node-1", 1024)
+	assert.NoError(err)
+}
+
+func TestManager_DefaultNodeMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New(Limits{MaxMemoryMB: 256}, map[string]Limits{
+		"acme": {MaxMemoryMB: 256, DefaultNodeMemoryMB: 128},
+		"free": {MaxNodes: 1},
+	})
+
+	// nodes without resources cannot bypass the memory quota
+	_, err := m.AcquireNode("default/functions/a", "node-1", 0)
+	assert.Equal(ErrResourcesRequired, err)
+
+	memory, err := m.AcquireNode("acme/functions/a", "node-2", 0)
+	assert.NoError(err)
+	assert.Equal(int64(128), memory)
+
+	memory, err = m.AcquireNode("acme/functions/a", "node-2", 0)
+	assert.NoError(err)
+	assert.Equal(int64(128), memory)
+
+	_, err = m.AcquireNode("acme/functions/a", "node-3", 0)
+	assert.NoError(err)
+	_, err = m.AcquireNode("acme/functions/a", "node-4", 0)
+	assert.True(IsExceeded(err))
+
+	// namespaces without memory quota do not reserve memory
+	memory, err = m.AcquireNode("free/functions/a", "node-5", 0)
+	assert.NoError(err)
+	assert.Equal(int64(0), memory)
+}
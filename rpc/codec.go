@@ -0,0 +1,38 @@
+// Package rpc contains helpers for sigma internal gRPC services that do not
+// (yet) have a protocol buffer definition in homebot/protobuf. Messages of
+// those services are plain Go structs encoded as JSON.
+package rpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+// Codec is a gRPC codec that encodes messages as JSON
+type Codec struct{}
+
+// Marshal returns the JSON encoding of v
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the JSON encoded data and stores the result in v
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// String returns the name of the codec
+func (Codec) String() string {
+	return "json"
+}
+
+// ServerOption returns the gRPC server option to use the JSON codec
+func ServerOption() grpc.ServerOption {
+	return grpc.CustomCodec(Codec{})
+}
+
+// DialOption returns the gRPC dial option to use the JSON codec
+func DialOption() grpc.DialOption {
+	return grpc.WithCodec(Codec{})
+}
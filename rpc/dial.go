@@ -0,0 +1,24 @@
+package rpc
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// UnixScheme is the address prefix of unix domain socket addresses
+const UnixScheme = "unix://"
+
+// Dialer returns a gRPC dial option supporting node handler addresses of
+// the form "unix:///path/to/socket". Other addresses are dialed using TCP
+func Dialer() grpc.DialOption {
+	return grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		if strings.HasPrefix(addr, UnixScheme) {
+			return net.DialTimeout("unix", strings.TrimPrefix(addr, UnixScheme), timeout)
+		}
+
+		return net.DialTimeout("tcp", addr, timeout)
+	})
+}
@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// TLSConfig configures mutual TLS for sigma internal services. Both sides
+// of a connection present a certificate signed by the configured CA
+type TLSConfig struct {
+	// CertFile holds the path to the PEM encoded certificate
+	CertFile string `json:"certFile" yaml:"certFile"`
+
+	// KeyFile holds the path to the PEM encoded private key
+	KeyFile string `json:"keyFile" yaml:"keyFile"`
+
+	// CAFile holds the path to the PEM encoded CA certificates used to
+	// verify the certificate of the remote side
+	CAFile string `json:"caFile" yaml:"caFile"`
+
+	// ServerName overrides the name used to verify server certificates.
+	// Defaults to the host of the dialed address
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+}
+
+// Load loads the certificates of c
+func (c *TLSConfig) Load() (*tls.Config, error) {
+	if c == nil || c.CertFile == "" || c.KeyFile == "" || c.CAFile == "" {
+		return nil, errors.New("tls: certFile, keyFile and caFile are mandatory")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(blob) {
+		return nil, errors.New("tls: no CA certificates found in " + c.CAFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   c.ServerName,
+	}, nil
+}
+
+// ServerCredentials returns transport credentials for servers requiring
+// clients to present a certificate signed by one of cfg.RootCAs
+func ServerCredentials(cfg *tls.Config) credentials.TransportCredentials {
+	c := cfg.Clone()
+	c.ClientCAs = cfg.RootCAs
+	c.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return credentials.NewTLS(c)
+}
+
+// ClientCredentials returns transport credentials for clients presenting
+// the certificate of cfg
+func ClientCredentials(cfg *tls.Config) credentials.TransportCredentials {
+	return credentials.NewTLS(cfg.Clone())
+}
+
+// AuthenticatedPeer returns the common name of the verified client
+// certificate of the call in ctx. An error is returned if the call does
+// not use a mutually authenticated TLS connection
+func AuthenticatedPeer(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "unknown peer")
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", status.Error(codes.Unauthenticated, "client certificate required")
+	}
+
+	return info.State.VerifiedChains[0][0].Subject.CommonName, nil
+}
@@ -0,0 +1,172 @@
+package runtimes
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/homebot/sigma"
+)
+
+var (
+	// ErrUnknownRuntime is returned if the requested runtime does not exist
+	ErrUnknownRuntime = errors.New("unknown runtime")
+
+	// ErrRuntimeRegistered is returned if a runtime with the same name and
+	// version is already registered
+	ErrRuntimeRegistered = errors.New("runtime already registered")
+)
+
+// Registry holds all available runtimes
+type Registry struct {
+	rw       sync.RWMutex
+	runtimes map[string]map[string]Runtime
+}
+
+// NewRegistry returns a new registry holding the given runtimes
+func NewRegistry(runtimes ...Runtime) (*Registry, error) {
+	r := &Registry{
+		runtimes: make(map[string]map[string]Runtime),
+	}
+
+	for _, rt := range runtimes {
+		if err := r.Register(rt); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register registers a new runtime
+func (r *Registry) Register(rt Runtime) error {
+	if rt.Name == "" || rt.Version == "" {
+		return errors.New("runtime name and version are mandatory")
+	}
+
+	if strings.Contains(rt.Name, "@") {
+		return errors.New("runtime name must not contain '@'")
+	}
+
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	versions, ok := r.runtimes[rt.Name]
+	if !ok {
+		versions = make(map[string]Runtime)
+		r.runtimes[rt.Name] = versions
+	}
+
+	if _, ok := versions[rt.Version]; ok {
+		return ErrRuntimeRegistered
+	}
+
+	versions[rt.Version] = rt
+	return nil
+}
+
+// Get returns the runtime with the given name and version. If version is
+// empty or "latest" the runtime with the highest version is returned
+func (r *Registry) Get(name, version string) (Runtime, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	versions, ok := r.runtimes[name]
+	if !ok || len(versions) == 0 {
+		return Runtime{}, ErrUnknownRuntime
+	}
+
+	if version == "" || version == "latest" {
+		var latest string
+		for v := range versions {
+			if latest == "" || compareVersions(v, latest) > 0 {
+				latest = v
+			}
+		}
+		return versions[latest], nil
+	}
+
+	rt, ok := versions[version]
+	if !ok {
+		return Runtime{}, ErrUnknownRuntime
+	}
+
+	return rt, nil
+}
+
+// Lookup returns the runtime for a reference in the form "name@version"
+func (r *Registry) Lookup(ref string) (Runtime, error) {
+	name, version, err := ParseReference(ref)
+	if err != nil {
+		return Runtime{}, err
+	}
+
+	return r.Get(name, version)
+}
+
+// Resolve returns the runtime for a function spec. If the spec does not
+// reference a runtime, the spec's type is used as the runtime name
+func (r *Registry) Resolve(spec sigma.FunctionSpec) (Runtime, error) {
+	ref := spec.Runtime
+	if ref == "" {
+		ref = spec.Type
+	}
+
+	return r.Lookup(ref)
+}
+
+// List returns all registered runtimes sorted by key
+func (r *Registry) List() []Runtime {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	var res []Runtime
+	for _, versions := range r.runtimes {
+		for _, rt := range versions {
+			res = append(res, rt)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key() < res[j].Key()
+	})
+
+	return res
+}
+
+// compareVersions compares two dotted version strings numerically where
+// possible and returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var sa, sb string
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+
+		na, errA := strconv.Atoi(sa)
+		nb, errB := strconv.Atoi(sb)
+
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && sa != sb:
+			if sa < sb {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
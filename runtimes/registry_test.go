@@ -0,0 +1,57 @@
+package runtimes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range []struct {
+		a, b string
+		res  int
+	}{
+		{"1", "1", 0},
+		{"1.2.3", "1.2.3", 0},
+		{"1", "2", -1},
+		{"2", "1", 1},
+		{"1.9", "1.10", -1},
+		{"1.10", "1.9", 1},
+		{"3.10.1", "3.9.12", 1},
+		{"1.2", "1.2.0", -1},
+		{"1.2.1", "1.2", 1},
+		{"1.2-beta", "1.2-rc", -1},
+		{"1.x", "1.x", 0},
+		{"1.x", "1.2", 1},
+		{"latest", "1", 1},
+	} {
+		assert.Equal(c.res, compareVersions(c.a, c.b), "%s <=> %s", c.a, c.b)
+	}
+}
+
+func TestRegistry_Get(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewRegistry(
+		Runtime{Name: "python", Version: "3.9"},
+		Runtime{Name: "python", Version: "3.10"},
+	)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(ErrRuntimeRegistered, r.Register(Runtime{Name: "python", Version: "3.9"}))
+
+	rt, err := r.Lookup("python")
+	assert.NoError(err)
+	assert.Equal("3.10", rt.Version)
+
+	rt, err = r.Lookup("python@3.9")
+	assert.NoError(err)
+	assert.Equal("3.9", rt.Version)
+
+	_, err = r.Lookup("python@2.7")
+	assert.Equal(ErrUnknownRuntime, err)
+}
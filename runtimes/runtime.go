@@ -0,0 +1,103 @@
+// Package runtimes provides a registry of function runtimes. A runtime
+// describes how nodes for a given language/runtime version are launched,
+// what they report during the registration handshake and which functions
+// they can execute
+package runtimes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/homebot/sigma"
+)
+
+// Runtime describes a function runtime (e.g. python3, node18, go or wasm)
+type Runtime struct {
+	// Name is the name of the runtime
+	Name string `json:"name" yaml:"name"`
+
+	// Version is the version of the runtime
+	Version string `json:"version" yaml:"version"`
+
+	// Command is the command used by the process launcher to start
+	// a node for this runtime
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+
+	// Image is the base image used by the docker launcher to start
+	// a node for this runtime
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+
+	// NodeType is the node type nodes of this runtime must report when
+	// registering. Defaults to Name
+	NodeType string `json:"nodeType,omitempty" yaml:"nodeType,omitempty"`
+
+	// Validation holds rules function specs must satisfy
+	Validation Validation `json:"validation" yaml:"validation"`
+}
+
+// Validation holds the validation rules of a runtime
+type Validation struct {
+	// RequireContent requires functions to provide inline content
+	// or an artifact
+	RequireContent bool `json:"requireContent" yaml:"requireContent"`
+
+	// MaxContentSize is the maximum size of inline content in bytes.
+	// Zero means unlimited
+	MaxContentSize int `json:"maxContentSize" yaml:"maxContentSize"`
+
+	// AllowArtifacts allows functions to reference artifacts
+	AllowArtifacts bool `json:"allowArtifacts" yaml:"allowArtifacts"`
+}
+
+// Key returns the unique key of the runtime in the form "name@version"
+func (r Runtime) Key() string {
+	return r.Name + "@" + r.Version
+}
+
+// ExpectedNodeType returns the node type nodes of this runtime report
+// during registration
+func (r Runtime) ExpectedNodeType() string {
+	if r.NodeType != "" {
+		return r.NodeType
+	}
+
+	return r.Name
+}
+
+// Validate checks if the function spec satisfies the runtime's validation
+// rules
+func (r Runtime) Validate(spec sigma.FunctionSpec) error {
+	v := r.Validation
+
+	if v.RequireContent && spec.Content == "" && spec.Artifact == "" {
+		return fmt.Errorf("runtime %s: function content required", r.Key())
+	}
+
+	if v.MaxContentSize > 0 && len(spec.Content) > v.MaxContentSize {
+		return fmt.Errorf("runtime %s: content exceeds %d bytes", r.Key(), v.MaxContentSize)
+	}
+
+	if !v.AllowArtifacts && spec.Artifact != "" {
+		return fmt.Errorf("runtime %s: artifacts not supported", r.Key())
+	}
+
+	return nil
+}
+
+// ParseReference parses a runtime reference in the form "name" or
+// "name@version"
+func ParseReference(ref string) (name string, version string, err error) {
+	parts := strings.SplitN(ref, "@", 2)
+
+	name = parts[0]
+	if name == "" {
+		return "", "", errors.New("invalid runtime reference")
+	}
+
+	if len(parts) == 2 {
+		version = parts[1]
+	}
+
+	return name, version, nil
+}
@@ -0,0 +1,53 @@
+package runtimes
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range []struct {
+		validation Validation
+		spec       sigma.FunctionSpec
+		valid      bool
+	}{
+		{Validation{}, sigma.FunctionSpec{}, true},
+		{Validation{RequireContent: true}, sigma.FunctionSpec{}, false},
+		{Validation{RequireContent: true}, sigma.FunctionSpec{Content: "code"}, true},
+		{Validation{RequireContent: true, AllowArtifacts: true}, sigma.FunctionSpec{Artifact: "sha256:abc"}, true},
+		{Validation{MaxContentSize: 4}, sigma.FunctionSpec{Content: "code"}, true},
+		{Validation{MaxContentSize: 4}, sigma.FunctionSpec{Content: "code!"}, false},
+		{Validation{}, sigma.FunctionSpec{Artifact: "sha256:abc"}, false},
+		{Validation{AllowArtifacts: true}, sigma.FunctionSpec{Artifact: "sha256:abc"}, true},
+	} {
+		rt := Runtime{Name: "python", Version: "3.10", Validation: c.validation}
+		err := rt.Validate(c.spec)
+
+		if c.valid {
+			assert.NoError(err, "case %d", i)
+		} else {
+			assert.Error(err, "case %d", i)
+		}
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	assert := assert.New(t)
+
+	name, version, err := ParseReference("python@3.10")
+	assert.NoError(err)
+	assert.Equal("python", name)
+	assert.Equal("3.10", version)
+
+	name, version, err = ParseReference("python")
+	assert.NoError(err)
+	assert.Equal("python", name)
+	assert.Equal("", version)
+
+	_, _, err = ParseReference("@3.10")
+	assert.Error(err)
+}
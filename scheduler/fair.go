@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fairQueue limits the number of concurrent dispatches and grants free
+// slots to waiting functions using weighted fair queuing. Each waiting
+// dispatch is tagged with a virtual finish time of
+//
+//	max(virtual time, finish time of the function's last dispatch) + 1/weight
+//
+// and slots are granted in order of the finish times so a function
+// flooding the dispatcher only delays its own dispatches
+type fairQueue struct {
+	mu      sync.Mutex
+	free    int
+	vtime   float64
+	finish  map[string]float64
+	waiting waiters
+	seq     uint64
+}
+
+func newFairQueue(concurrency int) *fairQueue {
+	return &fairQueue{
+		free:   concurrency,
+		finish: make(map[string]float64),
+	}
+}
+
+// acquire blocks until a dispatch slot has been granted to fn and returns
+// the time spent waiting. Slots must be returned using release
+func (q *fairQueue) acquire(ctx context.Context, fn string, weight int) (time.Duration, error) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	q.mu.Lock()
+	if q.free > 0 && len(q.waiting) == 0 {
+		q.free--
+		q.mu.Unlock()
+		return 0, nil
+	}
+
+	start := q.finish[fn]
+	if start < q.vtime {
+		start = q.vtime
+	}
+
+	q.seq++
+	w := &waiter{
+		fn:    fn,
+		tag:   start + 1/float64(weight),
+		seq:   q.seq,
+		ready: make(chan struct{}),
+	}
+	q.finish[fn] = w.tag
+	heap.Push(&q.waiting, w)
+	q.mu.Unlock()
+
+	queued := time.Now()
+
+	select {
+	case <-w.ready:
+		return time.Since(queued), nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if w.index >= 0 {
+		heap.Remove(&q.waiting, w.index)
+	} else {
+		// the slot has been granted concurrently, pass it on
+		q.releaseLocked()
+	}
+
+	return time.Since(queued), ctx.Err()
+}
+
+// queued returns the number of dispatches of fn waiting for a slot
+func (q *fairQueue) queued(fn string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, w := range q.waiting {
+		if w.fn == fn {
+			n++
+		}
+	}
+	return n
+}
+
+// release returns a dispatch slot
+func (q *fairQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.releaseLocked()
+}
+
+func (q *fairQueue) releaseLocked() {
+	if len(q.waiting) == 0 {
+		q.free++
+
+		// all functions are served, forget their history
+		if q.vtime > 0 {
+			q.vtime = 0
+			q.finish = make(map[string]float64)
+		}
+		return
+	}
+
+	w := heap.Pop(&q.waiting).(*waiter)
+	q.vtime = w.tag
+	close(w.ready)
+}
+
+type waiter struct {
+	fn    string
+	tag   float64
+	seq   uint64
+	index int
+	ready chan struct{}
+}
+
+// waiters is a min-heap of waiters ordered by virtual finish time
+type waiters []*waiter
+
+func (w waiters) Len() int { return len(w) }
+
+func (w waiters) Less(i, j int) bool {
+	if w[i].tag == w[j].tag {
+		return w[i].seq < w[j].seq
+	}
+	return w[i].tag < w[j].tag
+}
+
+func (w waiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index = i
+	w[j].index = j
+}
+
+func (w *waiters) Push(x interface{}) {
+	e := x.(*waiter)
+	e.index = len(*w)
+	*w = append(*w, e)
+}
+
+func (w *waiters) Pop() interface{} {
+	old := *w
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*w = old[:n-1]
+	return e
+}
@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newFairQueue(1)
+
+	// occupy the only slot
+	_, err := q.acquire(context.Background(), "busy", 1)
+	assert.NoError(err)
+
+	order := make(chan string, 5)
+	queued := 0
+	enqueue := func(fn string) {
+		go func() {
+			if _, err := q.acquire(context.Background(), fn, 1); err == nil {
+				order <- fn
+				q.release()
+			}
+		}()
+
+		// make sure waiters are queued in order
+		queued++
+		for i := 0; i < 1000; i++ {
+			q.mu.Lock()
+			n := len(q.waiting)
+			q.mu.Unlock()
+			if n == queued {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// a chatty function queues several dispatches before a quiet one
+	for i := 0; i < 4; i++ {
+		enqueue("chatty")
+	}
+	enqueue("quiet")
+
+	q.release()
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		got = append(got, <-order)
+	}
+
+	// the quiet function is served after the first dispatch of the chatty
+	// one instead of waiting for all of them
+	assert.Equal([]string{"chatty", "quiet", "chatty", "chatty", "chatty"}, got)
+}
+
+func TestFairQueue_Cancel(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newFairQueue(1)
+	_, err := q.acquire(context.Background(), "a", 1)
+	assert.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = q.acquire(ctx, "b", 1)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	q.release()
+	assert.Equal(1, q.free)
+	assert.Len(q.waiting, 0)
+}
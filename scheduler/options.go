@@ -1,8 +1,14 @@
 package scheduler
 
 import (
+	"errors"
+	"time"
+
 	"github.com/homebot/core/resource"
 	"github.com/homebot/insight/logger"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/quota"
+	"github.com/homebot/sigma/signature"
 )
 
 // Option is a Scheduler option
@@ -30,3 +36,89 @@ func WithLogger(l logger.Logger) Option {
 		return nil
 	}
 }
+
+// WithDispatchConcurrency limits the number of concurrent dispatches to n.
+// Once saturated, free slots are shared between functions according to
+// their weight. Zero disables the limit
+func WithDispatchConcurrency(n int) Option {
+	return func(s *scheduler) error {
+		if n > 0 {
+			s.fair = newFairQueue(n)
+		}
+		return nil
+	}
+}
+
+// WithMaxChainDepth limits the number of functions an event chain may pass
+// through, e.g. functions invoking other functions using the ID of the
+// event they are handling. Events exceeding the limit are rejected.
+// Zero disables the limit
+func WithMaxChainDepth(n int) Option {
+	return func(s *scheduler) error {
+		s.maxChainDepth = n
+		return nil
+	}
+}
+
+// WithDeadLetter dispatches events rejected due to the chain depth to the
+// function fn instead of dropping them
+func WithDeadLetter(fn string) Option {
+	return func(s *scheduler) error {
+		s.deadLetter = fn
+		return nil
+	}
+}
+
+// WithQuotas configures the quota manager used to limit the number of
+// functions per namespace
+func WithQuotas(m *quota.Manager) Option {
+	return func(s *scheduler) error {
+		s.quotas = m
+		return nil
+	}
+}
+
+// WithEventBufferDir enables store-and-forward buffering of trigger events
+// for unreachable functions. Events are persisted in dir and at most max
+// events are buffered per function (zero means unlimited)
+func WithEventBufferDir(dir string, max int) Option {
+	return func(s *scheduler) error {
+		s.bufferDir = dir
+		s.bufferMaxEvents = max
+		return nil
+	}
+}
+
+// WithRetention keeps destroyed functions for d so they can be restored.
+// Their records are purged and their artifacts become unreferenced once
+// the retention window expires. With zero retention destroyed functions
+// cannot be restored but their buffered events are kept and delivered if
+// the function is created again
+func WithRetention(d time.Duration) Option {
+	return func(s *scheduler) error {
+		if d < 0 {
+			return errors.New("negative retention")
+		}
+		s.retention = d
+		return nil
+	}
+}
+
+// WithAuthorizer configures the authorizer for trigger events and events
+// routed between functions
+func WithAuthorizer(a authz.Authorizer) Option {
+	return func(s *scheduler) error {
+		s.authorizer = a
+		return nil
+	}
+}
+
+// WithSignatureVerifier configures the verifier used to check function
+// signatures when functions are created or updated. Unsigned functions are
+// rejected
+func WithSignatureVerifier(v *signature.Verifier) Option {
+	return func(s *scheduler) error {
+		s.verifier = v
+		return nil
+	}
+}
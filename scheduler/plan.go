@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+)
+
+// Plan describes the changes applying a function spec makes
+type Plan struct {
+	// Function holds the ID of the function
+	Function string `json:"function"`
+
+	// Create is true if the function does not exist yet
+	Create bool `json:"create,omitempty"`
+
+	// Changes holds the changed fields of the spec
+	Changes []sigma.SpecChange `json:"changes,omitempty"`
+
+	// Triggers holds the added, removed and changed triggers
+	Triggers []sigma.TriggerChange `json:"triggers,omitempty"`
+
+	// Restart is true if all nodes are replaced using a rolling update
+	Restart bool `json:"restart,omitempty"`
+
+	// Recreate is true if some changes are only applied once the
+	// function is destroyed and created again. Such plans cannot be
+	// applied
+	Recreate bool `json:"recreate,omitempty"`
+
+	// Applied is true if the plan has been applied
+	Applied bool `json:"applied"`
+}
+
+// Empty returns true if applying the plan does not change anything
+func (p Plan) Empty() bool {
+	return !p.Create && len(p.Changes) == 0
+}
+
+// Apply diffs spec against the registered function and returns the
+// change plan. Unless dryRun is set the plan is applied by creating or
+// updating the function
+func (s *scheduler) Apply(ctx context.Context, spec sigma.FunctionSpec, dryRun bool) (Plan, error) {
+	plan := Plan{
+		Function: spec.ID,
+	}
+
+	s.mu.Lock()
+	ctrl, ok := s.controllers[spec.ID]
+	s.mu.Unlock()
+
+	if !ok {
+		plan.Create = true
+	} else {
+		current := ctrl.FunctionSpec()
+
+		changes, err := sigma.DiffSpecs(current, spec)
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Changes = changes
+		plan.Triggers = sigma.DiffTriggers(current.Triggers, spec.Triggers)
+		plan.Restart = sigma.NeedsRestart(changes)
+
+		for _, c := range changes {
+			if c.Effect == sigma.EffectRecreate {
+				plan.Recreate = true
+			}
+		}
+	}
+
+	if dryRun || plan.Empty() {
+		return plan, nil
+	}
+
+	var err error
+	if plan.Create {
+		_, err = s.Create(ctx, spec)
+	} else {
+		err = s.Update(ctx, spec)
+	}
+
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Applied = true
+
+	return plan, nil
+}
@@ -2,6 +2,8 @@ package scheduler
 
 import (
 	"errors"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,9 +15,30 @@ import (
 	"github.com/homebot/core/resource"
 	"github.com/homebot/insight/logger"
 	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/capture"
 	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/metrics"
 	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/quota"
+	"github.com/homebot/sigma/signature"
 	"github.com/homebot/sigma/trigger"
+	"github.com/homebot/sigma/trigger/buffer"
+	"github.com/homebot/sigma/urn"
+)
+
+var (
+	// ErrUnknownFunction is returned if the function in question is not
+	// registered at the scheduler
+	ErrUnknownFunction = errors.New("unknown function")
+
+	// ErrFunctionExists is returned by Create if a function with the
+	// same ID is already registered
+	ErrFunctionExists = errors.New("function already created")
+
+	// ErrChainDepthExceeded is returned by Dispatch if the event has
+	// passed through more functions than allowed
+	ErrChainDepthExceeded = errors.New("maximum chain depth exceeded")
 )
 
 // NodeInstance describes a node instance
@@ -40,6 +63,14 @@ type FunctionRegistration struct {
 
 	// Nodes holds a list of nodes baking the function
 	Nodes []NodeInstance
+
+	// QueueDepth holds the number of events waiting to be dispatched to
+	// the function, either buffered or waiting for a dispatch slot
+	QueueDepth int
+
+	// Paused is set while the function is paused or within a
+	// maintenance window
+	Paused *function.Pause
 }
 
 // Scheduler creates, manages and destroys function controllers
@@ -49,9 +80,33 @@ type Scheduler interface {
 	// Create creates a new function controller for the spec
 	Create(context.Context, sigma.FunctionSpec) (string, error)
 
-	// Destroy destroys the function controller for the URN
+	// Update updates the spec of an existing function. Nodes are replaced
+	// using a rolling restart if the change requires a restart
+	Update(context.Context, sigma.FunctionSpec) error
+
+	// Apply returns the change plan for a spec and, unless dry-run is
+	// set, applies it by creating or updating the function
+	Apply(ctx context.Context, spec sigma.FunctionSpec, dryRun bool) (Plan, error)
+
+	// Destroy destroys the function controller for the URN. If a
+	// retention window is configured the function can be restored until
+	// it expires
 	Destroy(context.Context, string) error
 
+	// Restore restores a destroyed function within its retention window
+	Restore(context.Context, string) (string, error)
+
+	// Purge purges a destroyed function before its retention window
+	// expires
+	Purge(context.Context, string) error
+
+	// Deleted returns the destroyed functions that can still be restored
+	Deleted(context.Context) ([]DeletedFunction, error)
+
+	// Bury records a destroyed function so it can be restored until it
+	// expires, e.g. when restoring a snapshot
+	Bury(context.Context, DeletedFunction) error
+
 	// Dispatch dispatches an event to a function and returns the result
 	Dispatch(context.Context, string, sigma.Event) (string, []byte, error)
 
@@ -61,6 +116,24 @@ type Scheduler interface {
 	// Inspec inspects a function and returns details and statistics about
 	// the function controller
 	Inspect(context.Context, resource.Name) (FunctionRegistration, error)
+
+	// Captures returns the captured invocations of a function
+	Captures(context.Context, string) ([]capture.Record, error)
+
+	// Attach puts a node of a function into debug mode
+	Attach(ctx context.Context, function, node string, timeout time.Duration) (function.DebugSession, error)
+
+	// Detach ends the debug session of a node
+	Detach(ctx context.Context, function, node string) error
+
+	// DebugSessions returns the debug sessions of a function
+	DebugSessions(ctx context.Context, function string) ([]function.DebugSession, error)
+
+	// Pause pauses a function until it is resumed
+	Pause(ctx context.Context, function string, p function.Pause) error
+
+	// Resume resumes a paused function
+	Resume(ctx context.Context, function string) error
 }
 
 type scheduler struct {
@@ -70,8 +143,42 @@ type scheduler struct {
 
 	log logger.Logger
 
+	// bufferDir is the directory used to persist trigger events of
+	// unreachable functions. Buffering is disabled if empty
+	bufferDir       string
+	bufferMaxEvents int
+
+	// fair limits concurrent dispatches and shares them between
+	// functions. Nil if unlimited
+	fair *fairQueue
+
+	// maxChainDepth limits the number of functions an event chain may
+	// pass through. Zero means unlimited
+	maxChainDepth int
+
+	// deadLetter is the function receiving events rejected due to the
+	// chain depth. Rejected events are dropped if empty
+	deadLetter string
+
+	// quotas limits the number of functions per namespace. Nil if
+	// unlimited
+	quotas *quota.Manager
+
+	// authorizer authorizes trigger events and events routed between
+	// functions, may be nil
+	authorizer authz.Authorizer
+
+	// retention is the time destroyed functions can be restored. Zero
+	// disables restoring functions
+	retention time.Duration
+
+	// verifier verifies function signatures, may be nil
+	verifier *signature.Verifier
+
 	mu          sync.Mutex
 	controllers map[string]function.Controller
+	buffers     map[string]buffer.Buffer
+	deleted     map[string]*tombstone
 }
 
 func (s *scheduler) Name() resource.Name {
@@ -85,6 +192,8 @@ func NewScheduler(d node.Deployer, opts ...Option) (Scheduler, error) {
 		id:          resource.Name(uuid.NewV4().String()),
 		deployer:    d,
 		controllers: make(map[string]function.Controller),
+		buffers:     make(map[string]buffer.Buffer),
+		deleted:     make(map[string]*tombstone),
 	}
 
 	for _, fn := range opts {
@@ -127,35 +236,187 @@ func (s *scheduler) Functions(ctx context.Context) ([]FunctionRegistration, erro
 	return res, nil
 }
 
+// Captures returns the captured invocations of the function u
+func (s *scheduler) Captures(ctx context.Context, u string) ([]capture.Record, error) {
+	s.mu.Lock()
+	ctrl, ok := s.controllers[u]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, ErrUnknownFunction
+	}
+
+	return ctrl.Captures(), nil
+}
+
+// controller returns the function controller for u
+func (s *scheduler) controller(u string) (function.Controller, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctrl, ok := s.controllers[u]
+	if !ok {
+		return nil, ErrUnknownFunction
+	}
+	return ctrl, nil
+}
+
+// Attach puts the node of function u into debug mode
+func (s *scheduler) Attach(ctx context.Context, u, node string, timeout time.Duration) (function.DebugSession, error) {
+	ctrl, err := s.controller(u)
+	if err != nil {
+		return function.DebugSession{}, err
+	}
+
+	return ctrl.Attach(node, timeout)
+}
+
+// Detach ends the debug session of the node of function u
+func (s *scheduler) Detach(ctx context.Context, u, node string) error {
+	ctrl, err := s.controller(u)
+	if err != nil {
+		return err
+	}
+
+	return ctrl.Detach(node)
+}
+
+// DebugSessions returns the debug sessions of function u
+func (s *scheduler) DebugSessions(ctx context.Context, u string) ([]function.DebugSession, error) {
+	ctrl, err := s.controller(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctrl.DebugSessions(), nil
+}
+
+// Pause pauses function u. Trigger events are buffered if requested and
+// event buffering is enabled
+func (s *scheduler) Pause(ctx context.Context, u string, p function.Pause) error {
+	ctrl, err := s.controller(u)
+	if err != nil {
+		return err
+	}
+
+	if p.Buffer && s.bufferDir == "" {
+		s.log.WithResource(u).Warnf("event buffering disabled, trigger events are dropped while paused")
+	}
+
+	return ctrl.Pause(p)
+}
+
+// Resume resumes the paused function u
+func (s *scheduler) Resume(ctx context.Context, u string) error {
+	ctrl, err := s.controller(u)
+	if err != nil {
+		return err
+	}
+
+	return ctrl.Resume()
+}
+
 // Create registeres a new function spec at the scheduler
 func (s *scheduler) Create(ctx context.Context, spec sigma.FunctionSpec) (string, error) {
 	u := ""
 
+	// self is set to the controller once it has been created
+	var self function.Controller
+
 	opts := []function.ControllerOption{
 		function.WithScalingPolicies(spec.Policies),
 		function.WithEventDispatcher(event.NewNopDispatcher(true)),
 		function.WithControlLoopInterval(10 * time.Second),
 		function.WithDeployer(s.deployer),
 		function.WithTriggerBuilder(trigger.DefaultBuilder),
+		function.WithEventRouter(func(fn string, e sigma.Event) error {
+			if s.authorizer != nil {
+				// routed events are authorized on behalf of the routing function
+				if err := s.authorizer.Authorize(context.Background(), authz.Request{
+					Identity: spec.ID,
+					Function: fn,
+					Event:    e,
+				}); err != nil {
+					return err
+				}
+			}
+
+			_, _, err := s.Dispatch(context.Background(), fn, e)
+			return err
+		}),
+		// trigger events are subject to fair queuing and the chain depth
+		// like any other event. They are dispatched to the controller
+		// itself as it is removed from the scheduler before being stopped
+		function.WithTriggerDispatcher(func(e sigma.Event) (string, []byte, error) {
+			return s.dispatch(context.Background(), spec.ID, self, e)
+		}),
+	}
+
+	if s.authorizer != nil {
+		opts = append(opts, function.WithAuthorizer(s.authorizer))
 	}
 
 	log := s.log.WithResource(spec.ID)
 
-	ctrl, err := function.NewController(spec, opts...)
-	if err != nil {
-		log.Errorf("failed to create controller")
+	// node URNs are derived from the function ID so it must be valid
+	// before any node is deployed
+	if err := urn.Validate(urn.ForFunction(spec.ID)); err != nil {
+		log.Errorf("invalid function ID: %s", err)
+		return u, err
+	}
+
+	if err := s.verify(spec); err != nil {
+		log.Errorf("failed to verify function signature: %s", err)
 		return u, err
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_, ok := s.controllers[ctrl.Name().String()]
-	if ok {
+	if _, ok := s.controllers[spec.ID]; ok {
 		log.Errorf("function already created")
-		return ctrl.Name().String(), errors.New("function already created")
+		return spec.ID, ErrFunctionExists
 	}
 
+	if err := s.quotas.AddFunction(spec.ID); err != nil {
+		log.Errorf("failed to create function: %s", err)
+		return u, err
+	}
+
+	var buf buffer.Buffer
+	if s.bufferDir != "" {
+		var err error
+		buf, err = buffer.OpenFile(s.bufferPath(spec.ID), s.bufferMaxEvents)
+		if err != nil {
+			log.Errorf("failed to open event buffer: %s", err)
+			s.quotas.RemoveFunction(spec.ID)
+			return u, err
+		}
+
+		opts = append(opts, function.WithEventBuffer(buf))
+	}
+
+	ctrl, err := function.NewController(spec, opts...)
+	if err != nil {
+		log.Errorf("failed to create controller")
+		if buf != nil {
+			buf.Close()
+		}
+		s.quotas.RemoveFunction(spec.ID)
+		return u, err
+	}
+	self = ctrl
+
 	s.controllers[ctrl.Name().String()] = ctrl
+	if buf != nil {
+		s.buffers[ctrl.Name().String()] = buf
+	}
+
+	// re-creating a deleted function supersedes its tombstone
+	if t, ok := s.deleted[spec.ID]; ok {
+		t.timer.Stop()
+		delete(s.deleted, spec.ID)
+	}
+
 	if err := ctrl.Start(); err != nil {
 		log.Errorf("failed to start controller")
 		return u, err
@@ -165,23 +426,90 @@ func (s *scheduler) Create(ctx context.Context, spec sigma.FunctionSpec) (string
 	return ctrl.Name().String(), nil
 }
 
-// Destroy destroys the function controller and all nodes
+// verify verifies the signature of spec if a verifier is configured
+func (s *scheduler) verify(spec sigma.FunctionSpec) error {
+	if s.verifier == nil {
+		return nil
+	}
+
+	return s.verifier.Verify(spec)
+}
+
+// Update updates the spec of an existing function. Unchanged specs are
+// ignored
+func (s *scheduler) Update(ctx context.Context, spec sigma.FunctionSpec) error {
+	log := s.log.WithResource(spec.ID)
+
+	s.mu.Lock()
+	ctrl, ok := s.controllers[spec.ID]
+	s.mu.Unlock()
+
+	if !ok {
+		log.Errorf("unknown function")
+		return ErrUnknownFunction
+	}
+
+	if err := s.verify(spec); err != nil {
+		log.Errorf("failed to verify function signature: %s", err)
+		return err
+	}
+
+	if reflect.DeepEqual(ctrl.FunctionSpec(), spec) {
+		log.Infof("function spec unchanged")
+		return nil
+	}
+
+	if err := ctrl.Update(spec); err != nil {
+		log.Errorf("failed to update function: %s", err)
+		return err
+	}
+
+	log.Infof("function updated")
+	return nil
+}
+
+// Destroy destroys the function controller and all nodes. The spec is
+// kept for the retention window, if any. Buffered events are only removed
+// once the retention window expires or the function is purged
 func (s *scheduler) Destroy(ctx context.Context, u string) error {
 	log := s.log.WithResource(u)
 
 	s.mu.Lock()
 	ctrl, ok := s.controllers[u]
+	buf := s.buffers[u]
 	delete(s.controllers, u)
+	delete(s.buffers, u)
 	s.mu.Unlock()
 
 	if !ok {
 		log.Errorf("unknown function")
-		return errors.New("unknown function")
+		return ErrUnknownFunction
 	}
 
+	s.quotas.RemoveFunction(u)
+
 	if err := ctrl.Stop(); err != nil {
 		log.Errorf("failed to stop function controller: %s", err)
 	}
+
+	if buf != nil {
+		if err := buf.Close(); err != nil {
+			log.Errorf("failed to close event buffer: %s", err)
+		}
+	}
+
+	if s.retention > 0 {
+		now := time.Now()
+
+		s.mu.Lock()
+		s.bury(DeletedFunction{
+			Spec:    ctrl.FunctionSpec(),
+			Deleted: now,
+			Expires: now.Add(s.retention),
+		})
+		s.mu.Unlock()
+	}
+
 	if err := ctrl.DestroyAll(); err != nil {
 		log.Errorf("failed to destroy function nodes: %s", err)
 		return err
@@ -203,7 +531,32 @@ func (s *scheduler) Dispatch(ctx context.Context, u string, event sigma.Event) (
 
 	if !ok {
 		log.Errorf("unknown function")
-		return "", nil, errors.New("unknown function")
+		return "", nil, ErrUnknownFunction
+	}
+
+	return s.dispatch(ctx, u, ctrl, event)
+}
+
+// dispatch dispatches event to the function controller ctrl of u
+func (s *scheduler) dispatch(ctx context.Context, u string, ctrl function.Controller, event sigma.Event) (string, []byte, error) {
+	log := s.log.WithResource(u)
+
+	md := sigma.EventMetadata(event)
+	if s.maxChainDepth > 0 && md.Hops() >= s.maxChainDepth {
+		s.rejectChain(u, event)
+		return "", nil, ErrChainDepthExceeded
+	}
+	event = sigma.NewEventWithMetadata(event.Type(), event.Payload(), md.Hop(u))
+
+	if s.fair != nil {
+		delay, err := s.fair.acquire(ctx, u, ctrl.FunctionSpec().Weight)
+		metrics.Add("scheduler.delay_us."+u, int64(delay/time.Microsecond))
+		metrics.Inc("scheduler.dispatches." + u)
+		if err != nil {
+			log.Errorf("dispatch not scheduled: %s", err)
+			return "", nil, err
+		}
+		defer s.fair.release()
 	}
 
 	start := time.Now()
@@ -220,6 +573,41 @@ func (s *scheduler) Dispatch(ctx context.Context, u string, event sigma.Event) (
 	return node, res, err
 }
 
+// rejectChain records an event that exceeded the maximum chain depth and
+// forwards it to the dead-letter function, if any
+func (s *scheduler) rejectChain(u string, event sigma.Event) {
+	md := sigma.EventMetadata(event)
+
+	chain := md.Cycle(u)
+	if chain == nil {
+		chain = append(md.Lineage(), u)
+	}
+
+	metrics.Inc("scheduler.loops." + strings.Join(chain, ">"))
+	s.log.WithResource(u).Errorf("rejected event after %d hops: %s", md.Hops(), strings.Join(chain, " -> "))
+
+	if s.deadLetter == "" || s.deadLetter == u {
+		return
+	}
+
+	s.mu.Lock()
+	ctrl, ok := s.controllers[s.deadLetter]
+	s.mu.Unlock()
+
+	if !ok {
+		s.log.WithResource(s.deadLetter).Errorf("dead-letter function does not exist")
+		return
+	}
+
+	dead := md.Copy()
+	dead[sigma.MetadataDeadLetter] = u
+
+	// dead-lettered events bypass the chain depth check
+	if _, _, err := ctrl.Dispatch(sigma.NewEventWithMetadata(event.Type(), event.Payload(), dead)); err != nil {
+		s.log.WithResource(s.deadLetter).Errorf("failed to dead-letter event: %s", err)
+	}
+}
+
 func (s *scheduler) inspect(ctx context.Context, u resource.Name) (FunctionRegistration, error) {
 	reg := FunctionRegistration{
 		Name: u,
@@ -227,7 +615,7 @@ func (s *scheduler) inspect(ctx context.Context, u resource.Name) (FunctionRegis
 
 	ctrl, ok := s.controllers[u.String()]
 	if !ok {
-		return reg, errors.New("unknown function")
+		return reg, ErrUnknownFunction
 	}
 
 	states := ctrl.Nodes()
@@ -244,6 +632,15 @@ func (s *scheduler) inspect(ctx context.Context, u resource.Name) (FunctionRegis
 	}
 
 	reg.Spec = ctrl.FunctionSpec()
+	reg.Paused = ctrl.Paused()
+
+	if b, ok := s.buffers[u.String()]; ok {
+		reg.QueueDepth += b.Len()
+	}
+
+	if s.fair != nil {
+		reg.QueueDepth += s.fair.queued(u.String())
+	}
 
 	return reg, nil
 }
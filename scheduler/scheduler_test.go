@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/signature"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScheduler(t *testing.T, opts ...Option) *scheduler {
+	s, err := NewScheduler(node.DeployFunc(func(context.Context, string, sigma.FunctionSpec) (node.Controller, error) {
+		return nil, errors.New("not supported")
+	}), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.(*scheduler)
+}
+
+func TestUpdate_Recreate(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestScheduler(t)
+
+	spec := sigma.FunctionSpec{ID: "fn", Type: "js"}
+
+	_, err := s.Create(context.Background(), spec)
+	assert.NoError(err)
+	defer s.Destroy(context.Background(), "fn")
+
+	_, err = s.Create(context.Background(), spec)
+	assert.Equal(ErrFunctionExists, err)
+
+	// node URNs cannot be derived from invalid IDs
+	_, err = s.Create(context.Background(), sigma.FunctionSpec{ID: "acme/functions/bad:id", Type: "js"})
+	assert.Error(err)
+
+	// triggers are only built when the function is created
+	changed := spec
+	changed.Triggers = []sigma.TriggerSpec{{Type: "cron"}}
+	assert.Equal(function.ErrRecreateRequired, s.Update(context.Background(), changed))
+
+	plan, err := s.Apply(context.Background(), changed, false)
+	assert.Equal(function.ErrRecreateRequired, err)
+	assert.True(plan.Recreate)
+	assert.False(plan.Applied)
+
+	// the stored spec still matches the running function
+	plan, err = s.Apply(context.Background(), changed, true)
+	assert.NoError(err)
+	assert.True(plan.Recreate)
+}
+
+func TestDestroy_Retention(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sigma-buffers-")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	exists := func(s *scheduler, u string) bool {
+		_, err := os.Stat(s.bufferPath(u))
+		return err == nil
+	}
+
+	spec := sigma.FunctionSpec{ID: "fn", Type: "js"}
+
+	// without retention buffered events are kept for the next function
+	// with the same ID
+	s := newTestScheduler(t, WithEventBufferDir(dir, 0))
+	_, err = s.Create(context.Background(), spec)
+	assert.NoError(err)
+	assert.NoError(s.Destroy(context.Background(), "fn"))
+	assert.True(exists(s, "fn"))
+	assert.Equal(ErrNotDeleted, s.Purge(context.Background(), "fn"))
+
+	// with retention the buffer is removed once the function is purged
+	s = newTestScheduler(t, WithEventBufferDir(dir, 0), WithRetention(time.Hour))
+	_, err = s.Create(context.Background(), spec)
+	assert.NoError(err)
+	assert.NoError(s.Destroy(context.Background(), "fn"))
+	assert.True(exists(s, "fn"))
+
+	deleted, err := s.Deleted(context.Background())
+	assert.NoError(err)
+	if assert.Len(deleted, 1) {
+		assert.Equal(spec, deleted[0].Spec)
+	}
+
+	assert.NoError(s.Purge(context.Background(), "fn"))
+	assert.False(exists(s, "fn"))
+
+	// restored tombstones expire at their original time
+	_, err = s.Create(context.Background(), spec)
+	assert.NoError(err)
+	assert.Equal(ErrFunctionExists, s.Bury(context.Background(), DeletedFunction{Spec: spec}))
+	assert.NoError(s.Destroy(context.Background(), "fn"))
+
+	assert.NoError(s.Bury(context.Background(), DeletedFunction{Spec: spec, Expires: time.Now()}))
+	for i := 0; i < 100 && exists(s, "fn"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(exists(s, "fn"))
+
+	deleted, err = s.Deleted(context.Background())
+	assert.NoError(err)
+	assert.Empty(deleted)
+}
+
+func TestSignatures(t *testing.T) {
+	assert := assert.New(t)
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	s := newTestScheduler(t, WithSignatureVerifier(signature.NewVerifier(map[string]ed25519.PublicKey{"k1": pub})))
+
+	spec := sigma.FunctionSpec{ID: "fn", Type: "js", Content: "v1"}
+
+	_, err = s.Create(context.Background(), spec)
+	assert.Equal(signature.ErrUnsigned, err)
+
+	spec.Signature = signature.Sign(key, spec)
+	_, err = s.Create(context.Background(), spec)
+	assert.NoError(err)
+	defer s.Destroy(context.Background(), "fn")
+
+	// updated content must be signed again
+	spec.Content = "v2"
+	assert.Equal(signature.ErrInvalidSignature, s.Update(context.Background(), spec))
+
+	_, err = s.Apply(context.Background(), spec, false)
+	assert.Equal(signature.ErrInvalidSignature, err)
+
+	spec.Signature = signature.Sign(key, spec)
+	assert.NoError(s.Update(context.Background(), spec))
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+)
+
+// ErrNotDeleted is returned by Restore and Purge if the function has not
+// been deleted or its retention window expired
+var ErrNotDeleted = errors.New("function not deleted")
+
+// DeletedFunction describes a function that has been destroyed but can
+// still be restored
+type DeletedFunction struct {
+	// Spec holds the function specification at the time of deletion
+	Spec sigma.FunctionSpec `json:"spec"`
+
+	// Deleted is the time the function has been destroyed
+	Deleted time.Time `json:"deleted"`
+
+	// Expires is the time the function is purged and can no longer be
+	// restored
+	Expires time.Time `json:"expires"`
+}
+
+// tombstone holds a deleted function until its retention window expires
+type tombstone struct {
+	DeletedFunction
+
+	timer *time.Timer
+}
+
+// bufferPath returns the path of the event buffer of function u
+func (s *scheduler) bufferPath(u string) string {
+	return filepath.Join(s.bufferDir, url.PathEscape(u)+".queue")
+}
+
+// bury keeps the spec of a destroyed function until df expires. Must be
+// called with s.mu held
+func (s *scheduler) bury(df DeletedFunction) {
+	id := df.Spec.ID
+
+	if old, ok := s.deleted[id]; ok {
+		old.timer.Stop()
+	}
+
+	t := &tombstone{
+		DeletedFunction: df,
+	}
+
+	t.timer = time.AfterFunc(time.Until(df.Expires), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// the function may have been restored and deleted again
+		// in the meantime
+		if s.deleted[id] == t {
+			s.purge(id)
+		}
+	})
+
+	s.deleted[id] = t
+}
+
+// Bury records the destroyed function df so it can be restored until
+// df.Expires. Functions that already expired are purged
+func (s *scheduler) Bury(ctx context.Context, df DeletedFunction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.controllers[df.Spec.ID]; ok {
+		return ErrFunctionExists
+	}
+
+	s.bury(df)
+
+	return nil
+}
+
+// purge drops the tombstone and the records of function u. Artifacts
+// are no longer referenced afterwards and are garbage collected by the
+// artifact store. Must be called with s.mu held
+func (s *scheduler) purge(u string) {
+	if t, ok := s.deleted[u]; ok {
+		t.timer.Stop()
+		delete(s.deleted, u)
+	}
+
+	if s.bufferDir != "" {
+		if err := os.Remove(s.bufferPath(u)); err != nil && !os.IsNotExist(err) {
+			s.log.WithResource(u).Errorf("failed to remove event buffer: %s", err)
+		}
+	}
+
+	s.log.WithResource(u).Infof("function purged")
+}
+
+// Deleted returns the functions that have been destroyed but are still
+// within their retention window
+func (s *scheduler) Deleted(ctx context.Context) ([]DeletedFunction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []DeletedFunction
+	for _, t := range s.deleted {
+		res = append(res, t.DeletedFunction)
+	}
+
+	return res, nil
+}
+
+// Restore re-creates a deleted function from the spec it had when it was
+// destroyed. Events buffered for the function are kept and delivered
+// once it is reachable again
+func (s *scheduler) Restore(ctx context.Context, u string) (string, error) {
+	s.mu.Lock()
+	t, ok := s.deleted[u]
+	s.mu.Unlock()
+
+	if !ok {
+		return "", ErrNotDeleted
+	}
+
+	// Create drops the tombstone once the function is registered again
+	// and keeps it if creating fails
+	name, err := s.Create(ctx, t.Spec)
+	if err != nil {
+		return "", err
+	}
+
+	s.log.WithResource(u).Infof("function restored")
+
+	return name, nil
+}
+
+// Purge purges a deleted function before its retention window expires
+func (s *scheduler) Purge(ctx context.Context, u string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deleted[u]; !ok {
+		return ErrNotDeleted
+	}
+
+	s.purge(u)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package sigma
+
+// Seccomp profile names with a special meaning. Other names reference
+// profiles configured at the launcher
+const (
+	// SeccompDefault applies the default profile of the container
+	// runtime
+	SeccompDefault = ""
+
+	// SeccompUnconfined disables seccomp filtering. Launchers only accept
+	// it if allowed by the operator
+	SeccompUnconfined = "unconfined"
+)
+
+// SecurityProfile restricts the privileges of function nodes so untrusted
+// functions can be run with least privilege. Launchers that cannot apply
+// a setting of the profile must refuse to create the instance
+type SecurityProfile struct {
+	// Seccomp selects the seccomp profile of nodes. See SeccompDefault
+	// and SeccompUnconfined
+	Seccomp string `json:"seccomp,omitempty" yaml:"seccomp,omitempty"`
+
+	// AppArmor holds the name of the AppArmor profile nodes are
+	// confined by. The profile must be loaded on the host and allowed
+	// by the launcher
+	AppArmor string `json:"apparmor,omitempty" yaml:"apparmor,omitempty"`
+
+	// SELinux holds the SELinux label of nodes in the form
+	// "user:<user>", "role:<role>", "type:<type>" or "level:<level>".
+	// Labels must be allowed by the launcher
+	SELinux []string `json:"selinux,omitempty" yaml:"selinux,omitempty"`
+
+	// ReadOnlyRootFS mounts the root filesystem of nodes read-only.
+	// Scratch volumes stay writable
+	ReadOnlyRootFS bool `json:"readOnlyRootFS,omitempty" yaml:"readOnlyRootFS,omitempty"`
+
+	// NoNewPrivileges prevents nodes from gaining privileges, e.g.
+	// using setuid binaries
+	NoNewPrivileges bool `json:"noNewPrivileges,omitempty" yaml:"noNewPrivileges,omitempty"`
+}
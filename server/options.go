@@ -1,6 +1,12 @@
 package server
 
-import "github.com/homebot/idam/token"
+import (
+	"golang.org/x/net/context"
+
+	"github.com/homebot/idam/token"
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/authz"
+)
 
 // Option is a server option
 type Option func(s *Server) error
@@ -13,3 +19,22 @@ func WithIdamKeyProvider(f token.KeyProviderFunc) Option {
 		return nil
 	}
 }
+
+// WithAuthorizer configures the authorizer evaluated for every
+// invocation. If not set, all invocations are allowed
+func WithAuthorizer(a authz.Authorizer) Option {
+	return func(s *Server) error {
+		s.authorizer = a
+		return nil
+	}
+}
+
+// WithNodeAuthenticator configures the function used to authenticate
+// nodes invoking other functions. Only authenticated nodes may pass the
+// metadata of the event they are handling on to the invoked function
+func WithNodeAuthenticator(fn func(context.Context) (sigma.FunctionSpec, error)) Option {
+	return func(s *Server) error {
+		s.nodes = fn
+		return nil
+	}
+}
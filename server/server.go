@@ -8,6 +8,8 @@ import (
 	uuid "github.com/satori/go.uuid"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/homebot/core/resource"
 	"github.com/homebot/idam"
@@ -15,6 +17,9 @@ import (
 	"github.com/homebot/idam/token"
 	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
 	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/authz"
+	"github.com/homebot/sigma/function"
+	"github.com/homebot/sigma/node"
 	"github.com/homebot/sigma/scheduler"
 )
 
@@ -25,6 +30,12 @@ type Server struct {
 	// keyFn is used to resolve the signing certifiact/key
 	// for verifying JWTs
 	keyFn token.KeyProviderFunc
+
+	// authorizer authorizes invocations, may be nil
+	authorizer authz.Authorizer
+
+	// nodes authenticates calling nodes, may be nil
+	nodes func(context.Context) (sigma.FunctionSpec, error)
 }
 
 // NewServer creates a new sigma server for the given scheduler
@@ -70,6 +81,11 @@ func (s *Server) Create(ctx context.Context, in *sigmaV1.CreateFunctionRequest)
 	spec.ID = fmt.Sprintf("%s/functions/%s", name, spec.ID)
 
 	u, err := s.scheduler.Create(ctx, spec)
+	if err == scheduler.ErrFunctionExists {
+		// re-submitting a function updates its nodes. Changes that
+		// require the function to be recreated are refused by Update
+		err = s.scheduler.Update(ctx, spec)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +124,8 @@ func (s *Server) Dispatch(ctx context.Context, in *sigmaV1.DispatchRequest) (*si
 		return nil, errors.New("invalid request")
 	}
 
+	identity, inherited := s.caller(ctx, in.GetEvent().GetId())
+
 	// a unique ID for the execution
 	in.Event.Id = uuid.NewV4().String()
 
@@ -117,22 +135,80 @@ func (s *Server) Dispatch(ctx context.Context, in *sigmaV1.DispatchRequest) (*si
 		return nil, errors.New("invalid request: event data invalid")
 	}
 
-	e := sigma.NewSimpleEvent(in.GetEvent().GetId(), in.GetEvent().GetPayload())
+	md := sigma.Metadata{
+		sigma.MetadataSource:        "api",
+		sigma.MetadataCorrelationID: in.GetEvent().GetId(),
+	}
+	if identity != "" {
+		md[sigma.MetadataCaller] = identity
+	}
+
+	// inherited metadata never overwrites the keys set above
+	e := sigma.NewEventWithMetadata(in.GetEvent().GetId(), in.GetEvent().GetPayload(), md)
+	e = sigma.WithMetadata(e, inherited)
 
-	node, res, err := s.scheduler.Dispatch(ctx, u, e)
+	if s.authorizer != nil {
+		req := authz.Request{
+			Identity: identity,
+			Function: u,
+			Event:    e,
+		}
+
+		if err := s.authorizer.Authorize(ctx, req); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	nodeURN, res, err := s.scheduler.Dispatch(ctx, u, e)
+	if _, ok := err.(node.BudgetExceededError); ok {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err == function.ErrPaused {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &sigmaV1.DispatchResult{
 		Target: u,
-		Node:   node,
+		Node:   nodeURN,
 		Result: &sigmaV1.DispatchResult_Data{
 			Data: res,
 		},
 	}, nil
 }
 
+// caller returns the identity of the caller and the metadata inherited
+// from the event the caller is handling. Functions invoking other
+// functions pass the ID of their event so the invocation chain can be
+// tracked. As the ID is controlled by the caller the metadata is only
+// accepted from authenticated nodes, identified by their function unless
+// they present a token as well
+func (s *Server) caller(ctx context.Context, eventID string) (string, sigma.Metadata) {
+	var identity string
+	if auth, ok := policy.TokenFromContext(ctx); ok && auth != nil {
+		identity = auth.Name
+	}
+
+	if s.nodes == nil {
+		return identity, nil
+	}
+
+	spec, err := s.nodes(ctx)
+	if err != nil {
+		return identity, nil
+	}
+
+	if identity == "" {
+		identity = spec.ID
+	}
+
+	_, inherited := node.DecodeEventID(eventID)
+
+	return identity, inherited
+}
+
 // Inspect inspects a function and returns details and statistics for the function
 func (s *Server) Inspect(ctx context.Context, in *sigmaV1.InspectRequest) (*sigmaV1.Function, error) {
 	u := in.GetName()
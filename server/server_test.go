@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/node"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaller(t *testing.T) {
+	assert := assert.New(t)
+
+	id := node.EncodeEventID("event", sigma.Metadata{
+		sigma.MetadataCaller: "admin",
+		sigma.MetadataHops:   "1",
+	})
+
+	// metadata passed by callers that are not nodes is ignored
+	s := &Server{}
+	identity, md := s.caller(context.Background(), id)
+	assert.Equal("", identity)
+	assert.Nil(md)
+
+	s.nodes = func(context.Context) (sigma.FunctionSpec, error) {
+		return sigma.FunctionSpec{}, errors.New("not a node")
+	}
+	_, md = s.caller(context.Background(), id)
+	assert.Nil(md)
+
+	// nodes are identified by their function
+	s.nodes = func(context.Context) (sigma.FunctionSpec, error) {
+		return sigma.FunctionSpec{ID: "fn"}, nil
+	}
+	identity, md = s.caller(context.Background(), id)
+	assert.Equal("fn", identity)
+	assert.Equal("1", md[sigma.MetadataHops])
+}
@@ -0,0 +1,53 @@
+package sidecar
+
+import (
+	"time"
+
+	"github.com/homebot/sigma/healthcheck"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// Option configures a Sidecar
+type Option func(s *Sidecar) error
+
+// WithNodeServerOptions configures the embedded node server
+func WithNodeServerOptions(opts ...node.ServerOption) Option {
+	return func(s *Sidecar) error {
+		s.nodeServerOpts = append(s.nodeServerOpts, opts...)
+		return nil
+	}
+}
+
+// WithDeployerOptions configures the deployer used to launch nodes
+func WithDeployerOptions(opts ...node.DeployerOption) Option {
+	return func(s *Sidecar) error {
+		s.deployerOpts = append(s.deployerOpts, opts...)
+		return nil
+	}
+}
+
+// WithSchedulerOptions configures the embedded scheduler
+func WithSchedulerOptions(opts ...scheduler.Option) Option {
+	return func(s *Sidecar) error {
+		s.schedulerOpts = append(s.schedulerOpts, opts...)
+		return nil
+	}
+}
+
+// WithHealthCheckOptions configures the health checker
+func WithHealthCheckOptions(opts ...healthcheck.Option) Option {
+	return func(s *Sidecar) error {
+		s.healthOpts = append(s.healthOpts, opts...)
+		return nil
+	}
+}
+
+// WithReconcileInterval configures the interval between two
+// reconciliation passes
+func WithReconcileInterval(d time.Duration) Option {
+	return func(s *Sidecar) error {
+		s.reconcileInterval = d
+		return nil
+	}
+}
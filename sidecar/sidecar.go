@@ -0,0 +1,219 @@
+// Package sidecar embeds the sigma node server and dispatcher into an
+// existing Go service. Instead of running the sigma controller as a
+// separate binary the host service registers the node handler on its own
+// gRPC and HTTP servers and dispatches events in-process:
+//
+//	sc, err := sidecar.New(launcher, "localhost:50051")
+//	...
+//	sc.RegisterGRPC(grpcServer)
+//	mux.Handle("/nodes/", sc.Handler())
+//
+//	if err := sc.Start(ctx); err != nil { ... }
+//	defer sc.Stop(ctx)
+//
+//	id, err := sc.Scheduler().Create(ctx, spec)
+//	node, result, err := sc.Scheduler().Dispatch(ctx, id, event)
+package sidecar
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	sigmaV1 "github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma/healthcheck"
+	"github.com/homebot/sigma/launcher"
+	"github.com/homebot/sigma/node"
+	"github.com/homebot/sigma/scheduler"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var (
+	// ErrStarted is returned by Start if the sidecar is already running
+	ErrStarted = errors.New("sidecar already started")
+
+	// ErrNotStarted is returned by Stop if the sidecar is not running
+	ErrNotStarted = errors.New("sidecar not started")
+)
+
+// Sidecar hosts a node server, deployer and scheduler in-process
+type Sidecar struct {
+	launcher  launcher.Launcher
+	advertise string
+
+	nodeServerOpts    []node.ServerOption
+	deployerOpts      []node.DeployerOption
+	schedulerOpts     []scheduler.Option
+	reconcileInterval time.Duration
+	healthOpts        []healthcheck.Option
+
+	nodes     node.NodeServer
+	deployer  node.Deployer
+	scheduler scheduler.Scheduler
+	checker   *healthcheck.Checker
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a new sidecar launching nodes using l. Nodes connect to the
+// node handler at advertise, which must be served by a gRPC server passed
+// to RegisterGRPC
+func New(l launcher.Launcher, advertise string, opts ...Option) (*Sidecar, error) {
+	if l == nil {
+		return nil, errors.New("no launcher configured")
+	}
+
+	s := &Sidecar{
+		launcher:          l,
+		advertise:         advertise,
+		reconcileInterval: node.DefaultReconcileInterval,
+	}
+
+	for _, fn := range opts {
+		if err := fn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	s.nodes = node.NewNodeServer(s.nodeServerOpts...)
+	s.deployer = node.NewDeployer(s.nodes, s.launcher, s.advertise, s.deployerOpts...)
+
+	var err error
+	s.scheduler, err = scheduler.NewScheduler(s.deployer, s.schedulerOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker, err = healthcheck.New(s.healthOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker.Add(healthcheck.Scheduler, func(ctx context.Context) error {
+		_, err := s.scheduler.Functions(ctx)
+		return err
+	})
+
+	if lister, ok := l.(launcher.Lister); ok {
+		s.checker.Add(healthcheck.NodeServer, func(ctx context.Context) error {
+			_, err := lister.Instances(ctx)
+			return err
+		})
+	}
+
+	return s, nil
+}
+
+// RegisterGRPC registers the node handler and the health service on srv.
+// Nodes launched by the sidecar connect to srv using the advertise
+// address passed to New
+func (s *Sidecar) RegisterGRPC(srv *grpc.Server) {
+	sigmaV1.RegisterNodeHandlerServer(srv, s.nodes)
+	s.checker.Register(srv)
+}
+
+// Handler returns the HTTP handler serving the WebSocket node transport.
+// It must be mounted at the path configured using node.WithWebSocketAddress
+func (s *Sidecar) Handler() http.Handler {
+	return s.nodes
+}
+
+// NodeServer returns the embedded node server
+func (s *Sidecar) NodeServer() node.NodeServer {
+	return s.nodes
+}
+
+// Checker returns the health checker of the sidecar. Additional
+// subsystems of the host service may be added to it
+func (s *Sidecar) Checker() *healthcheck.Checker {
+	return s.checker
+}
+
+// Scheduler returns the embedded scheduler used to create functions and
+// dispatch events
+func (s *Sidecar) Scheduler() scheduler.Scheduler {
+	return s.scheduler
+}
+
+// Start starts the background tasks of the sidecar: the health checker
+// and, if the launcher can list its instances, the reconciler. They run
+// until ctx is cancelled or Stop is called
+func (s *Sidecar) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return ErrStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.checker.Run(ctx)
+	}()
+
+	if r, ok := s.deployer.(node.Reconciler); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.RunReconciler(ctx, r, s.reconcileInterval)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	s.cancel = cancel
+	s.done = done
+
+	return nil
+}
+
+// Stop destroys all functions, which stops their nodes, and waits for
+// the background tasks to exit
+func (s *Sidecar) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return ErrNotStarted
+	}
+
+	var lastErr error
+
+	functions, err := s.scheduler.Functions(ctx)
+	if err != nil {
+		lastErr = err
+	}
+
+	for _, fn := range functions {
+		if err := s.scheduler.Destroy(ctx, fn.Spec.ID); err != nil {
+			glog.Error(fn.Spec.ID, " failed to destroy function: ", err)
+			lastErr = err
+		}
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return lastErr
+}
@@ -0,0 +1,45 @@
+package sidecar
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/launcher"
+	"github.com/stretchr/testify/assert"
+)
+
+var failingLauncher = launcher.CreateFunc(func(context.Context, string, launcher.Config) (launcher.Instance, error) {
+	return nil, errors.New("not supported")
+})
+
+func TestSidecar(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(nil, "localhost:50051")
+	assert.Error(err)
+
+	sc, err := New(failingLauncher, "localhost:50051")
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(ErrNotStarted, sc.Stop(context.Background()))
+
+	assert.NoError(sc.Start(context.Background()))
+	assert.Equal(ErrStarted, sc.Start(context.Background()))
+
+	_, err = sc.Scheduler().Create(context.Background(), sigma.FunctionSpec{ID: "fn", Type: "test"})
+	assert.NoError(err)
+
+	// stopping the sidecar destroys all functions
+	assert.NoError(sc.Stop(context.Background()))
+
+	functions, err := sc.Scheduler().Functions(context.Background())
+	assert.NoError(err)
+	assert.Len(functions, 0)
+
+	assert.Equal(ErrNotStarted, sc.Stop(context.Background()))
+}
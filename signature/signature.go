@@ -0,0 +1,130 @@
+// Package signature implements Ed25519 signatures for function content
+// and artifacts. Signatures are computed over the content digest of a
+// function ("sha256:<hex>")
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/homebot/sigma"
+)
+
+var (
+	// ErrUnsigned is returned if a function spec does not carry a signature
+	ErrUnsigned = errors.New("function spec is not signed")
+
+	// ErrInvalidSignature is returned if the signature could not be verified
+	// with any trusted key
+	ErrInvalidSignature = errors.New("invalid function signature")
+
+	// ErrUnknownKey is returned if the spec references an untrusted key
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// Digest returns the digest of data in the form "sha256:<hex>"
+func Digest(data []byte) string {
+	h := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// ContentDigest returns the digest of the function content. For functions
+// using an artifact, the artifact digest is returned
+func ContentDigest(spec sigma.FunctionSpec) string {
+	if spec.Artifact != "" {
+		return spec.Artifact
+	}
+
+	return Digest([]byte(spec.Content))
+}
+
+// Sign signs the content digest of spec and returns the base64 encoded
+// signature
+func Sign(key ed25519.PrivateKey, spec sigma.FunctionSpec) string {
+	sig := ed25519.Sign(key, []byte(ContentDigest(spec)))
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// ParsePublicKey parses a base64 encoded Ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 public key size")
+	}
+
+	return ed25519.PublicKey(blob), nil
+}
+
+// ParsePrivateKey parses a base64 encoded Ed25519 private key or seed
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(blob) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(blob), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(blob), nil
+	default:
+		return nil, errors.New("invalid Ed25519 private key size")
+	}
+}
+
+// Verifier verifies function signatures against a set of trusted keys
+type Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// NewVerifier returns a verifier trusting the given keys indexed by key ID
+func NewVerifier(keys map[string]ed25519.PublicKey) *Verifier {
+	return &Verifier{
+		keys: keys,
+	}
+}
+
+// Verify verifies the signature of spec. If the spec references a signing
+// key only that key is tried, otherwise the signature must be valid for
+// any of the trusted keys
+func (v *Verifier) Verify(spec sigma.FunctionSpec) error {
+	if spec.Signature == "" {
+		return ErrUnsigned
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(spec.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	msg := []byte(ContentDigest(spec))
+
+	if spec.SigningKey != "" {
+		key, ok := v.keys[spec.SigningKey]
+		if !ok {
+			return ErrUnknownKey
+		}
+
+		if !ed25519.Verify(key, msg, sig) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	for _, key := range v.keys {
+		if ed25519.Verify(key, msg, sig) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
@@ -0,0 +1,47 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	v := NewVerifier(map[string]ed25519.PublicKey{"k1": pub, "k2": other})
+
+	spec := sigma.FunctionSpec{Content: "content"}
+	assert.Equal(ErrUnsigned, v.Verify(spec))
+
+	spec.Signature = "invalid base64"
+	assert.Equal(ErrInvalidSignature, v.Verify(spec))
+
+	spec.Signature = Sign(key, spec)
+	assert.NoError(v.Verify(spec))
+
+	// only the referenced key is tried
+	spec.SigningKey = "k2"
+	assert.Equal(ErrInvalidSignature, v.Verify(spec))
+
+	spec.SigningKey = "k3"
+	assert.Equal(ErrUnknownKey, v.Verify(spec))
+
+	// artifacts are signed using their digest
+	spec = sigma.FunctionSpec{Artifact: "sha256:abc"}
+	spec.Signature = Sign(key, spec)
+	assert.NoError(v.Verify(spec))
+	assert.Equal("sha256:abc", ContentDigest(spec))
+}
@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the snapshot admin API via HTTP:
+//
+//	GET  /snapshot  export the controller state
+//	POST /snapshot  restore a snapshot sent as request body
+type Handler struct {
+	controller Controller
+	secrets    *SecretStore
+}
+
+// NewHandler returns a new HTTP handler exporting and restoring the state
+// of c. Secrets are not part of snapshots if secrets is nil
+func NewHandler(c Controller, secrets *SecretStore) *Handler {
+	return &Handler{
+		controller: c,
+		secrets:    secrets,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s, err := Export(r.Context(), h.controller, h.secrets)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s)
+
+	case http.MethodPost:
+		var s Snapshot
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := Restore(r.Context(), h.controller, &s, h.secrets); err != nil {
+			status := http.StatusInternalServerError
+			if err == ErrUnsupportedVersion || err == ErrNoSecretStore {
+				status = http.StatusBadRequest
+			}
+
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
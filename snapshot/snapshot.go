@@ -0,0 +1,262 @@
+// Package snapshot exports the state of a sigma controller to a portable
+// snapshot and restores it on another controller. Snapshots hold all
+// function specs including their triggers and parameters, the destroyed
+// functions that can still be restored as well as the secrets of the
+// controller encrypted using AES-GCM. Artifacts referenced
+// by functions are not part of a snapshot and must be copied separately
+package snapshot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/scheduler"
+)
+
+// FormatVersion is the version of the snapshot format
+const FormatVersion = 1
+
+var (
+	// ErrUnsupportedVersion is returned when restoring a snapshot of an
+	// unknown format version
+	ErrUnsupportedVersion = errors.New("snapshot: unsupported format version")
+
+	// ErrNoSecretStore is returned when restoring a snapshot containing
+	// secrets without a secret store
+	ErrNoSecretStore = errors.New("snapshot: snapshot contains secrets but no secret store is configured")
+
+	// ErrInvalidKey is returned if the secret encryption key is not a
+	// hex encoded 32 byte key
+	ErrInvalidKey = errors.New("snapshot: key must be 32 hex encoded bytes")
+)
+
+// Snapshot is a portable export of the controller state
+type Snapshot struct {
+	// Version holds the format version of the snapshot
+	Version int `json:"version"`
+
+	// Created holds the time the snapshot has been created
+	Created time.Time `json:"created"`
+
+	// Functions holds the specs of all functions
+	Functions []sigma.FunctionSpec `json:"functions"`
+
+	// Secrets holds the encrypted secrets of the controller
+	Secrets []Secret `json:"secrets,omitempty"`
+
+	// Deleted holds the destroyed functions that can still be restored
+	Deleted []scheduler.DeletedFunction `json:"deleted,omitempty"`
+}
+
+// Secret is an encrypted secret
+type Secret struct {
+	// Ref is the reference of the secret used by secret-ref parameters
+	Ref string `json:"ref"`
+
+	// Nonce holds the AES-GCM nonce
+	Nonce []byte `json:"nonce"`
+
+	// Value holds the encrypted value of the secret
+	Value []byte `json:"value"`
+}
+
+// Controller is the controller state is exported from and restored to
+type Controller interface {
+	// Functions returns all functions of the controller
+	Functions(context.Context) ([]scheduler.FunctionRegistration, error)
+
+	// Create creates a new function
+	Create(context.Context, sigma.FunctionSpec) (string, error)
+
+	// Update updates an existing function
+	Update(context.Context, sigma.FunctionSpec) error
+}
+
+// Trash is implemented by controllers keeping destroyed functions for a
+// retention window. Their tombstones are part of snapshots
+type Trash interface {
+	// Deleted returns the destroyed functions that can still be restored
+	Deleted(context.Context) ([]scheduler.DeletedFunction, error)
+
+	// Bury records a destroyed function
+	Bury(context.Context, scheduler.DeletedFunction) error
+}
+
+// SecretStore holds the secrets of a controller as files in a directory
+// (see parameters.DirResolver) and encrypts them for snapshots
+type SecretStore struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// NewSecretStore returns a secret store for the secrets in dir using the
+// hex encoded 32 byte key to encrypt and decrypt secrets
+func NewSecretStore(dir string, key string) (*SecretStore, error) {
+	k, err := hex.DecodeString(key)
+	if err != nil || len(k) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretStore{
+		dir:  dir,
+		aead: aead,
+	}, nil
+}
+
+// export returns all secrets in encrypted form
+func (s *SecretStore) export() ([]Secret, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Secret
+	for _, f := range files {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		value, err := ioutil.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+
+		res = append(res, Secret{
+			Ref:   f.Name(),
+			Nonce: nonce,
+			Value: s.aead.Seal(nil, nonce, value, []byte(f.Name())),
+		})
+	}
+
+	return res, nil
+}
+
+// restore decrypts secrets and writes them to the secret directory
+func (s *SecretStore) restore(secrets []Secret) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		if secret.Ref == "" || strings.ContainsAny(secret.Ref, `/\`) || secret.Ref == "." || secret.Ref == ".." {
+			return fmt.Errorf("snapshot: invalid secret reference %q", secret.Ref)
+		}
+
+		value, err := s.aead.Open(nil, secret.Nonce, secret.Value, []byte(secret.Ref))
+		if err != nil {
+			return fmt.Errorf("snapshot: failed to decrypt secret %q", secret.Ref)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(s.dir, secret.Ref), value, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Export creates a snapshot of all functions of c. If secrets is not nil,
+// the snapshot contains all secrets in encrypted form
+func Export(ctx context.Context, c Controller, secrets *SecretStore) (*Snapshot, error) {
+	functions, err := c.Functions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Version:   FormatVersion,
+		Created:   time.Now(),
+		Functions: make([]sigma.FunctionSpec, 0, len(functions)),
+	}
+
+	for _, fn := range functions {
+		s.Functions = append(s.Functions, fn.Spec)
+	}
+
+	if trash, ok := c.(Trash); ok {
+		s.Deleted, err = trash.Deleted(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if secrets != nil {
+		s.Secrets, err = secrets.export()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Restore restores the secrets of s and creates all functions at c.
+// Functions that already exist are updated, restoring fails if their
+// triggers or scaling policies differ from the snapshot. Destroyed
+// functions are restored if c implements Trash
+func Restore(ctx context.Context, c Controller, s *Snapshot, secrets *SecretStore) error {
+	if s.Version != FormatVersion {
+		return ErrUnsupportedVersion
+	}
+
+	// secrets are restored first as they are resolved when the nodes of
+	// the restored functions are prepared
+	if len(s.Secrets) > 0 {
+		if secrets == nil {
+			return ErrNoSecretStore
+		}
+
+		if err := secrets.restore(s.Secrets); err != nil {
+			return err
+		}
+	}
+
+	for _, spec := range s.Functions {
+		_, err := c.Create(ctx, spec)
+		if err == scheduler.ErrFunctionExists {
+			err = c.Update(ctx, spec)
+		}
+		if err != nil {
+			return fmt.Errorf("snapshot: failed to restore function %s: %s", spec.ID, err)
+		}
+	}
+
+	if trash, ok := c.(Trash); ok {
+		for _, df := range s.Deleted {
+			// functions restored above supersede their tombstones
+			if err := trash.Bury(ctx, df); err != nil && err != scheduler.ErrFunctionExists {
+				return fmt.Errorf("snapshot: failed to restore deleted function %s: %s", df.Spec.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+type fakeController struct {
+	specs   map[string]sigma.FunctionSpec
+	updated []string
+}
+
+func (c *fakeController) Functions(context.Context) ([]scheduler.FunctionRegistration, error) {
+	var res []scheduler.FunctionRegistration
+	for _, spec := range c.specs {
+		res = append(res, scheduler.FunctionRegistration{Spec: spec})
+	}
+	return res, nil
+}
+
+func (c *fakeController) Create(ctx context.Context, spec sigma.FunctionSpec) (string, error) {
+	if _, ok := c.specs[spec.ID]; ok {
+		return spec.ID, scheduler.ErrFunctionExists
+	}
+	c.specs[spec.ID] = spec
+	return spec.ID, nil
+}
+
+func (c *fakeController) Update(ctx context.Context, spec sigma.FunctionSpec) error {
+	c.specs[spec.ID] = spec
+	c.updated = append(c.updated, spec.ID)
+	return nil
+}
+
+type fakeTrash struct {
+	fakeController
+	deleted map[string]scheduler.DeletedFunction
+}
+
+func (c *fakeTrash) Deleted(context.Context) ([]scheduler.DeletedFunction, error) {
+	var res []scheduler.DeletedFunction
+	for _, df := range c.deleted {
+		res = append(res, df)
+	}
+	return res, nil
+}
+
+func (c *fakeTrash) Bury(ctx context.Context, df scheduler.DeletedFunction) error {
+	if _, ok := c.specs[df.Spec.ID]; ok {
+		return scheduler.ErrFunctionExists
+	}
+	c.deleted[df.Spec.ID] = df
+	return nil
+}
+
+func TestExportRestore_Deleted(t *testing.T) {
+	assert := assert.New(t)
+
+	df := scheduler.DeletedFunction{
+		Spec:    sigma.FunctionSpec{ID: "acme/functions/b", Type: "js"},
+		Deleted: time.Now(),
+		Expires: time.Now().Add(time.Hour),
+	}
+
+	from := &fakeTrash{
+		fakeController: fakeController{specs: map[string]sigma.FunctionSpec{}},
+		deleted:        map[string]scheduler.DeletedFunction{df.Spec.ID: df},
+	}
+
+	s, err := Export(context.Background(), from, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]scheduler.DeletedFunction{df}, s.Deleted)
+
+	to := &fakeTrash{
+		fakeController: fakeController{specs: map[string]sigma.FunctionSpec{}},
+		deleted:        map[string]scheduler.DeletedFunction{},
+	}
+
+	assert.NoError(Restore(context.Background(), to, s, nil))
+	assert.Equal(from.deleted, to.deleted)
+}
+
+func TestExportRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	src, err := ioutil.TempDir("", "sigma-secrets-")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "sigma-secrets-")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dst)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(src, "token"), []byte("s3cret"), 0600))
+
+	_, err = NewSecretStore(src, "short")
+	assert.Equal(ErrInvalidKey, err)
+
+	secrets, err := NewSecretStore(src, testKey)
+	if !assert.NoError(err) {
+		return
+	}
+
+	from := &fakeController{specs: map[string]sigma.FunctionSpec{
+		"acme/functions/a": {ID: "acme/functions/a", Type: "js", Triggers: []sigma.TriggerSpec{{Type: "cron"}}},
+	}}
+
+	s, err := Export(context.Background(), from, secrets)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Len(s.Functions, 1)
+	if assert.Len(s.Secrets, 1) {
+		assert.Equal("token", s.Secrets[0].Ref)
+		assert.NotContains(string(s.Secrets[0].Value), "s3cret")
+	}
+
+	to := &fakeController{specs: map[string]sigma.FunctionSpec{
+		"acme/functions/a": {ID: "acme/functions/a", Type: "old"},
+	}}
+
+	// restoring secrets requires a secret store
+	assert.Equal(ErrNoSecretStore, Restore(context.Background(), to, s, nil))
+
+	restored, err := NewSecretStore(dst, testKey)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(Restore(context.Background(), to, s, restored))
+	assert.Equal(from.specs, to.specs)
+	assert.Equal([]string{"acme/functions/a"}, to.updated)
+
+	value, err := ioutil.ReadFile(filepath.Join(dst, "token"))
+	assert.NoError(err)
+	assert.Equal("s3cret", string(value))
+
+	// secrets cannot be decrypted using a different key
+	other, err := NewSecretStore(dst, "ff"+testKey[2:])
+	if assert.NoError(err) {
+		assert.Error(Restore(context.Background(), to, s, other))
+	}
+}
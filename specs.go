@@ -1,8 +1,11 @@
 package sigma
 
 import (
+	"encoding/json"
+
 	"github.com/homebot/core/utils"
 	"github.com/homebot/protobuf/pkg/api/sigma/v1"
+	"github.com/homebot/sigma/parameters"
 )
 
 // TriggerSpec describes a sigma function trigger
@@ -16,9 +19,34 @@ type TriggerSpec struct {
 
 	// Options holds additional options for building the trigger
 	Options map[string]string `json:"options" yaml:"options"`
+
+	// Rules optionally route and transform trigger events. If set, events
+	// not matched by any rule are dropped
+	Rules []RuleSpec `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// RuleSpec routes trigger events matching a condition to functions. Rules
+// use the same expression language as trigger conditions
+type RuleSpec struct {
+	// When holds the condition of the rule. An empty condition matches
+	// all events
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
+
+	// Functions holds the IDs of the functions to dispatch matching
+	// events to. Defaults to the function owning the trigger
+	Functions []string `json:"functions,omitempty" yaml:"functions,omitempty"`
+
+	// Transform holds an expression evaluating to the new payload of
+	// matching events. Non-string results are JSON encoded
+	Transform string `json:"transform,omitempty" yaml:"transform,omitempty"`
+
+	// Stop stops evaluating further rules if the rule matched
+	Stop bool `json:"stop,omitempty" yaml:"stop,omitempty"`
 }
 
-// ToProtobuf converts the trigger spec to it's protocol buffer representation
+// ToProtobuf converts the trigger spec to it's protocol buffer
+// representation. Rules have no protocol buffer representation and are
+// transported by FunctionSpec.ToProtobuf
 func (t TriggerSpec) ToProtobuf() *sigma.TriggerSpec {
 	return &sigma.TriggerSpec{
 		Type:      t.Type,
@@ -37,6 +65,16 @@ func TriggerSpecFromProtobuf(t *sigma.TriggerSpec) TriggerSpec {
 	}
 }
 
+// Supported node transports
+const (
+	// TransportGRPC connects nodes using the gRPC node handler
+	TransportGRPC = "grpc"
+
+	// TransportWebSocket connects nodes using JSON framed messages over
+	// HTTP and WebSocket
+	TransportWebSocket = "websocket"
+)
+
 // FunctionSpec describes a function to be executed and managed by funker
 type FunctionSpec struct {
 	// ID holds the ID of the function specification
@@ -45,10 +83,23 @@ type FunctionSpec struct {
 	// Type is the type of function and is used to select the node type
 	Type string `json:"type" yaml:"type"`
 
+	// Runtime references the runtime to execute the function in the
+	// form "name@version". If empty, Type is used as the runtime name
+	Runtime string `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+
+	// Transport selects the transport nodes use to connect to the node
+	// handler. Defaults to TransportGRPC
+	Transport string `json:"transport,omitempty" yaml:"transport,omitempty"`
+
 	// Content holds the content of the function. The content type depends on
 	// the node executor
 	Content string `json:"content" yaml:"content"`
 
+	// Weight is the share of dispatch slots the function receives when
+	// the dispatcher is saturated, relative to other functions.
+	// Defaults to 1
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+
 	// Policies are auto-scaling policies for the function
 	Policies map[string]map[string]string `json:"policies" yaml:"policies"`
 
@@ -57,6 +108,212 @@ type FunctionSpec struct {
 
 	// Parameters may hold optional parameters for the function
 	Parameteres utils.ValueMap `json:"parameters" yaml:"parameters"`
+
+	// ParameterSchema optionally declares the types of Parameters. If
+	// set, parameters are validated and normalized before nodes are
+	// prepared
+	ParameterSchema parameters.Schema `json:"parameterSchema,omitempty" yaml:"parameterSchema,omitempty"`
+
+	// Artifact holds the digest of a function bundle stored in the
+	// artifact store. If set, it replaces Content
+	Artifact string `json:"artifact,omitempty" yaml:"artifact,omitempty"`
+
+	// Signature holds a base64 encoded Ed25519 signature of the content
+	// digest (or artifact digest)
+	Signature string `json:"signature,omitempty" yaml:"signature,omitempty"`
+
+	// SigningKey holds the ID of the key used to create Signature
+	SigningKey string `json:"signingKey,omitempty" yaml:"signingKey,omitempty"`
+
+	// Network holds an optional egress policy for the function's nodes
+	Network *NetworkPolicy `json:"network,omitempty" yaml:"network,omitempty"`
+
+	// Proxy holds an optional policy for outbound HTTP calls routed
+	// through the egress proxy
+	Proxy *ProxyPolicy `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+
+	// Schema optionally declares JSON schemas for the event payload and
+	// the result of the function
+	Schema *IOSchema `json:"schema,omitempty" yaml:"schema,omitempty"`
+
+	// Recycle holds an optional policy for replacing long-running nodes
+	Recycle *RecyclePolicy `json:"recycle,omitempty" yaml:"recycle,omitempty"`
+
+	// Update configures how nodes are replaced when the spec changes
+	Update *UpdatePolicy `json:"update,omitempty" yaml:"update,omitempty"`
+
+	// Readiness requires nodes to report readiness before they are
+	// selected for events
+	Readiness *ReadinessProbe `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+
+	// Lifecycle configures init and shutdown events sent to nodes
+	Lifecycle *LifecycleHooks `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty"`
+
+	// Scratch requests an ephemeral scratch volume for each node
+	Scratch *ScratchVolume `json:"scratch,omitempty" yaml:"scratch,omitempty"`
+
+	// Debug enables capturing of sampled invocations
+	Debug *DebugCapture `json:"debug,omitempty" yaml:"debug,omitempty"`
+
+	// Resources holds the resources reserved for each node of the
+	// function
+	Resources *Resources `json:"resources,omitempty" yaml:"resources,omitempty"`
+
+	// Security holds an optional security profile applied to the
+	// function's nodes
+	Security *SecurityProfile `json:"security,omitempty" yaml:"security,omitempty"`
+
+	// Budget holds optional execution budgets. Nodes exceeding them are
+	// killed and replaced
+	Budget *ExecutionBudget `json:"budget,omitempty" yaml:"budget,omitempty"`
+
+	// Maintenance holds scheduled windows during which the function is
+	// paused
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+}
+
+// MaintenanceWindow pauses a function for a scheduled period of time,
+// e.g. while a backend it depends on is upgraded. Triggers stop
+// dispatching, the auto-scaler is frozen and nodes are drained
+type MaintenanceWindow struct {
+	// Start holds the begin of the window in RFC 3339 format
+	Start string `json:"start" yaml:"start"`
+
+	// End holds the end of the window in RFC 3339 format
+	End string `json:"end" yaml:"end"`
+
+	// Reason describes the maintenance
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+
+	// Buffer buffers trigger events during the window and dispatches
+	// them afterwards. Requires event buffering to be enabled, events
+	// are dropped otherwise
+	Buffer bool `json:"buffer,omitempty" yaml:"buffer,omitempty"`
+}
+
+// Resources configures the resources of a function node. Reserved
+// resources count against the quota of the function's namespace
+type Resources struct {
+	// MemoryMB is the memory limit of a node in megabytes. Launchers
+	// that support resource limits enforce it
+	MemoryMB int64 `json:"memoryMB,omitempty" yaml:"memoryMB,omitempty"`
+}
+
+// ExecutionBudget limits the time invocations of a function may take and
+// the CPU time its nodes may consume
+type ExecutionBudget struct {
+	// MaxWallTime is the maximum time a single invocation may take,
+	// parsed by time.ParseDuration. Nodes exceeding it are killed
+	MaxWallTime string `json:"maxWallTime,omitempty" yaml:"maxWallTime,omitempty"`
+
+	// MaxCPUSecondsPerHour is the maximum CPU time all nodes of the
+	// function may consume per hour. Invocations are rejected once the
+	// budget is exhausted and nodes still consuming CPU are killed.
+	// Requires a launcher reporting CPU usage
+	MaxCPUSecondsPerHour float64 `json:"maxCPUSecondsPerHour,omitempty" yaml:"maxCPUSecondsPerHour,omitempty"`
+}
+
+// DebugCapture configures sampling of invocations. Payloads and results
+// of sampled invocations are kept in memory and can be retrieved using
+// the debug API
+type DebugCapture struct {
+	// SampleRate is the percentage (0 - 100) of invocations captured
+	SampleRate float64 `json:"sampleRate" yaml:"sampleRate"`
+
+	// MaxPayloadSize truncates captured payloads and results to the
+	// given number of bytes. Defaults to 64KiB
+	MaxPayloadSize int `json:"maxPayloadSize,omitempty" yaml:"maxPayloadSize,omitempty"`
+
+	// MaxRecords is the number of captured invocations kept. Defaults
+	// to 100
+	MaxRecords int `json:"maxRecords,omitempty" yaml:"maxRecords,omitempty"`
+
+	// RedactKeys holds keys of JSON objects whose values are redacted
+	RedactKeys []string `json:"redactKeys,omitempty" yaml:"redactKeys,omitempty"`
+
+	// RedactPatterns holds regular expressions whose matches are
+	// redacted
+	RedactPatterns []string `json:"redactPatterns,omitempty" yaml:"redactPatterns,omitempty"`
+}
+
+// ScratchVolume configures the per-node scratch volume. The volume is
+// exposed to functions using the SIGMA_SCRATCH_DIR environment variable
+// and wiped when the node is removed
+type ScratchVolume struct {
+	// SizeMB is the size of the volume in megabytes
+	SizeMB int64 `json:"sizeMB" yaml:"sizeMB"`
+}
+
+// LifecycleHooks configures the lifecycle events dispatched to nodes.
+// Timeouts are parsed by time.ParseDuration
+type LifecycleHooks struct {
+	// Init enables the init event sent after a node registered. Nodes
+	// failing to handle the init event are removed
+	Init bool `json:"init,omitempty" yaml:"init,omitempty"`
+
+	// InitTimeout is the time a node has to handle the init event
+	InitTimeout string `json:"initTimeout,omitempty" yaml:"initTimeout,omitempty"`
+
+	// Shutdown enables the shutdown event sent before a node is stopped
+	Shutdown bool `json:"shutdown,omitempty" yaml:"shutdown,omitempty"`
+
+	// ShutdownTimeout is the time a node has to handle the shutdown event
+	ShutdownTimeout string `json:"shutdownTimeout,omitempty" yaml:"shutdownTimeout,omitempty"`
+}
+
+// ReadinessProbe configures the readiness handshake of nodes
+type ReadinessProbe struct {
+	// Timeout is the time a node has to report readiness after it
+	// registered, parsed by time.ParseDuration
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// FailureThreshold is the number of failed readiness reports after
+	// which the node is considered unhealthy
+	FailureThreshold int `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+}
+
+// DefaultMaxUnavailable is the number of nodes replaced at once during
+// a rolling update if no UpdatePolicy is set
+const DefaultMaxUnavailable = 1
+
+// UpdatePolicy configures rolling updates of a function's nodes
+type UpdatePolicy struct {
+	// MaxUnavailable is the maximum number of nodes that may be
+	// unavailable during a rolling update. If zero, replacements are
+	// deployed before the outdated node is removed
+	MaxUnavailable int `json:"maxUnavailable" yaml:"maxUnavailable"`
+}
+
+// RecyclePolicy configures when nodes of a function are replaced by
+// fresh instances. A zero value disables the respective limit
+type RecyclePolicy struct {
+	// MaxAge is the maximum age of a node, parsed by time.ParseDuration
+	MaxAge string `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+
+	// MaxInvocations is the maximum number of invocations a node
+	// may serve
+	MaxInvocations int64 `json:"maxInvocations,omitempty" yaml:"maxInvocations,omitempty"`
+}
+
+// Schema validation modes
+const (
+	// SchemaEnforce rejects invalid payloads and results
+	SchemaEnforce = "enforce"
+
+	// SchemaWarn only logs and counts invalid payloads and results
+	SchemaWarn = "warn"
+)
+
+// IOSchema declares JSON schemas for the input and output of a function
+type IOSchema struct {
+	// Input holds the JSON schema of event payloads
+	Input string `json:"input,omitempty" yaml:"input,omitempty"`
+
+	// Output holds the JSON schema of function results
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+
+	// Mode is either SchemaEnforce (default) or SchemaWarn
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
 }
 
 // TriggersToProtobuf converts a slice or array of triggers to their
@@ -109,27 +366,102 @@ func ProtobufToPolicies(in []*sigma.Policy) map[string]map[string]string {
 	return res
 }
 
+// specExtensionsKey is the parameter key used to transport FunctionSpec
+// fields that do not have a protocol buffer representation. The key is
+// stripped by SpecFromProto and never sent to nodes
+const specExtensionsKey = "__sigma_spec"
+
+// specExtensions holds the FunctionSpec fields that do not have a protocol
+// buffer representation
+type specExtensions struct {
+	FunctionSpec
+
+	// TriggerRules holds the rules of each trigger in the order of
+	// FunctionSpec.Triggers
+	TriggerRules [][]RuleSpec `json:"triggerRules,omitempty"`
+}
+
+// extensions returns the JSON encoding of all fields that do not have a
+// protocol buffer representation or an empty string if none of them is set
+func (spec FunctionSpec) extensions() string {
+	ext := specExtensions{FunctionSpec: spec}
+	ext.ID = ""
+	ext.Type = ""
+	ext.Content = ""
+	ext.Policies = nil
+	ext.Triggers = nil
+	ext.Parameteres = nil
+
+	for i, t := range spec.Triggers {
+		if len(t.Rules) == 0 {
+			continue
+		}
+
+		if ext.TriggerRules == nil {
+			ext.TriggerRules = make([][]RuleSpec, len(spec.Triggers))
+		}
+		ext.TriggerRules[i] = t.Rules
+	}
+
+	blob, err := json.Marshal(ext)
+	if err != nil {
+		return ""
+	}
+
+	empty, _ := json.Marshal(specExtensions{})
+	if string(blob) == string(empty) {
+		return ""
+	}
+
+	return string(blob)
+}
+
 // ToProtobuf converts the function spec to it's protocol buffer representation
 func (spec FunctionSpec) ToProtobuf() *sigma.FunctionSpec {
+	params := spec.Parameteres
+
+	if ext := spec.extensions(); ext != "" {
+		params = make(utils.ValueMap)
+		for key, value := range spec.Parameteres {
+			params[key] = value
+		}
+		params[specExtensionsKey] = ext
+	}
+
 	return &sigma.FunctionSpec{
 		Id:         spec.ID,
 		Type:       spec.Type,
 		Policies:   PoliciesToProtobuf(spec.Policies),
 		Content:    []byte(spec.Content),
 		Triggers:   TriggersToProtobuf(spec.Triggers),
-		Parameters: spec.Parameteres.ToProto(),
+		Parameters: params.ToProto(),
 	}
 }
 
 // SpecFromProto creates a function spec from it's protocol buffer
 // representation
 func SpecFromProto(in *sigma.FunctionSpec) FunctionSpec {
-	return FunctionSpec{
-		ID:          in.GetId(),
-		Type:        in.GetType(),
-		Policies:    ProtobufToPolicies(in.GetPolicies()),
-		Content:     string(in.GetContent()),
-		Triggers:    TriggersFromProtobuf(in.GetTriggers()),
-		Parameteres: utils.ValueMapFrom(in.GetParameters()),
+	var ext specExtensions
+
+	params := utils.ValueMapFrom(in.GetParameters())
+	if blob, ok := params[specExtensionsKey].(string); ok {
+		delete(params, specExtensionsKey)
+		json.Unmarshal([]byte(blob), &ext)
 	}
+
+	spec := ext.FunctionSpec
+	spec.ID = in.GetId()
+	spec.Type = in.GetType()
+	spec.Policies = ProtobufToPolicies(in.GetPolicies())
+	spec.Content = string(in.GetContent())
+	spec.Triggers = TriggersFromProtobuf(in.GetTriggers())
+	spec.Parameteres = params
+
+	for i, rules := range ext.TriggerRules {
+		if i < len(spec.Triggers) {
+			spec.Triggers[i].Rules = rules
+		}
+	}
+
+	return spec
 }
@@ -0,0 +1,39 @@
+package sigma
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecFromProto_TriggerRules(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := FunctionSpec{
+		ID:      "fn",
+		Type:    "js",
+		Content: "content",
+		Weight:  2,
+		Triggers: []TriggerSpec{
+			{Type: "cron", Options: map[string]string{"schedule": "@every 1m"}},
+			{
+				Type:      "mqtt",
+				Condition: "topic == 'home'",
+				Options:   map[string]string{"topic": "home/#"},
+				Rules: []RuleSpec{
+					{When: "payload.temp > 30", Functions: []string{"alert"}, Stop: true},
+					{Transform: "payload.temp"},
+				},
+			},
+		},
+	}
+
+	res := SpecFromProto(spec.ToProtobuf())
+	assert.Equal(spec.Triggers, res.Triggers)
+	assert.Equal(2, res.Weight)
+	assert.Empty(res.Parameteres)
+
+	// specs without extensions do not carry the extension parameter
+	plain := FunctionSpec{ID: "fn", Type: "js", Triggers: []TriggerSpec{{Type: "cron"}}}
+	assert.Empty(plain.extensions())
+}
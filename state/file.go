@@ -0,0 +1,165 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore is a Store persisting each scope as a JSON file in a local
+// directory. Scopes are cached in memory once loaded. As each write
+// rewrites the file of the scope, scopes are limited to MaxScopeKeys and
+// MaxScopeSize
+type FileStore struct {
+	dir string
+
+	mu     sync.Mutex
+	scopes map[string]map[string][]byte
+}
+
+// NewFileStore creates a new file store in dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		dir:    dir,
+		scopes: make(map[string]map[string][]byte),
+	}, nil
+}
+
+// Get returns the value of key and implements Store
+func (s *FileStore) Get(scope, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), v...), nil
+}
+
+// Set sets the value of key and implements Store
+func (s *FileStore) Set(scope, key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	if len(value) > MaxValueSize {
+		return ErrValueTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(scope)
+	if err != nil {
+		return err
+	}
+
+	if err := checkScope(m, key, value); err != nil {
+		return err
+	}
+
+	prev, existed := m[key]
+	m[key] = append([]byte(nil), value...)
+
+	if err := s.write(scope, m); err != nil {
+		if existed {
+			m[key] = prev
+		} else {
+			delete(m, key)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes key and implements Store
+func (s *FileStore) Delete(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(scope)
+	if err != nil {
+		return err
+	}
+
+	prev, ok := m[key]
+	if !ok {
+		return nil
+	}
+
+	delete(m, key)
+
+	if err := s.write(scope, m); err != nil {
+		m[key] = prev
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStore) path(scope string) string {
+	return filepath.Join(s.dir, url.PathEscape(scope)+".json")
+}
+
+// load returns the values of scope. s.mu must be held
+func (s *FileStore) load(scope string) (map[string][]byte, error) {
+	if m, ok := s.scopes[scope]; ok {
+		return m, nil
+	}
+
+	m := make(map[string][]byte)
+
+	blob, err := ioutil.ReadFile(s.path(scope))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(blob, &m); err != nil {
+			return nil, err
+		}
+	}
+
+	s.scopes[scope] = m
+	return m, nil
+}
+
+// write persists the values of scope. s.mu must be held
+func (s *FileStore) write(scope string, m map[string][]byte) error {
+	blob, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(scope))
+}
@@ -0,0 +1,194 @@
+package state
+
+import (
+	"net"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/homebot/sigma/rpc"
+)
+
+// Request is a state service request
+type Request struct {
+	// Scope is either ScopeFunction (default) or ScopeNamespace
+	Scope string `json:"scope,omitempty"`
+
+	// Key is the key of the value
+	Key string `json:"key"`
+
+	// Value holds the value for Set requests
+	Value []byte `json:"value,omitempty"`
+}
+
+// Response is a state service response
+type Response struct {
+	// Found is true if Get found the key
+	Found bool `json:"found,omitempty"`
+
+	// Value holds the value for Get requests
+	Value []byte `json:"value,omitempty"`
+}
+
+// StateServer is the state service nodes call back to
+type StateServer interface {
+	Get(context.Context, *Request) (*Response, error)
+	Set(context.Context, *Request) (*Response, error)
+	Delete(context.Context, *Request) (*Response, error)
+}
+
+// Authenticator returns the ID of the function the calling node belongs to
+type Authenticator func(ctx context.Context) (string, error)
+
+// Server serves the state service for a store
+type Server struct {
+	store Store
+	auth  Authenticator
+}
+
+// NewServer creates a new state server. Nodes are authenticated using auth
+func NewServer(store Store, auth Authenticator) *Server {
+	return &Server{
+		store: store,
+		auth:  auth,
+	}
+}
+
+// Serve serves the state gRPC service on lis
+func (s *Server) Serve(lis net.Listener) error {
+	srv := grpc.NewServer(rpc.ServerOption())
+	RegisterStateServer(srv, s)
+
+	return srv.Serve(lis)
+}
+
+func (s *Server) scope(ctx context.Context, in *Request) (string, error) {
+	fn, err := s.auth(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return ScopeKey(in.Scope, fn)
+}
+
+// Get returns the value of a key and implements StateServer
+func (s *Server) Get(ctx context.Context, in *Request) (*Response, error) {
+	scope, err := s.scope(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.store.Get(scope, in.Key)
+	if err == ErrNotFound {
+		return &Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{Found: true, Value: v}, nil
+}
+
+// Set sets the value of a key and implements StateServer
+func (s *Server) Set(ctx context.Context, in *Request) (*Response, error) {
+	scope, err := s.scope(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{}, s.store.Set(scope, in.Key, in.Value)
+}
+
+// Delete deletes a key and implements StateServer
+func (s *Server) Delete(ctx context.Context, in *Request) (*Response, error) {
+	scope, err := s.scope(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{}, s.store.Delete(scope, in.Key)
+}
+
+// RegisterStateServer registers srv at the gRPC server s. The server must
+// be configured to use rpc.ServerOption()
+func RegisterStateServer(s *grpc.Server, srv StateServer) {
+	s.RegisterService(&stateServiceDesc, srv)
+}
+
+func stateHandler(call func(StateServer, context.Context, *Request) (*Response, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(Request)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		return call(srv.(StateServer), ctx, in)
+	}
+}
+
+var stateServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sigma.state.State",
+	HandlerType: (*StateServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: stateHandler(StateServer.Get)},
+		{MethodName: "Set", Handler: stateHandler(StateServer.Set)},
+		{MethodName: "Delete", Handler: stateHandler(StateServer.Delete)},
+	},
+}
+
+// Client is a state service client used by nodes
+type Client struct {
+	cc     *grpc.ClientConn
+	urn    string
+	secret string
+}
+
+// NewClient returns a state client using cc. The connection must be dialed
+// using rpc.DialOption(). Calls are authenticated using the node URN and
+// secret
+func NewClient(cc *grpc.ClientConn, urn, secret string) *Client {
+	return &Client{
+		cc:     cc,
+		urn:    urn,
+		secret: secret,
+	}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in *Request) (*Response, error) {
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("node-urn", c.urn, "node-secret", c.secret))
+
+	out := new(Response)
+	if err := grpc.Invoke(ctx, "/sigma.state.State/"+method, in, out, c.cc); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Get returns the value of key in scope or ErrNotFound
+func (c *Client) Get(ctx context.Context, scope, key string) ([]byte, error) {
+	res, err := c.invoke(ctx, "Get", &Request{Scope: scope, Key: key})
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Found {
+		return nil, ErrNotFound
+	}
+
+	return res.Value, nil
+}
+
+// Set sets the value of key in scope
+func (c *Client) Set(ctx context.Context, scope, key string, value []byte) error {
+	_, err := c.invoke(ctx, "Set", &Request{Scope: scope, Key: key, Value: value})
+	return err
+}
+
+// Delete deletes key in scope
+func (c *Client) Delete(ctx context.Context, scope, key string) error {
+	_, err := c.invoke(ctx, "Delete", &Request{Scope: scope, Key: key})
+	return err
+}
+
+// compile time check
+var _ StateServer = &Server{}
@@ -0,0 +1,180 @@
+// Package state provides a small key/value store functions can use to keep
+// state between invocations. Values are scoped per function or per
+// namespace and persisted by the controller
+package state
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned if a key does not exist
+	ErrNotFound = errors.New("key not found")
+
+	// ErrValueTooLarge is returned if a value exceeds MaxValueSize
+	ErrValueTooLarge = errors.New("value too large")
+
+	// ErrInvalidKey is returned for empty keys or keys exceeding
+	// MaxKeySize
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrScopeFull is returned if a value would exceed MaxScopeKeys or
+	// MaxScopeSize
+	ErrScopeFull = errors.New("scope limit exceeded")
+)
+
+const (
+	// MaxKeySize is the maximum size of a key in bytes
+	MaxKeySize = 256
+
+	// MaxValueSize is the maximum size of a value in bytes
+	MaxValueSize = 64 << 10
+
+	// MaxScopeKeys is the maximum number of keys stored in a scope
+	MaxScopeKeys = 1024
+
+	// MaxScopeSize is the maximum size of all keys and values stored
+	// in a scope in bytes
+	MaxScopeSize = 1 << 20
+)
+
+// Scopes of stored values
+const (
+	// ScopeFunction stores values visible to all nodes of a function
+	ScopeFunction = "function"
+
+	// ScopeNamespace stores values visible to all functions of a namespace
+	ScopeNamespace = "namespace"
+)
+
+// Store stores keyed values for a scope
+type Store interface {
+	// Get returns the value of key or ErrNotFound
+	Get(scope, key string) ([]byte, error)
+
+	// Set sets the value of key
+	Set(scope, key string, value []byte) error
+
+	// Delete deletes key. Deleting a missing key is not an error
+	Delete(scope, key string) error
+}
+
+// Namespace returns the namespace of a function ID. Function IDs created
+// by the sigma server have the form "<namespace>/functions/<name>". An
+// empty string is returned for IDs without namespace
+func Namespace(functionID string) string {
+	idx := strings.Index(functionID, "/functions/")
+	if idx < 0 {
+		return ""
+	}
+
+	return functionID[:idx]
+}
+
+// ScopeKey returns the store scope of a function for the given scope type
+func ScopeKey(scope, functionID string) (string, error) {
+	switch scope {
+	case "", ScopeFunction:
+		return "function:" + functionID, nil
+	case ScopeNamespace:
+		ns := Namespace(functionID)
+		if ns == "" {
+			return "", errors.New("function does not belong to a namespace")
+		}
+		return "namespace:" + ns, nil
+	default:
+		return "", errors.New("unknown scope: " + scope)
+	}
+}
+
+func checkKey(key string) error {
+	if key == "" || len(key) > MaxKeySize {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// checkScope returns ErrScopeFull if setting key to value would exceed the
+// limits of the scope holding m
+func checkScope(m map[string][]byte, key string, value []byte) error {
+	if _, ok := m[key]; !ok && len(m) >= MaxScopeKeys {
+		return ErrScopeFull
+	}
+
+	size := len(key) + len(value)
+	for k, v := range m {
+		if k != key {
+			size += len(k) + len(v)
+		}
+	}
+
+	if size > MaxScopeSize {
+		return ErrScopeFull
+	}
+
+	return nil
+}
+
+// MemoryStore is a Store keeping values in memory
+type MemoryStore struct {
+	rw     sync.RWMutex
+	scopes map[string]map[string][]byte
+}
+
+// NewMemoryStore returns a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		scopes: make(map[string]map[string][]byte),
+	}
+}
+
+// Get returns the value of key and implements Store
+func (s *MemoryStore) Get(scope, key string) ([]byte, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	v, ok := s.scopes[scope][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), v...), nil
+}
+
+// Set sets the value of key and implements Store
+func (s *MemoryStore) Set(scope, key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	if len(value) > MaxValueSize {
+		return ErrValueTooLarge
+	}
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	m, ok := s.scopes[scope]
+	if !ok {
+		m = make(map[string][]byte)
+		s.scopes[scope] = m
+	}
+
+	if err := checkScope(m, key, value); err != nil {
+		return err
+	}
+
+	m[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete deletes key and implements Store
+func (s *MemoryStore) Delete(scope, key string) error {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	delete(s.scopes[scope], key)
+	return nil
+}
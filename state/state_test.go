@@ -0,0 +1,102 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sigma-state-")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = s.Get("function:a", "counter")
+	assert.Equal(ErrNotFound, err)
+
+	assert.NoError(s.Set("function:a", "counter", []byte("1")))
+	assert.Equal(ErrInvalidKey, s.Set("function:a", "", nil))
+	assert.Equal(ErrValueTooLarge, s.Set("function:a", "big", make([]byte, MaxValueSize+1)))
+
+	// values are persisted
+	s, err = NewFileStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	v, err := s.Get("function:a", "counter")
+	assert.NoError(err)
+	assert.Equal([]byte("1"), v)
+
+	_, err = s.Get("function:b", "counter")
+	assert.Equal(ErrNotFound, err)
+
+	assert.NoError(s.Delete("function:a", "counter"))
+	_, err = s.Get("function:a", "counter")
+	assert.Equal(ErrNotFound, err)
+}
+
+func TestScopeKey(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := ScopeKey("", "acme/functions/resize")
+	assert.NoError(err)
+	assert.Equal("function:acme/functions/resize", s)
+
+	s, err = ScopeKey(ScopeNamespace, "acme/functions/resize")
+	assert.NoError(err)
+	assert.Equal("namespace:acme", s)
+
+	_, err = ScopeKey(ScopeNamespace, "resize")
+	assert.Error(err)
+}
+
+func TestScopeLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sigma-state-")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	for _, s := range []Store{NewMemoryStore(), fs} {
+		for i := 0; i < MaxScopeKeys; i++ {
+			assert.NoError(s.Set("function:keys", strconv.Itoa(i), nil))
+		}
+		assert.Equal(ErrScopeFull, s.Set("function:keys", "full", nil))
+
+		// existing keys can still be updated
+		assert.NoError(s.Set("function:keys", "0", []byte("1")))
+
+		// other scopes are not affected
+		assert.NoError(s.Set("function:other", "0", nil))
+
+		value := make([]byte, MaxValueSize)
+		for i := 0; i < MaxScopeSize/MaxValueSize-1; i++ {
+			assert.NoError(s.Set("function:size", strconv.Itoa(i), value))
+		}
+		assert.Equal(ErrScopeFull, s.Set("function:size", "full", value))
+
+		// shrinking a value frees space in the scope
+		assert.NoError(s.Set("function:size", "0", nil))
+		assert.NoError(s.Set("function:size", "full", value))
+	}
+}
@@ -0,0 +1,105 @@
+// Package buffer provides store-and-forward buffers for trigger events that
+// could not be dispatched because the target function was unreachable
+package buffer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/homebot/sigma"
+)
+
+var (
+	// ErrEmpty is returned by Peek if the buffer does not contain any events
+	ErrEmpty = errors.New("buffer empty")
+
+	// ErrFull is returned by Push if the buffer reached it's maximum size
+	ErrFull = errors.New("buffer full")
+)
+
+// Buffer is a FIFO queue of trigger events
+type Buffer interface {
+	// Push appends an event to the end of the buffer
+	Push(sigma.Event) error
+
+	// Peek returns the oldest event without removing it
+	Peek() (sigma.Event, error)
+
+	// Pop removes the oldest event
+	Pop() error
+
+	// Len returns the number of buffered events
+	Len() int
+
+	// Close closes the buffer
+	Close() error
+}
+
+// Memory is an in-memory Buffer. Buffered events are lost when
+// the process terminates
+type Memory struct {
+	max int
+
+	mu     sync.Mutex
+	events []sigma.Event
+}
+
+// NewMemory returns a new in-memory buffer holding at most max events. If
+// max is zero the buffer is unbounded
+func NewMemory(max int) *Memory {
+	return &Memory{
+		max: max,
+	}
+}
+
+// Push appends an event to the buffer
+func (m *Memory) Push(e sigma.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.max > 0 && len(m.events) >= m.max {
+		return ErrFull
+	}
+
+	m.events = append(m.events, e)
+	return nil
+}
+
+// Peek returns the oldest event
+func (m *Memory) Peek() (sigma.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.events) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return m.events[0], nil
+}
+
+// Pop removes the oldest event
+func (m *Memory) Pop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.events) == 0 {
+		return ErrEmpty
+	}
+
+	m.events[0] = nil
+	m.events = m.events[1:]
+	return nil
+}
+
+// Len returns the number of buffered events
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.events)
+}
+
+// Close implements Buffer
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,328 @@
+package buffer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/bufpool"
+)
+
+// compactThreshold is the number of consumed events after which the
+// buffer file is rewritten
+const compactThreshold = 1024
+
+type record struct {
+	Type     string         `json:"type"`
+	Payload  []byte         `json:"payload"`
+	Metadata sigma.Metadata `json:"metadata,omitempty"`
+
+	// Generation is only set on the first record of compacted files
+	// which does not hold an event
+	Generation int `json:"generation,omitempty"`
+}
+
+// File is a Buffer persisted to the local file system. Events are appended
+// to a JSON-lines log file while the number of consumed events is tracked
+// in a separate head file so buffered events survive restarts.
+//
+// Each compaction of the log file increments its generation which is
+// stored in the log file itself and in the head file. A head recorded for
+// another generation is stale and ignored, so a crash between replacing
+// the log file and updating the head file does not skip events
+type File struct {
+	path string
+	max  int
+
+	mu         sync.Mutex
+	f          *os.File
+	events     []sigma.Event
+	head       int
+	generation int
+}
+
+// OpenFile opens (or creates) the file buffer at path and loads all events
+// that have not yet been consumed. If max is zero the buffer is unbounded
+func OpenFile(path string, max int) (*File, error) {
+	b := &File{
+		path: path,
+		max:  max,
+	}
+
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	b.f = f
+
+	return b, nil
+}
+
+// Push appends an event to the buffer and persists it
+func (b *File) Push(e sigma.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 && len(b.events) >= b.max {
+		return ErrFull
+	}
+
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
+	// Encode appends the newline separating records
+	if err := json.NewEncoder(buf).Encode(record{
+		Type:     e.Type(),
+		Payload:  e.Payload(),
+		Metadata: sigma.EventMetadata(e),
+	}); err != nil {
+		return err
+	}
+
+	if _, err := b.f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := b.f.Sync(); err != nil {
+		return err
+	}
+
+	b.events = append(b.events, e)
+	return nil
+}
+
+// Peek returns the oldest event
+func (b *File) Peek() (sigma.Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.events) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return b.events[0], nil
+}
+
+// Pop removes the oldest event
+func (b *File) Pop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.events) == 0 {
+		return ErrEmpty
+	}
+
+	b.events[0] = nil
+	b.events = b.events[1:]
+	b.head++
+
+	if b.head >= compactThreshold || len(b.events) == 0 {
+		return b.compact()
+	}
+
+	return b.writeHead()
+}
+
+// Len returns the number of buffered events
+func (b *File) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.events)
+}
+
+// Close closes the underlying buffer file
+func (b *File) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.f.Close()
+}
+
+func (b *File) headPath() string {
+	return b.path + ".head"
+}
+
+// writeHead atomically replaces the head file with the current head and
+// generation
+func (b *File) writeHead() error {
+	tmp := b.headPath() + ".tmp"
+
+	blob := fmt.Sprintf("%d %d", b.generation, b.head)
+	if err := ioutil.WriteFile(tmp, []byte(blob), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, b.headPath())
+}
+
+// readHead returns the head and the generation it has been recorded for.
+// Head files written before generations were introduced belong to
+// generation zero
+func (b *File) readHead() (head, generation int, err error) {
+	blob, err := ioutil.ReadFile(b.headPath())
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(blob))
+	switch len(fields) {
+	case 1:
+		_, err = fmt.Sscan(fields[0], &head)
+	case 2:
+		_, err = fmt.Sscan(fields[0]+" "+fields[1], &generation, &head)
+	default:
+		err = fmt.Errorf("invalid head file %s", b.headPath())
+	}
+
+	return head, generation, err
+}
+
+func (b *File) load() error {
+	head, generation, err := b.readHead()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rd := bufio.NewReader(f)
+
+	var (
+		records []record
+
+		// size is the offset of the end of the last complete record
+		size int64
+	)
+
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			break
+		}
+		size += int64(len(line))
+
+		if len(records) == 0 && r.Generation > 0 && b.generation == 0 {
+			b.generation = r.Generation
+			continue
+		}
+
+		records = append(records, r)
+	}
+
+	// a partially written record at the end of the file is the result
+	// of a crash during Push. It is cut off so events pushed after the
+	// crash are not appended to it
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > size {
+		if err := os.Truncate(b.path, size); err != nil {
+			return err
+		}
+	}
+
+	// the head belongs to the previous generation if the process
+	// crashed before the head file was updated after compacting
+	if generation == b.generation {
+		b.head = head
+	}
+
+	for i, r := range records {
+		if i < b.head {
+			continue
+		}
+
+		b.events = append(b.events, sigma.NewEventWithMetadata(r.Type, r.Payload, r.Metadata))
+	}
+
+	return nil
+}
+
+// compact rewrites the buffer file so it only contains events that have
+// not been consumed. It must be called with b.mu held
+func (b *File) compact() error {
+	tmp := b.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	if err := enc.Encode(record{Generation: b.generation + 1}); err != nil {
+		f.Close()
+		return err
+	}
+
+	for _, e := range b.events {
+		if err := enc.Encode(record{
+			Type:     e.Type(),
+			Payload:  e.Payload(),
+			Metadata: sigma.EventMetadata(e),
+		}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+
+	// once renamed, the stale head is ignored as it belongs to the
+	// previous generation
+	if err := os.Rename(tmp, b.path); err != nil {
+		return err
+	}
+
+	b.generation++
+	b.head = 0
+
+	b.f.Close()
+	b.f, err = os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	return b.writeHead()
+}
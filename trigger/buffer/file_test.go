@@ -0,0 +1,172 @@
+package buffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestFile(t *testing.T, max int) (*File, string) {
+	dir, err := ioutil.TempDir("", "sigma-buffer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "events")
+
+	b, err := OpenFile(path, max)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return b, path
+}
+
+func types(t *testing.T, b Buffer) []string {
+	var res []string
+	for b.Len() > 0 {
+		e, err := b.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, e.Type())
+
+		if err := b.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res
+}
+
+func TestFile(t *testing.T) {
+	assert := assert.New(t)
+
+	b, path := openTestFile(t, 3)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, typ := range []string{"a", "b", "c"} {
+		assert.NoError(b.Push(sigma.NewEventWithMetadata(typ, []byte(typ), sigma.Metadata{"k": typ})))
+	}
+	assert.Equal(ErrFull, b.Push(sigma.NewSimpleEvent("d", nil)))
+
+	assert.NoError(b.Pop())
+	assert.NoError(b.Close())
+
+	// consumed events are not loaded again
+	b, err := OpenFile(path, 3)
+	assert.NoError(err)
+	assert.Equal(2, b.Len())
+
+	e, err := b.Peek()
+	assert.NoError(err)
+	assert.Equal("b", e.Type())
+	assert.Equal("b", sigma.EventMetadata(e)["k"])
+
+	assert.Equal([]string{"b", "c"}, types(t, b))
+	_, err = b.Peek()
+	assert.Equal(ErrEmpty, err)
+	assert.Equal(ErrEmpty, b.Pop())
+	assert.NoError(b.Close())
+
+	b, err = OpenFile(path, 3)
+	assert.NoError(err)
+	assert.Equal(0, b.Len())
+	assert.NoError(b.Close())
+}
+
+func TestFile_CompactCrash(t *testing.T) {
+	assert := assert.New(t)
+
+	b, path := openTestFile(t, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, typ := range []string{"a", "b", "c"} {
+		assert.NoError(b.Push(sigma.NewSimpleEvent(typ, nil)))
+	}
+	assert.NoError(b.Pop())
+
+	stale, err := ioutil.ReadFile(b.headPath())
+	assert.NoError(err)
+
+	// simulate a crash after the compacted file has been renamed but
+	// before the head file has been updated
+	b.mu.Lock()
+	assert.NoError(b.compact())
+	b.mu.Unlock()
+	assert.NoError(b.Close())
+	assert.NoError(ioutil.WriteFile(b.headPath(), stale, 0600))
+
+	b, err = OpenFile(path, 0)
+	assert.NoError(err)
+	assert.Equal([]string{"b", "c"}, types(t, b))
+	assert.NoError(b.Close())
+}
+
+func TestFile_LegacyHead(t *testing.T) {
+	assert := assert.New(t)
+
+	b, path := openTestFile(t, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, typ := range []string{"a", "b"} {
+		assert.NoError(b.Push(sigma.NewSimpleEvent(typ, nil)))
+	}
+	assert.NoError(b.Close())
+	assert.NoError(ioutil.WriteFile(b.headPath(), []byte("1"), 0600))
+
+	b, err := OpenFile(path, 0)
+	assert.NoError(err)
+	assert.Equal([]string{"b"}, types(t, b))
+	assert.NoError(b.Close())
+}
+
+func TestMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewMemory(2)
+	assert.NoError(m.Push(sigma.NewSimpleEvent("a", nil)))
+	assert.NoError(m.Push(sigma.NewSimpleEvent("b", nil)))
+	assert.Equal(ErrFull, m.Push(sigma.NewSimpleEvent("c", nil)))
+	assert.Equal([]string{"a", "b"}, types(t, m))
+}
+
+func TestFile_TornWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	b, path := openTestFile(t, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	assert.NoError(b.Push(sigma.NewSimpleEvent("a", nil)))
+	assert.NoError(b.Close())
+
+	// simulate a crash while writing the second record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte(`{"type":"b","pay`))
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	b, err = OpenFile(path, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(1, b.Len())
+
+	// events pushed after the crash survive the next restart
+	assert.NoError(b.Push(sigma.NewSimpleEvent("c", nil)))
+	assert.NoError(b.Close())
+
+	b, err = OpenFile(path, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"a", "c"}, types(t, b))
+	assert.NoError(b.Close())
+}
@@ -2,5 +2,7 @@ package builtin
 
 import (
 	// Import all built-in triggers
+	_ "github.com/homebot/sigma/trigger/builtin/batch"
+	_ "github.com/homebot/sigma/trigger/builtin/homeassistant"
 	_ "github.com/homebot/sigma/trigger/builtin/timer"
 )
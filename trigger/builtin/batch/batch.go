@@ -0,0 +1,265 @@
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/trigger"
+)
+
+// EventType is the type of batched events
+const EventType = "batch"
+
+// sourcePrefix is the prefix of options passed to the source trigger
+const sourcePrefix = "source."
+
+// DefaultMaxEvents is the maximum number of events per batch if the `max`
+// option is not set. It bounds batches that are only limited by `window`
+const DefaultMaxEvents = 1000
+
+var (
+	// ErrMissingSource is returned when the `source` configuration key
+	// is missing during Build()
+	ErrMissingSource = errors.New("missing `source` configuration key")
+
+	// ErrMissingLimit is returned if neither `window` nor `count` is
+	// configured
+	ErrMissingLimit = errors.New("`window` or `count` must be configured")
+
+	// ErrInvalidMax is returned if the `max` option is not positive
+	ErrInvalidMax = errors.New("`max` must be positive")
+)
+
+// Record is a single event of a batch
+type Record struct {
+	Type string `json:"type"`
+
+	// Payload holds the payload of the event. JSON payloads are embedded
+	// as is, other payloads are encoded as JSON strings
+	Payload json.RawMessage `json:"payload"`
+
+	// Metadata holds the invocation metadata of the event, if any
+	Metadata sigma.Metadata `json:"metadata,omitempty"`
+}
+
+// Payload is the payload of batched events
+type Payload struct {
+	// Start and End hold the time the first and last event of the batch
+	// have been received
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Events holds the events of the batch in order
+	Events []Record `json:"events"`
+}
+
+type result struct {
+	event sigma.Event
+	err   error
+	at    time.Time
+}
+
+// Batch is a trigger.Trigger that accumulates the events of a source
+// trigger and fires once per window or once count events have been
+// received, whichever happens first. Batches never hold more than max
+// events. The batch event carries the metadata of the batched event with
+// the most hops so chain depth limits still apply
+type Batch struct {
+	source trigger.Trigger
+	window time.Duration
+	count  int
+	max    int
+
+	events chan result
+	closed chan struct{}
+
+	// err is returned by the next call to Next after a batch has been
+	// flushed because the source failed
+	err error
+}
+
+// URN returns the URN for the batch trigger
+func (b *Batch) URN() string { return "batch:" + b.source.URN() }
+
+// Close closes the batch trigger and its source
+func (b *Batch) Close() error {
+	select {
+	case <-b.closed:
+		return errors.New("already closed")
+	default:
+		close(b.closed)
+	}
+
+	return b.source.Close()
+}
+
+// pump reads events from the source trigger until it fails
+func (b *Batch) pump() {
+	for {
+		evt, err := b.source.Next()
+
+		select {
+		case b.events <- result{evt, err, time.Now()}:
+		case <-b.closed:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Next blocks until a batch is complete and returns it as a single event
+func (b *Batch) Next() (sigma.Event, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	var (
+		batch   Payload
+		md      sigma.Metadata
+		timeout <-chan time.Time
+	)
+
+	for {
+		select {
+		case r := <-b.events:
+			if r.err != nil {
+				if len(batch.Events) == 0 {
+					return nil, r.err
+				}
+
+				b.err = r.err
+				return flush(batch, md)
+			}
+
+			rec := record(r.event)
+			if len(batch.Events) == 0 || rec.Metadata.Hops() > md.Hops() {
+				md = rec.Metadata
+			}
+
+			batch.Events = append(batch.Events, rec)
+			batch.End = r.at
+
+			if len(batch.Events) == 1 {
+				batch.Start = r.at
+
+				if b.window > 0 {
+					timer := time.NewTimer(b.window)
+					defer timer.Stop()
+					timeout = timer.C
+				}
+			}
+
+			if (b.count > 0 && len(batch.Events) >= b.count) || len(batch.Events) >= b.max {
+				return flush(batch, md)
+			}
+
+		case <-timeout:
+			return flush(batch, md)
+
+		case <-b.closed:
+			return nil, io.EOF
+		}
+	}
+}
+
+func record(e sigma.Event) Record {
+	payload := json.RawMessage(e.Payload())
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(e.Payload()))
+	}
+
+	return Record{
+		Type:     e.Type(),
+		Payload:  payload,
+		Metadata: sigma.EventMetadata(e),
+	}
+}
+
+func flush(batch Payload, md sigma.Metadata) (sigma.Event, error) {
+	blob, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	return sigma.NewEventWithMetadata(EventType, blob, md.Copy()), nil
+}
+
+// Factory is trigger.Factory for batch triggers
+type Factory struct{}
+
+// Build builds a new batch trigger and implements trigger.Factory. The
+// source trigger is configured using all options prefixed with "source.".
+// The `max` option limits the number of events per batch and defaults to
+// DefaultMaxEvents
+func (f Factory) Build(opts map[string]string) (trigger.Trigger, error) {
+	typ, ok := opts["source"]
+	if !ok {
+		return nil, ErrMissingSource
+	}
+
+	b := &Batch{
+		max:    DefaultMaxEvents,
+		events: make(chan result),
+		closed: make(chan struct{}),
+	}
+
+	if w, ok := opts["window"]; ok {
+		d, err := time.ParseDuration(w)
+		if err != nil {
+			return nil, err
+		}
+		b.window = d
+	}
+
+	if c, ok := opts["count"]; ok {
+		n, err := strconv.Atoi(c)
+		if err != nil {
+			return nil, err
+		}
+		b.count = n
+	}
+
+	if m, ok := opts["max"]; ok {
+		n, err := strconv.Atoi(m)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, ErrInvalidMax
+		}
+		b.max = n
+	}
+
+	if b.window <= 0 && b.count <= 0 {
+		return nil, ErrMissingLimit
+	}
+
+	sourceOpts := make(map[string]string)
+	for k, v := range opts {
+		if strings.HasPrefix(k, sourcePrefix) {
+			sourceOpts[strings.TrimPrefix(k, sourcePrefix)] = v
+		}
+	}
+
+	source, err := trigger.Build(typ, sourceOpts)
+	if err != nil {
+		return nil, err
+	}
+	b.source = source
+
+	go b.pump()
+
+	return b, nil
+}
+
+func init() {
+	trigger.Register("batch", &Factory{})
+}
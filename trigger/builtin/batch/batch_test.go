@@ -0,0 +1,137 @@
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+// source is a trigger.Trigger returning the events sent to it
+type source chan sigma.Event
+
+func (s source) URN() string  { return "test" }
+func (s source) Close() error { return nil }
+
+func (s source) Next() (sigma.Event, error) {
+	evt, ok := <-s
+	if !ok {
+		return nil, errors.New("closed")
+	}
+	return evt, nil
+}
+
+var sources = make(chan source, 1)
+
+func init() {
+	trigger.Register("batch-test", trigger.FactoryFunc(func(map[string]string) (trigger.Trigger, error) {
+		return <-sources, nil
+	}))
+}
+
+func build(t *testing.T, opts map[string]string) (*Batch, source) {
+	src := make(source)
+	sources <- src
+
+	opts["source"] = "batch-test"
+	tr, err := Factory{}.Build(opts)
+	if err != nil {
+		<-sources
+		t.Fatal(err)
+	}
+
+	return tr.(*Batch), src
+}
+
+func decode(t *testing.T, evt sigma.Event) Payload {
+	var p Payload
+	if err := json.Unmarshal(evt.Payload(), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFactory(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, opts := range []map[string]string{
+		{"window": "1s"},
+		{"source": "batch-test"},
+		{"source": "batch-test", "window": "invalid"},
+		{"source": "batch-test", "count": "invalid"},
+		{"source": "batch-test", "count": "1", "max": "0"},
+	} {
+		_, err := Factory{}.Build(opts)
+		assert.Error(err)
+	}
+}
+
+func TestBatch_Count(t *testing.T) {
+	assert := assert.New(t)
+
+	b, src := build(t, map[string]string{"count": "2"})
+
+	go func() {
+		src <- sigma.NewEventWithMetadata("a", []byte(`{"n":1}`), sigma.Metadata{sigma.MetadataHops: "1"})
+		src <- sigma.NewEventWithMetadata("b", []byte("text"), sigma.Metadata{sigma.MetadataHops: "3"})
+	}()
+
+	evt, err := b.Next()
+	assert.NoError(err)
+	assert.Equal(EventType, evt.Type())
+
+	// the batch carries the metadata of the longest invocation chain
+	assert.Equal(3, sigma.EventMetadata(evt).Hops())
+
+	p := decode(t, evt)
+	if assert.Len(p.Events, 2) {
+		assert.Equal(json.RawMessage(`{"n":1}`), p.Events[0].Payload)
+		assert.Equal(json.RawMessage(`"text"`), p.Events[1].Payload)
+		assert.Equal("1", p.Events[0].Metadata[sigma.MetadataHops])
+	}
+
+	assert.NoError(b.Close())
+	_, err = b.Next()
+	assert.Equal(io.EOF, err)
+}
+
+func TestBatch_Window(t *testing.T) {
+	assert := assert.New(t)
+
+	b, src := build(t, map[string]string{"window": "50ms", "max": "3"})
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			src <- sigma.NewSimpleEvent("a", nil)
+		}
+	}()
+
+	// window-only batches are limited by max
+	evt, err := b.Next()
+	assert.NoError(err)
+	assert.Len(decode(t, evt).Events, 3)
+
+	start := time.Now()
+	evt, err = b.Next()
+	assert.NoError(err)
+	assert.Len(decode(t, evt).Events, 1)
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+
+	// pending batches are flushed if the source fails
+	go func() {
+		src <- sigma.NewSimpleEvent("a", nil)
+		close(src)
+	}()
+
+	evt, err = b.Next()
+	assert.NoError(err)
+	assert.Len(decode(t, evt).Events, 1)
+
+	_, err = b.Next()
+	assert.Error(err)
+}
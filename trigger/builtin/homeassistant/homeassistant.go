@@ -0,0 +1,441 @@
+// Package homeassistant bridges sigma and Home Assistant. The trigger
+// subscribes to events of the Home Assistant event bus using the WebSocket
+// API and fires for each of them. Trigger rules map events to functions:
+//
+//	triggers:
+//	- type: homeassistant
+//	  options:
+//	    url: http://localhost:8123
+//	    token: <long-lived access token>
+//	    entities: binary_sensor.door,light.hall
+//	    services: light,notify
+//	  rules:
+//	  - when: jsonpath(payload, "$.entity_id") == "binary_sensor.door"
+//	    functions: [door-opened]
+//
+// If the services option is set, results of the function owning the
+// trigger can call Home Assistant services. A result calls a service if
+// it is a JSON object with a service key, or a list of such objects:
+//
+//	{"service": "light.turn_on", "data": {"entity_id": "light.hall"}}
+//
+// Only services of the listed domains may be called, "*" allows all
+package homeassistant
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homebot/sigma"
+	"github.com/homebot/sigma/trigger"
+	"golang.org/x/net/websocket"
+)
+
+// EventPrefix is prepended to the Home Assistant event type to build the
+// type of trigger events
+const EventPrefix = "homeassistant."
+
+// DefaultEventType is the Home Assistant event type subscribed to if the
+// `event` option is not set
+const DefaultEventType = "state_changed"
+
+// maxBackoff is the maximum time between two connection attempts
+const maxBackoff = time.Minute
+
+// validName matches valid service domains and names. It prevents results
+// from escaping the service path
+var validName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var (
+	// ErrMissingURL is returned when the `url` configuration key is
+	// missing during Build()
+	ErrMissingURL = errors.New("missing `url` configuration key")
+
+	// ErrMissingToken is returned when the `token` configuration key is
+	// missing during Build()
+	ErrMissingToken = errors.New("missing `token` configuration key")
+
+	// ErrServiceNotAllowed is returned by Respond if a result calls a
+	// service whose domain is not allowed by the `services` option
+	ErrServiceNotAllowed = errors.New("service not allowed")
+)
+
+// message is a message of the Home Assistant WebSocket API
+type message struct {
+	ID          int    `json:"id,omitempty"`
+	Type        string `json:"type"`
+	AccessToken string `json:"access_token,omitempty"`
+	EventType   string `json:"event_type,omitempty"`
+	Success     *bool  `json:"success,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Event       *struct {
+		EventType string          `json:"event_type"`
+		Data      json.RawMessage `json:"data"`
+	} `json:"event,omitempty"`
+}
+
+// Call is a Home Assistant service call returned by a function
+type Call struct {
+	// Service holds the service to call in the form "domain.service"
+	Service string `json:"service"`
+
+	// Data holds the service data
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Bridge is a trigger.Trigger firing for Home Assistant events and a
+// trigger.Responder calling Home Assistant services
+type Bridge struct {
+	base      *url.URL
+	token     string
+	eventType string
+	entities  map[string]bool
+	services  map[string]bool
+	client    *http.Client
+
+	events chan sigma.Event
+	closed chan struct{}
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// URN returns the URN for the bridge
+func (b *Bridge) URN() string { return "homeassistant:" + b.eventType }
+
+// Close closes the bridge and its connection to Home Assistant
+func (b *Bridge) Close() error {
+	select {
+	case <-b.closed:
+		return errors.New("already closed")
+	default:
+		close(b.closed)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn != nil {
+		return b.conn.Close()
+	}
+	return nil
+}
+
+// Next blocks until the next Home Assistant event is received
+func (b *Bridge) Next() (sigma.Event, error) {
+	select {
+	case evt := <-b.events:
+		return evt, nil
+	case <-b.closed:
+		return nil, io.EOF
+	}
+}
+
+// Respond calls the Home Assistant services requested by result.
+// Results that are not service calls are ignored
+func (b *Bridge) Respond(_ sigma.Event, result []byte) error {
+	if len(b.services) == 0 {
+		return nil
+	}
+
+	calls, ok := parseCalls(result)
+	if !ok {
+		return nil
+	}
+
+	for _, c := range calls {
+		if err := b.call(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseCalls parses the service calls of a function result
+func parseCalls(result []byte) ([]Call, bool) {
+	result = bytes.TrimSpace(result)
+	if len(result) == 0 {
+		return nil, false
+	}
+
+	var calls []Call
+	if result[0] == '[' {
+		if err := json.Unmarshal(result, &calls); err != nil {
+			return nil, false
+		}
+	} else {
+		var c Call
+		if err := json.Unmarshal(result, &c); err != nil {
+			return nil, false
+		}
+		calls = append(calls, c)
+	}
+
+	for _, c := range calls {
+		if c.Service == "" {
+			return nil, false
+		}
+	}
+
+	return calls, true
+}
+
+func (b *Bridge) call(c Call) error {
+	parts := strings.SplitN(c.Service, ".", 2)
+	if len(parts) != 2 || !validName.MatchString(parts[0]) || !validName.MatchString(parts[1]) {
+		return fmt.Errorf("invalid service %q", c.Service)
+	}
+
+	if !b.services["*"] && !b.services[parts[0]] {
+		return fmt.Errorf("%s: %s", c.Service, ErrServiceNotAllowed)
+	}
+
+	data := []byte(c.Data)
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	u := *b.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/services/" + parts[0] + "/" + parts[1]
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s: %s", c.Service, res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// run keeps the bridge subscribed to Home Assistant until it is closed.
+// Lost connections are re-established with an exponential backoff
+func (b *Bridge) run() {
+	backoff := time.Second
+
+	for {
+		subscribed, _ := b.subscribe()
+		if subscribed {
+			backoff = time.Second
+		}
+
+		select {
+		case <-b.closed:
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// subscribe connects to Home Assistant and forwards events until the
+// connection fails. It returns true if the subscription succeeded
+func (b *Bridge) subscribe() (bool, error) {
+	ws := *b.base
+	switch ws.Scheme {
+	case "https":
+		ws.Scheme = "wss"
+	default:
+		ws.Scheme = "ws"
+	}
+	ws.Path = strings.TrimSuffix(ws.Path, "/") + "/api/websocket"
+
+	conn, err := websocket.Dial(ws.String(), "", b.base.String())
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	select {
+	case <-b.closed:
+		b.mu.Unlock()
+		conn.Close()
+		return false, io.EOF
+	default:
+		b.conn = conn
+	}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+		conn.Close()
+	}()
+
+	if err := b.authenticate(conn); err != nil {
+		return false, err
+	}
+
+	if err := websocket.JSON.Send(conn, message{
+		ID:        1,
+		Type:      "subscribe_events",
+		EventType: b.eventType,
+	}); err != nil {
+		return false, err
+	}
+
+	subscribed := false
+
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return subscribed, err
+		}
+
+		switch msg.Type {
+		case "result":
+			if msg.Success == nil || !*msg.Success {
+				return false, fmt.Errorf("failed to subscribe to %s events", b.eventType)
+			}
+			subscribed = true
+
+		case "event":
+			if msg.Event == nil || !b.matches(msg.Event.Data) {
+				continue
+			}
+
+			evt := sigma.NewSimpleEvent(EventPrefix+msg.Event.EventType, []byte(msg.Event.Data))
+
+			select {
+			case b.events <- evt:
+			case <-b.closed:
+				return subscribed, io.EOF
+			}
+		}
+	}
+}
+
+func (b *Bridge) authenticate(conn *websocket.Conn) error {
+	var msg message
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		return err
+	}
+
+	if msg.Type == "auth_required" {
+		if err := websocket.JSON.Send(conn, message{
+			Type:        "auth",
+			AccessToken: b.token,
+		}); err != nil {
+			return err
+		}
+
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return err
+		}
+	}
+
+	if msg.Type != "auth_ok" {
+		return fmt.Errorf("authentication failed: %s", msg.Message)
+	}
+
+	return nil
+}
+
+// matches returns true if the event data belongs to one of the configured
+// entities
+func (b *Bridge) matches(data json.RawMessage) bool {
+	if len(b.entities) == 0 {
+		return true
+	}
+
+	var d struct {
+		EntityID string `json:"entity_id"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return false
+	}
+
+	return b.entities[d.EntityID]
+}
+
+// Factory is trigger.Factory for Home Assistant bridges
+type Factory struct{}
+
+// Build builds a new Home Assistant bridge and implements
+// trigger.Factory. Supported options are:
+//
+//	url       base URL of Home Assistant, e.g. http://localhost:8123
+//	token     long-lived access token
+//	event     event type to subscribe to, defaults to state_changed
+//	entities  comma separated entity IDs to fire for, defaults to all
+//	services  comma separated service domains results may call
+func (f Factory) Build(opts map[string]string) (trigger.Trigger, error) {
+	u, ok := opts["url"]
+	if !ok || u == "" {
+		return nil, ErrMissingURL
+	}
+
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme %q", base.Scheme)
+	}
+
+	token, ok := opts["token"]
+	if !ok || token == "" {
+		return nil, ErrMissingToken
+	}
+
+	eventType := opts["event"]
+	if eventType == "" {
+		eventType = DefaultEventType
+	}
+
+	b := &Bridge{
+		base:      base,
+		token:     token,
+		eventType: eventType,
+		entities:  splitSet(opts["entities"]),
+		services:  splitSet(opts["services"]),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		events:    make(chan sigma.Event),
+		closed:    make(chan struct{}),
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+func splitSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+func init() {
+	trigger.Register("homeassistant", &Factory{})
+}
@@ -0,0 +1,114 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+type fakeHomeAssistant struct {
+	calls chan string
+}
+
+func (f *fakeHomeAssistant) serveWebSocket(conn *websocket.Conn) {
+	websocket.JSON.Send(conn, map[string]string{"type": "auth_required"})
+
+	var auth message
+	websocket.JSON.Receive(conn, &auth)
+	if auth.AccessToken != "secret" {
+		websocket.JSON.Send(conn, map[string]string{"type": "auth_invalid", "message": "invalid token"})
+		return
+	}
+	websocket.JSON.Send(conn, map[string]string{"type": "auth_ok"})
+
+	var sub message
+	websocket.JSON.Receive(conn, &sub)
+	websocket.JSON.Send(conn, map[string]interface{}{"id": sub.ID, "type": "result", "success": true})
+
+	for _, entity := range []string{"light.kitchen", "binary_sensor.door"} {
+		websocket.JSON.Send(conn, map[string]interface{}{
+			"id":   sub.ID,
+			"type": "event",
+			"event": map[string]interface{}{
+				"event_type": sub.EventType,
+				"data":       map[string]string{"entity_id": entity},
+			},
+		})
+	}
+
+	// keep the connection open until the client closes it
+	var msg message
+	websocket.JSON.Receive(conn, &msg)
+}
+
+func (f *fakeHomeAssistant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/websocket" {
+		websocket.Handler(f.serveWebSocket).ServeHTTP(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	f.calls <- r.URL.Path + " " + string(body)
+}
+
+func TestBridge(t *testing.T) {
+	assert := assert.New(t)
+
+	ha := &fakeHomeAssistant{calls: make(chan string, 10)}
+	srv := httptest.NewServer(ha)
+	defer srv.Close()
+
+	_, err := Factory{}.Build(map[string]string{"token": "secret"})
+	assert.Equal(ErrMissingURL, err)
+
+	_, err = Factory{}.Build(map[string]string{"url": srv.URL})
+	assert.Equal(ErrMissingToken, err)
+
+	tr, err := Factory{}.Build(map[string]string{
+		"url":      srv.URL,
+		"token":    "secret",
+		"entities": "binary_sensor.door",
+		"services": "light",
+	})
+	assert.NoError(err)
+	defer tr.Close()
+
+	evt, err := tr.Next()
+	assert.NoError(err)
+	assert.Equal("homeassistant.state_changed", evt.Type())
+
+	var data map[string]string
+	assert.NoError(json.Unmarshal(evt.Payload(), &data))
+	assert.Equal("binary_sensor.door", data["entity_id"])
+
+	b := tr.(*Bridge)
+
+	assert.NoError(b.Respond(evt, []byte(`{"service": "light.turn_on", "data": {"entity_id": "light.hall"}}`)))
+	assert.Equal(`/api/services/light/turn_on {"entity_id": "light.hall"}`, <-ha.calls)
+
+	assert.NoError(b.Respond(evt, []byte(`[{"service": "light.turn_off"}]`)))
+	assert.Equal(`/api/services/light/turn_off {}`, <-ha.calls)
+
+	// results that are not service calls are ignored
+	assert.NoError(b.Respond(evt, []byte(`ok`)))
+	assert.NoError(b.Respond(evt, []byte(`{"state": "on"}`)))
+
+	err = b.Respond(evt, []byte(`{"service": "lock.unlock"}`))
+	assert.Error(err)
+
+	// service domains and names must not alter the request path
+	for _, svc := range []string{"light.turn_on/../../states", "light.turn_on?x=1", "light../config", "Light.turn_on", "light."} {
+		assert.Error(b.Respond(evt, []byte(`{"service": "`+svc+`"}`)), svc)
+	}
+	assert.Len(ha.calls, 0)
+}
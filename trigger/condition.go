@@ -69,6 +69,21 @@ func Evaluate(condtion string, event sigma.Event, values utils.ValueMap) (bool,
 		return true, nil
 	}
 
+	res, err := evaluate(condtion, event, values)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := res.(bool)
+	if ok {
+		return b, nil
+	}
+
+	return false, fmt.Errorf("unsupported return value: %#v (%s)", res, reflect.TypeOf(res))
+}
+
+// evaluate evaluates the expression on event and returns the result
+func evaluate(expression string, event sigma.Event, values utils.ValueMap) (interface{}, error) {
 	functions := map[string]govaluate.ExpressionFunction{
 		"jsonpath": func(args ...interface{}) (interface{}, error) {
 			if len(args) != 2 {
@@ -113,9 +128,9 @@ func Evaluate(condtion string, event sigma.Event, values utils.ValueMap) (bool,
 		"weekday": buildTimeFunc("weekday"),
 	}
 
-	expr, err := govaluate.NewEvaluableExpressionWithFunctions(condtion, functions)
+	expr, err := govaluate.NewEvaluableExpressionWithFunctions(expression, functions)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	parameters := map[string]interface{}{
@@ -127,15 +142,5 @@ func Evaluate(condtion string, event sigma.Event, values utils.ValueMap) (bool,
 		parameters[k] = v
 	}
 
-	res, err := expr.Evaluate(parameters)
-	if err != nil {
-		return false, err
-	}
-
-	b, ok := res.(bool)
-	if ok {
-		return b, nil
-	}
-
-	return false, fmt.Errorf("unsupported return value: %#v (%s)", res, reflect.TypeOf(res))
+	return expr.Evaluate(parameters)
 }
@@ -0,0 +1,70 @@
+package trigger
+
+import (
+	"encoding/json"
+
+	"github.com/homebot/core/utils"
+	"github.com/homebot/sigma"
+)
+
+// Route is the result of a matching rule
+type Route struct {
+	// Functions holds the target functions. Empty means the function
+	// owning the trigger
+	Functions []string
+
+	// Event is the (transformed) event to dispatch
+	Event sigma.Event
+}
+
+// Apply evaluates rules in order on event and returns the routes of all
+// matching rules. Evaluation stops after the first matching rule with
+// Stop set
+func Apply(rules []sigma.RuleSpec, event sigma.Event, values utils.ValueMap) ([]Route, error) {
+	var routes []Route
+
+	for _, rule := range rules {
+		ok, err := Evaluate(rule.When, event, values)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		evt := event
+		if rule.Transform != "" {
+			payload, err := transform(rule.Transform, event, values)
+			if err != nil {
+				return nil, err
+			}
+
+			evt = sigma.NewEventWithMetadata(event.Type(), payload, sigma.EventMetadata(event))
+		}
+
+		routes = append(routes, Route{
+			Functions: rule.Functions,
+			Event:     evt,
+		})
+
+		if rule.Stop {
+			break
+		}
+	}
+
+	return routes, nil
+}
+
+func transform(expression string, event sigma.Event, values utils.ValueMap) ([]byte, error) {
+	res, err := evaluate(expression, event, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := res.(string); ok {
+		return []byte(s), nil
+	}
+
+	return json.Marshal(res)
+}
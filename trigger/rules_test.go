@@ -0,0 +1,76 @@
+package trigger
+
+import (
+	"testing"
+
+	"github.com/homebot/core/utils"
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	type route struct {
+		functions []string
+		payload   string
+	}
+
+	cases := []struct {
+		name     string
+		rules    []sigma.RuleSpec
+		expected []route
+		err      bool
+	}{
+		{"no rules", nil, nil, false},
+		{"empty condition", []sigma.RuleSpec{{}}, []route{{nil, `{"temp": 21}`}}, false},
+		{"not matching", []sigma.RuleSpec{{When: "type == 'other'"}}, nil, false},
+		{"routing", []sigma.RuleSpec{
+			{When: "type == 'sensor'", Functions: []string{"a", "b"}},
+			{When: "type == 'other'", Functions: []string{"c"}},
+			{When: "contains(payload, 'temp')", Functions: []string{"d"}},
+		}, []route{
+			{[]string{"a", "b"}, `{"temp": 21}`},
+			{[]string{"d"}, `{"temp": 21}`},
+		}, false},
+		{"values", []sigma.RuleSpec{{When: "room == 'kitchen'", Functions: []string{"a"}}}, []route{{[]string{"a"}, `{"temp": 21}`}}, false},
+		{"transform string", []sigma.RuleSpec{{Transform: "'room: ' + room"}}, []route{{nil, "room: kitchen"}}, false},
+		{"transform value", []sigma.RuleSpec{{Transform: "target * 2"}}, []route{{nil, "42"}}, false},
+		{"stop", []sigma.RuleSpec{
+			{When: "type == 'other'", Functions: []string{"a"}, Stop: true},
+			{Functions: []string{"b"}, Stop: true},
+			{Functions: []string{"c"}},
+		}, []route{{[]string{"b"}, `{"temp": 21}`}}, false},
+		{"invalid condition", []sigma.RuleSpec{{When: "type =="}}, nil, true},
+		{"non-bool condition", []sigma.RuleSpec{{When: "room"}}, nil, true},
+		{"invalid transform", []sigma.RuleSpec{{Transform: "unknown(payload)"}}, nil, true},
+	}
+
+	values := utils.ValueMap{"room": "kitchen", "target": 21.0}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			event := sigma.NewEventWithMetadata("sensor", []byte(`{"temp": 21}`), sigma.Metadata{"source": "mqtt"})
+
+			routes, err := Apply(c.rules, event, values)
+			if c.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+
+			if !assert.Len(routes, len(c.expected)) {
+				return
+			}
+
+			for i, r := range routes {
+				assert.Equal(c.expected[i].functions, r.Functions)
+				assert.Equal(c.expected[i].payload, string(r.Event.Payload()))
+
+				// transformed events keep the type and metadata
+				assert.Equal("sensor", r.Event.Type())
+				assert.Equal(sigma.Metadata{"source": "mqtt"}, sigma.EventMetadata(r.Event))
+			}
+		})
+	}
+}
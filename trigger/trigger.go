@@ -14,3 +14,13 @@ type Trigger interface {
 	// Any calles blocked in Next() should return an error
 	Close() error
 }
+
+// Responder is implemented by triggers that handle the results of the
+// events they fired, e.g. to call back into the system that emitted the
+// event. Results of events routed to other functions are not passed to
+// the responder
+type Responder interface {
+	// Respond is called with the result of a successfully dispatched
+	// event
+	Respond(event sigma.Event, result []byte) error
+}
@@ -0,0 +1,226 @@
+// Package urn parses, validates and generates the URNs identifying
+// functions and their node instances. URNs have the form
+//
+//	urn:sigma:<namespace>:<function>[:<version>[:<instance>]]
+//
+// Function URNs omit the version and instance components while node URNs
+// carry all of them. Validation of the components and generation of
+// instance IDs is delegated to a pluggable Scheme
+package urn
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Prefix is the prefix of all sigma URNs
+const Prefix = "urn:sigma:"
+
+// DefaultNamespace is the namespace of functions whose ID does not carry a
+// namespace
+const DefaultNamespace = "default"
+
+var (
+	// ErrMalformed is returned if a string is not a sigma URN
+	ErrMalformed = errors.New("urn: malformed URN")
+
+	// ErrNotInstance is returned if a node URN is expected but the URN
+	// does not have an instance component
+	ErrNotInstance = errors.New("urn: not an instance URN")
+)
+
+// URN identifies a function or one of its node instances
+type URN struct {
+	Namespace string
+	Function  string
+	Version   string
+	Instance  string
+}
+
+// String returns the string representation of u
+func (u URN) String() string {
+	parts := []string{u.Namespace, u.Function}
+
+	if u.Version != "" || u.Instance != "" {
+		parts = append(parts, u.Version)
+	}
+
+	if u.Instance != "" {
+		parts = append(parts, u.Instance)
+	}
+
+	return Prefix + strings.Join(parts, ":")
+}
+
+// IsInstance returns true if u identifies a node instance
+func (u URN) IsInstance() bool {
+	return u.Instance != ""
+}
+
+// FunctionURN returns the URN of the function u belongs to
+func (u URN) FunctionURN() URN {
+	return URN{
+		Namespace: u.Namespace,
+		Function:  u.Function,
+	}
+}
+
+// Scheme validates the components of URNs and generates instance IDs
+type Scheme interface {
+	// Validate returns an error if u is invalid
+	Validate(u URN) error
+
+	// InstanceID returns a new, unique instance ID
+	InstanceID() string
+}
+
+var componentRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// DefaultScheme is the default Scheme. Components must start with a letter
+// or digit followed by letters, digits, '.', '_', '/' or '-'. Instance IDs
+// are random UUIDs
+type DefaultScheme struct{}
+
+// Validate implements Scheme
+func (DefaultScheme) Validate(u URN) error {
+	components := []struct {
+		name     string
+		value    string
+		optional bool
+	}{
+		{"namespace", u.Namespace, false},
+		{"function", u.Function, false},
+		{"version", u.Version, !u.IsInstance()},
+		{"instance", u.Instance, true},
+	}
+
+	for _, c := range components {
+		if c.value == "" && c.optional {
+			continue
+		}
+
+		if !componentRegexp.MatchString(c.value) {
+			return fmt.Errorf("urn: invalid %s %q", c.name, c.value)
+		}
+	}
+
+	return nil
+}
+
+// InstanceID implements Scheme
+func (DefaultScheme) InstanceID() string {
+	return uuid.NewV4().String()
+}
+
+var (
+	mu     sync.RWMutex
+	scheme Scheme = DefaultScheme{}
+)
+
+// SetScheme replaces the scheme used to validate and generate URNs
+func SetScheme(s Scheme) {
+	if s == nil {
+		s = DefaultScheme{}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	scheme = s
+}
+
+func current() Scheme {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return scheme
+}
+
+// Validate validates u using the current scheme
+func Validate(u URN) error {
+	return current().Validate(u)
+}
+
+// Parse parses and validates a function or instance URN
+func Parse(s string) (URN, error) {
+	if !strings.HasPrefix(s, Prefix) {
+		return URN{}, ErrMalformed
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, Prefix), ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return URN{}, ErrMalformed
+	}
+
+	var u URN
+	for i, p := range parts {
+		switch i {
+		case 0:
+			u.Namespace = p
+		case 1:
+			u.Function = p
+		case 2:
+			u.Version = p
+		case 3:
+			u.Instance = p
+		}
+	}
+
+	if err := Validate(u); err != nil {
+		return URN{}, err
+	}
+
+	return u, nil
+}
+
+// ParseInstance parses and validates the URN of a node instance
+func ParseInstance(s string) (URN, error) {
+	u, err := Parse(s)
+	if err != nil {
+		return URN{}, err
+	}
+
+	if !u.IsInstance() {
+		return URN{}, ErrNotInstance
+	}
+
+	return u, nil
+}
+
+// ForFunction returns the URN of the function with the given ID. Function
+// IDs have the form "<namespace>/functions/<name>". IDs without namespace
+// belong to DefaultNamespace
+func ForFunction(functionID string) URN {
+	u := URN{
+		Namespace: DefaultNamespace,
+		Function:  functionID,
+	}
+
+	if idx := strings.Index(functionID, "/functions/"); idx >= 0 {
+		u.Namespace = functionID[:idx]
+		u.Function = functionID[idx+len("/functions/"):]
+	}
+
+	return u
+}
+
+// NewInstance generates a new node URN for the given version of the
+// function with the given ID
+func NewInstance(functionID, version string) (URN, error) {
+	s := current()
+
+	u := ForFunction(functionID)
+	u.Version = version
+	u.Instance = s.InstanceID()
+
+	if err := s.Validate(u); err != nil {
+		return URN{}, err
+	}
+
+	return u, nil
+}
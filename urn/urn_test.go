@@ -0,0 +1,75 @@
+package urn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := Parse("urn:sigma:acme:echo:3:abc")
+	assert.NoError(err)
+	assert.Equal(URN{"acme", "echo", "3", "abc"}, u)
+	assert.True(u.IsInstance())
+	assert.Equal("urn:sigma:acme:echo:3:abc", u.String())
+	assert.Equal("urn:sigma:acme:echo", u.FunctionURN().String())
+
+	u, err = Parse("urn:sigma:acme:echo")
+	assert.NoError(err)
+	assert.False(u.IsInstance())
+
+	_, err = ParseInstance("urn:sigma:acme:echo")
+	assert.Equal(ErrNotInstance, err)
+
+	for _, s := range []string{
+		"",
+		"echo",
+		"urn:other:acme:echo",
+		"urn:sigma:acme",
+		"urn:sigma:acme:echo:1:abc:def",
+		"urn:sigma::echo",
+		"urn:sigma:acme:echo::abc",
+		"urn:sigma:acme:ec ho:1:abc",
+	} {
+		_, err := Parse(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestNewInstance(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := NewInstance("acme/functions/echo", "1")
+	assert.NoError(err)
+	assert.Equal(URN{Namespace: "acme", Function: "echo"}, a.FunctionURN())
+
+	b, err := NewInstance("acme/functions/echo", "1")
+	assert.NoError(err)
+	assert.NotEqual(a, b)
+
+	parsed, err := ParseInstance(a.String())
+	assert.NoError(err)
+	assert.Equal(a, parsed)
+
+	assert.Equal(URN{Namespace: DefaultNamespace, Function: "echo"}, ForFunction("echo"))
+
+	_, err = NewInstance("acme/functions/ec:ho", "1")
+	assert.Error(err)
+}
+
+type fixedScheme struct {
+	DefaultScheme
+}
+
+func (fixedScheme) InstanceID() string { return "fixed" }
+
+func TestSetScheme(t *testing.T) {
+	SetScheme(fixedScheme{})
+	defer SetScheme(nil)
+
+	u, err := NewInstance("echo", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "urn:sigma:default:echo:1:fixed", u.String())
+}
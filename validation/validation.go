@@ -0,0 +1,114 @@
+// Package validation validates function input and output payloads against
+// the JSON schemas declared in a function spec.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/homebot/sigma"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Error is returned if a payload does not match its schema
+type Error struct {
+	// Output is true if the result of the function was invalid
+	Output bool
+
+	// Violations holds the schema violations
+	Violations []string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	kind := "input"
+	if e.Output {
+		kind = "output"
+	}
+
+	return fmt.Sprintf("invalid %s: %s", kind, strings.Join(e.Violations, "; "))
+}
+
+// Validator validates payloads of a function
+type Validator struct {
+	input   *gojsonschema.Schema
+	output  *gojsonschema.Schema
+	enforce bool
+}
+
+// New creates a new validator for the given schema. A nil schema results
+// in a nil validator
+func New(s *sigma.IOSchema) (*Validator, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	v := &Validator{}
+
+	switch s.Mode {
+	case "", sigma.SchemaEnforce:
+		v.enforce = true
+	case sigma.SchemaWarn:
+	default:
+		return nil, fmt.Errorf("unknown schema mode %q", s.Mode)
+	}
+
+	var err error
+	if s.Input != "" {
+		if v.input, err = gojsonschema.NewSchema(gojsonschema.NewStringLoader(s.Input)); err != nil {
+			return nil, fmt.Errorf("input schema: %s", err)
+		}
+	}
+
+	if s.Output != "" {
+		if v.output, err = gojsonschema.NewSchema(gojsonschema.NewStringLoader(s.Output)); err != nil {
+			return nil, fmt.Errorf("output schema: %s", err)
+		}
+	}
+
+	return v, nil
+}
+
+// Enforce returns true if invalid payloads must be rejected. If false,
+// violations should only be reported
+func (v *Validator) Enforce() bool {
+	return v != nil && v.enforce
+}
+
+// Input validates an event payload
+func (v *Validator) Input(payload []byte) error {
+	if v == nil {
+		return nil
+	}
+	return validate(v.input, payload, false)
+}
+
+// Output validates a function result
+func (v *Validator) Output(result []byte) error {
+	if v == nil {
+		return nil
+	}
+	return validate(v.output, result, true)
+}
+
+func validate(schema *gojsonschema.Schema, payload []byte, output bool) error {
+	if schema == nil {
+		return nil
+	}
+
+	res, err := schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		// the payload is not valid JSON
+		return &Error{Output: output, Violations: []string{err.Error()}}
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	e := &Error{Output: output}
+	for _, r := range res.Errors() {
+		e.Violations = append(e.Violations, r.String())
+	}
+	return e
+}
@@ -0,0 +1,112 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/homebot/sigma"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	inputSchema  = `{"type": "object", "required": ["temp"], "properties": {"temp": {"type": "number"}}}`
+	outputSchema = `{"type": "string"}`
+)
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := New(nil)
+	assert.NoError(err)
+	assert.Nil(v)
+
+	// nil validators accept everything
+	assert.False(v.Enforce())
+	assert.NoError(v.Input([]byte("not json")))
+	assert.NoError(v.Output([]byte("not json")))
+
+	for _, s := range []*sigma.IOSchema{
+		{Input: `{"type": `},
+		{Output: `{"type": "unknown"}`},
+		{Input: inputSchema, Mode: "strict"},
+	} {
+		_, err := New(s)
+		assert.Error(err, "%+v", s)
+	}
+}
+
+func TestMode(t *testing.T) {
+	assert := assert.New(t)
+
+	for mode, enforce := range map[string]bool{
+		"":                  true,
+		sigma.SchemaEnforce: true,
+		sigma.SchemaWarn:    false,
+	} {
+		v, err := New(&sigma.IOSchema{Input: inputSchema, Mode: mode})
+		if !assert.NoError(err) {
+			continue
+		}
+		assert.Equal(enforce, v.Enforce(), mode)
+
+		// violations are reported in both modes
+		assert.Error(v.Input([]byte(`{}`)), mode)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v, err := New(&sigma.IOSchema{Input: inputSchema, Output: outputSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		output  bool
+		payload string
+		valid   bool
+	}{
+		{"valid input", false, `{"temp": 21}`, true},
+		{"missing property", false, `{}`, false},
+		{"wrong type", false, `{"temp": "warm"}`, false},
+		{"invalid input JSON", false, `{`, false},
+		{"valid output", true, `"ok"`, true},
+		{"invalid output", true, `{"temp": 21}`, false},
+		{"invalid output JSON", true, `ok`, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			validate := v.Input
+			if c.output {
+				validate = v.Output
+			}
+
+			err := validate([]byte(c.payload))
+			if c.valid {
+				assert.NoError(err)
+				return
+			}
+
+			e, ok := err.(*Error)
+			if !assert.True(ok, "%v", err) {
+				return
+			}
+			assert.Equal(c.output, e.Output)
+			assert.NotEmpty(e.Violations)
+
+			prefix := "invalid input: "
+			if c.output {
+				prefix = "invalid output: "
+			}
+			assert.Contains(e.Error(), prefix)
+		})
+	}
+
+	// payloads without a schema are not validated
+	v, err = New(&sigma.IOSchema{Output: outputSchema})
+	if assert.NoError(t, err) {
+		assert.NoError(t, v.Input([]byte("not json")))
+	}
+}